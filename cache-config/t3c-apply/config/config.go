@@ -106,6 +106,15 @@ type Cfg struct {
 	MaxMindLocation string
 	TsHome          string
 	TsConfigDir     string
+	// NoRollback is whether to not roll back the config files replaced by a run,
+	// if reloading or restarting ATS or the post-apply health check fails.
+	NoRollback bool
+	// HealthCheckURL is a local URL which must return a 200 after ATS is reloaded or restarted
+	// with changed config files. If empty, only that ATS is running is checked.
+	HealthCheckURL string
+	// HealthCheckTimeout is how long to wait for ATS to be running, and HealthCheckURL to return a 200,
+	// before failing the health check.
+	HealthCheckTimeout time.Duration
 }
 
 type UseGitFlag string
@@ -235,6 +244,9 @@ func GetCfg() (Cfg, error) {
 	defaultEnableH2 := getopt.BoolLong("default-client-enable-h2", '2', "Whether to enable HTTP/2 on Delivery Services by default, if they have no explicit Parameter. This is irrelevant if ATS records.config is not serving H2. If omitted, H2 is disabled.")
 	defaultClientTLSVersions := getopt.StringLong("default-client-tls-versions", 'V', "", "Comma-delimited list of default TLS versions for Delivery Services with no Parameter, e.g. --default-tls-versions='1.1,1.2,1.3'. If omitted, all versions are enabled.")
 	maxmindLocationPtr := getopt.StringLong("maxmind-location", 'M', "", "URL of a maxmind gzipped database file, to be installed into the trafficserver etc directory.")
+	noRollbackPtr := getopt.BoolLong("no-rollback", 'N', "Whether to not roll back changed config files if reloading or restarting ATS, or the health check after, fails. Default false.")
+	healthCheckURLPtr := getopt.StringLong("health-check-url", 'k', "", "Local URL which must return a 200 after ATS is reloaded or restarted with changed config files, e.g. http://127.0.0.1/_astats. If omitted, only that ATS is running is checked.")
+	healthCheckTimeoutPtr := getopt.IntLong("health-check-timeout", 'K', 60, "[seconds] wait up to [seconds] for ATS to be running and the health check URL to return a 200, default is 60")
 	verbosePtr := getopt.CounterLong("verbose", 'v', `Log verbosity. Logging is output to stderr. By default, errors are logged. To log warnings, pass '-v'. To log info, pass '-vv'. To omit error logging, see '-s'`)
 	silentPtr := getopt.BoolLong("silent", 's', `Silent. Errors are not logged, and the 'verbose' flag is ignored. If a fatal error occurs, the return code will be non-zero but no text will be output to stderr`)
 
@@ -296,6 +308,7 @@ func GetCfg() (Cfg, error) {
 	dnsLocalBind := *dnsLocalBindPtr
 	help := *helpPtr
 	maxmindLocation := *maxmindLocationPtr
+	healthCheckTimeout := time.Second * time.Duration(*healthCheckTimeoutPtr)
 
 	if help {
 		Usage()
@@ -364,6 +377,15 @@ func GetCfg() (Cfg, error) {
 		return Cfg{}, errors.New("Missing required argument --cache-host-name. " + usageStr)
 	}
 
+	if *healthCheckURLPtr != "" {
+		healthCheckURL, err := url.Parse(*healthCheckURLPtr)
+		if err != nil {
+			return Cfg{}, errors.New("parsing health check URL '" + *healthCheckURLPtr + "': " + err.Error())
+		} else if err = validateURL(healthCheckURL); err != nil {
+			return Cfg{}, errors.New("invalid health check URL '" + *healthCheckURLPtr + "': " + err.Error())
+		}
+	}
+
 	toURLParsed, err := url.Parse(toURL)
 	if err != nil {
 		return Cfg{}, errors.New("parsing Traffic Ops URL from " + urlSourceStr + " '" + toURL + "': " + err.Error())
@@ -406,6 +428,9 @@ func GetCfg() (Cfg, error) {
 		MaxMindLocation:             maxmindLocation,
 		TsHome:                      TSHome,
 		TsConfigDir:                 TSConfigDir,
+		NoRollback:                  *noRollbackPtr,
+		HealthCheckURL:              *healthCheckURLPtr,
+		HealthCheckTimeout:          healthCheckTimeout,
 	}
 
 	if err = log.InitCfg(cfg); err != nil {
@@ -479,6 +504,9 @@ func printConfig(cfg Cfg) {
 	log.Debugf("WaitForParents: %v\n", cfg.WaitForParents)
 	log.Debugf("YumOptions: %s\n", cfg.YumOptions)
 	log.Debugf("MaxmindLocation: %s\n", cfg.MaxMindLocation)
+	log.Debugf("NoRollback: %t\n", cfg.NoRollback)
+	log.Debugf("HealthCheckURL: %s\n", cfg.HealthCheckURL)
+	log.Debugf("HealthCheckTimeout: %d\n", cfg.HealthCheckTimeout)
 }
 
 func Usage() {
@@ -43,6 +43,7 @@ const (
 	ServicesError     = 138
 	SyncDSError       = 139
 	UserCheckError    = 140
+	RollbackError     = 141
 )
 
 func runSysctl(cfg config.Cfg) {
@@ -183,8 +184,14 @@ func main() {
 	// check for maxmind db updates
 	CheckMaxmindUpdate(cfg)
 
-	if err := trops.StartServices(&syncdsUpdate); err != nil {
+	if err := trops.StartServicesAndVerify(&syncdsUpdate); err != nil {
 		log.Errorln("failed to start services: " + err.Error())
+		if syncdsUpdate == torequest.UpdateTropsRolledBack {
+			if _, err := trops.UpdateTrafficOps(&syncdsUpdate); err != nil {
+				log.Errorf("failed to update Traffic Ops: %s\n", err.Error())
+			}
+			GitCommitAndExit(RollbackError, cfg)
+		}
 		GitCommitAndExit(ServicesError, cfg)
 	}
 
@@ -218,6 +225,9 @@ func main() {
 		log.Infoln("Traffic Ops has been updated.")
 	}
 
+	if syncdsUpdate == torequest.UpdateTropsRolledBack {
+		GitCommitAndExit(RollbackError, cfg)
+	}
 	GitCommitAndExit(Success, cfg)
 }
 
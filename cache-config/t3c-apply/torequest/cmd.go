@@ -193,6 +193,16 @@ func getUpdateStatus(cfg config.Cfg) (*tc.ServerUpdateStatus, error) {
 	return &status, nil
 }
 
+// getRolloutStatus gets the staged rollout status of the server from t3c-request.
+// It's a variable so tests can replace it without running t3c-request.
+var getRolloutStatus = func(cfg config.Cfg) (*t3cutil.RolloutStatus, error) {
+	status := t3cutil.RolloutStatus{}
+	if err := requestJSON(cfg, "rollout", &status); err != nil {
+		return nil, errors.New("requesting json: " + err.Error())
+	}
+	return &status, nil
+}
+
 func getSystemInfo(cfg config.Cfg) (map[string]interface{}, error) {
 	result := map[string]interface{}{}
 	if err := requestJSON(cfg, "system-info", &result); err != nil {
@@ -257,7 +267,8 @@ func sendUpdate(cfg config.Cfg, updateStatus bool, revalStatus bool) error {
 // Logs the difference.
 // If the file on disk doesn't exist, returns true and logs the entire file as a diff.
 func diff(cfg config.Cfg, newFile []byte, fileLocation string) (bool, error) {
-	stdOut, stdErr, code := t3cutil.DoInput(newFile, `t3c-diff`, `stdin`, fileLocation)
+	// the file on disk is first, so the diff is the change the new file makes
+	stdOut, stdErr, code := t3cutil.DoInput(newFile, `t3c-diff`, fileLocation, `stdin`)
 	if code > 1 {
 		return false, fmt.Errorf("t3c-diff returned error code %v stdout '%v' stderr '%v'", code, string(stdOut), string(stdErr))
 	}
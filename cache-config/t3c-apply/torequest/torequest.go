@@ -46,6 +46,7 @@ const (
 	UpdateTropsNeeded     UpdateStatus = 1
 	UpdateTropsSuccessful UpdateStatus = 2
 	UpdateTropsFailed     UpdateStatus = 3
+	UpdateTropsRolledBack UpdateStatus = 4
 )
 
 type Package struct {
@@ -61,6 +62,8 @@ type TrafficOpsReq struct {
 	installedPkgs map[string]struct{} // map of packages which were installed by us.
 	pluginPkgs    map[string]struct{} // map of packages
 	changedFiles  []string            // list of config files which were changed
+	appliedFiles  []*ConfigFile       // config files which were replaced, in order, to roll back if necessary
+	gitBackup     string              // git commit of the ATS config directory before config files were replaced, or empty if not using git
 
 	configFiles          map[string]*ConfigFile
 	TrafficCtlReload     bool   // a traffic_ctl_reload is required
@@ -69,6 +72,7 @@ type TrafficOpsReq struct {
 	TeakdRestart         bool   // a restart of teakd is required
 	TrafficServerRestart bool   // a trafficserver restart is required
 	RemapConfigReload    bool   // remap.config should be reloaded
+	ServicesReloaded     bool   // trafficserver was reloaded or restarted by StartServices
 	unixTimeStr          string // unix time string at program startup.
 }
 
@@ -78,6 +82,8 @@ type ConfigFile struct {
 	Path              string // full path
 	Service           string // service assigned to
 	CfgBackup         string // location to backup the config at 'Path'
+	CfgBackupGit      bool   // the backup of the config at 'Path' is in the git commit gitBackup, not CfgBackup
+	CfgExisted        bool   // the config at 'Path' existed before it was replaced
 	TropsBackup       string // location to backup the TrafficOps Version
 	AuditComplete     bool   // audit is complete
 	AuditFailed       bool   // audit failed
@@ -102,6 +108,8 @@ func (u UpdateStatus) String() string {
 		result = "UpdateTropsSuccessful"
 	case 3:
 		result = "UpdateTropsFailed"
+	case 4:
+		result = "UpdateTropsRolledBack"
 	}
 	return result
 }
@@ -211,7 +219,7 @@ func (r *TrafficOpsReq) checkConfigFile(cfg *ConfigFile, filesAdding []string) e
 	}
 
 	// perform plugin verification
-	if cfg.Name == "remap.config" || cfg.Name == "plugin.config" {
+	if cfg.Name == "remap.config" || cfg.Name == "plugin.config" || cfg.Name == "records.yaml" {
 		if err := checkRefs(r.Cfg, cfg.Body, filesAdding); err != nil {
 			return errors.New("failed to verify '" + cfg.Name + "': " + err.Error())
 		}
@@ -461,33 +469,16 @@ func (r *TrafficOpsReq) readCfgFile(cfg *ConfigFile, dir string) ([]byte, error)
 
 const configFileTempSuffix = `.tmp`
 
-// replaceCfgFile replaces an ATS configuration file with one from Traffic Ops.
+// replaceCfgFile replaces an ATS configuration file with the one from Traffic Ops staged by stageCfgFile.
 func (r *TrafficOpsReq) replaceCfgFile(cfg *ConfigFile) error {
-	if r.Cfg.RunMode != t3cutil.ModeBadAss &&
-		r.Cfg.RunMode != t3cutil.ModeSyncDS &&
-		r.Cfg.RunMode != t3cutil.ModeRevalidate {
-		log.Infof("You elected not to replace %s with the version from Traffic Ops.\n", cfg.Name)
-		cfg.ChangeApplied = false
-		return nil
-	}
-
 	tmpFileName := cfg.Path + configFileTempSuffix
-	log.Infof("Writing temp file '%s'\n", tmpFileName)
-
-	// write a new file, then move to the real location
-	// because moving is atomic but writing is not.
-	// If we just wrote to the real location and the app or OS or anything crashed,
-	// we'd end up with malformed files.
-
-	if _, err := util.WriteFileWithOwner(tmpFileName, cfg.Body, &cfg.Uid, &cfg.Gid, 0644); err != nil {
-		return errors.New("Failed to write temp config file '" + tmpFileName + "': " + err.Error())
-	}
 
 	log.Infof("Copying temp file '%s' to real '%s'\n", tmpFileName, cfg.Path)
 	if err := os.Rename(tmpFileName, cfg.Path); err != nil {
 		return errors.New("Failed to move temp '" + tmpFileName + "' to real '" + cfg.Path + "': " + err.Error())
 	}
 	cfg.ChangeApplied = true
+	r.appliedFiles = append(r.appliedFiles, cfg)
 	r.changedFiles = append(r.changedFiles, filepath.Join(cfg.Path, cfg.Name))
 
 	r.RemapConfigReload = r.RemapConfigReload ||
@@ -506,6 +497,7 @@ func (r *TrafficOpsReq) replaceCfgFile(cfg *ConfigFile) error {
 		r.RemapConfigReload ||
 		cfg.Name == "ssl_multicert.config" ||
 		cfg.Name == "records.config" ||
+		cfg.Name == "records.yaml" ||
 		(strings.HasSuffix(cfg.Dir, "ssl") && strings.HasSuffix(cfg.Name, ".cer")) ||
 		(strings.HasSuffix(cfg.Dir, "ssl") && strings.HasSuffix(cfg.Name, ".key"))
 
@@ -813,6 +805,17 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 			} else {
 				log.Debugf("Processing with update: Traffic Ops server status %+v config wait-for-parents %+v", serverStatus, r.Cfg.WaitForParents)
 			}
+
+			if r.Cfg.RunMode != t3cutil.ModeBadAss {
+				waveDone, err := r.checkRolloutWave(serverStatus)
+				if err != nil {
+					return updateStatus, errors.New("checking rollout wave: " + err.Error())
+				}
+				if !waveDone {
+					log.Errorln("Waiting for the first rollout wave to apply the update, bailing.")
+					return UpdateTropsNotNeeded, nil
+				}
+			}
 		} else if r.Cfg.RunMode == t3cutil.ModeSyncDS {
 			log.Errorln("In syncds mode, but no syncds update needs to be applied.  Running revalidation before exiting.")
 			r.RevalidateWhileSleeping()
@@ -830,7 +833,54 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 	return updateStatus, nil
 }
 
+// checkRolloutWave returns whether this server may apply its pending update, according to the staged rollout in Traffic Ops.
+// Servers not in the first wave wait for it in syncds mode, like --wait-for-parents, and return false if it still hasn't applied the update.
+//
+// A server in the wave which failed to apply the update, or rolled it back, keeps its update pending,
+// so a failed wave halts the rollout until the wave applies the update successfully.
+func (r *TrafficOpsReq) checkRolloutWave(serverStatus *tc.ServerUpdateStatus) (bool, error) {
+	rollout, err := getRolloutStatus(r.Cfg)
+	if err != nil {
+		return false, errors.New("getting rollout status: " + err.Error())
+	}
+	if !rollout.Enabled {
+		return true, nil
+	}
+	if rollout.InWave {
+		log.Infof("This server is in the first rollout wave %v, applying the update.\n", rollout.WaveServers)
+		return true, nil
+	}
+	if rolloutWaveDone(rollout) {
+		log.Infoln("The first rollout wave has applied the update.")
+		return true, nil
+	}
+
+	log.Errorf("Traffic Ops is signaling that the first rollout wave has not applied the update, servers still pending: %v\n", rollout.PendingWaveServers)
+	if r.Cfg.RunMode != t3cutil.ModeSyncDS {
+		return true, nil
+	}
+
+	log.Infoln("In syncds mode, sleeping to see if the first rollout wave applies the update.")
+	r.sleepTimer(serverStatus)
+	rollout, err = getRolloutStatus(r.Cfg)
+	if err != nil {
+		return false, errors.New("getting rollout status: " + err.Error())
+	}
+	if !rolloutWaveDone(rollout) {
+		log.Errorf("Rollout halted: servers in the first rollout wave have still not applied the update, and may have failed to apply it: %v\n", rollout.PendingWaveServers)
+		return false, nil
+	}
+	log.Debugln("The first rollout wave has applied the update; continuing.")
+	return true, nil
+}
+
+// rolloutWaveDone returns whether the staged rollout no longer needs this server to wait for the first wave.
+func rolloutWaveDone(rollout *t3cutil.RolloutStatus) bool {
+	return !rollout.Enabled || rollout.InWave || len(rollout.PendingWaveServers) == 0
+}
+
 // ProcessConfigFiles processes all config files retrieved from Traffic Ops.
+// If replacing the changed config files fails, and they're rolled back, it returns UpdateTropsRolledBack, for UpdateTrafficOps to report to Traffic Ops.
 func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 	var updateStatus UpdateStatus = UpdateTropsNotNeeded
 
@@ -867,6 +917,7 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 	}
 
 	changesRequired := 0
+	replaceFiles := []*ConfigFile{}
 
 	for _, cfg := range r.configFiles {
 		if cfg.ChangeNeeded &&
@@ -889,19 +940,24 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 				continue
 			} else {
 				log.Debugf("All Prereqs passed for replacing %s on disk with that in Traffic Ops.\n", cfg.Name)
-				err := r.replaceCfgFile(cfg)
-				if err != nil {
-					log.Errorf("failed to replace the config file, '%s',  on disk with data in Traffic Ops.\n", cfg.Name)
-				}
+				replaceFiles = append(replaceFiles, cfg)
 			}
 		}
 	}
 
+	if rolledBack, err := r.replaceCfgFiles(replaceFiles); err != nil {
+		updateStatus = UpdateTropsFailed
+		if rolledBack {
+			updateStatus = UpdateTropsRolledBack
+		}
+		log.Errorln("failed to replace the config files on disk with data in Traffic Ops: " + err.Error())
+	}
+
 	if 0 < len(r.changedFiles) {
 		log.Infof("Final state: remap.config: %t reload: %t restart: %t ntpd: %t sysctl: %t", r.RemapConfigReload, r.TrafficCtlReload, r.TrafficServerRestart, r.NtpdRestart, r.SysCtlReload)
 	}
 
-	if updateStatus != UpdateTropsFailed && changesRequired > 0 {
+	if updateStatus == UpdateTropsNotNeeded && changesRequired > 0 {
 		return UpdateTropsNeeded, nil
 	}
 
@@ -1067,7 +1123,12 @@ func (r *TrafficOpsReq) RevalidateWhileSleeping() (UpdateStatus, error) {
 			return updateStatus, err
 		}
 
-		if err := r.StartServices(&updateStatus); err != nil {
+		if err := r.StartServicesAndVerify(&updateStatus); err != nil {
+			if updateStatus == UpdateTropsRolledBack {
+				if _, err := r.UpdateTrafficOps(&updateStatus); err != nil {
+					log.Errorf("failed to update Traffic Ops: %s\n", err.Error())
+				}
+			}
 			return updateStatus, errors.New("failed to start services: " + err.Error())
 		}
 
@@ -1113,6 +1174,7 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 		if _, err := util.ServiceStart("trafficserver", startStr); err != nil {
 			return errors.New("failed to restart trafficserver")
 		}
+		r.ServicesReloaded = true
 		log.Infoln("trafficserver has been " + startStr + "ed")
 		if *syncdsUpdate == UpdateTropsNeeded {
 			*syncdsUpdate = UpdateTropsSuccessful
@@ -1135,6 +1197,7 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) error {
 			log.Errorln("ATS configuration has changed.  The new config will be picked up the next time ATS is started.")
 		} else if serviceNeeds == t3cutil.ServiceNeedsReload {
 			log.Infoln("ATS configuration has changed, Running 'traffic_ctl config reload' now.")
+			r.ServicesReloaded = true
 			if _, _, err := util.ExecCommand(config.TSHome+config.TrafficCtl, "config", "reload"); err != nil {
 				if *syncdsUpdate == UpdateTropsNeeded {
 					*syncdsUpdate = UpdateTropsFailed
@@ -1181,6 +1244,18 @@ func (r *TrafficOpsReq) UpdateTrafficOps(syncdsUpdate *UpdateStatus) (bool, erro
 	} else if *syncdsUpdate == UpdateTropsFailed {
 		log.Errorln("Traffic Ops requires an update but, applying the update locally failed.  Traffic Ops is not being updated.")
 		return true, nil
+	} else if *syncdsUpdate == UpdateTropsRolledBack {
+		log.Errorln("Traffic Ops requires an update but, applying the update locally failed and was rolled back.  Setting the update as still pending in Traffic Ops.")
+		updatePending, revalPending := serverStatus.UpdatePending, serverStatus.RevalPending
+		if r.Cfg.RunMode == t3cutil.ModeRevalidate {
+			revalPending = true
+		} else {
+			updatePending = true
+		}
+		if err := sendUpdate(r.Cfg, updatePending, revalPending); err != nil {
+			return false, errors.New("Traffic Ops Update failed: " + err.Error())
+		}
+		return true, nil
 	} else if *syncdsUpdate == UpdateTropsSuccessful {
 		updateResult = true
 		log.Errorln("Traffic Ops requires an update and it was applied successfully.  Clearing update state in Traffic Ops.")
@@ -20,10 +20,19 @@ package torequest
  */
 
 import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
 	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-tc"
 )
 
 var testCfg config.Cfg = config.Cfg{
@@ -141,3 +150,266 @@ func TestGetConfigFile(t *testing.T) {
 		t.Errorf("GetConfigFile('remap.config') failed, expected 'remap.config' got '" + cfg.Name + "'.")
 	}
 }
+
+// makeTestTransactionFiles makes a config file which exists in dir and one which doesn't, to be replaced.
+func makeTestTransactionFiles(t *testing.T, dir string) []*ConfigFile {
+	if err := ioutil.WriteFile(filepath.Join(dir, "remap.config"), []byte("old remap"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfgs := []*ConfigFile{}
+	for _, name := range []string{"remap.config", "new.config"} {
+		cfgs = append(cfgs, &ConfigFile{
+			Name: name,
+			Dir:  dir,
+			Path: filepath.Join(dir, name),
+			Body: []byte("new " + name),
+			Uid:  os.Getuid(),
+			Gid:  os.Getgid(),
+		})
+	}
+	return cfgs
+}
+
+func testTransactionFiles(t *testing.T, dir string, expected map[string]string) {
+	for name, expectedBody := range expected {
+		body, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if expectedBody == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("expected '%v' to not exist, actual error %v", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("reading '%v': %v", name, err)
+		} else if string(body) != expectedBody {
+			t.Errorf("expected '%v' body '%v', actual '%v'", name, expectedBody, string(body))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "remap.config"+configFileTempSuffix)); !os.IsNotExist(err) {
+		t.Errorf("expected temp file to be removed, actual error %v", err)
+	}
+}
+
+func TestReplaceAndRollbackConfigFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t3c-apply-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldBackupBase := backupBase
+	backupBase = filepath.Join(dir, "tmp")
+	defer func() { backupBase = oldBackupBase }()
+
+	cfg := testCfg
+	cfg.RunMode = t3cutil.ModeBadAss
+	cfg.UseGit = config.UseGitNo
+	trops := NewTrafficOpsReq(cfg)
+	cfgs := makeTestTransactionFiles(t, dir)
+
+	if _, err := trops.replaceCfgFiles(cfgs); err != nil {
+		t.Fatal(err)
+	}
+	testTransactionFiles(t, dir, map[string]string{"remap.config": "new remap.config", "new.config": "new new.config"})
+	if !cfgs[0].CfgExisted || cfgs[0].CfgBackup == "" || cfgs[1].CfgExisted {
+		t.Errorf("expected existing file backed up and new file not, actual %+v %+v", *cfgs[0], *cfgs[1])
+	}
+
+	if err := trops.RollbackConfigFiles(); err != nil {
+		t.Fatal(err)
+	}
+	testTransactionFiles(t, dir, map[string]string{"remap.config": "old remap", "new.config": ""})
+	if cfgs[0].ChangeApplied || cfgs[1].ChangeApplied {
+		t.Errorf("expected rolled back files to not be applied")
+	}
+}
+
+func TestReplaceAndRollbackConfigFilesGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "t3c-apply-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldTSConfigDir := config.TSConfigDir
+	config.TSConfigDir = dir
+	defer func() { config.TSConfigDir = oldTSConfigDir }()
+
+	cfgs := makeTestTransactionFiles(t, dir)
+	for _, args := range [][]string{
+		{"init"},
+		{"config", "user.email", "t3c-apply@test"},
+		{"config", "user.name", "t3c-apply"},
+		{"add", "remap.config"},
+		{"commit", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %v", args, err, string(out))
+		}
+	}
+
+	cfg := testCfg
+	cfg.RunMode = t3cutil.ModeSyncDS
+	cfg.UseGit = config.UseGitYes
+	trops := NewTrafficOpsReq(cfg)
+
+	if _, err := trops.replaceCfgFiles(cfgs); err != nil {
+		t.Fatal(err)
+	}
+	if trops.gitBackup == "" || !cfgs[0].CfgBackupGit || cfgs[0].CfgBackup != "" {
+		t.Errorf("expected existing file backed up in git, actual %+v", *cfgs[0])
+	}
+
+	if err := trops.RollbackConfigFiles(); err != nil {
+		t.Fatal(err)
+	}
+	testTransactionFiles(t, dir, map[string]string{"remap.config": "old remap", "new.config": ""})
+}
+
+func TestReplaceConfigFilesReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t3c-apply-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := testCfg
+	cfg.RunMode = t3cutil.ModeReport
+	trops := NewTrafficOpsReq(cfg)
+	cfgs := makeTestTransactionFiles(t, dir)
+
+	if _, err := trops.replaceCfgFiles(cfgs); err != nil {
+		t.Fatal(err)
+	}
+	testTransactionFiles(t, dir, map[string]string{"remap.config": "old remap", "new.config": ""})
+}
+
+func TestProcessConfigFilesReplaceFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t3c-apply-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldBackupBase := backupBase
+	backupBase = filepath.Join(dir, "tmp")
+	defer func() { backupBase = oldBackupBase }()
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.config"), []byte("old a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a directory can't be replaced with a file, so replacing b.config fails after staging and backing up succeed.
+	if err := os.MkdirAll(filepath.Join(dir, "b.config", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testCfg
+	cfg.RunMode = t3cutil.ModeBadAss
+	cfg.UseGit = config.UseGitNo
+	trops := NewTrafficOpsReq(cfg)
+	for _, name := range []string{"a.config", "b.config"} {
+		trops.configFiles[name] = &ConfigFile{
+			Name:          name,
+			Dir:           dir,
+			Path:          filepath.Join(dir, name),
+			Body:          []byte("new " + name),
+			Uid:           os.Getuid(),
+			Gid:           os.Getgid(),
+			AuditComplete: true,
+			ChangeNeeded:  true,
+		}
+	}
+
+	updateStatus, err := trops.ProcessConfigFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updateStatus != UpdateTropsRolledBack {
+		t.Errorf("expected update status %v after replacing failed and rolled back, actual %v", UpdateTropsRolledBack, updateStatus)
+	}
+	body, err := ioutil.ReadFile(filepath.Join(dir, "a.config"))
+	if err != nil || string(body) != "old a" {
+		t.Errorf("expected 'a.config' rolled back to 'old a', actual '%v' error %v", string(body), err)
+	}
+}
+
+func TestCheckHealthURL(t *testing.T) {
+	healthy := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	if err := checkHealthURL(srv.URL, time.Second); err != nil {
+		t.Errorf("expected healthy URL to succeed, actual %v", err)
+	}
+	healthy = false
+	if err := checkHealthURL(srv.URL, time.Second); err == nil {
+		t.Errorf("expected 503 URL to fail, actual nil error")
+	}
+}
+
+func TestCheckRolloutWave(t *testing.T) {
+	defer func(get func(config.Cfg) (*t3cutil.RolloutStatus, error)) { getRolloutStatus = get }(getRolloutStatus)
+
+	enabled := t3cutil.RolloutStatus{Enabled: true, WaveServers: []string{"edge0", "edge1"}, PendingWaveServers: []string{}}
+	pending := enabled
+	pending.PendingWaveServers = []string{"edge1"}
+	inWave := pending
+	inWave.InWave = true
+
+	for _, test := range []struct {
+		name     string
+		runMode  t3cutil.Mode
+		statuses []t3cutil.RolloutStatus
+		expected bool
+		calls    int
+	}{
+		{name: "disabled", runMode: t3cutil.ModeSyncDS, statuses: []t3cutil.RolloutStatus{{}}, expected: true, calls: 1},
+		{name: "in wave", runMode: t3cutil.ModeSyncDS, statuses: []t3cutil.RolloutStatus{inWave}, expected: true, calls: 1},
+		{name: "wave done", runMode: t3cutil.ModeSyncDS, statuses: []t3cutil.RolloutStatus{enabled}, expected: true, calls: 1},
+		{name: "wave done after sleeping", runMode: t3cutil.ModeSyncDS, statuses: []t3cutil.RolloutStatus{pending, enabled}, expected: true, calls: 2},
+		{name: "disabled after sleeping", runMode: t3cutil.ModeSyncDS, statuses: []t3cutil.RolloutStatus{pending, {}}, expected: true, calls: 2},
+		{name: "wave halted", runMode: t3cutil.ModeSyncDS, statuses: []t3cutil.RolloutStatus{pending, pending}, expected: false, calls: 2},
+		{name: "report", runMode: t3cutil.ModeReport, statuses: []t3cutil.RolloutStatus{pending}, expected: true, calls: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			getRolloutStatus = func(cfg config.Cfg) (*t3cutil.RolloutStatus, error) {
+				if calls >= len(test.statuses) {
+					t.Fatalf("expected %v rollout status requests, actual more", len(test.statuses))
+				}
+				status := test.statuses[calls]
+				calls++
+				return &status, nil
+			}
+			cfg := testCfg
+			cfg.Dispersion = 0
+			cfg.RunMode = test.runMode
+			r := NewTrafficOpsReq(cfg)
+
+			actual, err := r.checkRolloutWave(&tc.ServerUpdateStatus{})
+			if err != nil {
+				t.Fatalf("expected no error, actual %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected %v, actual %v", test.expected, actual)
+			}
+			if calls != test.calls {
+				t.Errorf("expected %v rollout status requests, actual %v", test.calls, calls)
+			}
+		})
+	}
+
+	getRolloutStatus = func(cfg config.Cfg) (*t3cutil.RolloutStatus, error) {
+		return nil, errors.New("t3c-request failed")
+	}
+	if ok, err := NewTrafficOpsReq(testCfg).checkRolloutWave(&tc.ServerUpdateStatus{}); err == nil || ok {
+		t.Errorf("expected error and false when the rollout status can't be gotten, actual %v %v", ok, err)
+	}
+}
@@ -0,0 +1,328 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// transaction.go has funcs to replace config files as a single transaction,
+// check ATS health after applying them, and roll them back.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/config"
+	"github.com/apache/trafficcontrol/cache-config/t3c-apply/util"
+	"github.com/apache/trafficcontrol/cache-config/t3cutil"
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// backupBase is the directory config files not in the ATS config directory git repo are backed up under, before being replaced.
+// Each run backs up to its own '<unix time>/backup' directory, which is removed with other old directories by util.CleanTmpDir.
+var backupBase = config.TmpBase
+
+// healthCheckInterval is how long CheckHealth waits between failed checks.
+const healthCheckInterval = time.Second
+
+// healthCheckRequestTimeout is the timeout of each request to the health check URL.
+const healthCheckRequestTimeout = 5 * time.Second
+
+// replaceCfgFiles replaces the given ATS configuration files with those from Traffic Ops, as a single transaction.
+// Every file is staged to a temp file, and its existing version backed up, first. If any of that fails, no file is replaced.
+// If replacing any file fails, the files already replaced are rolled back.
+// Returns any error, and whether the files were rolled back after replacing one failed, so the previous config files are in place.
+func (r *TrafficOpsReq) replaceCfgFiles(cfgs []*ConfigFile) (bool, error) {
+	r.appliedFiles = nil
+	if r.Cfg.RunMode != t3cutil.ModeBadAss &&
+		r.Cfg.RunMode != t3cutil.ModeSyncDS &&
+		r.Cfg.RunMode != t3cutil.ModeRevalidate {
+		for _, cfg := range cfgs {
+			log.Infof("You elected not to replace %s with the version from Traffic Ops.\n", cfg.Name)
+			cfg.ChangeApplied = false
+		}
+		return false, nil
+	}
+	if len(cfgs) == 0 {
+		return false, nil
+	}
+
+	r.makeGitBackup()
+
+	for i, cfg := range cfgs {
+		if err := r.stageCfgFile(cfg); err != nil {
+			removeStagedCfgFiles(cfgs[:i+1])
+			return false, errors.New("staging '" + cfg.Path + "': " + err.Error())
+		}
+		if err := r.backupCfgFile(cfg); err != nil {
+			removeStagedCfgFiles(cfgs[:i+1])
+			return false, errors.New("backing up '" + cfg.Path + "': " + err.Error())
+		}
+	}
+
+	for i, cfg := range cfgs {
+		if err := r.replaceCfgFile(cfg); err != nil {
+			removeStagedCfgFiles(cfgs[i:])
+			if rollbackErr := r.RollbackConfigFiles(); rollbackErr != nil {
+				return false, errors.New("replacing '" + cfg.Path + "': " + err.Error() + ", and rolling back failed: " + rollbackErr.Error())
+			}
+			return true, errors.New("replacing '" + cfg.Path + "', rolled back: " + err.Error())
+		}
+	}
+	return false, nil
+}
+
+// stageCfgFile writes the config file from Traffic Ops to a temp file, to be moved to the real location by replaceCfgFile.
+// We write a new file, then move it to the real location, because moving is atomic but writing is not.
+// If we just wrote to the real location and the app or OS or anything crashed,
+// we'd end up with malformed files.
+func (r *TrafficOpsReq) stageCfgFile(cfg *ConfigFile) error {
+	tmpFileName := cfg.Path + configFileTempSuffix
+	log.Infof("Writing temp file '%s'\n", tmpFileName)
+	if _, err := util.WriteFileWithOwner(tmpFileName, cfg.Body, &cfg.Uid, &cfg.Gid, 0644); err != nil {
+		return errors.New("Failed to write temp config file '" + tmpFileName + "': " + err.Error())
+	}
+	return nil
+}
+
+// removeStagedCfgFiles removes the temp files written by stageCfgFile, which haven't been moved to the real location.
+func removeStagedCfgFiles(cfgs []*ConfigFile) {
+	for _, cfg := range cfgs {
+		tmpFileName := cfg.Path + configFileTempSuffix
+		if err := os.Remove(tmpFileName); err != nil && !os.IsNotExist(err) {
+			log.Errorln("removing temp config file '" + tmpFileName + "': " + err.Error())
+		}
+	}
+}
+
+// makeGitBackup commits the ATS config directory, if using git, so the config files replaced in it can be rolled back from git.
+// If the commit fails, config files are backed up under backupBase instead.
+func (r *TrafficOpsReq) makeGitBackup() {
+	r.gitBackup = ""
+	if r.Cfg.UseGit != config.UseGitYes && r.Cfg.UseGit != config.UseGitAuto {
+		return
+	}
+	// commit anything changed since we started, e.g. by installing packages, so the commit is the config being replaced.
+	if err := util.MakeGitCommitAll(config.TSConfigDir, util.GitChangeNotSelf, r.Cfg.RunMode, true); err != nil {
+		log.Infoln("git committing config directory '" + config.TSConfigDir + "' to back up config files, backing up to files instead: " + err.Error())
+		return
+	}
+	head, err := util.GetGitHead(config.TSConfigDir)
+	if err != nil {
+		log.Errorln("getting git backup commit, backing up to files instead: " + err.Error())
+		return
+	}
+	r.gitBackup = head
+}
+
+// backupCfgFile backs up the existing file at cfg.Path, so it can be restored by RollbackConfigFiles.
+// Files committed to git by makeGitBackup are restored from git, and other files are copied under backupBase.
+func (r *TrafficOpsReq) backupCfgFile(cfg *ConfigFile) error {
+	cfg.CfgBackup = ""
+	cfg.CfgBackupGit = false
+	cfg.CfgExisted, _ = util.FileExists(cfg.Path)
+	if !cfg.CfgExisted {
+		return nil // rolling back removes the file
+	}
+
+	if r.gitBackup != "" {
+		if relPath, ok := gitRelPath(cfg.Path); ok && util.GitFileInCommit(config.TSConfigDir, r.gitBackup, relPath) {
+			cfg.CfgBackupGit = true
+			return nil
+		}
+	}
+
+	data, err := ioutil.ReadFile(cfg.Path)
+	if err != nil {
+		return errors.New("reading file: " + err.Error())
+	}
+	backupPath := filepath.Join(backupBase, r.unixTimeStr, "backup", cfg.Path)
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return errors.New("creating backup directory: " + err.Error())
+	}
+	if err := ioutil.WriteFile(backupPath, data, 0600); err != nil {
+		return errors.New("writing backup '" + backupPath + "': " + err.Error())
+	}
+	cfg.CfgBackup = backupPath
+	return nil
+}
+
+// gitRelPath returns the path relative to the ATS config directory, or false if it isn't in the ATS config directory.
+func gitRelPath(path string) (string, bool) {
+	relPath, err := filepath.Rel(config.TSConfigDir, path)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return relPath, true
+}
+
+// RollbackConfigFiles restores the previous version of every config file replaced by this run, in reverse order.
+// Files which didn't exist before are removed.
+// Every file is restored even if others fail, and an error is returned if any failed.
+func (r *TrafficOpsReq) RollbackConfigFiles() error {
+	errs := []string{}
+	for i := len(r.appliedFiles) - 1; i >= 0; i-- {
+		cfg := r.appliedFiles[i]
+		if err := r.restoreCfgFile(cfg); err != nil {
+			errs = append(errs, "'"+cfg.Path+"': "+err.Error())
+			continue
+		}
+		cfg.ChangeApplied = false
+		log.Infoln("Rolled back config file '" + cfg.Path + "'")
+	}
+	r.appliedFiles = nil
+	if len(errs) > 0 {
+		return errors.New("restoring config files " + strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// restoreCfgFile restores the backup of the config file made by backupCfgFile.
+func (r *TrafficOpsReq) restoreCfgFile(cfg *ConfigFile) error {
+	if !cfg.CfgExisted {
+		if err := os.Remove(cfg.Path); err != nil && !os.IsNotExist(err) {
+			return errors.New("removing new file: " + err.Error())
+		}
+		return nil
+	}
+
+	data := []byte(nil)
+	err := error(nil)
+	if cfg.CfgBackupGit {
+		relPath, _ := gitRelPath(cfg.Path)
+		data, err = util.GetGitFile(config.TSConfigDir, r.gitBackup, relPath)
+	} else {
+		data, err = ioutil.ReadFile(cfg.CfgBackup)
+	}
+	if err != nil {
+		return errors.New("reading backup: " + err.Error())
+	}
+
+	tmpFileName := cfg.Path + configFileTempSuffix
+	if _, err := util.WriteFileWithOwner(tmpFileName, data, &cfg.Uid, &cfg.Gid, 0644); err != nil {
+		return errors.New("writing temp file: " + err.Error())
+	}
+	if err := os.Rename(tmpFileName, cfg.Path); err != nil {
+		return errors.New("moving temp '" + tmpFileName + "' to real: " + err.Error())
+	}
+	return nil
+}
+
+// StartServicesAndVerify calls StartServices and then, if config files were replaced and ATS was reloaded or restarted, CheckHealth.
+//
+// If either fails and rollback isn't disabled, the replaced config files are rolled back, ATS is reloaded or restarted again,
+// and syncdsUpdate is set to UpdateTropsRolledBack, for UpdateTrafficOps to report to Traffic Ops.
+//
+// Returns any StartServices or health check error, whether or not the config files were rolled back.
+func (r *TrafficOpsReq) StartServicesAndVerify(syncdsUpdate *UpdateStatus) error {
+	r.ServicesReloaded = false
+	err := r.StartServices(syncdsUpdate)
+	if err == nil && r.ServicesReloaded && len(r.appliedFiles) > 0 {
+		if err = r.CheckHealth(); err != nil {
+			err = errors.New("health check after applying config files: " + err.Error())
+		} else {
+			log.Infoln("Health check after applying config files succeeded")
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	if r.Cfg.NoRollback || len(r.appliedFiles) == 0 {
+		return err
+	}
+
+	log.Errorln("Rolling back config files: " + err.Error())
+	if rollbackErr := r.rollback(); rollbackErr != nil {
+		*syncdsUpdate = UpdateTropsFailed
+		return errors.New(err.Error() + ", and rolling back failed: " + rollbackErr.Error())
+	}
+	*syncdsUpdate = UpdateTropsRolledBack
+	return err
+}
+
+// rollback rolls back the replaced config files, and reloads or restarts ATS with them.
+func (r *TrafficOpsReq) rollback() error {
+	if err := r.RollbackConfigFiles(); err != nil {
+		return err
+	}
+	r.ServicesReloaded = false
+	rollbackStatus := UpdateTropsNotNeeded
+	if err := r.StartServices(&rollbackStatus); err != nil {
+		return errors.New("starting services with the rolled back config files: " + err.Error())
+	}
+	if r.ServicesReloaded {
+		if err := r.CheckHealth(); err != nil {
+			// the previous config is restored, there's nothing more we can do.
+			log.Errorln("Health check after rolling back config files failed: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// CheckHealth checks that ATS is running and, if a health check URL is configured, that it returns a 200.
+// Failed checks are retried until the health check timeout, to give ATS time to start.
+func (r *TrafficOpsReq) CheckHealth() error {
+	deadline := time.Now().Add(r.Cfg.HealthCheckTimeout)
+	for {
+		err := r.checkHealth()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(healthCheckInterval).After(deadline) {
+			return err
+		}
+		log.Infoln("Health check failed, retrying: " + err.Error())
+		time.Sleep(healthCheckInterval)
+	}
+}
+
+// checkHealth checks ATS health once. See CheckHealth.
+func (r *TrafficOpsReq) checkHealth() error {
+	svcStatus, _, err := util.GetServiceStatus("trafficserver")
+	if err != nil {
+		return errors.New("getting trafficserver service status: " + err.Error())
+	}
+	if svcStatus != util.SvcRunning {
+		return errors.New("trafficserver is not running")
+	}
+	if r.Cfg.HealthCheckURL == "" {
+		return nil
+	}
+	return checkHealthURL(r.Cfg.HealthCheckURL, healthCheckRequestTimeout)
+}
+
+// checkHealthURL returns nil if a GET request to the URL returns a 200, or an error describing the failure.
+func checkHealthURL(url string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return errors.New("requesting health check URL: " + err.Error())
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check URL '%v' returned %v, expected %v", url, resp.StatusCode, http.StatusOK)
+	}
+	return nil
+}
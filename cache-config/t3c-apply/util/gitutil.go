@@ -185,3 +185,35 @@ func makeGitCommitMsg(now time.Time, self bool, mode t3cutil.Mode, success bool)
 	const sep = " "
 	return strings.Join([]string{appStr, selfStr, modeStr, successStr, timeStr}, sep)
 }
+
+// GetGitHead returns the commit hash of HEAD in the git repo in atsConfigDir.
+func GetGitHead(atsConfigDir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = atsConfigDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse error: in config dir '%v' returned err %v msg '%v'", atsConfigDir, err, string(output))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GitFileInCommit returns whether the file at path, relative to atsConfigDir, exists in the given commit.
+func GitFileInCommit(atsConfigDir string, commit string, path string) bool {
+	cmd := exec.Command("git", "cat-file", "-e", commit+":"+path)
+	cmd.Dir = atsConfigDir
+	return cmd.Run() == nil
+}
+
+// GetGitFile returns the contents of the file at path, relative to atsConfigDir, in the given commit.
+func GetGitFile(atsConfigDir string, commit string, path string) ([]byte, error) {
+	cmd := exec.Command("git", "show", commit+":"+path)
+	cmd.Dir = atsConfigDir
+	outbuf := bytes.Buffer{}
+	errbuf := bytes.Buffer{}
+	cmd.Stdout = &outbuf
+	cmd.Stderr = &errbuf
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git show error: in config dir '%v' returned err %v msg '%v'", atsConfigDir, err, errbuf.String())
+	}
+	return outbuf.Bytes(), nil
+}
@@ -41,7 +41,7 @@ var (
 )
 
 // This function accepts config line data from either ATS
-// a 'plugin.config' or a 'remap.config' format.
+// a 'plugin.config', a 'remap.config', or a 'records.yaml' format.
 //
 // It checks the configuration file line by line and verifies
 // that any specified plugin exists in the file system at the
@@ -52,6 +52,9 @@ var (
 // that the exist at the absolute path in the file name or
 // relative to the ATS configuration files directory.
 //
+// Any records.yaml record value with one of those extensions is
+// likewise verified to exist.
+//
 // Returns '0' if all plugins on the config line successfully verify
 // otherwise, returns the the count of plugins that failed to verify.
 //
@@ -129,6 +132,28 @@ func checkConfigLine(line string, lineNumber int, filesAdding map[string]struct{
 				}
 			}
 		}
+	} else if length > 1 && strings.HasSuffix(fields[len(fields)-2], ":") { // process a records.yaml 'key: value' line
+		// Any record value that ends in '.config | .cfg | .txt | .yml | .yaml' is
+		// assumed to be a configuration file and is checked that it
+		// exists in the filesystem at the absolute location in the name
+		// or relative to the ATS configuration files directory.
+		m := regexp.MustCompile(`(\.config|\.cfg|\.txt|\.yml|\.yaml)$`)
+		key := strings.TrimSuffix(fields[len(fields)-2], ":")
+		param := strings.Trim(fields[len(fields)-1], `'"`)
+		if m.MatchString(param) {
+			verified, exists = pluginParams[param]
+			if !exists {
+				verified = verifyPluginConfigfile(param, filesAdding)
+				pluginParams[param] = verified
+			}
+			if !verified {
+				log.Errorf("the config file '%s' for record '%s' on line '%d' of records.yaml does not exist or is empty\n",
+					param, key, lineNumber)
+				pluginErrorCount++
+			} else {
+				log.Infof("the config file '%s' for record '%s' on line '%d' of records.yaml has been verified\n", param, key, lineNumber)
+			}
+		}
 	} else { // process a line from plugin.config
 
 		// process a line from plugin.config
@@ -100,3 +100,20 @@ func TestBadPluConfig(t *testing.T) {
 		t.Errorf("expected 0 errors got %d errors\n", rc)
 	}
 }
+
+func TestRecordsYAML(t *testing.T) {
+	rc, err := t3c_check_refs_exec("./test-files/etc/records.yaml", t)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if rc != 0 {
+		t.Errorf("expected 0 errors got %d errors\n", rc)
+	}
+}
+
+func TestBadRecordsYAML(t *testing.T) {
+	rc, _ := t3c_check_refs_exec("./test-files/etc/bad-records.yaml", t)
+	if rc != -1 {
+		t.Errorf("expected 1 error got %d errors\n", rc)
+	}
+}
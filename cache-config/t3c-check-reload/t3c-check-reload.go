@@ -72,6 +72,7 @@ func main() {
 	// ATS reload is needed if:
 	// [ ] 1. new SSL keys were installed AND ssl_multicert.config was changed
 	// [ ] 2. any of the following were changed: url_sig*, uri_signing*, hdr_rw*, (plugin.config), (50-ats.rules),
+	//        records.config, records.yaml,
 	//        ssl/*.cer, ssl/*.key, anything else in /trafficserver,
 	//
 
@@ -99,6 +100,10 @@ func main() {
 		if strings.Contains(path, "/trafficserver/") {
 			ExitReload()
 		}
+		// records.yaml replaced records.config in ATS 10, and may be outside the trafficserver directory like records.config.
+		if strings.HasSuffix(path, "records.config") || strings.HasSuffix(path, "records.yaml") {
+			ExitReload()
+		}
 		if strings.Contains(path, "hdr_rw_") ||
 			strings.Contains(path, "url_sig_") ||
 			strings.Contains(path, "uri_signing_") ||
@@ -0,0 +1,263 @@
+package main
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configRecords is a config file parsed into records, keyed by what identifies each record in the file,
+// e.g. the remap.config from-URL. Each value is the record's normalized text.
+type configRecords map[string]string
+
+// configParser parses the lines of a config file into records.
+// Returns false if the file can't be compared as a set of records, in which case it must be compared line by line.
+type configParser func(lines []string) (configRecords, bool)
+
+// configParsers are the parsers of the config files which are compared semantically, by file name.
+var configParsers = map[string]configParser{
+	"remap.config":         parseRemapDotConfig,
+	"parent.config":        parseParentDotConfig,
+	"ssl_multicert.config": parseSSLMultiCertDotConfig,
+	"records.config":       parseRecordsDotConfig,
+}
+
+// recordChange is a record added to or removed from a config file.
+type recordChange struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// recordModification is a record whose value changed in a config file.
+type recordModification struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// changeReport is the semantic difference between two versions of a config file.
+// Added records are in the second file and not the first, and removed records are in the first and not the second.
+type changeReport struct {
+	File     string               `json:"file"`
+	Added    []recordChange       `json:"added"`
+	Removed  []recordChange       `json:"removed"`
+	Modified []recordModification `json:"modified"`
+}
+
+// Empty returns whether the report has no changes.
+func (cr changeReport) Empty() bool {
+	return len(cr.Added) == 0 && len(cr.Removed) == 0 && len(cr.Modified) == 0
+}
+
+// configFileName returns the base name of the first of the file names which isn't stdin, to find its configParser.
+// Returns the empty string if all the files are stdin.
+func configFileName(fileNames ...string) string {
+	for _, name := range fileNames {
+		if strings.ToLower(name) != "stdin" {
+			return filepath.Base(name)
+		}
+	}
+	return ""
+}
+
+// diffRecords returns the changeReport from the records a to the records b, sorted by key.
+func diffRecords(file string, a configRecords, b configRecords) changeReport {
+	report := changeReport{File: file, Added: []recordChange{}, Removed: []recordChange{}, Modified: []recordModification{}}
+	for key, aVal := range a {
+		bVal, ok := b[key]
+		if !ok {
+			report.Removed = append(report.Removed, recordChange{Key: key, Value: aVal})
+		} else if aVal != bVal {
+			report.Modified = append(report.Modified, recordModification{Key: key, Old: aVal, New: bVal})
+		}
+	}
+	for key, bVal := range b {
+		if _, ok := a[key]; !ok {
+			report.Added = append(report.Added, recordChange{Key: key, Value: bVal})
+		}
+	}
+	sort.Slice(report.Added, func(i, j int) bool { return report.Added[i].Key < report.Added[j].Key })
+	sort.Slice(report.Removed, func(i, j int) bool { return report.Removed[i].Key < report.Removed[j].Key })
+	sort.Slice(report.Modified, func(i, j int) bool { return report.Modified[i].Key < report.Modified[j].Key })
+	return report
+}
+
+// addOrderedRecord adds the record to records. Because ATS uses the first matching line,
+// a repeated key is suffixed with its occurrence, so reordering lines with the same key is a change.
+func addOrderedRecord(records configRecords, key string, val string) {
+	if _, ok := records[key]; !ok {
+		records[key] = val
+		return
+	}
+	for i := 2; ; i++ {
+		numKey := key + " #" + strconv.Itoa(i)
+		if _, ok := records[numKey]; !ok {
+			records[numKey] = val
+			return
+		}
+	}
+}
+
+// parseRemapDotConfig parses remap.config rules, keyed by their from-URL.
+//
+// Files with directives, e.g. .activatefilter, can't be compared as sets,
+// because directives apply to the rules after them. Neither can files with regex rules,
+// e.g. regex_map, because ATS uses the first matching regex, so reordering them is a change.
+func parseRemapDotConfig(lines []string) (configRecords, bool) {
+	records := configRecords{}
+	for _, line := range joinContinuedLines(lines) {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ".") {
+			return nil, false
+		}
+		fields := splitConfigFields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "regex_") {
+			return nil, false
+		}
+		addOrderedRecord(records, fields[1], strings.Join(fields, " "))
+	}
+	return records, true
+}
+
+// joinContinuedLines joins lines ending in a backslash with the line after them.
+func joinContinuedLines(lines []string) []string {
+	joined := []string{}
+	continued := ""
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, `\`) {
+			continued += strings.TrimSuffix(line, `\`) + " "
+			continue
+		}
+		joined = append(joined, strings.TrimSpace(continued+line))
+		continued = ""
+	}
+	if continued != "" {
+		joined = append(joined, strings.TrimSpace(continued))
+	}
+	return joined
+}
+
+// parentDestFields are the parent.config fields which select the requests a line applies to,
+// and together identify the line.
+var parentDestFields = []string{"dest_domain", "dest_host", "dest_ip", "port", "scheme", "prefix", "suffix", "method", "time", "src_ip", "internal"}
+
+// parseParentDotConfig parses parent.config lines, keyed by their destination, e.g. 'dest_domain=example.net port=80'.
+// The fields of each line are compared regardless of order.
+// Files with url_regex or host_regex lines aren't parsed, because ATS uses the first matching regex line, so their order matters.
+func parseParentDotConfig(lines []string) (configRecords, bool) {
+	for _, line := range lines {
+		for _, field := range splitConfigFields(strings.TrimSpace(line)) {
+			if strings.HasPrefix(field, "url_regex=") || strings.HasPrefix(field, "host_regex=") {
+				return nil, false
+			}
+		}
+	}
+	return parseFieldsConfig(lines, parentDestFields)
+}
+
+// parseSSLMultiCertDotConfig parses ssl_multicert.config lines, keyed by their destination IP and certificate name.
+// The fields of each line are compared regardless of order.
+func parseSSLMultiCertDotConfig(lines []string) (configRecords, bool) {
+	return parseFieldsConfig(lines, []string{"dest_ip", "ssl_cert_name"})
+}
+
+// parseFieldsConfig parses a config file of lines of space-delimited key=value fields,
+// keyed by the values of the given key fields in the line.
+func parseFieldsConfig(lines []string, keyFields []string) (configRecords, bool) {
+	records := configRecords{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fieldVals := map[string]string{}
+		fields := splitConfigFields(line)
+		for _, field := range fields {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, false
+			}
+			fieldVals[kv[0]] = kv[1]
+		}
+
+		keys := []string{}
+		for _, field := range keyFields {
+			if val, ok := fieldVals[field]; ok {
+				keys = append(keys, field+"="+val)
+			}
+		}
+		if len(keys) == 0 {
+			return nil, false
+		}
+
+		sort.Strings(fields)
+		addOrderedRecord(records, strings.Join(keys, " "), strings.Join(fields, " "))
+	}
+	return records, true
+}
+
+// parseRecordsDotConfig parses records.config lines, keyed by their record name.
+// Unlike other files, ATS uses the last line of a repeated record, so that is its value.
+func parseRecordsDotConfig(lines []string) (configRecords, bool) {
+	records := configRecords{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, false
+		}
+		records[fields[1]] = strings.Join(append([]string{fields[0]}, fields[2:]...), " ")
+	}
+	return records, true
+}
+
+// splitConfigFields splits the line on whitespace, except whitespace inside double quotes.
+func splitConfigFields(line string) []string {
+	fields := []string{}
+	field := strings.Builder{}
+	inQuote := false
+	for _, ch := range line {
+		switch {
+		case ch == '"':
+			inQuote = !inQuote
+			field.WriteRune(ch)
+		case !inQuote && (ch == ' ' || ch == '\t'):
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(ch)
+		}
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
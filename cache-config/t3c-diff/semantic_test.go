@@ -0,0 +1,179 @@
+package main
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemanticDiffRemap(t *testing.T) {
+	fileA := `map http://a.example.net/ http://origin-a.example.net/ @plugin=header_rewrite.so @pparam=hdr_rw_a.config
+map http://b.example.net/ http://origin-b.example.net/
+map http://c.example.net/ http://origin-c.example.net/`
+
+	// reordered lines and whitespace aren't changes
+	fileB := `map http://b.example.net/   http://origin-b.example.net/
+map http://a.example.net/ http://origin-a.example.net/ \
+    @plugin=header_rewrite.so @pparam=hdr_rw_a.config
+map http://c.example.net/ http://origin-c.example.net/`
+	report, ok := semanticDiff("remap.config", fileA, fileB)
+	if !ok {
+		t.Fatal("expected remap.config to be compared semantically")
+	}
+	if !report.Empty() {
+		t.Errorf("expected no changes for reordered lines, actual %+v", report)
+	}
+
+	fileB = `map http://b.example.net/ http://origin-b2.example.net/
+map http://a.example.net/ http://origin-a.example.net/ @plugin=header_rewrite.so @pparam=hdr_rw_a.config
+map http://d.example.net/ http://origin-d.example.net/`
+	report, ok = semanticDiff("remap.config", fileA, fileB)
+	if !ok {
+		t.Fatal("expected remap.config to be compared semantically")
+	}
+	expected := changeReport{
+		File:     "remap.config",
+		Added:    []recordChange{{Key: "http://d.example.net/", Value: "map http://d.example.net/ http://origin-d.example.net/"}},
+		Removed:  []recordChange{{Key: "http://c.example.net/", Value: "map http://c.example.net/ http://origin-c.example.net/"}},
+		Modified: []recordModification{{Key: "http://b.example.net/", Old: "map http://b.example.net/ http://origin-b.example.net/", New: "map http://b.example.net/ http://origin-b2.example.net/"}},
+	}
+	if !reflect.DeepEqual(expected, report) {
+		t.Errorf("expected %+v, actual %+v", expected, report)
+	}
+}
+
+func TestSemanticDiffRemapDirectives(t *testing.T) {
+	fileA := `.activatefilter allow_purge
+map http://a.example.net/ http://origin-a.example.net/`
+	if _, ok := semanticDiff("remap.config", fileA, fileA); ok {
+		t.Error("expected remap.config with directives to not be compared semantically")
+	}
+}
+
+func TestSemanticDiffRemapRegex(t *testing.T) {
+	fileA := `map http://a.example.net/ http://origin-a.example.net/
+regex_map http://(.*)\.example\.net/ http://origin-$1.example.net/
+regex_map http://b\.example\.net/ http://origin-b.example.net/`
+
+	// ATS uses the first matching regex, so reordering regex rules changes which is used
+	fileB := `map http://a.example.net/ http://origin-a.example.net/
+regex_map http://b\.example\.net/ http://origin-b.example.net/
+regex_map http://(.*)\.example\.net/ http://origin-$1.example.net/`
+	if _, ok := semanticDiff("remap.config", fileA, fileB); ok {
+		t.Error("expected remap.config with regex_map rules to not be compared semantically")
+	}
+
+	fileA = `regex_redirect http://(.*)\.example\.net/ http://new-$1.example.net/`
+	if _, ok := semanticDiff("remap.config", fileA, fileA); ok {
+		t.Error("expected remap.config with regex_redirect rules to not be compared semantically")
+	}
+}
+
+func TestSemanticDiffParent(t *testing.T) {
+	fileA := `dest_domain=a.example.net port=80 parent="mid0:80|0.999;mid1:80|0.999" round_robin=consistent_hash go_direct=false
+dest_domain=a.example.net port=443 parent="mid0:443|0.999" round_robin=consistent_hash go_direct=false
+dest_domain=. go_direct=true`
+
+	fileB := `dest_domain=a.example.net port=443 go_direct=false round_robin=consistent_hash parent="mid0:443|0.999"
+dest_domain=. go_direct=true
+dest_domain=a.example.net port=80 parent="mid1:80|0.999;mid0:80|0.999" round_robin=consistent_hash go_direct=false`
+	report, ok := semanticDiff("parent.config", fileA, fileB)
+	if !ok {
+		t.Fatal("expected parent.config to be compared semantically")
+	}
+	if len(report.Added) != 0 || len(report.Removed) != 0 || len(report.Modified) != 1 {
+		t.Fatalf("expected only the reordered parents to be modified, actual %+v", report)
+	}
+	if report.Modified[0].Key != "dest_domain=a.example.net port=80" {
+		t.Errorf("expected modified key 'dest_domain=a.example.net port=80', actual '%v'", report.Modified[0].Key)
+	}
+}
+
+func TestSemanticDiffParentRegex(t *testing.T) {
+	fileA := `dest_domain=a.example.net port=80 parent="mid0:80|0.999" round_robin=consistent_hash go_direct=false
+url_regex=^http://a\.example\.net/images/ parent="mid1:80|0.999" round_robin=consistent_hash go_direct=false
+url_regex=^http://a\.example\.net/ parent="mid2:80|0.999" round_robin=consistent_hash go_direct=false`
+
+	// ATS uses the first matching regex line, so reordering regex lines changes which is used
+	fileB := `dest_domain=a.example.net port=80 parent="mid0:80|0.999" round_robin=consistent_hash go_direct=false
+url_regex=^http://a\.example\.net/ parent="mid2:80|0.999" round_robin=consistent_hash go_direct=false
+url_regex=^http://a\.example\.net/images/ parent="mid1:80|0.999" round_robin=consistent_hash go_direct=false`
+	if _, ok := semanticDiff("parent.config", fileA, fileB); ok {
+		t.Error("expected parent.config with url_regex lines to not be compared semantically")
+	}
+
+	fileA = `host_regex=^cdn[0-9]+\.example\.net$ parent="mid0:80|0.999" round_robin=consistent_hash go_direct=false`
+	if _, ok := semanticDiff("parent.config", fileA, fileA); ok {
+		t.Error("expected parent.config with host_regex lines to not be compared semantically")
+	}
+}
+
+func TestSemanticDiffSSLMultiCert(t *testing.T) {
+	fileA := `ssl_cert_name=a_cert.cer dest_ip=* ssl_key_name=a_cert.key
+ssl_cert_name=b_cert.cer dest_ip=* ssl_key_name=b_cert.key`
+	fileB := `dest_ip=* ssl_key_name=b_cert.key ssl_cert_name=b_cert.cer`
+	report, ok := semanticDiff("ssl_multicert.config", fileA, fileB)
+	if !ok {
+		t.Fatal("expected ssl_multicert.config to be compared semantically")
+	}
+	expected := []recordChange{{Key: "dest_ip=* ssl_cert_name=a_cert.cer", Value: "dest_ip=* ssl_cert_name=a_cert.cer ssl_key_name=a_cert.key"}}
+	if len(report.Added) != 0 || len(report.Modified) != 0 || !reflect.DeepEqual(expected, report.Removed) {
+		t.Errorf("expected only a_cert removed, actual %+v", report)
+	}
+}
+
+func TestSemanticDiffRecords(t *testing.T) {
+	fileA := `CONFIG proxy.config.diags.debug.enabled INT 0
+CONFIG proxy.config.http.server_ports STRING 80 80:ipv6
+CONFIG proxy.config.diags.debug.enabled INT 1`
+	fileB := `CONFIG proxy.config.http.server_ports STRING 80    80:ipv6
+CONFIG proxy.config.diags.debug.enabled INT 1`
+	report, ok := semanticDiff("records.config", fileA, fileB)
+	if !ok {
+		t.Fatal("expected records.config to be compared semantically")
+	}
+	if !report.Empty() {
+		t.Errorf("expected no changes when the last repeated record is the same, actual %+v", report)
+	}
+
+	fileB = `CONFIG proxy.config.http.server_ports STRING 80 80:ipv6
+CONFIG proxy.config.diags.debug.enabled INT 0`
+	report, _ = semanticDiff("records.config", fileA, fileB)
+	expected := []recordModification{{Key: "proxy.config.diags.debug.enabled", Old: "CONFIG INT 1", New: "CONFIG INT 0"}}
+	if !reflect.DeepEqual(expected, report.Modified) {
+		t.Errorf("expected %+v, actual %+v", expected, report.Modified)
+	}
+}
+
+func TestSemanticDiffUnknownFile(t *testing.T) {
+	if _, ok := semanticDiff("plugin.config", "a.so", "b.so"); ok {
+		t.Error("expected unknown config file to not be compared semantically")
+	}
+}
+
+func TestConfigFileName(t *testing.T) {
+	if name := configFileName("stdin", "/opt/trafficserver/etc/trafficserver/remap.config"); name != "remap.config" {
+		t.Errorf("expected remap.config, actual '%v'", name)
+	}
+	if name := configFileName("STDIN", "stdin"); name != "" {
+		t.Errorf("expected no name for stdin, actual '%v'", name)
+	}
+}
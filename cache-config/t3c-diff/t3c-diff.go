@@ -20,6 +20,7 @@ package main
  */
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -34,19 +35,21 @@ import (
 
 func main() {
 	help := getopt.BoolLong("help", 'h', "Print usage info and exit")
+	lineDiff := getopt.BoolLong("line-diff", 'l', "Compare all files line by line, not known config files semantically")
 	getopt.ParseV2()
 	if *help {
 		fmt.Println(usageStr)
 		os.Exit(0)
 	}
 
-	if len(os.Args) < 3 {
+	args := getopt.Args()
+	if len(args) < 2 {
 		fmt.Println(usageStr)
 		os.Exit(3)
 	}
 
-	fileNameA := strings.TrimSpace(os.Args[1])
-	fileNameB := strings.TrimSpace(os.Args[2])
+	fileNameA := strings.TrimSpace(args[0])
+	fileNameB := strings.TrimSpace(args[1])
 
 	if len(fileNameA) == 0 || len(fileNameB) == 0 {
 		fmt.Println(usageStr)
@@ -64,18 +67,47 @@ func main() {
 		os.Exit(6)
 	}
 
+	// YAML indentation is significant, so it isn't removed before comparing, e.g. for records.yaml.
+	isYAML := t3cutil.IsYAMLFile(fileNameA) || t3cutil.IsYAMLFile(fileNameB)
+
 	fileALines := strings.Split(string(fileA), "\n")
-	fileALines = t3cutil.UnencodeFilter(fileALines)
+	if isYAML {
+		fileALines = t3cutil.YAMLUnencodeFilter(fileALines)
+	} else {
+		fileALines = t3cutil.UnencodeFilter(fileALines)
+	}
 	fileALines = t3cutil.CommentsFilter(fileALines)
 	fileA = strings.Join(fileALines, "\n")
 	fileA = t3cutil.NewLineFilter(fileA)
 
 	fileBLines := strings.Split(string(fileB), "\n")
-	fileBLines = t3cutil.UnencodeFilter(fileBLines)
+	if isYAML {
+		fileBLines = t3cutil.YAMLUnencodeFilter(fileBLines)
+	} else {
+		fileBLines = t3cutil.UnencodeFilter(fileBLines)
+	}
 	fileBLines = t3cutil.CommentsFilter(fileBLines)
 	fileB = strings.Join(fileBLines, "\n")
 	fileB = t3cutil.NewLineFilter(fileB)
 
+	if !*lineDiff {
+		if report, ok := semanticDiff(configFileName(fileNameA, fileNameB), fileA, fileB); ok {
+			if !report.Empty() {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					fmt.Fprintf(os.Stderr, "error writing change report: "+err.Error())
+					os.Exit(7)
+				}
+				os.Exit(1)
+			}
+			if fileAExisted != fileBExisted {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
+
 	if fileA != fileB {
 		match := regexp.MustCompile(`(?m)^\+.*|^-.*`)
 		changes := diff.Diff(fileA, fileB)
@@ -91,7 +123,25 @@ func main() {
 
 }
 
-const usageStr = `usage: t3c-diff [--help]
+// semanticDiff compares the filtered text of two versions of the config file with the given name as sets of records.
+// Returns false if the file isn't a known config file, or either version can't be compared as records.
+func semanticDiff(fileName string, fileA string, fileB string) (changeReport, bool) {
+	parser, ok := configParsers[fileName]
+	if !ok {
+		return changeReport{}, false
+	}
+	recordsA, ok := parser(strings.Split(fileA, "\n"))
+	if !ok {
+		return changeReport{}, false
+	}
+	recordsB, ok := parser(strings.Split(fileB, "\n"))
+	if !ok {
+		return changeReport{}, false
+	}
+	return diffRecords(fileName, recordsA, recordsB), true
+}
+
+const usageStr = `usage: t3c-diff [--help] [--line-diff]
        <file-a> <file-b>
 
 Either file may be 'stdin', in which case that file is read from stdin.
@@ -100,6 +150,11 @@ Either file may not exist.
 Prints the diff to stdout, and returns the exit code 0 if there was no diff, 1 if there was a diff.
 If one file exists but the other doesn't, it will always be a diff.
 
+The files remap.config, parent.config, ssl_multicert.config, and records.config are compared
+as sets of records, ignoring line order and whitespace, and the diff is a JSON report of the
+records added to, removed from, and modified in file-b, compared to file-a. Other files, and
+files which can't be parsed, are compared line by line, as are all files if --line-diff is given.
+
 Note this means there may be no diff text printed to stdout but still exit 1 indicating a diff
 if the file being created or deleted is semantically empty.`
 
@@ -94,12 +94,14 @@ var configFileLiteralFuncs = []ConfigFileLiteralFunc{
 	{"parent.config", MakeParentDotConfig},
 	{"plugin.config", MakePluginDotConfig},
 	{"records.config", MakeRecordsDotConfig},
+	{"records.yaml", MakeRecordsDotYAML},
 	{"regex_revalidate.config", MakeRegexRevalidateDotConfig},
 	{"remap.config", MakeRemapDotConfig},
 	{"ssl_multicert.config", MakeSSLMultiCertDotConfig},
 	{"ssl_server_name.yaml", MakeSSLServerNameYAML},
 	{"sni.yaml", MakeSNIDotYAML},
 	{"storage.config", MakeStorageDotConfig},
+	{"strategies.yaml", MakeStrategiesDotYAML},
 	{"sysctl.conf", MakeSysCtlDotConf},
 	{"volume.config", MakeVolumeDotConfig},
 }
@@ -67,6 +67,7 @@ func GetDataFuncs() map[string]func(TCCfg, io.Writer) error {
 		`system-info`:   WriteSystemInfo,
 		`statuses`:      WriteStatuses,
 		`config`:        WriteConfig,
+		`rollout`:       WriteRolloutStatus,
 	}
 }
 
@@ -0,0 +1,225 @@
+package t3cutil
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// RolloutParamConfigFile is the config file of the Parameters which define the first wave of a staged rollout.
+// The Parameters are on the Profile of the servers being rolled out to.
+const RolloutParamConfigFile = `rollout`
+
+// RolloutParamWaveCacheGroups is the Parameter name of a comma-delimited list of cache groups in the first wave.
+const RolloutParamWaveCacheGroups = `wave.cachegroups`
+
+// RolloutParamWaveServers is the Parameter name of a comma-delimited list of server host names in the first wave.
+const RolloutParamWaveServers = `wave.servers`
+
+// RolloutParamWavePercent is the Parameter name of the percentage of servers in the first wave, from 0 to 100.
+const RolloutParamWavePercent = `wave.percent`
+
+// RolloutWave is the first wave of a staged rollout, as defined by Parameters.
+// A server is in the wave if it matches any of the cache groups, host names, or percentage.
+type RolloutWave struct {
+	CacheGroups map[string]struct{}
+	Servers     map[string]struct{}
+	Percent     float64
+}
+
+// RolloutStatus is the status of the staged rollout of a server's pending update.
+type RolloutStatus struct {
+	// Enabled is whether the server's Profile has a rollout wave.
+	Enabled bool `json:"enabled"`
+	// InWave is whether the server is in the first wave, and may apply updates without waiting for the wave.
+	InWave bool `json:"inWave"`
+	// WaveServers is the host names of the servers in the first wave.
+	WaveServers []string `json:"waveServers"`
+	// PendingWaveServers is the host names of the servers in the first wave which have not yet applied their update.
+	PendingWaveServers []string `json:"pendingWaveServers"`
+}
+
+// WriteRolloutStatus writes the RolloutStatus of cfg.CacheHostName to output.
+func WriteRolloutStatus(cfg TCCfg, output io.Writer) error {
+	status, err := GetRolloutStatus(cfg)
+	if err != nil {
+		return errors.New("getting rollout status: " + err.Error())
+	}
+	if err := json.NewEncoder(output).Encode(status); err != nil {
+		return errors.New("writing rollout status: " + err.Error())
+	}
+	return nil
+}
+
+// GetRolloutStatus gets the RolloutStatus of cfg.CacheHostName from Traffic Ops.
+func GetRolloutStatus(cfg TCCfg) (*RolloutStatus, error) {
+	server, _, err := cfg.TOClient.GetServerByHostName(string(cfg.CacheHostName), nil)
+	if err != nil {
+		return nil, errors.New("getting server: " + err.Error())
+	} else if server.Profile == nil {
+		return nil, errors.New("getting server: nil profile")
+	}
+	params, _, err := cfg.TOClient.GetServerProfileParameters(*server.Profile, nil)
+	if err != nil {
+		return nil, errors.New("getting server profile '" + *server.Profile + "' parameters: " + err.Error())
+	}
+
+	wave, warnings := MakeRolloutWave(params)
+	for _, warn := range warnings {
+		log.Warnln(warn)
+	}
+	if wave == nil {
+		return &RolloutStatus{}, nil
+	}
+
+	servers, _, err := cfg.TOClient.GetServers(nil)
+	if err != nil {
+		return nil, errors.New("getting servers: " + err.Error())
+	}
+	status := MakeRolloutStatus(server, servers, wave)
+	return &status, nil
+}
+
+// MakeRolloutWave makes the RolloutWave from the rollout Parameters in params.
+// Returns nil if params has no rollout Parameters, and any warnings for malformed Parameters.
+func MakeRolloutWave(params []tc.Parameter) (*RolloutWave, []string) {
+	warnings := []string{}
+	wave := &RolloutWave{CacheGroups: map[string]struct{}{}, Servers: map[string]struct{}{}}
+	hasWave := false
+	for _, param := range params {
+		if param.ConfigFile != RolloutParamConfigFile {
+			continue
+		}
+		switch param.Name {
+		case RolloutParamWaveCacheGroups:
+			hasWave = true
+			addRolloutList(wave.CacheGroups, param.Value)
+		case RolloutParamWaveServers:
+			hasWave = true
+			addRolloutList(wave.Servers, param.Value)
+		case RolloutParamWavePercent:
+			pct, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(param.Value), "%")), 64)
+			if err != nil || pct < 0 || pct > 100 {
+				warnings = append(warnings, "rollout Parameter '"+param.Name+"' value '"+param.Value+"' is not a percentage from 0 to 100, ignoring!")
+				continue
+			}
+			hasWave = true
+			wave.Percent = pct
+		default:
+			warnings = append(warnings, "rollout Parameter '"+param.Name+"' is unknown, ignoring!")
+		}
+	}
+	if !hasWave {
+		return nil, warnings
+	}
+	return wave, warnings
+}
+
+// addRolloutList adds the comma-delimited names in val to the set.
+func addRolloutList(set map[string]struct{}, val string) {
+	for _, name := range strings.Split(val, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			set[name] = struct{}{}
+		}
+	}
+}
+
+// MakeRolloutStatus makes the RolloutStatus of server.
+//
+// The rollout is among the servers in the same CDN with the same Profile as server,
+// because those are the servers which share the rollout Parameters.
+// Servers with the OFFLINE status are never waited for, because they may never apply the update,
+// and aren't counted in the percentage, so they don't take the place of servers which will.
+//
+// Servers in the percentage of the wave are chosen by a hash of their host names,
+// so every server computes the same wave, and adding or removing a server rarely moves others in or out of it.
+func MakeRolloutStatus(server *atscfg.Server, servers []atscfg.Server, wave *RolloutWave) RolloutStatus {
+	hostName := derefStr(server.HostName)
+
+	candidates := []atscfg.Server{}
+	percentCandidates := []string{}
+	for _, sv := range servers {
+		if sv.HostName == nil || derefStr(sv.CDNName) != derefStr(server.CDNName) || derefStr(sv.Profile) != derefStr(server.Profile) {
+			continue
+		}
+		candidates = append(candidates, sv)
+		if derefStr(sv.Status) != string(tc.CacheStatusOffline) {
+			percentCandidates = append(percentCandidates, *sv.HostName)
+		}
+	}
+	sort.Slice(percentCandidates, func(i, j int) bool {
+		hi, hj := rolloutHash(percentCandidates[i]), rolloutHash(percentCandidates[j])
+		if hi != hj {
+			return hi < hj
+		}
+		return percentCandidates[i] < percentCandidates[j]
+	})
+	numPercent := int(math.Ceil(float64(len(percentCandidates)) * wave.Percent / 100))
+	inPercent := map[string]struct{}{}
+	for _, name := range percentCandidates[:numPercent] {
+		inPercent[name] = struct{}{}
+	}
+
+	status := RolloutStatus{Enabled: true, WaveServers: []string{}, PendingWaveServers: []string{}}
+	for _, sv := range candidates {
+		_, inServers := wave.Servers[*sv.HostName]
+		_, inCacheGroups := wave.CacheGroups[derefStr(sv.Cachegroup)]
+		_, inPercentage := inPercent[*sv.HostName]
+		if !inServers && !inCacheGroups && !inPercentage {
+			continue
+		}
+		status.WaveServers = append(status.WaveServers, *sv.HostName)
+		if *sv.HostName == hostName {
+			status.InWave = true
+			continue
+		}
+		if sv.UpdPending != nil && *sv.UpdPending && derefStr(sv.Status) != string(tc.CacheStatusOffline) {
+			status.PendingWaveServers = append(status.PendingWaveServers, *sv.HostName)
+		}
+	}
+	sort.Strings(status.WaveServers)
+	sort.Strings(status.PendingWaveServers)
+	return status
+}
+
+// rolloutHash returns the hash used to choose the percentage of servers in a rollout wave.
+func rolloutHash(hostName string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(hostName))
+	return h.Sum32()
+}
+
+func derefStr(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
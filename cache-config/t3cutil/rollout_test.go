@@ -0,0 +1,149 @@
+package t3cutil
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+)
+
+func makeTestRolloutServer(hostName string, cg string, cdn string, profile string, updPending bool) atscfg.Server {
+	sv := atscfg.Server{}
+	sv.HostName = util.StrPtr(hostName)
+	sv.Cachegroup = util.StrPtr(cg)
+	sv.CDNName = util.StrPtr(cdn)
+	sv.Profile = util.StrPtr(profile)
+	sv.Status = util.StrPtr(string(tc.CacheStatusReported))
+	sv.UpdPending = util.BoolPtr(updPending)
+	return sv
+}
+
+func TestMakeRolloutWave(t *testing.T) {
+	params := []tc.Parameter{
+		{ConfigFile: RolloutParamConfigFile, Name: RolloutParamWaveCacheGroups, Value: "cg0, cg1"},
+		{ConfigFile: RolloutParamConfigFile, Name: RolloutParamWaveServers, Value: "edge0"},
+		{ConfigFile: RolloutParamConfigFile, Name: RolloutParamWavePercent, Value: "10%"},
+		{ConfigFile: RolloutParamConfigFile, Name: "wave.unknown", Value: "1"},
+		{ConfigFile: "records.config", Name: RolloutParamWaveServers, Value: "edge1"},
+	}
+	wave, warnings := MakeRolloutWave(params)
+	if wave == nil {
+		t.Fatal("expected wave, actual nil")
+	}
+	expected := &RolloutWave{
+		CacheGroups: map[string]struct{}{"cg0": {}, "cg1": {}},
+		Servers:     map[string]struct{}{"edge0": {}},
+		Percent:     10,
+	}
+	if !reflect.DeepEqual(expected, wave) {
+		t.Errorf("expected %+v, actual %+v", expected, wave)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected 1 warning for the unknown parameter, actual %v", warnings)
+	}
+
+	if wave, _ := MakeRolloutWave(params[3:]); wave != nil {
+		t.Errorf("expected no wave without rollout wave parameters, actual %+v", wave)
+	}
+	if wave, warnings := MakeRolloutWave([]tc.Parameter{{ConfigFile: RolloutParamConfigFile, Name: RolloutParamWavePercent, Value: "110"}}); wave != nil || len(warnings) != 1 {
+		t.Errorf("expected no wave and a warning for an invalid percent, actual %+v %v", wave, warnings)
+	}
+}
+
+func TestMakeRolloutStatus(t *testing.T) {
+	servers := []atscfg.Server{
+		makeTestRolloutServer("edge0", "cg0", "cdn0", "profile0", true),
+		makeTestRolloutServer("edge1", "cg1", "cdn0", "profile0", false),
+		makeTestRolloutServer("edge2", "cg1", "cdn0", "profile0", true),
+		makeTestRolloutServer("edge3", "cg2", "cdn0", "profile0", true),
+		makeTestRolloutServer("edge4", "cg1", "cdn1", "profile0", true),
+		makeTestRolloutServer("edge5", "cg1", "cdn0", "profile1", true),
+		makeTestRolloutServer("edge6", "cg1", "cdn0", "profile0", true),
+	}
+	servers[6].Status = util.StrPtr(string(tc.CacheStatusOffline))
+
+	wave := &RolloutWave{
+		CacheGroups: map[string]struct{}{"cg1": {}},
+		Servers:     map[string]struct{}{"edge0": {}},
+	}
+
+	status := MakeRolloutStatus(&servers[3], servers, wave)
+	expected := RolloutStatus{
+		Enabled:            true,
+		InWave:             false,
+		WaveServers:        []string{"edge0", "edge1", "edge2", "edge6"},
+		PendingWaveServers: []string{"edge0", "edge2"},
+	}
+	if !reflect.DeepEqual(expected, status) {
+		t.Errorf("expected %+v, actual %+v", expected, status)
+	}
+
+	status = MakeRolloutStatus(&servers[0], servers, wave)
+	if !status.InWave || !reflect.DeepEqual(status.PendingWaveServers, []string{"edge2"}) {
+		t.Errorf("expected edge0 in wave waiting on edge2, actual %+v", status)
+	}
+}
+
+func TestMakeRolloutStatusPercent(t *testing.T) {
+	servers := []atscfg.Server{}
+	for i := 0; i < 20; i++ {
+		servers = append(servers, makeTestRolloutServer("edge"+strconv.Itoa(i), "cg0", "cdn0", "profile0", true))
+	}
+	wave := &RolloutWave{CacheGroups: map[string]struct{}{}, Servers: map[string]struct{}{}, Percent: 12}
+
+	status := MakeRolloutStatus(&servers[0], servers, wave)
+	if len(status.WaveServers) != 3 {
+		t.Fatalf("expected 12%% of 20 servers to round up to 3, actual %v", status.WaveServers)
+	}
+
+	// every server must compute the same wave, regardless of order
+	reversed := []atscfg.Server{}
+	for i := len(servers) - 1; i >= 0; i-- {
+		reversed = append(reversed, servers[i])
+	}
+	if other := MakeRolloutStatus(&servers[1], reversed, wave); !reflect.DeepEqual(status.WaveServers, other.WaveServers) {
+		t.Errorf("expected the same wave from every server, actual %v and %v", status.WaveServers, other.WaveServers)
+	}
+
+	// OFFLINE servers would never apply the update, so they must not fill the percentage
+	offline := map[string]struct{}{}
+	for _, name := range status.WaveServers {
+		offline[name] = struct{}{}
+	}
+	for i := range servers {
+		if _, ok := offline[*servers[i].HostName]; ok {
+			servers[i].Status = util.StrPtr(string(tc.CacheStatusOffline))
+		}
+	}
+	status = MakeRolloutStatus(&servers[0], servers, wave)
+	if len(status.WaveServers) != 3 {
+		t.Fatalf("expected 12%% of 17 servers not OFFLINE to round up to 3, actual %v", status.WaveServers)
+	}
+	for _, name := range status.WaveServers {
+		if _, ok := offline[name]; ok {
+			t.Errorf("expected OFFLINE server %v not in the percentage, actual wave %v", name, status.WaveServers)
+		}
+	}
+}
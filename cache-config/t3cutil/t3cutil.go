@@ -167,3 +167,24 @@ func DoInput(input []byte, cmdStr string, args ...string) ([]byte, []byte, int)
 
 	return outbuf.Bytes(), errbuf.Bytes(), code
 }
+
+// YAMLUnencodeFilter is UnencodeFilter for YAML config files.
+// It keeps each line's leading indentation, because YAML indentation
+// is significant, e.g. moving a records.yaml key to a different parent.
+func YAMLUnencodeFilter(body []string) []string {
+	newlines := make([]string, 0, len(body))
+	unencoded := UnencodeFilter(body)
+	for ii := range body {
+		indent := body[ii][:len(body[ii])-len(strings.TrimLeft(body[ii], " "))]
+		if unencoded[ii] == "" {
+			indent = ""
+		}
+		newlines = append(newlines, indent+unencoded[ii])
+	}
+	return newlines
+}
+
+// IsYAMLFile returns whether the file name is a YAML file, by its extension.
+func IsYAMLFile(fileName string) bool {
+	return strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml")
+}
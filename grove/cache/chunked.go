@@ -0,0 +1,348 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// ParentBody is the rest of the body of a chunked object, after its first chunk, being read from the parent.
+type ParentBody struct {
+	io.ReadCloser
+	// Cache is whether the object was cached, and its chunks should be stored as they're read.
+	Cache bool
+	// fill is the in-flight fill other requests for the object's chunks wait for, if it's cached.
+	fill *chunkFill
+	// key is the cache key the object is stored under, which may be a variant key, rather than the key it was requested with.
+	key string
+}
+
+// Close closes the body, and finishes its fill, so requests waiting for chunks it didn't read request them themselves.
+func (b *ParentBody) Close() error {
+	if b.fill != nil {
+		b.fill.Done()
+	}
+	return b.ReadCloser.Close()
+}
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// requestFirstChunk makes the given request, and returns its response code, headers, body, the request time, response time, and any error, like web.Request.
+//
+// If chunkSize isn't 0, and the response is a 200 to a GET larger than chunkSize, only the first chunkSize bytes of the body are read, and the rest of the body is returned unread. The caller must close it.
+func requestFirstChunk(transport *http.Transport, req *http.Request, chunkSize uint64) (int, http.Header, []byte, io.ReadCloser, time.Time, time.Time, error) {
+	resp, reqTime, respTime, err := web.RequestStream(transport, req)
+	if err != nil {
+		return 0, nil, nil, nil, reqTime, respTime, err
+	}
+
+	if chunkSize == 0 || req.Method != http.MethodGet || resp.StatusCode != http.StatusOK || (resp.ContentLength >= 0 && uint64(resp.ContentLength) <= chunkSize) {
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return 0, nil, nil, nil, reqTime, respTime, errors.New("reading response body: " + err.Error())
+		}
+		return resp.StatusCode, resp.Header, body, nil, reqTime, respTime, nil
+	}
+
+	body := make([]byte, chunkSize)
+	n, err := io.ReadFull(resp.Body, body)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		resp.Body.Close() // the body without a Content-Length fit in one chunk
+		return resp.StatusCode, resp.Header, body[:n], nil, reqTime, respTime, nil
+	} else if err != nil {
+		resp.Body.Close()
+		return 0, nil, nil, nil, reqTime, respTime, errors.New("reading response body: " + err.Error())
+	}
+	return resp.StatusCode, resp.Header, body, resp.Body, reqTime, respTime, nil
+}
+
+// setChunked makes obj, whose Body is the first chunk of a larger body, a chunked object. The size is the parent's Content-Length, or -1 if it had none.
+func setChunked(obj *cacheobj.CacheObj, cacheKey string, chunkSize uint64, size int64) {
+	obj.ChunkSize = chunkSize
+	obj.BodySize = size
+	obj.ChunkPrefix = cacheKey + cacheobj.ChunkKeySeparator + strconv.FormatInt(obj.ReqRespTime.UnixNano(), 36)
+}
+
+// chunkedBody writes the body of a chunked object, from its chunks in the cache, the rest of the body being read from the parent if this request fetched it, and new range requests to the parent for chunks which are in neither, storing the chunks it reads from the parent.
+// Chunks which aren't in the cache, but are being read from the parent by another request, are waited for, up to waitTimeout, rather than requested again.
+type chunkedBody struct {
+	obj         *cacheobj.CacheObj
+	cacheKey    string
+	cache       icache.Cache
+	fills       *chunkFills
+	waitTimeout time.Duration
+	retrier     rangeGetter
+	req         *http.Request
+	reqID       uint64
+	// parent is the body being read from the parent, if any, and parentChunk is the next chunk to be read from it.
+	parent      *ParentBody
+	parentChunk uint64
+}
+
+// rangeGetter requests a byte range of an object's body from the parent. It's implemented by Retrier.
+type rangeGetter interface {
+	GetRange(req *http.Request, obj *cacheobj.CacheObj, start int64, end int64) (io.ReadCloser, error)
+}
+
+// newChunkedBody creates a chunkedBody for obj, which is stored under cacheKey. The parent is the rest of the body being read from the parent, if this request fetched obj, or else nil; its key, if any, is used instead of cacheKey, because a fetched object may be stored under a variant key. The chunkedBody must be closed, whether or not it's written.
+func newChunkedBody(obj *cacheobj.CacheObj, cacheKey string, cache icache.Cache, fills *chunkFills, waitTimeout time.Duration, retrier rangeGetter, req *http.Request, parent *ParentBody, reqID uint64) *chunkedBody {
+	if parent != nil && parent.key != "" {
+		cacheKey = parent.key
+	}
+	return &chunkedBody{obj: obj, cacheKey: cacheKey, cache: cache, fills: fills, waitTimeout: waitTimeout, retrier: retrier, req: req, reqID: reqID, parent: parent, parentChunk: 1}
+}
+
+// Close closes the body being read from the parent, if any.
+func (b *chunkedBody) Close() {
+	if b.parent != nil {
+		b.parent.Close()
+		b.parent = nil
+	}
+}
+
+// WriteTo writes the bytes of the body from start to end inclusive to w. If end is negative, the body is written to its end. It returns the number of bytes written, and any error.
+func (b *chunkedBody) WriteTo(w io.Writer, start int64, end int64) (uint64, error) {
+	defer b.Close()
+	chunkSize := int64(b.obj.ChunkSize)
+	written := uint64(0)
+	for chunk := uint64(start / chunkSize); end < 0 || int64(chunk)*chunkSize <= end; chunk++ {
+		data, last, err := b.chunk(chunk, end)
+		if err == errRangeNotSatisfiable && b.obj.BodySize < 0 {
+			return written, nil // the previous chunk was the last, but it was exactly chunkSize
+		} else if err != nil {
+			return written, err
+		}
+
+		chunkStart := int64(chunk) * chunkSize
+		from := int64(0)
+		if start > chunkStart {
+			from = start - chunkStart
+		}
+		to := int64(len(data))
+		if end >= 0 && end-chunkStart+1 < to {
+			to = end - chunkStart + 1
+		}
+		if from < to {
+			n, err := w.Write(data[from:to])
+			written += uint64(n)
+			if err != nil {
+				return written, errors.New("writing chunk: " + err.Error())
+			}
+		}
+		if last {
+			break
+		}
+	}
+	return written, nil
+}
+
+// chunk returns the given chunk, and whether it's the last chunk of the body. The chunk is taken from the body being read from the parent, if it's that body's next chunk, or from the cache. If it's in neither, the chunks from it to the chunk containing end are requested from the parent.
+func (b *chunkedBody) chunk(chunk uint64, end int64) ([]byte, bool, error) {
+	chunkSize := int64(b.obj.ChunkSize)
+	for {
+		if b.parent != nil && chunk >= b.parentChunk {
+			data, last, err := b.readParentChunk()
+			if err != nil {
+				return nil, false, err
+			}
+			if b.parentChunk-1 == chunk {
+				return data, last, nil
+			}
+			if last {
+				return nil, true, nil // the body ended before the requested chunk
+			}
+			continue // a chunk before the requested one, which was read to fill the cache
+		}
+
+		if chunk == 0 {
+			return b.obj.Body, int64(len(b.obj.Body)) < chunkSize, nil
+		}
+		if data, last, ok := b.cachedChunk(chunk); ok {
+			return data, last, nil
+		}
+		if b.fills.Wait(b.obj.ChunkPrefix, chunk, b.waitTimeout) {
+			log.Debugf("chunk %v of '%v' read by another request (reqid %v)\n", chunk, b.cacheKey, b.reqID)
+		}
+		if data, last, ok := b.cachedChunk(chunk); ok {
+			return data, last, nil
+		}
+
+		log.Debugf("chunk %v of '%v' not in cache, requesting from parent (reqid %v)\n", chunk, b.cacheKey, b.reqID)
+		b.Close()
+		rangeStart := int64(chunk) * chunkSize
+		rangeEnd := int64(-1)
+		if end >= 0 {
+			rangeEnd = (end/chunkSize+1)*chunkSize - 1
+		}
+		if b.obj.BodySize >= 0 && (rangeEnd < 0 || rangeEnd >= b.obj.BodySize) {
+			rangeEnd = b.obj.BodySize - 1
+		}
+		body, err := b.retrier.GetRange(b.req, b.obj, rangeStart, rangeEnd)
+		if err != nil {
+			return nil, false, err
+		}
+		lastChunk := int64(-1)
+		if rangeEnd >= 0 {
+			lastChunk = rangeEnd / chunkSize
+		}
+		b.parent = &ParentBody{ReadCloser: body, Cache: true, fill: b.fills.Start(b.obj.ChunkPrefix, chunk, lastChunk), key: b.cacheKey}
+		b.parentChunk = chunk
+	}
+}
+
+// cachedChunk returns the given chunk from the cache, whether it's the last chunk of the body, and whether it was in the cache.
+func (b *chunkedBody) cachedChunk(chunk uint64) ([]byte, bool, bool) {
+	obj, ok := b.cache.Get(b.obj.ChunkKey(chunk))
+	if !ok {
+		return nil, false, false
+	}
+	chunkSize := int64(b.obj.ChunkSize)
+	return obj.Body, int64(len(obj.Body)) < chunkSize || (b.obj.BodySize >= 0 && int64(chunk+1)*chunkSize >= b.obj.BodySize), true
+}
+
+// readParentChunk reads the next chunk from the body being read from the parent, and stores it in the cache if the object is cached. It returns the chunk, whether it's the last chunk of the body, and any error.
+func (b *chunkedBody) readParentChunk() ([]byte, bool, error) {
+	chunk := b.parentChunk
+	data := make([]byte, b.obj.ChunkSize)
+	n, err := io.ReadFull(b.parent, data)
+	data = data[:n]
+	last := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !last {
+		return nil, false, fmt.Errorf("reading chunk %v from parent: %v", chunk, err)
+	}
+
+	read := int64(chunk)*int64(b.obj.ChunkSize) + int64(n)
+	if b.obj.BodySize >= 0 {
+		if read > b.obj.BodySize || (last && read != b.obj.BodySize) {
+			return nil, false, fmt.Errorf("parent body size %v doesn't match Content-Length %v", read, b.obj.BodySize)
+		}
+		last = read == b.obj.BodySize
+	}
+	b.parentChunk++
+
+	cache := b.parent.Cache
+	if cache && n > 0 {
+		b.cache.Add(b.obj.ChunkKey(chunk), cacheobj.NewChunk(data))
+	}
+	if b.parent.fill != nil {
+		b.parent.fill.Read(chunk)
+	}
+	if last {
+		key := b.parent.key // Close clears the parent
+		b.Close()
+		if cache && b.obj.BodySize < 0 {
+			b.completeBodySize(key, read)
+		}
+	}
+	return data, last, nil
+}
+
+// completeBodySize stores the object under the given key with its body size, once the whole body of an object with no Content-Length has been read. The object isn't stored until then, because its chunks can't be served by range without knowing the size.
+func (b *chunkedBody) completeBodySize(key string, size int64) {
+	obj := *b.obj // must copy, because this cache object may be concurrently read by other goroutines
+	obj.BodySize = size
+	obj.RespHeaders = web.CopyHeader(obj.RespHeaders)
+	obj.RespHeaders.Set("Content-Length", strconv.FormatInt(size, 10))
+	b.cache.Add(key, &obj)
+}
+
+// chunkedRange returns the code, headers, and body byte range to respond with to a request with the given headers, for the given chunked object and its response headers. A single satisfiable Range is served as a 206, any other Range is ignored, unless it's unsatisfiable. The returned end is -1 if the body size isn't known, in which case Range is ignored.
+func chunkedRange(reqHdr http.Header, obj *cacheobj.CacheObj, respHdr http.Header) (int, http.Header, int64, int64) {
+	hdr := web.CopyHeader(respHdr)
+	size := obj.BodySize
+	if size < 0 {
+		hdr.Del("Content-Length")
+		return obj.Code, hdr, 0, -1
+	}
+	hdr.Set("Accept-Ranges", "bytes")
+	hdr.Set("Content-Length", strconv.FormatInt(size, 10))
+
+	rangeHdr := reqHdr.Get("Range")
+	if rangeHdr == "" || reqHdr.Get("If-Range") != "" {
+		return obj.Code, hdr, 0, size - 1
+	}
+	start, end, ok := parseRange(rangeHdr, size)
+	if !ok {
+		return obj.Code, hdr, 0, size - 1
+	}
+	if start < 0 {
+		hdr.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		hdr.Set("Content-Length", "0")
+		return http.StatusRequestedRangeNotSatisfiable, hdr, 0, -1
+	}
+	hdr.Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10)+"/"+strconv.FormatInt(size, 10))
+	hdr.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	return http.StatusPartialContent, hdr, start, end
+}
+
+// parseRange parses a Range header with a single byte range, for a body of the given size. It returns false if the header isn't a single byte range, and a negative start if the range isn't satisfiable.
+func parseRange(rangeHdr string, size int64) (int64, int64, bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(rangeHdr, prefix) || strings.Contains(rangeHdr, ",") {
+		return 0, 0, false
+	}
+	rangeStr := strings.TrimSpace(rangeHdr[len(prefix):])
+	dash := strings.Index(rangeStr, "-")
+	if dash < 0 {
+		return 0, 0, false
+	}
+	startStr, endStr := strings.TrimSpace(rangeStr[:dash]), strings.TrimSpace(rangeStr[dash+1:])
+
+	if startStr == "" {
+		suffix, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false
+		}
+		if suffix == 0 || size == 0 {
+			return -1, -1, true
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	end := size - 1
+	if endStr != "" {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return -1, -1, true
+	}
+	return start, end, true
+}
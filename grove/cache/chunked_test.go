@@ -0,0 +1,221 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/memcache"
+)
+
+func TestChunkedBody(t *testing.T) {
+	body := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	chunkSize := uint64(10)
+	cache := memcache.New(1024 * 1024)
+	defer cache.Close()
+
+	obj := cacheobj.New(http.Header{}, body[:chunkSize], http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now())
+	setChunked(obj, "key", chunkSize, int64(len(body)))
+
+	parent := &ParentBody{ReadCloser: ioutil.NopCloser(bytes.NewReader(body[chunkSize:])), Cache: true}
+	buf := &bytes.Buffer{}
+	written, err := newChunkedBody(obj, "key", cache, newChunkFills(), 0, nil, nil, parent, 0).WriteTo(buf, 0, -1)
+	if err != nil {
+		t.Fatalf("writing body from parent: %v", err)
+	}
+	if written != uint64(len(body)) || !bytes.Equal(buf.Bytes(), body) {
+		t.Fatalf("expected body '%s' written from parent, actual '%s' (%v bytes)", body, buf.Bytes(), written)
+	}
+
+	for chunk := uint64(1); chunk < 4; chunk++ {
+		if _, ok := cache.Peek(obj.ChunkKey(chunk)); !ok {
+			t.Errorf("expected chunk %v to be stored", chunk)
+		}
+	}
+
+	// all chunks are cached, so no parent request is made
+	buf = &bytes.Buffer{}
+	if _, err := newChunkedBody(obj, "key", cache, newChunkFills(), 0, nil, nil, nil, 0).WriteTo(buf, 5, 24); err != nil {
+		t.Fatalf("writing range from cache: %v", err)
+	}
+	if expected := body[5:25]; !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("expected range '%s' written from cache, actual '%s'", expected, buf.Bytes())
+	}
+}
+
+func TestChunkedBodyShortParent(t *testing.T) {
+	body := []byte("0123456789abcdefghij")
+	cache := memcache.New(1024 * 1024)
+	defer cache.Close()
+
+	obj := cacheobj.New(http.Header{}, body[:10], http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now())
+	setChunked(obj, "key", 10, 30)
+
+	parent := &ParentBody{ReadCloser: ioutil.NopCloser(bytes.NewReader(body[10:])), Cache: true}
+	if _, err := newChunkedBody(obj, "key", cache, newChunkFills(), 0, nil, nil, parent, 0).WriteTo(ioutil.Discard, 0, -1); err == nil {
+		t.Error("expected error for parent body shorter than its Content-Length")
+	}
+}
+
+func TestChunkedBodyUnknownSize(t *testing.T) {
+	body := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	cache := memcache.New(1024 * 1024)
+	defer cache.Close()
+
+	obj := cacheobj.New(http.Header{}, body[:10], http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now())
+	setChunked(obj, "variant-key", 10, -1)
+
+	// the object is stored under the parent's variant key, not the key it was requested with
+	parent := &ParentBody{ReadCloser: ioutil.NopCloser(bytes.NewReader(body[10:])), Cache: true, key: "variant-key"}
+	buf := &bytes.Buffer{}
+	if _, err := newChunkedBody(obj, "key", cache, newChunkFills(), 0, nil, nil, parent, 0).WriteTo(buf, 0, -1); err != nil {
+		t.Fatalf("writing body of unknown size from parent: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), body) {
+		t.Fatalf("expected body '%s' written from parent, actual '%s'", body, buf.Bytes())
+	}
+
+	stored, ok := cache.Peek("variant-key")
+	if !ok {
+		t.Fatal("expected the object to be stored once its whole body was read")
+	}
+	if stored.BodySize != int64(len(body)) {
+		t.Errorf("expected stored body size %v, actual %v", len(body), stored.BodySize)
+	}
+	if cl := stored.RespHeaders.Get("Content-Length"); cl != strconv.Itoa(len(body)) {
+		t.Errorf("expected stored Content-Length %v, actual '%v'", len(body), cl)
+	}
+	if obj.BodySize != -1 {
+		t.Errorf("expected the object being read to be unchanged, actual body size %v", obj.BodySize)
+	}
+}
+
+// testRangeGetter serves ranges of body, as the parent would.
+type testRangeGetter struct {
+	body   []byte
+	ranges [][2]int64
+}
+
+func (g *testRangeGetter) GetRange(req *http.Request, obj *cacheobj.CacheObj, start int64, end int64) (io.ReadCloser, error) {
+	g.ranges = append(g.ranges, [2]int64{start, end})
+	if end < 0 || end >= int64(len(g.body)) {
+		end = int64(len(g.body)) - 1
+	}
+	return ioutil.NopCloser(bytes.NewReader(g.body[start : end+1])), nil
+}
+
+func TestChunkedBodyUnknownSizeRange(t *testing.T) {
+	body := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	cache := memcache.New(1024 * 1024)
+	defer cache.Close()
+
+	obj := cacheobj.New(http.Header{}, body[:10], http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now())
+	setChunked(obj, "variant-key", 10, -1)
+
+	// the rest of the body isn't being read from the parent, so it's requested by range
+	getter := &testRangeGetter{body: body}
+	buf := &bytes.Buffer{}
+	if _, err := newChunkedBody(obj, "variant-key", cache, newChunkFills(), 0, getter, nil, nil, 0).WriteTo(buf, 0, -1); err != nil {
+		t.Fatalf("writing body of unknown size by range: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), body) {
+		t.Fatalf("expected body '%s' written by range, actual '%s'", body, buf.Bytes())
+	}
+	if expected := [][2]int64{{10, -1}}; !reflect.DeepEqual(expected, getter.ranges) {
+		t.Errorf("expected ranges %v requested, actual %v", expected, getter.ranges)
+	}
+
+	if _, ok := cache.Peek(""); ok {
+		t.Error("expected the object not to be stored under the empty key")
+	}
+	stored, ok := cache.Peek("variant-key")
+	if !ok {
+		t.Fatal("expected the object to be stored under its key once its whole body was read by range")
+	}
+	if stored.BodySize != int64(len(body)) {
+		t.Errorf("expected stored body size %v, actual %v", len(body), stored.BodySize)
+	}
+}
+
+func TestPurgeChunked(t *testing.T) {
+	body := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	cache := memcache.New(1024 * 1024)
+	defer cache.Close()
+
+	obj := cacheobj.New(http.Header{}, body[:10], http.StatusOK, http.StatusOK, "", http.Header{"Surrogate-Key": {"a b"}}, time.Now(), time.Now(), time.Now(), time.Now())
+	setChunked(obj, "key", 10, int64(len(body)))
+	parent := &ParentBody{ReadCloser: ioutil.NopCloser(bytes.NewReader(body[10:])), Cache: true}
+	if _, err := newChunkedBody(obj, "key", cache, newChunkFills(), 0, nil, nil, parent, 0).WriteTo(ioutil.Discard, 0, -1); err != nil {
+		t.Fatalf("writing body from parent: %v", err)
+	}
+	cache.Add("key", obj)
+	if !obj.HasTag("b") {
+		t.Errorf("expected tag 'b' from the Surrogate-Key header, actual tags %v", obj.Tags)
+	}
+
+	if !icache.Purge(cache, "key", true) {
+		t.Fatal("expected soft purge to find the object")
+	}
+	if invalidated, ok := cache.Peek("key"); !ok || !invalidated.Invalidated {
+		t.Error("expected soft purge to keep the object, invalidated")
+	}
+	if _, ok := cache.Peek(obj.ChunkKey(1)); !ok {
+		t.Error("expected soft purge to keep the object's chunks")
+	}
+
+	if !icache.Purge(cache, "key", false) {
+		t.Fatal("expected purge to find the object")
+	}
+	if keys := cache.Keys(); len(keys) != 0 {
+		t.Errorf("expected purge to remove the object and its chunks, actual remaining keys %v", keys)
+	}
+	if icache.Purge(cache, "key", false) {
+		t.Error("expected purge of a missing object to return false")
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	size := int64(100)
+	tests := []struct {
+		hdr   string
+		start int64
+		end   int64
+		ok    bool
+	}{
+		{"bytes=0-9", 0, 9, true},
+		{"bytes=90-", 90, 99, true},
+		{"bytes=-10", 90, 99, true},
+		{"bytes=50-200", 50, 99, true},
+		{"bytes=100-", -1, -1, true},
+		{"bytes=0-9,20-29", 0, 0, false},
+		{"bytes=9-0", 0, 0, false},
+		{"items=0-9", 0, 0, false},
+	}
+	for _, test := range tests {
+		start, end, ok := parseRange(test.hdr, size)
+		if ok != test.ok || (ok && (start != test.start || end != test.end)) {
+			t.Errorf("parseRange('%v') expected %v %v %v, actual %v %v %v", test.hdr, test.start, test.end, test.ok, start, end, ok)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"sync"
+	"time"
+)
+
+// chunkFills tracks the in-flight reads of chunked objects' bodies from the parent, so concurrent requests for chunks which are being read can wait for them to be stored in the cache, rather than each requesting them from the parent.
+type chunkFills struct {
+	// fills is a map of chunked objects' ChunkPrefix to their in-flight fills. A single object may have multiple fills, of different ranges of its body.
+	fills map[string]map[*chunkFill]struct{}
+	m     sync.Mutex
+}
+
+// chunkFill is a single in-flight read of a range of a chunked object's body from the parent, by one request, which stores each chunk in the cache as it's read.
+type chunkFill struct {
+	fills  *chunkFills
+	prefix string
+	first  uint64
+	last   int64 // the last chunk which will be read, or -1 if the body is read to its end
+	next   uint64
+	done   bool
+	// progress is closed and replaced whenever next or done changes, to signal waiters.
+	progress chan struct{}
+}
+
+func newChunkFills() *chunkFills {
+	return &chunkFills{fills: map[string]map[*chunkFill]struct{}{}}
+}
+
+// Start adds an in-flight fill of the object with the given chunk prefix, of the chunks from first to last inclusive, or to the end of the body if last is negative. The fill must be finished with Done.
+func (f *chunkFills) Start(prefix string, first uint64, last int64) *chunkFill {
+	fill := &chunkFill{fills: f, prefix: prefix, first: first, last: last, next: first, progress: make(chan struct{})}
+	f.m.Lock()
+	defer f.m.Unlock()
+	if _, ok := f.fills[prefix]; !ok {
+		f.fills[prefix] = map[*chunkFill]struct{}{}
+	}
+	f.fills[prefix][fill] = struct{}{}
+	return fill
+}
+
+// Read records that the given chunk was read, and stored in the cache if the object is cached, and wakes requests waiting for it.
+func (c *chunkFill) Read(chunk uint64) {
+	c.fills.m.Lock()
+	defer c.fills.m.Unlock()
+	c.next = chunk + 1
+	close(c.progress)
+	c.progress = make(chan struct{})
+}
+
+// Done removes the fill, and wakes requests waiting for chunks it will no longer read. It may be called multiple times.
+func (c *chunkFill) Done() {
+	c.fills.m.Lock()
+	defer c.fills.m.Unlock()
+	if c.done {
+		return
+	}
+	c.done = true
+	close(c.progress)
+	delete(c.fills.fills[c.prefix], c)
+	if len(c.fills.fills[c.prefix]) == 0 {
+		delete(c.fills.fills, c.prefix)
+	}
+}
+
+// covers returns whether the fill has read or will read the given chunk. It must be called with the fills locked.
+func (c *chunkFill) covers(chunk uint64) bool {
+	return chunk >= c.first && (c.last < 0 || chunk <= uint64(c.last))
+}
+
+// Wait waits for an in-flight fill of the object with the given chunk prefix to read the given chunk, up to the given timeout, or with no limit if the timeout is 0. It returns whether a fill read the chunk. If it returns false, there's no fill which will read the chunk, or the timeout was reached, and the caller should request the chunk itself.
+func (f *chunkFills) Wait(prefix string, chunk uint64, timeout time.Duration) bool {
+	timeoutChan := (<-chan time.Time)(nil) // nil blocks forever
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	for {
+		progress := (chan struct{})(nil)
+		f.m.Lock()
+		for fill := range f.fills[prefix] {
+			if !fill.covers(chunk) {
+				continue
+			}
+			if fill.next > chunk {
+				f.m.Unlock()
+				return true
+			}
+			progress = fill.progress
+			break
+		}
+		f.m.Unlock()
+
+		if progress == nil {
+			return false
+		}
+		select {
+		case <-progress:
+		case <-timeoutChan:
+			return false
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChunkFillsWait(t *testing.T) {
+	fills := newChunkFills()
+	fill := fills.Start("prefix", 1, 3)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		fill.Read(1)
+		fill.Read(2)
+	}()
+	if !fills.Wait("prefix", 2, time.Second) {
+		t.Error("expected Wait to return true when the fill reads the chunk")
+	}
+	if fills.Wait("prefix", 4, time.Second) {
+		t.Error("expected Wait to return false for a chunk the fill won't read")
+	}
+	if fills.Wait("other", 1, time.Second) {
+		t.Error("expected Wait to return false for an object with no fill")
+	}
+	if fills.Wait("prefix", 3, 10*time.Millisecond) {
+		t.Error("expected Wait to return false when the timeout is reached")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		fill.Done()
+	}()
+	if fills.Wait("prefix", 3, time.Second) {
+		t.Error("expected Wait to return false when the fill is done without reading the chunk")
+	}
+	if len(fills.fills) != 0 {
+		t.Errorf("expected done fill to be removed, actual %v fills", len(fills.fills))
+	}
+}
@@ -18,14 +18,18 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/apache/trafficcontrol/grove/cachedata"
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/plugin"
 
 	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/remapdata"
 	"github.com/apache/trafficcontrol/grove/stat"
 	"github.com/apache/trafficcontrol/grove/thread"
 	"github.com/apache/trafficcontrol/grove/web"
@@ -34,6 +38,12 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-rfc"
 )
 
+// MethodPurge is the HTTP method of requests to purge the requested object from the cache. Only clients allowed by the stats rules may purge.
+const MethodPurge = "PURGE"
+
+// SoftPurgeHeader is the request header which, if "true", makes a purge invalidate the object rather than removing it, so it's revalidated with the parent before it's reused.
+const SoftPurgeHeader = "X-Grove-Soft-Purge"
+
 type HandlerPointer struct {
 	realHandler *unsafe.Pointer
 }
@@ -69,6 +79,10 @@ type Handler struct {
 	httpConns       *web.ConnMap
 	httpsConns      *web.ConnMap
 	interfaceName   string
+	chunkSize       uint64
+	fills           *chunkFills
+	revalidations   *revalidations
+	collapseTimeout time.Duration
 	requestID       uint64 // Atomic - DO NOT access or modify without atomic operations
 	// keyThrottlers     Throttlers
 	// nocacheThrottlers Throttlers
@@ -97,6 +111,10 @@ type Handler struct {
 // Example: Origin limit is 10,000, key limit is 1, the uncacheable limit is 1,000.
 // Then, 2,000 requests come in for the same URL, simultaneously. They are all within the Origin limit, so they are all allowed to proceed to the key limiter. Then, the first request is allowed to make an actual request to the origin, while the other 1,999 wait at the key limiter.
 //
+// The chunkSize parameter is the size of the chunks in which response bodies larger than it are streamed to clients and stored in the cache. If it's 0, bodies are never chunked, and are read in full before responding.
+//
+// Concurrent cache misses for the same cache key are collapsed into a single parent request, whose response is given to all of them. Requests for chunks of a chunked object which are being read from the parent wait for them to be stored, rather than requesting them again. The collapseTimeout is the longest a request waits for another request's response or chunk, before making its own parent request. If it's 0, requests wait indefinitely.
+//
 // The connectionClose parameter determines whether to send a `Connection: close` header. This is primarily designed for maintenance, to drain the cache of incoming requestors. This overrides rule-specific `connection-close: false` configuration, under the assumption that draining a cache is a temporary maintenance operation, and if connectionClose is true on the service and false on some rules, those rules' configuration is probably a permament setting whereas the operator probably wants to drain all connections if the global setting is true. If it's necessary to leave connection close false on some rules, set all other rules' connectionClose to true and leave the global connectionClose unset.
 func NewHandler(
 	remapper remap.HTTPRequestRemapper,
@@ -112,6 +130,8 @@ func NewHandler(
 	httpConns *web.ConnMap,
 	httpsConns *web.ConnMap,
 	interfaceName string,
+	chunkSize uint64,
+	collapseTimeout time.Duration,
 ) *Handler {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -120,7 +140,7 @@ func NewHandler(
 
 	return &Handler{
 		remapper:        remapper,
-		getter:          thread.NewGetter(),
+		getter:          thread.NewGetter(collapseTimeout),
 		ruleThrottlers:  makeRuleThrottlers(remapper, ruleLimit),
 		strictRFC:       strictRFC,
 		scheme:          scheme,
@@ -134,6 +154,10 @@ func NewHandler(
 		httpConns:       httpConns,
 		httpsConns:      httpsConns,
 		interfaceName:   interfaceName,
+		chunkSize:       chunkSize,
+		fills:           newChunkFills(),
+		revalidations:   newRevalidations(),
+		collapseTimeout: collapseTimeout,
 		// keyThrottlers:     NewThrottlers(keyLimit),
 		// nocacheThrottlers: NewThrottlers(nocacheLimit),
 	}
@@ -189,6 +213,10 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err == nil && remappingProducer.NormalizeAcceptEncoding() {
+		web.NormalizeAcceptEncoding(r.Header) // before copying, so the normalized header is both sent to the parent and selects the variant
+	}
+
 	reqHeader := web.CopyHeader(r.Header) // copy request header, because it's not guaranteed valid after actually issuing the request
 	clientIP, _ := web.GetClientIPPort(r)
 
@@ -223,25 +251,45 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	connectionClose := h.connectionClose || remappingProducer.ConnectionClose()
 
+	if r.Method == MethodPurge {
+		remappingProducer.OverrideCacheKey(remappingProducer.MethodCacheKey(http.MethodGet)) // purge the object a GET of the same URI would get
+	}
+
 	beforeCacheLookUpData := plugin.BeforeCacheLookUpData{Req: r, DefaultCacheKey: remappingProducer.CacheKey(), CacheKeyOverrideFunc: remappingProducer.OverrideCacheKey}
 	h.plugins.OnBeforeCacheLookup(remappingProducer.PluginCfg(), pluginContext, beforeCacheLookUpData)
 
 	cacheKey := remappingProducer.CacheKey()
+	if r.Method == MethodPurge {
+		h.purge(responder, r, remappingProducer.Cache(), cacheKey, connectionClose, reqID)
+		return
+	}
+
 	retrier := NewRetrier(h, reqHeader, reqTime, reqCacheControl, remappingProducer, reqID)
 
 	cache := remappingProducer.Cache()
 
 	var reqHost *string
+	parentBody := (*ParentBody)(nil)
+	defer func() {
+		if parentBody != nil {
+			parentBody.Close()
+		}
+	}()
 	cacheObj, ok := cache.Get(cacheKey)
+	if ok && cacheObj.IsVariantIndex() {
+		cacheObj, cacheKey = lookupVariant(cache, cacheKey, cacheObj, reqHeader)
+		ok = cacheObj != nil
+		remappingProducer.OverrideCacheKey(cacheKey) // so a fetched variant is stored under its variant key
+	}
 	if !ok {
 		log.Debugf("cache.Handler.ServeHTTP: '%v' not in cache (reqid %v)\n", cacheKey, reqID)
 		beforeParentRequestData := plugin.BeforeParentRequestData{Req: r, RemapRule: remappingProducer.Name()}
 		h.plugins.OnBeforeParentRequest(remappingProducer.PluginCfg(), pluginContext, beforeParentRequestData)
-		cacheObj, reqHost, err = retrier.Get(r, nil)
+		cacheObj, parentBody, reqHost, err = retrier.Get(r, nil)
 		if err != nil {
 			log.Errorf("retrying get error (in uncached): %v (reqid %v)\n", err, reqID)
 			responder.OriginConnectFailed = true
-			responder.ProxyStr = cacheObj.ProxyURL
+			setRetryErrCode(responder, err)
 			if reqHost != nil {
 				responder.ToFQDN = *reqHost
 			}
@@ -260,12 +308,16 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
 		h.plugins.OnBeforeRespond(remappingProducer.PluginCfg(), pluginContext, beforeRespData)
+		if cacheObj.Chunked() && codePtr == cacheObj.Code {
+			h.setChunkedResponse(responder, reqHeader, cacheObj, cacheKey, cache, retrier, r, parentBody, &hdrsPtr, connectionClose, reqID)
+			parentBody = nil
+		}
 		responder.Do()
 		return
 	}
 
 	reqHeaders := r.Header
-	canReuseStored := rfc.CanReuseStored(reqHeaders, cacheObj.RespHeaders, reqCacheControl, cacheObj.RespCacheControl, cacheObj.ReqHeaders, cacheObj.ReqRespTime, cacheObj.RespRespTime, h.strictRFC)
+	canReuseStored := cacheobj.Reuse(reqHeaders, reqCacheControl, cacheObj, h.strictRFC)
 
 	if canReuseStored != rfc.ReuseCan { // run the BeforeParentRequest hook for revalidations / ReuseCannot
 		beforeParentRequestData := plugin.BeforeParentRequestData{Req: r, RemapRule: remappingProducer.Name()}
@@ -277,28 +329,40 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Debugf("cache.Handler.ServeHTTP: '%v' cache hit! (reqid %v)\n", cacheKey, reqID)
 	case rfc.ReuseCannot:
 		log.Debugf("cache.Handler.ServeHTTP: '%v' can't reuse (reqid %v)\n", cacheKey, reqID)
-		cacheObj, reqHost, err = retrier.Get(r, nil)
+		cacheObj, parentBody, reqHost, err = retrier.Get(r, nil)
 		if err != nil {
 			log.Errorf("retrying get error (in reuse-cannot): %v (reqid %v)\n", err, reqID)
+			setRetryErrCode(responder, err)
 			responder.Do()
 			return
 		}
-	case rfc.ReuseMustRevalidate:
-		log.Debugf("cache.Handler.ServeHTTP: '%v' must revalidate (reqid %v)\n", cacheKey, reqID)
-		cacheObj, reqHost, err = retrier.Get(r, cacheObj)
-		if err != nil {
+	case rfc.ReuseMustRevalidate, rfc.ReuseMustRevalidateCanStale:
+		if cacheobj.CanStaleWhileRevalidate(cacheObj, remappingProducer.StaleWhileRevalidate()) {
+			log.Debugf("cache.Handler.ServeHTTP: '%v' must revalidate - serving stale while revalidating (reqid %v)\n", cacheKey, reqID)
+			h.revalidate(retrier, r, cacheObj, cacheKey, reqID)
+			responder.Stale = cachedata.StaleWhileRevalidate
+			break
+		}
+		log.Debugf("cache.Handler.ServeHTTP: '%v' must revalidate (can stale %v) (reqid %v)\n", cacheKey, canReuseStored == rfc.ReuseMustRevalidateCanStale, reqID)
+		staleObj := cacheObj
+		cacheObj, parentBody, reqHost, err = retrier.Get(r, cacheObj)
+		if (err != nil || cacheobj.IsStaleIfErrorCode(cacheObj.Code)) && cacheobj.CanStaleIfError(reqCacheControl, staleObj, remappingProducer.StaleIfError()) {
+			log.Errorf("revalidating '%v' failed - serving stale if error: %v (reqid %v)\n", cacheKey, err, reqID)
+			if parentBody != nil {
+				parentBody.Close()
+				parentBody = nil
+			}
+			cacheObj = staleObj
+			responder.Stale = cachedata.StaleIfError
+		} else if err != nil && canReuseStored == rfc.ReuseMustRevalidateCanStale {
+			log.Errorf("retrying get error - serving stale as allowed: %v (reqid %v)\n", err, reqID)
+			cacheObj = staleObj
+		} else if err != nil {
 			log.Errorf("retrying get error: %v (reqid %v)\n", err, reqID)
+			setRetryErrCode(responder, err)
 			responder.Do()
 			return
 		}
-	case rfc.ReuseMustRevalidateCanStale:
-		log.Debugf("cache.Handler.ServeHTTP: '%v' must revalidate (but allowed stale) (reqid %v)\n", cacheKey, reqID)
-		oldCacheObj := cacheObj
-		cacheObj, reqHost, err = retrier.Get(r, cacheObj)
-		if err != nil {
-			log.Errorf("retrying get error - serving stale as allowed: %v (reqid %v)\n", err, reqID)
-			cacheObj = oldCacheObj
-		}
 	}
 	log.Debugf("cache.Handler.ServeHTTP: '%v' responding with %v (reqid %v)\n", cacheKey, cacheObj.Code, reqID)
 
@@ -315,5 +379,64 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
 	h.plugins.OnBeforeRespond(remappingProducer.PluginCfg(), pluginContext, beforeRespData)
+	if cacheObj.Chunked() && codePtr == cacheObj.Code {
+		h.setChunkedResponse(responder, reqHeader, cacheObj, cacheKey, cache, retrier, r, parentBody, &hdrsPtr, connectionClose, reqID)
+		parentBody = nil
+	}
+	responder.Do()
+}
+
+// setRetryErrCode sets the response code for the given error getting an object from the parents. If every parent is marked down, the response is a Bad Gateway.
+func setRetryErrCode(responder *Responder, err error) {
+	if err == remapdata.ErrAllParentsDown {
+		*responder.ResponseCode = http.StatusBadGateway
+	}
+}
+
+// purge removes the object with the given cache key from the cache, or invalidates it if the request has the SoftPurgeHeader, and responds with a 200 if it existed, or a 404 if it didn't.
+func (h *Handler) purge(responder *Responder, r *http.Request, cache icache.Cache, cacheKey string, connectionClose bool, reqID uint64) {
+	code := http.StatusOK
+	if ip, err := web.GetIP(r); err != nil {
+		log.Errorf("purge: getting client IP: %v (reqid %v)\n", err, reqID)
+		code = http.StatusInternalServerError
+	} else if !h.remapper.StatRules().Allowed(ip) {
+		log.Debugf("purge: IP %v not allowed (reqid %v)\n", ip, reqID)
+		code = http.StatusForbidden
+	} else if soft := strings.ToLower(r.Header.Get(SoftPurgeHeader)) == "true"; !icache.Purge(cache, cacheKey, soft) {
+		code = http.StatusNotFound
+	} else {
+		log.Infof("purged '%v' soft %v (reqid %v)\n", cacheKey, soft, reqID)
+	}
+	hdrs := http.Header{}
+	body := []byte(nil)
+	responder.SetResponse(&code, &hdrs, &body, connectionClose)
 	responder.Do()
 }
+
+// setChunkedResponse sets the responder to write the body of the chunked cacheObj, from its chunks in the cache, the given parentBody if this request fetched the object, and range requests to the parent for missing chunks. The response is a 206 if the client requested a single satisfiable range. The hdrs are the response headers after plugins.
+// This is only done if plugins didn't change the response code, for example to a 304, in which case the response set by plugins is sent as-is. The responder takes ownership of parentBody.
+func (h *Handler) setChunkedResponse(
+	responder *Responder,
+	reqHeader http.Header,
+	cacheObj *cacheobj.CacheObj,
+	cacheKey string,
+	cache icache.Cache,
+	retrier *Retrier,
+	r *http.Request,
+	parentBody *ParentBody,
+	hdrs *http.Header,
+	connectionClose bool,
+	reqID uint64,
+) {
+	code, respHdrs, start, end := chunkedRange(reqHeader, cacheObj, *hdrs)
+	if code == http.StatusRequestedRangeNotSatisfiable {
+		if parentBody != nil {
+			parentBody.Close()
+		}
+		body := []byte(nil)
+		responder.SetResponse(&code, &respHdrs, &body, connectionClose)
+		return
+	}
+	body := newChunkedBody(cacheObj, cacheKey, cache, h.fills, h.collapseTimeout, retrier, r, parentBody, reqID)
+	responder.SetChunkedResponse(&code, &respHdrs, body, start, end, connectionClose)
+}
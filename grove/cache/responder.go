@@ -15,6 +15,7 @@ package cache
 */
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/apache/trafficcontrol/grove/cachedata"
@@ -88,6 +89,18 @@ func (r *Responder) SetResponse(code *int, hdrs *http.Header, body *[]byte, conn
 	}
 }
 
+// SetChunkedResponse is like SetResponse, but writes the bytes from start to end inclusive of the body of a chunked object, which are read from the cache and the parent as they're written. If end is negative, the body is written to its end.
+func (r *Responder) SetChunkedResponse(code *int, hdrs *http.Header, body *chunkedBody, start int64, end int64, connectionClose bool) {
+	r.ResponseCode = code
+	r.F = func() (uint64, error) {
+		if r.Req.Method == http.MethodHead {
+			return web.Respond(r.W, *code, *hdrs, nil, connectionClose)
+		}
+		writeBody := func(w io.Writer) (uint64, error) { return body.WriteTo(w, start, end) }
+		return web.RespondStream(r.W, *code, *hdrs, writeBody, connectionClose)
+	}
+}
+
 // Do responds to the client, according to the data in r, with the given code, headers, and body. It additionally writes to the event log, and adds statistics about this request. This should always be called for the final response to a client, in order to properly log, stat, and other final operations.
 // For cache misses, reuse should be ReuseCannot.
 // For parent connect failures, originCode should be 0.
@@ -100,7 +113,7 @@ func (r *Responder) Do() {
 	web.TryFlush(r.W) // TODO remove? Let plugins do it, if they need to?
 
 	respSuccess := err != nil
-	respData := cachedata.RespData{RespCode: *r.ResponseCode, BytesWritten: bytesSent, RespSuccess: respSuccess, CacheHit: isCacheHit(r.Reuse, r.OriginCode)}
+	respData := cachedata.RespData{RespCode: *r.ResponseCode, BytesWritten: bytesSent, RespSuccess: respSuccess, CacheHit: isCacheHit(r.Reuse, r.OriginCode) || r.Stale != cachedata.StaleNone}
 	arData := plugin.AfterRespondData{W: r.W, Stats: r.Stats, ReqData: r.ReqData, SrvrData: r.SrvrData, ParentRespData: r.ParentRespData, RespData: respData, RequestID: r.RequestID}
 	r.Plugins.OnAfterRespond(r.PluginCfg, r.PluginContext, arData)
 }
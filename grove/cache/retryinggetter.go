@@ -16,13 +16,18 @@ package cache
 
 import (
 	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/remapdata"
 	"github.com/apache/trafficcontrol/grove/thread"
 	"github.com/apache/trafficcontrol/grove/web"
 
@@ -53,14 +58,31 @@ func NewRetrier(h *Handler, reqHdr http.Header, reqTime time.Time, reqCacheContr
 
 // Get takes the HTTP request and the cached object if there is one, and makes a new request, retrying according to its RemappingProducer. If no cached object exists, pass a nil obj.
 // Along with the cacheobj.CacheObj, a string pointer to the request hostname used to fetch the cacheobj.CacheObj is returned.
-func (r *Retrier) Get(req *http.Request, obj *cacheobj.CacheObj) (*cacheobj.CacheObj, *string, error) {
+// If this request fetched a chunked object, the rest of its body being read from the parent is also returned, and must be closed by the caller. Otherwise, it's nil.
+func (r *Retrier) Get(req *http.Request, obj *cacheobj.CacheObj) (*cacheobj.CacheObj, *ParentBody, *string, error) {
+	parentBody := (*ParentBody)(nil)
 	retryGetFunc := func(remapping remap.Remapping, retryFailures bool, obj *cacheobj.CacheObj) *cacheobj.CacheObj {
 		// return true for Revalidate, and issue revalidate requests separately.
 		canReuse := func(cacheObj *cacheobj.CacheObj) bool {
 			return cacheobj.CanReuse(r.ReqHdr, r.ReqCacheControl, cacheObj, r.H.strictRFC, true)
 		}
 		getAndCache := func() *cacheobj.CacheObj {
-			return GetAndCache(remapping.Request, remapping.ProxyURL, remapping.CacheKey, remapping.Name, remapping.Request.Header, r.ReqTime, r.H.strictRFC, remapping.Cache, r.H.ruleThrottlers[remapping.Name], obj, remapping.Timeout, retryFailures, remapping.RetryNum, remapping.RetryCodes, remapping.Transport, r.ReqID)
+			reqStart := time.Now()
+			gotObj, body, err := GetAndCache(remapping.Request, remapping.ProxyURL, remapping.CacheKey, remapping.Name, remapping.Request.Header, r.ReqTime, r.H.strictRFC, remapping.Cache, r.H.ruleThrottlers[remapping.Name], obj, remapping.Timeout, retryFailures, remapping.RetryNum, remapping.RetryCodes, remapping.Transport, r.H.chunkSize, remapping.MaxVariants, r.ReqID)
+			if err != nil {
+				remapping.ParentHealth.Failed(remapping.Parent)
+			} else {
+				remapping.ParentHealth.Succeeded(remapping.Parent, time.Since(reqStart))
+			}
+			if parentBody != nil {
+				parentBody.Close() // a previous try's body, which shouldn't happen, because chunked responses aren't failures
+			}
+			if body != nil && body.Cache {
+				// started before the Getter gives the object to Waiters, so they wait for the chunks this request reads
+				body.fill = r.H.fills.Start(gotObj.ChunkPrefix, 1, -1)
+			}
+			parentBody = body
+			return gotObj
 		}
 		gotObj, getReqID := r.H.getter.Get(remapping.CacheKey, getAndCache, canReuse, r.ReqID)
 
@@ -70,7 +92,111 @@ func (r *Retrier) Get(req *http.Request, obj *cacheobj.CacheObj) (*cacheobj.Cach
 		return gotObj
 	}
 
-	return retryingGet(retryGetFunc, req, r.RemappingProducer, obj)
+	gotObj, reqHost, err := retryingGet(retryGetFunc, req, r.RemappingProducer, obj)
+	if err != nil && parentBody != nil {
+		parentBody.Close()
+		parentBody = nil
+	}
+	return gotObj, parentBody, reqHost, err
+}
+
+// GetRange requests the bytes of the chunked obj's body from start to end inclusive from the parent, or from start to the end of the body if end is negative. It returns the parent body, from which the bytes from start may be read, and which must be closed by the caller.
+// It retries according to a new RemappingProducer for req, so retries used to fetch the object don't count against it. If the parent no longer has the same object, an error is returned.
+func (r *Retrier) GetRange(req *http.Request, obj *cacheobj.CacheObj, start int64, end int64) (io.ReadCloser, error) {
+	remappingProducer, err := r.H.remapper.RemappingProducer(req, r.H.scheme)
+	if err != nil {
+		return nil, errors.New("getting remapping producer: " + err.Error())
+	}
+
+	rangeHdr := "bytes=" + strconv.FormatInt(start, 10) + "-"
+	if end >= 0 {
+		rangeHdr += strconv.FormatInt(end, 10)
+	}
+	ifRange := obj.RespHeaders.Get("ETag")
+	if ifRange == "" {
+		ifRange = obj.RespHeaders.Get("Last-Modified")
+	}
+
+	lastErr := error(nil)
+	for {
+		remapping, _, err := remappingProducer.GetNext(req)
+		if err == remap.ErrNoMoreRetries && lastErr != nil {
+			return nil, lastErr
+		} else if err != nil {
+			return nil, err
+		}
+
+		parentReq := remapping.Request
+		parentReq.Header.Set("Range", rangeHdr)
+		parentReq.Header.Del("If-Range")
+		if ifRange != "" {
+			parentReq.Header.Set("If-Range", ifRange)
+		}
+		parentReq.Header.Del(ModifiedSinceHdr)
+		parentReq.Header.Del("If-None-Match")
+
+		ruleThrottler := r.H.ruleThrottlers[remapping.Name]
+		if ruleThrottler == nil {
+			ruleThrottler = thread.NewNoThrottler()
+		}
+		resp := (*http.Response)(nil)
+		reqTime, respTime := time.Time{}, time.Time{}
+		ruleThrottler.Throttle(func() { resp, reqTime, respTime, err = web.RequestStream(remapping.Transport, parentReq) })
+		if err != nil {
+			log.Errorf("Parent error requesting range %v of cacheKey %v rule %v error %v (reqid %v)\n", rangeHdr, remapping.CacheKey, remapping.Name, err, r.ReqID)
+			remapping.ParentHealth.Failed(remapping.Parent)
+			lastErr = err
+			continue
+		}
+		remapping.ParentHealth.Succeeded(remapping.Parent, respTime.Sub(reqTime))
+
+		body, err := rangeBody(resp, obj, start)
+		if err == errRangeNotSatisfiable {
+			return nil, err
+		} else if err != nil {
+			log.Errorf("Parent error requesting range %v of cacheKey %v rule %v error %v (reqid %v)\n", rangeHdr, remapping.CacheKey, remapping.Name, err, r.ReqID)
+			lastErr = err
+			continue
+		}
+		return body, nil
+	}
+}
+
+// rangeBody returns the body of the parent response to a range request for obj's body from start, from which the bytes from start may be read. If the parent ignored the range, and returned the whole body of the same object, the bytes before start are discarded.
+func rangeBody(resp *http.Response, obj *cacheobj.CacheObj, start int64) (io.ReadCloser, error) {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(start, 10)+"-") {
+			resp.Body.Close()
+			return nil, errors.New("parent returned unexpected Content-Range '" + resp.Header.Get("Content-Range") + "'")
+		}
+		return resp.Body, nil
+	case http.StatusOK:
+		if !sameObject(obj.RespHeaders, resp.Header) {
+			resp.Body.Close()
+			return nil, errors.New("parent object changed")
+		}
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, start); err != nil {
+			resp.Body.Close()
+			return nil, errors.New("reading parent body: " + err.Error())
+		}
+		return resp.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, errRangeNotSatisfiable
+	default:
+		resp.Body.Close()
+		return nil, errors.New("parent returned code " + strconv.Itoa(resp.StatusCode))
+	}
+}
+
+// sameObject returns whether the given response headers are for the same object, according to their ETag, or Last-Modified if there's no ETag.
+func sameObject(hdr http.Header, newHdr http.Header) bool {
+	if etag := hdr.Get("ETag"); etag != "" {
+		return etag == newHdr.Get("ETag")
+	}
+	lastModified := hdr.Get("Last-Modified")
+	return lastModified != "" && lastModified == newHdr.Get("Last-Modified")
 }
 
 // retryingGet takes a function, and retries failures up to the RemappingProducer RetryNum limit. On failure, it creates a new remapping. The func f should use `remapping` to make its request. If it hits failures up to the limit, it returns the last received cacheobj.CacheObj
@@ -80,7 +206,9 @@ func retryingGet(getCacheObj func(remapping remap.Remapping, retryFailures bool,
 	obj := (*cacheobj.CacheObj)(nil)
 	for {
 		remapping, retryAllowed, err := remappingProducer.GetNext(request)
-		if err == remap.ErrNoMoreRetries {
+		if err == remapdata.ErrAllParentsDown && obj != nil {
+			return obj, nil, nil // the remaining parents were marked down by this request's failures
+		} else if err == remap.ErrNoMoreRetries {
 			if obj == nil {
 				return nil, nil, errors.New("remapping producer allows no requests") // should never happen
 			}
@@ -104,6 +232,9 @@ const ModifiedSinceHdr = "If-Modified-Since"
 
 // GetAndCache makes a client request for the given `http.Request` and caches it if `CanCache`.
 // THe `ruleThrottler` may be nil, in which case the request will be unthrottled.
+// If the response body is larger than chunkSize, the returned object is chunked, with only the first chunk read, and the rest of the body is returned to be read and stored by the caller, which must close it. If chunkSize is 0, bodies are never chunked.
+// If the response has a Vary header, the object is stored under its variant key rather than cacheKey, keeping up to maxVariants variants. See storeVariant.
+// If the parent couldn't be requested, the request error is returned, along with a CodeConnectFailure object to respond with. A response from the parent, even one with CodeConnectFailure, returns a nil error.
 func GetAndCache(
 	req *http.Request,
 	proxyURL *url.URL,
@@ -120,9 +251,13 @@ func GetAndCache(
 	retryNum int,
 	retryCodes map[int]struct{},
 	transport *http.Transport,
+	chunkSize uint64,
+	maxVariants int,
 	reqID uint64,
-) *cacheobj.CacheObj {
+) (*cacheobj.CacheObj, *ParentBody, error) {
 	// TODO this is awkward, with 'revalidateObj' indicating whether the request is a Revalidate. Should Getting and Caching be split up? How?
+	parentBody := (*ParentBody)(nil)
+	reqErr := error(nil)
 	get := func() *cacheobj.CacheObj {
 		// TODO figure out why respReqTime isn't used by rules
 		log.Debugf("GetAndCache calling request %v %v %v %v %v (reqid %v)\n", req.Method, req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), req.Header, reqID)
@@ -136,16 +271,20 @@ func GetAndCache(
 		} else {
 			req.Header.Del(ModifiedSinceHdr)
 		}
-		respCode, respHeader, respBody, reqTime, reqRespTime, err := web.Request(transport, req)
+		respCode, respHeader, respBody, rest, reqTime, reqRespTime, err := requestFirstChunk(transport, req, chunkSize)
 		log.Debugf("GetAndCache web.Request URI %v %v %v cacheKey %v rule %v parent %v error %v reval %v code %v len(body) %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), cacheKey, remapName, proxyURLStr, err, revalidateObj != nil, respCode, len(respBody), reqID)
 
 		if err != nil {
 			log.Errorf("Parent error for URI %v %v %v cacheKey %v rule %v parent %v error %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), cacheKey, remapName, proxyURLStr, err, reqID)
+			reqErr = err
 			code := CodeConnectFailure
 			body := []byte(http.StatusText(code))
 			return cacheobj.New(reqHeader, body, code, code, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
 		}
 		if _, ok := retryCodes[respCode]; ok && !cacheFailure {
+			if rest != nil {
+				rest.Close()
+			}
 			return cacheobj.New(reqHeader, respBody, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
 		}
 
@@ -167,7 +306,22 @@ func GetAndCache(
 		if revalidateObj == nil || respCode != http.StatusNotModified {
 			log.Debugf("GetAndCache new %v (reqid %v)\n", cacheKey, reqID)
 			obj = cacheobj.New(reqHeader, respBody, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, respRespTime, lastModified)
-			if !rfc.CanCache(req.Method, reqHeader, respCode, respHeader, strictRFC) {
+			canCache := rfc.CanCache(req.Method, reqHeader, respCode, respHeader, strictRFC)
+			if canCache {
+				cacheKey, canCache = storeVariant(cache, cacheKey, obj, maxVariants)
+			}
+			if rest != nil {
+				contentLength, err := strconv.ParseInt(respHeader.Get("Content-Length"), 10, 64)
+				if err != nil {
+					contentLength = -1
+				}
+				setChunked(obj, cacheKey, chunkSize, contentLength)
+				parentBody = &ParentBody{ReadCloser: rest, Cache: canCache, key: cacheKey}
+				if contentLength < 0 {
+					return obj // an object with no Content-Length is cached when its whole body has been read
+				}
+			}
+			if !canCache {
 				return obj // return without caching
 			}
 		} else {
@@ -189,6 +343,11 @@ func GetAndCache(
 				LastModified:     revalidateObj.LastModified,
 				Size:             revalidateObj.Size,
 				HitCount:         revalidateObj.HitCount, // no need to +1 here, the cache Get did that
+				ChunkSize:        revalidateObj.ChunkSize,
+				BodySize:         revalidateObj.BodySize,
+				ChunkPrefix:      revalidateObj.ChunkPrefix,
+				Tags:             revalidateObj.Tags,
+				Vary:             revalidateObj.Vary,
 			}
 		}
 		cache.Add(cacheKey, obj) // TODO store pointer?
@@ -201,5 +360,5 @@ func GetAndCache(
 		ruleThrottler = thread.NewNoThrottler()
 	}
 	ruleThrottler.Throttle(func() { c = get() })
-	return c
+	return c, parentBody, reqErr
 }
@@ -0,0 +1,53 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/thread"
+)
+
+func TestGetAndCacheConnectFailure(t *testing.T) {
+	parent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway) // a parent relaying its own parent's failure
+	}))
+	parentURL := parent.URL
+
+	get := func() (int, error) {
+		req, err := http.NewRequest(http.MethodGet, parentURL+"/obj", nil)
+		if err != nil {
+			t.Fatalf("creating request: %v", err)
+		}
+		obj, body, err := GetAndCache(req, nil, "key", "rule", http.Header{}, time.Now(), false, memcache.New(1<<20), thread.NewNoThrottler(), nil, time.Second, false, 0, nil, &http.Transport{}, 0, 0, 0)
+		if body != nil {
+			body.Close()
+		}
+		return obj.Code, err
+	}
+
+	if code, err := get(); err != nil || code != http.StatusBadGateway {
+		t.Errorf("expected parent %v response with no request error, actual code %v error %v", http.StatusBadGateway, code, err)
+	}
+
+	parent.Close()
+	if code, err := get(); err == nil || code != CodeConnectFailure {
+		t.Errorf("expected request error with code %v for closed parent, actual code %v error %v", CodeConnectFailure, code, err)
+	}
+}
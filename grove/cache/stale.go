@@ -0,0 +1,79 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// revalidations tracks the cache keys of stale objects being revalidated in the background, so concurrent requests served the same stale object don't each revalidate it.
+type revalidations struct {
+	keys map[string]struct{}
+	m    sync.Mutex
+}
+
+func newRevalidations() *revalidations {
+	return &revalidations{keys: map[string]struct{}{}}
+}
+
+// Start adds the given cache key, and returns whether it was added. If it returns false, the key is already being revalidated. If it returns true, the revalidation must be finished with Done.
+func (r *revalidations) Start(key string) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, ok := r.keys[key]; ok {
+		return false
+	}
+	r.keys[key] = struct{}{}
+	return true
+}
+
+// Done removes the given cache key, so it may be revalidated again.
+func (r *revalidations) Done(key string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	delete(r.keys, key)
+}
+
+// revalidate revalidates the stale cacheObj with the parent in the background, per RFC5861§3 stale-while-revalidate, storing the revalidated or new object in the cache for later requests. If the cache key is already being revalidated, it does nothing.
+func (h *Handler) revalidate(retrier *Retrier, r *http.Request, cacheObj *cacheobj.CacheObj, cacheKey string, reqID uint64) {
+	if !h.revalidations.Start(cacheKey) {
+		log.Debugf("cache.Handler.revalidate: '%v' already revalidating (reqid %v)\n", cacheKey, reqID)
+		return
+	}
+	go func() {
+		defer h.revalidations.Done(cacheKey)
+		newObj, parentBody, _, err := retrier.Get(r, cacheObj)
+		if err != nil {
+			log.Errorf("revalidating '%v' in the background: %v (reqid %v)\n", cacheKey, err, reqID)
+			return
+		}
+		if parentBody != nil && !parentBody.Cache {
+			parentBody.Close()
+		} else if parentBody != nil {
+			// the object changed, and is chunked. Read the rest of its body, so its chunks are stored for later requests.
+			body := newChunkedBody(newObj, parentBody.key, retrier.RemappingProducer.Cache(), h.fills, h.collapseTimeout, retrier, r, parentBody, reqID)
+			if _, err := body.WriteTo(ioutil.Discard, 0, -1); err != nil {
+				log.Errorf("revalidating '%v' in the background: reading body: %v (reqid %v)\n", cacheKey, err, reqID)
+			}
+		}
+		log.Debugf("cache.Handler.revalidate: '%v' revalidated with code %v (reqid %v)\n", cacheKey, newObj.Code, reqID)
+	}()
+}
@@ -0,0 +1,94 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// staleObj returns an object with the given Cache-Control, received from the parent the given time ago.
+func staleObj(cacheControl string, age time.Duration) *cacheobj.CacheObj {
+	date := time.Now().Add(-age)
+	hdr := http.Header{"Cache-Control": {cacheControl}, "Date": {date.Format(http.TimeFormat)}}
+	return cacheobj.New(http.Header{}, []byte("body"), http.StatusOK, http.StatusOK, "", hdr, date, date, date, date)
+}
+
+func TestStale(t *testing.T) {
+	noReqCC := rfc.CacheControlMap{}
+	dur := func(d time.Duration) *time.Duration { return &d }
+
+	tests := []struct {
+		name              string
+		obj               *cacheobj.CacheObj
+		reqCC             rfc.CacheControlMap
+		ruleSWR           *time.Duration
+		ruleSIE           *time.Duration
+		whileRevalidate   bool
+		ifError           bool
+		expectedStaleness time.Duration
+	}{
+		{"fresh", staleObj("max-age=60, stale-while-revalidate=60, stale-if-error=60", 30*time.Second), noReqCC, nil, nil, false, true, 0},
+		{"within windows", staleObj("max-age=60, stale-while-revalidate=60, stale-if-error=60", 90*time.Second), noReqCC, nil, nil, true, true, 30 * time.Second},
+		{"past windows", staleObj("max-age=60, stale-while-revalidate=10, stale-if-error=10", 90*time.Second), noReqCC, nil, nil, false, false, 30 * time.Second},
+		{"no directives", staleObj("max-age=60", 90*time.Second), noReqCC, nil, nil, false, false, 30 * time.Second},
+		{"must-revalidate", staleObj("max-age=60, must-revalidate, stale-while-revalidate=60, stale-if-error=60", 90*time.Second), noReqCC, nil, nil, false, false, 30 * time.Second},
+		{"rule overrides", staleObj("max-age=60", 90*time.Second), noReqCC, dur(time.Minute), dur(time.Minute), true, true, 30 * time.Second},
+		{"rule disables", staleObj("max-age=60, stale-while-revalidate=60, stale-if-error=60", 90*time.Second), noReqCC, dur(0), dur(0), false, false, 30 * time.Second},
+		{"request stale-if-error", staleObj("max-age=60, stale-if-error=60", 90*time.Second), rfc.CacheControlMap{"stale-if-error": "10"}, nil, nil, false, false, 30 * time.Second},
+	}
+	for _, test := range tests {
+		// the Date header has second precision, so the staleness may be up to a second more
+		if actual := test.obj.Staleness(); actual < test.expectedStaleness || actual > test.expectedStaleness+2*time.Second {
+			t.Errorf("%v: expected staleness %v, actual %v", test.name, test.expectedStaleness, actual)
+		}
+		if actual := cacheobj.CanStaleWhileRevalidate(test.obj, test.ruleSWR); actual != test.whileRevalidate {
+			t.Errorf("%v: expected stale-while-revalidate %v, actual %v", test.name, test.whileRevalidate, actual)
+		}
+		if actual := cacheobj.CanStaleIfError(test.reqCC, test.obj, test.ruleSIE); actual != test.ifError {
+			t.Errorf("%v: expected stale-if-error %v, actual %v", test.name, test.ifError, actual)
+		}
+	}
+
+	invalidated := staleObj("max-age=60, stale-while-revalidate=60, stale-if-error=60", 90*time.Second).Invalidate()
+	if cacheobj.CanStaleWhileRevalidate(invalidated, nil) {
+		t.Error("expected soft-purged object not to be served while revalidating")
+	}
+	if !cacheobj.CanStaleIfError(noReqCC, invalidated, nil) {
+		t.Error("expected soft-purged object to be served if revalidating it fails")
+	}
+}
+
+func TestRevalidations(t *testing.T) {
+	r := newRevalidations()
+	if !r.Start("a") {
+		t.Fatal("expected revalidation of 'a' to start")
+	}
+	if r.Start("a") {
+		t.Error("expected concurrent revalidation of 'a' not to start")
+	}
+	if !r.Start("b") {
+		t.Error("expected revalidation of 'b' to start while 'a' is revalidating")
+	}
+	r.Done("a")
+	if !r.Start("a") {
+		t.Error("expected revalidation of 'a' to start after the previous one was done")
+	}
+}
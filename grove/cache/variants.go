@@ -0,0 +1,92 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+)
+
+// variantsMutex serializes changes to variant indexes, which are read, modified, and added back to the cache, so concurrent changes don't lose variants.
+var variantsMutex sync.Mutex
+
+// lookupVariant returns the variant of the object with the given primary key selected by the request headers, and its variant key, if the primary key holds a variant index. Otherwise, the given object and key are returned. The returned object is nil if the variant isn't cached.
+func lookupVariant(cache icache.Cache, primaryKey string, obj *cacheobj.CacheObj, reqHeader http.Header) (*cacheobj.CacheObj, string) {
+	if obj == nil || !obj.IsVariantIndex() {
+		return obj, primaryKey
+	}
+	variantKey := cacheobj.VariantKey(primaryKey, obj.Vary, reqHeader)
+	variant, ok := cache.Get(variantKey)
+	if !ok {
+		return nil, variantKey
+	}
+	return variant, variantKey
+}
+
+// storeVariant returns the key to store the new cacheable obj under, fetched for the given cache key, which is either the object's primary key, or a variant key from its variant index, and whether it can be stored.
+// An object whose response varies is stored under its variant key, and added to the variant index at its primary key, removing the least recently added variants beyond maxVariants, and any variants which varied by different headers. An object which doesn't vary is stored under its primary key, replacing any variant index and its variants. An object which varies by '*' can't be stored.
+func storeVariant(cache icache.Cache, cacheKey string, obj *cacheobj.CacheObj, maxVariants int) (string, bool) {
+	if obj.VaryAll() {
+		return "", false
+	}
+	primaryKey := cacheobj.PrimaryKey(cacheKey)
+
+	variantsMutex.Lock()
+	defer variantsMutex.Unlock()
+	index, ok := cache.Peek(primaryKey)
+	isIndex := ok && index.IsVariantIndex()
+	if len(obj.Vary) == 0 {
+		if isIndex {
+			icache.Purge(cache, primaryKey, false)
+		}
+		return primaryKey, true
+	}
+
+	variantKey := cacheobj.VariantKey(primaryKey, obj.Vary, obj.ReqHeaders)
+	variants := []string{}
+	if isIndex && equalStrings(index.Vary, obj.Vary) {
+		for _, variant := range index.Variants {
+			if variant != variantKey {
+				variants = append(variants, variant)
+			}
+		}
+	} else if ok {
+		icache.Purge(cache, primaryKey, false) // the object stored didn't vary, or varied by different headers
+	}
+	variants = append(variants, variantKey)
+	if maxVariants > 0 {
+		for len(variants) > maxVariants {
+			icache.Purge(cache, variants[0], false)
+			variants = variants[1:]
+		}
+	}
+	cache.Add(primaryKey, cacheobj.NewVariantIndex(obj.Vary, variants))
+	return variantKey, true
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
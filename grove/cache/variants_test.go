@@ -0,0 +1,85 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/memcache"
+)
+
+func variantTestObj(acceptEncoding string, vary string) *cacheobj.CacheObj {
+	reqHdr := http.Header{"Accept-Encoding": {acceptEncoding}}
+	respHdr := http.Header{"Vary": {vary}}
+	return cacheobj.New(reqHdr, []byte(acceptEncoding), http.StatusOK, http.StatusOK, "", respHdr, time.Now(), time.Now(), time.Now(), time.Now())
+}
+
+func TestStoreVariant(t *testing.T) {
+	cache := memcache.New(1024 * 1024)
+	defer cache.Close()
+	primaryKey := "GET:http://example.net/obj"
+
+	for _, enc := range []string{"gzip", "br", "identity"} {
+		obj := variantTestObj(enc, "accept-encoding")
+		key, ok := storeVariant(cache, primaryKey, obj, 2)
+		if !ok {
+			t.Fatalf("expected variant '%v' to be storable", enc)
+		}
+		cache.Add(key, obj)
+	}
+
+	index, ok := cache.Peek(primaryKey)
+	if !ok || !index.IsVariantIndex() {
+		t.Fatalf("expected a variant index at the primary key, actual %+v", index)
+	}
+	if len(index.Variants) != 2 {
+		t.Fatalf("expected max 2 variants, actual %v", index.Variants)
+	}
+
+	obj, key := lookupVariant(cache, primaryKey, index, http.Header{"Accept-Encoding": {"br"}})
+	if obj == nil || string(obj.Body) != "br" || cacheobj.PrimaryKey(key) != primaryKey {
+		t.Errorf("expected br variant under a variant key of the primary key, actual %+v key '%v'", obj, key)
+	}
+	if obj, _ := lookupVariant(cache, primaryKey, index, http.Header{"Accept-Encoding": {"gzip"}}); obj != nil {
+		t.Error("expected the least recently stored gzip variant to be removed beyond max variants")
+	}
+
+	// a response which stops varying replaces the variants
+	obj = variantTestObj("br", "")
+	key, ok = storeVariant(cache, key, obj, 2)
+	if !ok || key != primaryKey {
+		t.Fatalf("expected an object which doesn't vary to be stored under the primary key, actual '%v' %v", key, ok)
+	}
+	if keys := cache.Keys(); len(keys) != 0 {
+		t.Errorf("expected the variant index and variants to be removed, actual keys %v", keys)
+	}
+
+	if _, ok := storeVariant(cache, primaryKey, variantTestObj("br", "*"), 2); ok {
+		t.Error("expected an object which varies by '*' not to be storable")
+	}
+}
+
+func TestVariantReuse(t *testing.T) {
+	obj := variantTestObj("gzip", "Accept-Encoding, Accept-Language")
+	if !obj.VariantMatches(http.Header{"Accept-Encoding": {"gzip"}}) {
+		t.Error("expected variant to match request with the same Vary headers")
+	}
+	if obj.VariantMatches(http.Header{"Accept-Encoding": {"gzip"}, "Accept-Language": {"en"}}) {
+		t.Error("expected variant not to match request with different Vary headers")
+	}
+}
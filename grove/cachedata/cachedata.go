@@ -33,8 +33,22 @@ type ParentRespData struct {
 	OriginConnectFailed bool
 	OriginBytes         uint64
 	ProxyStr            string
+	// Stale is why the cached object was served stale, if it was.
+	Stale Stale
 }
 
+// Stale is why a stale cached object was served, rather than a fresh or revalidated one.
+type Stale int
+
+const (
+	// StaleNone indicates the object wasn't served stale.
+	StaleNone Stale = iota
+	// StaleWhileRevalidate indicates the object was served stale while it was revalidated in the background, per RFC5861§3.
+	StaleWhileRevalidate
+	// StaleIfError indicates the object was served stale because revalidating it failed, per RFC5861§4.
+	StaleIfError
+)
+
 // HandlerData contains data generally held by the Handler, and known as soon as the request is received.
 type SrvrData struct {
 	Hostname string
@@ -16,8 +16,14 @@ package cacheobj
 
 import (
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/apache/trafficcontrol/grove/web"
+
 	"github.com/apache/trafficcontrol/lib/go-rfc"
 )
 
@@ -35,6 +41,162 @@ type CacheObj struct {
 	LastModified     time.Time // the origin LastModified if it exists, or Date if it doesn't
 	Size             uint64
 	HitCount         uint64 // the number of times this object was hit
+	// ChunkSize is the size of the chunks the body is stored in, if it's larger than one chunk. If it's 0, the whole body is in Body. Otherwise, Body is the first chunk, and the following chunks are separate objects in the cache, under ChunkKey.
+	ChunkSize uint64
+	// BodySize is the size of a chunked body, or -1 if it isn't known yet, because the parent didn't send a Content-Length.
+	BodySize int64
+	// ChunkPrefix is the prefix of the cache keys of the body's chunks. It's unique to each parent response, so chunks of a replaced object are never served with its replacement.
+	ChunkPrefix string
+	// Tags are the surrogate keys of the object, from its TagHeaders, which it may be purged by.
+	Tags []string
+	// Invalidated is whether the object was soft-purged, and must be revalidated with the parent before it's reused.
+	Invalidated bool
+	// Vary is the canonical names of the request headers in the response's Vary header, sorted, which select the variant of the object. If the object is a variant index, it's the Vary of all its Variants.
+	Vary []string
+	// Variants is the cache keys of the variants of the object, if this is a variant index stored under the object's primary key, in the order they were added. It's nil for all other objects.
+	Variants []string
+}
+
+// VaryWildcard is the Vary header value for responses which vary by more than request headers, which can't be selected by a cache.
+const VaryWildcard = "*"
+
+// ParseVary returns the canonical names of the request headers in the Vary header of the given response headers, sorted and without duplicates.
+func ParseVary(respHeader http.Header) []string {
+	vary := []string(nil)
+	seen := map[string]struct{}{}
+	for _, val := range respHeader[rfc.Vary] {
+		for _, name := range strings.Split(val, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if name != VaryWildcard {
+				name = http.CanonicalHeaderKey(name)
+			}
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			vary = append(vary, name)
+		}
+	}
+	sort.Strings(vary)
+	return vary
+}
+
+// VaryAll returns whether the object's response varies by more than request headers, and thus can't be reused.
+func (c CacheObj) VaryAll() bool {
+	for _, name := range c.Vary {
+		if name == VaryWildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// IsVariantIndex returns whether the object is a variant index, which only lists the Variants of the object stored under their own keys.
+func (c CacheObj) IsVariantIndex() bool {
+	return c.Variants != nil
+}
+
+// NewVariantIndex creates a variant index, to be stored under an object's primary key, of the given variant keys of objects with the given Vary.
+func NewVariantIndex(vary []string, variants []string) *CacheObj {
+	obj := &CacheObj{Vary: vary, Variants: variants, HitCount: 1}
+	for _, variant := range variants {
+		obj.Size += uint64(len(variant))
+	}
+	return obj
+}
+
+// VariantKeySeparator separates an object's primary cache key from the request header values which select the variant, in variant keys. Request URIs can't contain it, so only variant keys do.
+const VariantKeySeparator = " "
+
+// VariantKey returns the cache key of the variant of the object with the given primary key which is selected by the given request headers, for objects with the given Vary.
+func VariantKey(primaryKey string, vary []string, reqHeader http.Header) string {
+	values := url.Values{}
+	for _, name := range vary {
+		values.Set(name, strings.Join(reqHeader[name], ","))
+	}
+	return primaryKey + VariantKeySeparator + values.Encode()
+}
+
+// PrimaryKey returns the primary key of the object with the given cache key, which is the key itself unless it's a variant key.
+func PrimaryKey(key string) string {
+	if i := strings.Index(key, VariantKeySeparator); i != -1 {
+		return key[:i]
+	}
+	return key
+}
+
+// VariantMatches returns whether the object is the variant selected by the given request headers, which is always true for objects whose response doesn't vary.
+func (c CacheObj) VariantMatches(reqHeader http.Header) bool {
+	if len(c.Vary) == 0 {
+		return true
+	}
+	if c.VaryAll() {
+		return false
+	}
+	return VariantKey("", c.Vary, c.ReqHeaders) == VariantKey("", c.Vary, reqHeader)
+}
+
+// TagHeaders are the parent response headers whose space- or comma-separated values are the object's Tags.
+var TagHeaders = []string{"Surrogate-Key", "Cache-Tag"}
+
+// ParseTags returns the tags in the TagHeaders of the given response headers.
+func ParseTags(respHeader http.Header) []string {
+	tags := []string(nil)
+	for _, hdr := range TagHeaders {
+		for _, val := range respHeader[http.CanonicalHeaderKey(hdr)] {
+			tags = append(tags, strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })...)
+		}
+	}
+	return tags
+}
+
+// HasTag returns whether the object has the given tag.
+func (c CacheObj) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Invalidate returns a copy of the object, marked Invalidated. The object itself isn't modified, because cached objects may be concurrently read by other goroutines.
+func (c CacheObj) Invalidate() *CacheObj {
+	c.Invalidated = true
+	return &c
+}
+
+// Chunked returns whether the body of the object is stored in separate chunks, of which Body is only the first.
+func (c CacheObj) Chunked() bool {
+	return c.ChunkSize > 0
+}
+
+// ChunkKey returns the cache key of the given chunk of a chunked object's body. The first chunk, 0, is the object's Body, and isn't stored under its own key.
+func (c CacheObj) ChunkKey(chunk uint64) string {
+	return c.ChunkPrefix + "." + strconv.FormatUint(chunk, 10)
+}
+
+// NumChunks returns the number of chunks of a chunked object's body, including the first, or 0 if the body size isn't known.
+func (c CacheObj) NumChunks() uint64 {
+	if c.ChunkSize == 0 || c.BodySize < 0 {
+		return 0
+	}
+	return (uint64(c.BodySize) + c.ChunkSize - 1) / c.ChunkSize
+}
+
+// ChunkKeySeparator separates the cache key of a chunked object from the rest of its ChunkPrefix. Request URIs can't contain it, so only chunk keys do.
+const ChunkKeySeparator = "#"
+
+// IsChunkKey returns whether the given cache key is the key of a chunk of a chunked object, rather than of an object.
+func IsChunkKey(key string) bool {
+	return strings.Contains(key, ChunkKeySeparator)
+}
+
+// NewChunk creates an object for a single chunk of a chunked object's body, to be stored under the chunked object's ChunkKey.
+func NewChunk(bytes []byte) *CacheObj {
+	return &CacheObj{Body: bytes, Code: http.StatusOK, Size: uint64(len(bytes)), HitCount: 1}
 }
 
 // ComputeSize computes the size of the given CacheObj. This computation is expensive, as the headers must be iterated over. Thus, the size should be computed once and stored, not computed on-the-fly for every new request for the cached object.
@@ -57,6 +219,8 @@ func New(reqHeader http.Header, bytes []byte, code int, originCode int, proxyURL
 		RespRespTime:     respRespTime,
 		LastModified:     lastModified,
 		HitCount:         1,
+		Tags:             ParseTags(respHeader),
+		Vary:             ParseVary(respHeader),
 	}
 	// copyHeader(reqHeader, &obj.reqHeaders)
 	// copyHeader(respHeader, &obj.respHeaders)
@@ -64,6 +228,18 @@ func New(reqHeader http.Header, bytes []byte, code int, originCode int, proxyURL
 	return obj
 }
 
+// Reuse wraps github.com/apache/trafficcontrol/lib/go-rfc.CanReuseStored for the given object, and additionally requires Invalidated objects to be revalidated, and objects whose Vary doesn't select them for the request not to be reused.
+func Reuse(reqHeader http.Header, reqCacheControl rfc.CacheControlMap, cacheObj *CacheObj, strictRFC bool) rfc.Reuse {
+	if !cacheObj.VariantMatches(reqHeader) {
+		return rfc.ReuseCannot
+	}
+	canReuse := rfc.CanReuseStored(reqHeader, cacheObj.RespHeaders, reqCacheControl, cacheObj.RespCacheControl, cacheObj.ReqHeaders, cacheObj.ReqRespTime, cacheObj.RespRespTime, strictRFC)
+	if cacheObj.Invalidated && canReuse == rfc.ReuseCan {
+		return rfc.ReuseMustRevalidate
+	}
+	return canReuse
+}
+
 // CanReuse is a helper wrapping
 // github.com/apache/trafficcontrol/lib/go-rfc.CanReuseStored, returning a
 // boolean rather than an enumerated "Reuse" value, for when it's known whether
@@ -75,6 +251,54 @@ func CanReuse(
 	strictRFC bool,
 	revalidateCanReuse bool,
 ) bool {
-	canReuse := rfc.CanReuseStored(reqHeader, cacheObj.RespHeaders, reqCacheControl, cacheObj.RespCacheControl, cacheObj.ReqHeaders, cacheObj.ReqRespTime, cacheObj.RespRespTime, strictRFC)
+	canReuse := Reuse(reqHeader, reqCacheControl, cacheObj, strictRFC)
 	return canReuse == rfc.ReuseCan || (canReuse == rfc.ReuseMustRevalidate && revalidateCanReuse)
 }
+
+// Staleness returns how long ago the object became stale, or 0 if it's still fresh, even if it's Invalidated.
+func (c CacheObj) Staleness() time.Duration {
+	staleness := -rfc.FreshFor(c.RespHeaders, c.RespCacheControl, c.ReqRespTime, c.RespRespTime)
+	if staleness < 0 {
+		return 0
+	}
+	return staleness
+}
+
+// forbidsStale returns whether the object's response forbids serving it stale, per RFC7234§5.2.2.1 and §5.2.2.7.
+func (c CacheObj) forbidsStale() bool {
+	return c.RespCacheControl.Has("must-revalidate") || c.RespCacheControl.Has("proxy-revalidate")
+}
+
+// CanStaleWhileRevalidate returns whether the stale object may be served while it's revalidated in the background, per RFC5861§3. The ruleStaleWhileRevalidate is the remap rule's override of the response's stale-while-revalidate, or nil to use the response's. Invalidated objects must always be revalidated before they're served.
+func CanStaleWhileRevalidate(cacheObj *CacheObj, ruleStaleWhileRevalidate *time.Duration) bool {
+	if cacheObj.Invalidated || cacheObj.forbidsStale() {
+		return false
+	}
+	staleWhileRevalidate, ok := web.StaleWhileRevalidate(cacheObj.RespCacheControl)
+	if ruleStaleWhileRevalidate != nil {
+		staleWhileRevalidate, ok = *ruleStaleWhileRevalidate, true
+	}
+	staleness := cacheObj.Staleness()
+	return ok && staleness > 0 && staleness <= staleWhileRevalidate
+}
+
+// CanStaleIfError returns whether the object may be served stale when revalidating it fails, per RFC5861§4. The ruleStaleIfError is the remap rule's override of the request and response's stale-if-error, or nil to use theirs.
+func CanStaleIfError(reqCacheControl rfc.CacheControlMap, cacheObj *CacheObj, ruleStaleIfError *time.Duration) bool {
+	if cacheObj.forbidsStale() {
+		return false
+	}
+	staleIfError, ok := web.StaleIfError(reqCacheControl, cacheObj.RespCacheControl)
+	if ruleStaleIfError != nil {
+		staleIfError, ok = *ruleStaleIfError, true
+	}
+	return ok && staleIfError > 0 && cacheObj.Staleness() <= staleIfError
+}
+
+// IsStaleIfErrorCode returns whether the given parent response code is an error in which stale objects may be served, per RFC5861§4.
+func IsStaleIfErrorCode(code int) bool {
+	switch code {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
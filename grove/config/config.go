@@ -61,6 +61,20 @@ type Config struct {
 	CacheFiles           map[string][]CacheFile `json:"cache_files"`
 	// FileMemBytes is the amount of memory to use as an LRU in front of each name in CacheFiles, that is, each named group of files. E.g. if there are 10 files, the amount of memory used will be 10*FileMemBytes+CacheSizeBytes.
 	FileMemBytes int `json:"file_mem_bytes"`
+	// CacheFilesIndexSyncMS is how often the LRU order of objects gotten from each file in CacheFiles is written to its index, so it's kept when Grove restarts. Objects are written to the index as they're added, and the LRU order is always written when Grove shuts down, so only the order of objects gotten since the last sync is lost if Grove crashes. If it's 0, it's only written at shutdown.
+	CacheFilesIndexSyncMS int `json:"cache_files_index_sync_ms"`
+	// CacheFilesScrubIntervalMS is how often each file in CacheFiles is checked for objects which don't match their index checksums or don't decode, which are removed. If it's 0, files are never scrubbed.
+	CacheFilesScrubIntervalMS int `json:"cache_files_scrub_interval_ms"`
+	// CacheChunkSizeBytes is the size of the chunks in which response bodies larger than it are streamed to clients while they're read from the parent, and stored in the cache. Range requests for chunked objects are served from the chunks in the cache, and missing chunks are requested from the parent. If it's 0, bodies are never chunked, and are read in full before responding.
+	CacheChunkSizeBytes int `json:"cache_chunk_size_bytes"`
+	// RequestCollapseTimeoutMS is the longest a cache miss waits for a concurrent parent request for the same object, or for a chunk being read by one, before making its own parent request. If it's 0, misses wait indefinitely.
+	RequestCollapseTimeoutMS int `json:"request_collapse_timeout_ms"`
+	// ParentFailThreshold is the number of consecutive failures to connect to a parent, across all requests, after which it's marked down and skipped by parent selection. If it's 0, parents are never marked down.
+	ParentFailThreshold int `json:"parent_fail_threshold"`
+	// ParentRetryTimeMS is how long a parent is marked down before a single request retries it. If the retry succeeds, the parent is marked available.
+	ParentRetryTimeMS int `json:"parent_retry_time_ms"`
+	// OCSPStapling is whether to request the OCSP responders of certificates, and staple their responses to TLS handshakes. Certificates with a web.OCSPStapleFileSuffix file next to them are stapled with it, regardless.
+	OCSPStapling bool `json:"ocsp_stapling"`
 }
 
 type CacheFile struct {
@@ -88,27 +102,33 @@ const MSPerSec = 1000
 
 // DefaultConfig is the default configuration for the application, if no configuration file is given, or if a given config setting doesn't exist in the config file.
 var DefaultConfig = Config{
-	RFCCompliant:           true,
-	Port:                   80,
-	DisableHTTP2:           false,
-	HTTPSPort:              443,
-	CacheSizeBytes:         bytesPerGibibyte,
-	RemapRulesFile:         "remap.config",
-	ConcurrentRuleRequests: 100000,
-	ConnectionClose:        false,
-	LogLocationError:       log.LogLocationStderr,
-	LogLocationWarning:     log.LogLocationStdout,
-	LogLocationInfo:        log.LogLocationNull,
-	LogLocationDebug:       log.LogLocationNull,
-	LogLocationEvent:       log.LogLocationStdout,
-	ReqTimeoutMS:           30 * MSPerSec,
-	ReqKeepAliveMS:         30 * MSPerSec,
-	ReqMaxIdleConns:        100,
-	ReqIdleConnTimeoutMS:   90 * MSPerSec,
-	ServerIdleTimeoutMS:    10 * MSPerSec,
-	ServerWriteTimeoutMS:   3 * MSPerSec,
-	ServerReadTimeoutMS:    3 * MSPerSec,
-	FileMemBytes:           bytesPerMebibyte * 100,
+	RFCCompliant:              true,
+	Port:                      80,
+	DisableHTTP2:              false,
+	HTTPSPort:                 443,
+	CacheSizeBytes:            bytesPerGibibyte,
+	RemapRulesFile:            "remap.config",
+	ConcurrentRuleRequests:    100000,
+	ConnectionClose:           false,
+	LogLocationError:          log.LogLocationStderr,
+	LogLocationWarning:        log.LogLocationStdout,
+	LogLocationInfo:           log.LogLocationNull,
+	LogLocationDebug:          log.LogLocationNull,
+	LogLocationEvent:          log.LogLocationStdout,
+	ReqTimeoutMS:              30 * MSPerSec,
+	ReqKeepAliveMS:            30 * MSPerSec,
+	ReqMaxIdleConns:           100,
+	ReqIdleConnTimeoutMS:      90 * MSPerSec,
+	ServerIdleTimeoutMS:       10 * MSPerSec,
+	ServerWriteTimeoutMS:      3 * MSPerSec,
+	ServerReadTimeoutMS:       3 * MSPerSec,
+	FileMemBytes:              bytesPerMebibyte * 100,
+	CacheFilesIndexSyncMS:     60 * MSPerSec,
+	CacheFilesScrubIntervalMS: 24 * 60 * 60 * MSPerSec,
+	CacheChunkSizeBytes:       bytesPerMebibyte,
+	RequestCollapseTimeoutMS:  30 * MSPerSec,
+	ParentFailThreshold:       10,
+	ParentRetryTimeMS:         300 * MSPerSec,
 }
 
 // LoadConfig loads the given config file. If an empty string is passed, the default config is returned.
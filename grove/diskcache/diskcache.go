@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"errors"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -34,10 +35,19 @@ type DiskCache struct {
 	sizeBytes    uint64
 	maxSizeBytes uint64
 	lru          *lru.LRU
+	// access is the access sequence number of the most recent Add or Get. See Entry.Access.
+	access uint64
+	// touched is the access sequence numbers of the objects gotten since the index was last synced.
+	touched  map[string]uint64
+	touchedM sync.Mutex
+	done     chan struct{}
+	wg       sync.WaitGroup
+	closed   sync.Once
 }
 
 const BucketName = "b"
 
+// New opens the disk cache database at the given path, creating it if it doesn't exist, and loads its index, so the cache is immediately usable with the LRU order and size it had when it was closed.
 func New(path string, cacheSizeBytes uint64) (*DiskCache, error) {
 	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
@@ -45,37 +55,30 @@ func New(path string, cacheSizeBytes uint64) (*DiskCache, error) {
 	}
 
 	err = db.Update(func(tx *bolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists([]byte(BucketName)); err != nil {
-			return errors.New("creating bucket: " + err.Error())
+		for _, name := range []string{BucketName, IndexBucketName, MetaBucketName} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return errors.New("creating bucket '" + name + "': " + err.Error())
+			}
 		}
 		return nil
 	})
 	if err != nil {
+		db.Close()
 		return nil, errors.New("creating bucket for database '" + path + "': " + err.Error())
 	}
 
-	return &DiskCache{db: db, maxSizeBytes: cacheSizeBytes, lru: lru.NewLRU(), sizeBytes: 0}, nil
+	c := &DiskCache{db: db, maxSizeBytes: cacheSizeBytes, lru: lru.NewLRU(), sizeBytes: 0, touched: map[string]uint64{}, done: make(chan struct{})}
+	if err := c.loadIndex(); err != nil {
+		db.Close()
+		return nil, errors.New("loading index for database '" + path + "': " + err.Error())
+	}
+	return c, nil
 }
 
-// ResetAfterRestart rebuilds the LRU with an arbirtrary order and sets sizeBytes. This seems crazy, but it is better than doing nothing, sice gc is based on the LRU and sizeBytes. In the future, we may want to periodically sync the LRU to disk, but we'll still need to iterate over all keys in the disk DB to avoid orphaning objects.
-// Note: this assumes the LRU is empty. Don't run twice
-func (c *DiskCache) ResetAfterRestart() {
-	go c.db.View(func(tx *bolt.Tx) error {
-		log.Infof("Starting cache recovery from disk for: %s... ", c.db.Path())
-		size := 0
-		b := tx.Bucket([]byte(BucketName))
-
-		cursor := b.Cursor()
-
-		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
-			c.lru.Add(string(k), uint64(len(v)))
-			size += len(v)
-		}
-
-		atomic.AddUint64(&c.sizeBytes, uint64(size))
-		log.Infof("Cache recovery from disk for %s done (%d bytes). ", c.db.Path(), c.sizeBytes)
-		return nil
-	})
+// Start starts syncing the LRU order of gotten objects to the index every indexSyncInterval, and scrubbing corrupt objects every scrubInterval, in the background until the cache is closed. If either interval is 0, it isn't done, and the LRU order is only synced when the cache is closed.
+func (c *DiskCache) Start(indexSyncInterval time.Duration, scrubInterval time.Duration) {
+	c.wg.Add(1)
+	go c.background(indexSyncInterval, scrubInterval)
 }
 
 // Add takes a key and value to add. Returns whether an eviction occurred
@@ -93,22 +96,26 @@ func (c *DiskCache) Add(key string, val *cacheobj.CacheObj) bool {
 		return eviction
 	}
 	valBytes := buf.Bytes()
+	entry := newEntry(key, valBytes, atomic.AddUint64(&c.access, 1))
 
 	err := c.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketName))
 		if b == nil {
 			return errors.New("bucket does not exist")
 		}
-		return b.Put([]byte(key), valBytes)
+		if err := b.Put([]byte(key), valBytes); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(IndexBucketName)).Put([]byte(key), entry.indexBytes())
 	})
 	if err != nil {
 		log.Errorln("DiskCache.Add inserting '" + key + "' in database: " + err.Error())
 		return eviction
 	}
 
-	c.lru.Add(key, uint64(len(valBytes)))
+	oldSizeBytes := c.lru.Add(key, entry.Size)
 
-	newSizeBytes := atomic.AddUint64(&c.sizeBytes, uint64(len(valBytes)))
+	newSizeBytes := atomic.AddUint64(&c.sizeBytes, entry.Size-oldSizeBytes) // wraps to subtract, if the old object was larger
 	if newSizeBytes > c.maxSizeBytes {
 		go c.gc(newSizeBytes)
 	}
@@ -136,9 +143,10 @@ func (c *DiskCache) gc(cacheSizeBytes uint64) {
 			if b == nil {
 				return errors.New("bucket does not exist")
 			}
-			b.Delete([]byte(key))
-
-			return b.Delete([]byte(key))
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+			return tx.Bucket([]byte(IndexBucketName)).Delete([]byte(key))
 		})
 		if err != nil {
 			log.Errorln("removing '" + key + "' from cache: " + err.Error())
@@ -152,7 +160,8 @@ func (c *DiskCache) gc(cacheSizeBytes uint64) {
 func (c *DiskCache) Get(key string) (*cacheobj.CacheObj, bool) {
 	val, found := c.Peek(key)
 	if found {
-		c.lru.Add(key, val.Size) // TODO directly call c.ll.MoveToFront
+		c.lru.Touch(key)
+		c.touch(key)
 		log.Debugln("DiskCache.Get getting '" + key + "' from cache and updating LRU")
 		atomic.AddUint64(&val.HitCount, 1)
 		return val, true
@@ -195,12 +204,88 @@ func (c *DiskCache) Peek(key string) (*cacheobj.CacheObj, bool) {
 	return &val, true
 }
 
+// Remove removes the object with the given key, and returns whether it existed.
+func (c *DiskCache) Remove(key string) bool {
+	exists := false
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		if b == nil {
+			return errors.New("bucket does not exist")
+		}
+		exists = b.Get([]byte(key)) != nil
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(IndexBucketName)).Delete([]byte(key))
+	})
+	if err != nil {
+		log.Errorln("DiskCache.Remove removing '" + key + "' from cache: " + err.Error())
+		return false
+	}
+	if sizeBytes, inLRU := c.lru.Remove(key); inLRU {
+		atomic.AddUint64(&c.sizeBytes, ^uint64(sizeBytes-1)) // subtract sizeBytes
+	}
+	return exists
+}
+
+// Invalidate replaces the object with the given key with an invalidated copy, and returns whether it existed.
+func (c *DiskCache) Invalidate(key string) bool {
+	exists := false
+	newSizeBytes := uint64(0)
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		if b == nil {
+			return errors.New("bucket does not exist")
+		}
+		valBytes := b.Get([]byte(key))
+		if valBytes == nil {
+			return nil
+		}
+		exists = true
+		val := cacheobj.CacheObj{}
+		if err := gob.NewDecoder(bytes.NewBuffer(valBytes)).Decode(&val); err != nil {
+			return errors.New("decoding: " + err.Error())
+		}
+		buf := bytes.Buffer{}
+		if err := gob.NewEncoder(&buf).Encode(val.Invalidate()); err != nil {
+			return errors.New("encoding: " + err.Error())
+		}
+		idx := tx.Bucket([]byte(IndexBucketName))
+		access := uint64(0) // keep the object's place in the LRU, because invalidating it isn't using it
+		if oldEntry, err := parseEntry(key, idx.Get([]byte(key))); err == nil {
+			access = oldEntry.Access
+		}
+		entry := newEntry(key, buf.Bytes(), access)
+		newSizeBytes = entry.Size
+		if err := b.Put([]byte(key), buf.Bytes()); err != nil {
+			return err
+		}
+		return idx.Put([]byte(key), entry.indexBytes())
+	})
+	if err != nil {
+		log.Errorln("DiskCache.Invalidate invalidating '" + key + "' in cache: " + err.Error())
+		return false
+	}
+	if oldSizeBytes, inLRU := c.lru.SetSize(key, newSizeBytes); inLRU {
+		atomic.AddUint64(&c.sizeBytes, newSizeBytes-oldSizeBytes) // wraps to subtract, if the old object was larger
+	}
+	return exists
+}
+
 func (c *DiskCache) Size() uint64 {
 	return atomic.LoadUint64(&c.sizeBytes)
 }
 
+// Close stops syncing the index and scrubbing, syncs the index so the cache is reopened with its current LRU order, and closes the database.
 func (c *DiskCache) Close() {
-	c.db.Close()
+	c.closed.Do(func() {
+		close(c.done)
+		c.wg.Wait()
+		if err := c.syncIndex(); err != nil {
+			log.Errorln("DiskCache.Close syncing index for " + c.db.Path() + ": " + err.Error())
+		}
+		c.db.Close()
+	})
 }
 
 func (c *DiskCache) Keys() []string {
@@ -0,0 +1,248 @@
+package diskcache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func testObj(body string) *cacheobj.CacheObj {
+	now := time.Now()
+	return cacheobj.New(http.Header{}, []byte(body), http.StatusOK, http.StatusOK, "", http.Header{}, now, now, now, now)
+}
+
+func tempCachePath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "grove-diskcache")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	return filepath.Join(dir, "cache.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestWarmRestart(t *testing.T) {
+	path, cleanup := tempCachePath(t)
+	defer cleanup()
+
+	c, err := New(path, 1024*1024)
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	c.Add("a", testObj("aaaa"))
+	c.Add("b", testObj("bbbbbbbb"))
+	c.Add("c", testObj("c"))
+	c.Add("b", testObj("b")) // replacing an object replaces its size
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected 'a' to be cached")
+	}
+	size := c.Size()
+	c.Close()
+
+	c, err = New(path, 1024*1024)
+	if err != nil {
+		t.Fatalf("reopening cache: %v", err)
+	}
+	defer c.Close()
+	if expected, actual := []string{"c", "b", "a"}, c.Keys(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected LRU order %v after restart, actual %v", expected, actual)
+	}
+	if actual := c.Size(); actual != size {
+		t.Errorf("expected size %v after restart, actual %v", size, actual)
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatalf("getting entries: %v", err)
+	}
+	sum := uint64(0)
+	for _, entry := range entries {
+		sum += entry.Size
+	}
+	if sum != size {
+		t.Errorf("expected size %v to be the sum of the index entries' sizes %v", size, sum)
+	}
+}
+
+func TestIndexMigration(t *testing.T) {
+	path, cleanup := tempCachePath(t)
+	defer cleanup()
+
+	// a database created before the index existed has only the objects
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(testObj("old")); err != nil {
+		t.Fatalf("encoding object: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(BucketName))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("old"), buf.Bytes())
+	})
+	if err != nil {
+		t.Fatalf("storing object: %v", err)
+	}
+	db.Close()
+
+	c, err := New(path, 1024*1024)
+	if err != nil {
+		t.Fatalf("opening cache: %v", err)
+	}
+	defer c.Close()
+	if actual := c.Size(); actual != uint64(buf.Len()) {
+		t.Errorf("expected size %v after indexing, actual %v", buf.Len(), actual)
+	}
+	if err := c.Check("old"); err != nil {
+		t.Errorf("expected indexed object to check, actual error %v", err)
+	}
+	if _, ok := c.Get("old"); !ok {
+		t.Error("expected indexed object to be cached")
+	}
+}
+
+func TestScrub(t *testing.T) {
+	path, cleanup := tempCachePath(t)
+	defer cleanup()
+
+	c, err := New(path, 1024*1024)
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	defer c.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		c.Add(key, testObj(key))
+	}
+	intactSize := c.Size()
+	c.Add("corrupt", testObj("corrupt"))
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BucketName)).Put([]byte("corrupt"), []byte("not an object"))
+	})
+	if err != nil {
+		t.Fatalf("corrupting object: %v", err)
+	}
+	if err := c.Check("corrupt"); err == nil {
+		t.Error("expected corrupt object to fail its check")
+	}
+
+	removed, err := c.Scrub()
+	if err != nil {
+		t.Fatalf("scrubbing: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected scrub to remove 1 object, actual %v", removed)
+	}
+	if _, ok := c.Peek("corrupt"); ok {
+		t.Error("expected scrub to remove the corrupt object")
+	}
+	if _, ok := c.Peek("a"); !ok {
+		t.Error("expected scrub to keep intact objects")
+	}
+	if actual := c.Size(); actual != intactSize {
+		t.Errorf("expected size %v after scrub, actual %v", intactSize, actual)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		key      string
+		expected bool
+		keys     []string
+	}{
+		{name: "existing", key: "a", expected: true, keys: []string{"b"}},
+		{name: "missing", key: "c", expected: false, keys: []string{"a", "b"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path, cleanup := tempCachePath(t)
+			defer cleanup()
+			c, err := New(path, 1024*1024)
+			if err != nil {
+				t.Fatalf("creating cache: %v", err)
+			}
+			defer c.Close()
+			c.Add("a", testObj("aaaa"))
+			aSize := c.Size()
+			c.Add("b", testObj("bb"))
+			bSize := c.Size() - aSize
+
+			if actual := c.Remove(test.key); actual != test.expected {
+				t.Errorf("expected Remove '%v' %v, actual %v", test.key, test.expected, actual)
+			}
+			if _, ok := c.Peek(test.key); ok {
+				t.Errorf("expected '%v' not cached after Remove", test.key)
+			}
+			if actual := c.Keys(); !reflect.DeepEqual(test.keys, actual) {
+				t.Errorf("expected keys %v after Remove, actual %v", test.keys, actual)
+			}
+			expectedSize := aSize + bSize
+			if test.expected {
+				expectedSize = bSize
+			}
+			if actual := c.Size(); actual != expectedSize {
+				t.Errorf("expected size %v after Remove, actual %v", expectedSize, actual)
+			}
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		key      string
+		expected bool
+	}{
+		{name: "existing", key: "a", expected: true},
+		{name: "missing", key: "c", expected: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path, cleanup := tempCachePath(t)
+			defer cleanup()
+			c, err := New(path, 1024*1024)
+			if err != nil {
+				t.Fatalf("creating cache: %v", err)
+			}
+			defer c.Close()
+			c.Add("a", testObj("aaaa"))
+			c.Add("b", testObj("bb"))
+
+			if actual := c.Invalidate(test.key); actual != test.expected {
+				t.Errorf("expected Invalidate '%v' %v, actual %v", test.key, test.expected, actual)
+			}
+			if obj, ok := c.Peek(test.key); ok != test.expected || (ok && !obj.Invalidated) {
+				t.Errorf("expected '%v' cached and invalidated %v, actual cached %v obj %+v", test.key, test.expected, ok, obj)
+			}
+			if obj, ok := c.Peek("b"); !ok || obj.Invalidated {
+				t.Error("expected other objects cached and not invalidated")
+			}
+			if err := c.Check(test.key); test.expected && err != nil {
+				t.Errorf("expected invalidated object to check, actual error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package diskcache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// IndexBucketName is the name of the bucket of the index of the objects in BucketName, by the same keys. Index entries are written in the same transactions as their objects, so the index is consistent with the objects after a crash.
+const IndexBucketName = "i"
+
+// MetaBucketName is the name of the bucket of data about the database itself.
+const MetaBucketName = "m"
+
+// IndexVersion is the version of the index format. Databases without it, which were created before the index existed, are indexed when they're opened.
+const IndexVersion = "1"
+
+const indexVersionKey = "index_version"
+
+// indexEntryLen is the length of an encoded index entry: the size, the access sequence number, and the checksum.
+const indexEntryLen = 8 + 8 + 4
+
+// scrubBatchSize is the number of objects Scrub checks in each read transaction. Long read transactions block the database from growing, so they're kept short.
+const scrubBatchSize = 1000
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Entry is the index entry of a stored object.
+type Entry struct {
+	Key string
+	// Size is the size of the stored object, in bytes.
+	Size uint64
+	// Access is the access sequence number of the object's last Add or Get, as of the last index sync. Objects with lower numbers were less recently used.
+	Access uint64
+	// Checksum is the CRC-32 (Castagnoli) of the stored object, used to detect corruption.
+	Checksum uint32
+}
+
+func newEntry(key string, valBytes []byte, access uint64) Entry {
+	return Entry{Key: key, Size: uint64(len(valBytes)), Access: access, Checksum: crc32.Checksum(valBytes, crcTable)}
+}
+
+func (e Entry) indexBytes() []byte {
+	b := make([]byte, indexEntryLen)
+	binary.BigEndian.PutUint64(b[0:8], e.Size)
+	binary.BigEndian.PutUint64(b[8:16], e.Access)
+	binary.BigEndian.PutUint32(b[16:20], e.Checksum)
+	return b
+}
+
+func parseEntry(key string, b []byte) (Entry, error) {
+	if b == nil {
+		return Entry{}, errors.New("no index entry")
+	}
+	if len(b) != indexEntryLen {
+		return Entry{}, errors.New("malformed index entry length " + strconv.Itoa(len(b)))
+	}
+	return Entry{
+		Key:      key,
+		Size:     binary.BigEndian.Uint64(b[0:8]),
+		Access:   binary.BigEndian.Uint64(b[8:16]),
+		Checksum: binary.BigEndian.Uint32(b[16:20]),
+	}, nil
+}
+
+// checkObject returns an error describing how the stored object is corrupt, if it doesn't match its index entry, or doesn't decode.
+func checkObject(key string, valBytes []byte, entryBytes []byte) error {
+	entry, err := parseEntry(key, entryBytes)
+	if err != nil {
+		return err
+	}
+	if uint64(len(valBytes)) != entry.Size {
+		return errors.New("size " + strconv.Itoa(len(valBytes)) + " doesn't match index size " + strconv.FormatUint(entry.Size, 10))
+	}
+	if crc32.Checksum(valBytes, crcTable) != entry.Checksum {
+		return errors.New("checksum doesn't match index")
+	}
+	if err := gob.NewDecoder(bytes.NewReader(valBytes)).Decode(&cacheobj.CacheObj{}); err != nil {
+		return errors.New("decoding: " + err.Error())
+	}
+	return nil
+}
+
+// Entries returns the index entries of the stored objects, from the least to the most recently used as of the last index sync.
+func (c *DiskCache) Entries() ([]Entry, error) {
+	entries := []Entry{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(IndexBucketName)).ForEach(func(k, v []byte) error {
+			entry, err := parseEntry(string(k), v)
+			if err != nil {
+				log.Errorln("DiskCache.Entries skipping '" + string(k) + "' in " + c.db.Path() + ": " + err.Error()) // the scrubber will remove its object
+				return nil
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Access < entries[j].Access })
+	return entries, nil
+}
+
+// loadIndex rebuilds the LRU and size from the index, in the order the objects were last used, so a restarted cache evicts the same objects it would have before. Objects without index entries, stored before the index existed, are indexed first, as the least recently used.
+// Note: this assumes the LRU is empty. Don't run twice
+func (c *DiskCache) loadIndex() error {
+	start := time.Now()
+	if err := c.migrateIndex(); err != nil {
+		return errors.New("indexing: " + err.Error())
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		return errors.New("reading index: " + err.Error())
+	}
+	size := uint64(0)
+	for _, entry := range entries {
+		c.lru.Add(entry.Key, entry.Size)
+		size += entry.Size
+		if entry.Access > c.access {
+			c.access = entry.Access
+		}
+	}
+	atomic.StoreUint64(&c.sizeBytes, size)
+	log.Infof("Loaded cache index for %s: %d objects, %d bytes, in %v\n", c.db.Path(), len(entries), size, time.Since(start))
+	if size > c.maxSizeBytes {
+		go c.gc(size)
+	}
+	return nil
+}
+
+// migrateIndex indexes the objects without index entries, and removes index entries without objects, if the database doesn't have the current IndexVersion.
+func (c *DiskCache) migrateIndex() error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte(MetaBucketName))
+		if string(meta.Get([]byte(indexVersionKey))) == IndexVersion {
+			return nil
+		}
+		log.Infof("Indexing cache %s\n", c.db.Path())
+		b := tx.Bucket([]byte(BucketName))
+		idx := tx.Bucket([]byte(IndexBucketName))
+
+		unindexed := map[string]Entry{}
+		if err := b.ForEach(func(k, v []byte) error {
+			if idx.Get(k) == nil {
+				unindexed[string(k)] = newEntry(string(k), v, 0)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for key, entry := range unindexed {
+			if err := idx.Put([]byte(key), entry.indexBytes()); err != nil {
+				return err
+			}
+		}
+
+		orphans := []string{}
+		if err := idx.ForEach(func(k, v []byte) error {
+			if b.Get(k) == nil {
+				orphans = append(orphans, string(k))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, key := range orphans {
+			if err := idx.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		log.Infof("Indexed cache %s: %d objects indexed, %d orphaned index entries removed\n", c.db.Path(), len(unindexed), len(orphans))
+		return meta.Put([]byte(indexVersionKey), []byte(IndexVersion))
+	})
+}
+
+// touch records that the object with the given key was used, to be written to the index by the next syncIndex.
+func (c *DiskCache) touch(key string) {
+	access := atomic.AddUint64(&c.access, 1)
+	c.touchedM.Lock()
+	defer c.touchedM.Unlock()
+	c.touched[key] = access
+}
+
+// syncIndex writes the access sequence numbers of the objects used since it was last called to the index. Objects are only written to the index as they're used when they're added, because writing to disk on every Get would be too expensive, so the LRU order of objects gotten since the last sync is lost if Grove crashes.
+func (c *DiskCache) syncIndex() error {
+	c.touchedM.Lock()
+	touched := c.touched
+	c.touched = map[string]uint64{}
+	c.touchedM.Unlock()
+	if len(touched) == 0 {
+		return nil
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		idx := tx.Bucket([]byte(IndexBucketName))
+		for key, access := range touched {
+			entry, err := parseEntry(key, idx.Get([]byte(key)))
+			if err != nil || entry.Access >= access {
+				continue // removed or re-added since it was gotten, or corrupt, which the scrubber will remove
+			}
+			entry.Access = access
+			if err := idx.Put([]byte(key), entry.indexBytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Check returns an error describing how the stored object with the given key is corrupt, if it doesn't match its index entry, or doesn't decode. Returns nil if the object is intact or doesn't exist.
+func (c *DiskCache) Check(key string) error {
+	return c.db.View(func(tx *bolt.Tx) error {
+		valBytes := tx.Bucket([]byte(BucketName)).Get([]byte(key))
+		if valBytes == nil {
+			return nil
+		}
+		return checkObject(key, valBytes, tx.Bucket([]byte(IndexBucketName)).Get([]byte(key)))
+	})
+}
+
+// Scrub checks every stored object against its index entry, and removes corrupt objects. It returns the number of objects removed. It stops early if the cache is closed.
+func (c *DiskCache) Scrub() (uint64, error) {
+	removed := uint64(0)
+	after := []byte(nil)
+	for {
+		corrupt := []string{}
+		more := false
+		err := c.db.View(func(tx *bolt.Tx) error {
+			idx := tx.Bucket([]byte(IndexBucketName))
+			cursor := tx.Bucket([]byte(BucketName)).Cursor()
+			k, v := cursor.First()
+			if after != nil {
+				if k, v = cursor.Seek(after); k != nil && bytes.Equal(k, after) {
+					k, v = cursor.Next()
+				}
+			}
+			for i := 0; k != nil && i < scrubBatchSize; k, v = cursor.Next() {
+				if err := checkObject(string(k), v, idx.Get(k)); err != nil {
+					log.Errorln("DiskCache.Scrub '" + string(k) + "' in " + c.db.Path() + " is corrupt: " + err.Error())
+					corrupt = append(corrupt, string(k))
+				}
+				after = append(after[:0], k...) // k is only valid during the transaction
+				i++
+			}
+			more = k != nil
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+		for _, key := range corrupt {
+			if c.removeCorrupt(key) {
+				removed++
+			}
+		}
+		if !more {
+			return removed, nil
+		}
+		select {
+		case <-c.done:
+			return removed, nil
+		default:
+		}
+	}
+}
+
+// removeCorrupt removes the object with the given key if it's still corrupt, and returns whether it was removed. The object is checked again in the same transaction it's removed in, in case it was replaced since it was found to be corrupt.
+func (c *DiskCache) removeCorrupt(key string) bool {
+	removed := false
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		idx := tx.Bucket([]byte(IndexBucketName))
+		valBytes := b.Get([]byte(key))
+		if valBytes == nil || checkObject(key, valBytes, idx.Get([]byte(key))) == nil {
+			return nil
+		}
+		removed = true
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return idx.Delete([]byte(key))
+	})
+	if err != nil {
+		log.Errorln("DiskCache.Scrub removing '" + key + "' from " + c.db.Path() + ": " + err.Error())
+		return false
+	}
+	if sizeBytes, inLRU := c.lru.Remove(key); inLRU {
+		atomic.AddUint64(&c.sizeBytes, ^uint64(sizeBytes-1)) // subtract sizeBytes
+	}
+	return removed
+}
+
+// background syncs the index every indexSyncInterval, and scrubs corrupt objects every scrubInterval, until the cache is closed. An interval of 0 disables it.
+func (c *DiskCache) background(indexSyncInterval time.Duration, scrubInterval time.Duration) {
+	defer c.wg.Done()
+	syncC, scrubC := (<-chan time.Time)(nil), (<-chan time.Time)(nil)
+	if indexSyncInterval > 0 {
+		syncTicker := time.NewTicker(indexSyncInterval)
+		defer syncTicker.Stop()
+		syncC = syncTicker.C
+	}
+	if scrubInterval > 0 {
+		scrubTicker := time.NewTicker(scrubInterval)
+		defer scrubTicker.Stop()
+		scrubC = scrubTicker.C
+	}
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-syncC:
+			if err := c.syncIndex(); err != nil {
+				log.Errorln("DiskCache syncing index for " + c.db.Path() + ": " + err.Error())
+			}
+		case <-scrubC:
+			start := time.Now()
+			removed, err := c.Scrub()
+			if err != nil {
+				log.Errorln("DiskCache scrubbing " + c.db.Path() + ": " + err.Error())
+			}
+			log.Infof("Scrubbed cache %s: removed %d corrupt objects in %v\n", c.db.Path(), removed, time.Since(start))
+		}
+	}
+}
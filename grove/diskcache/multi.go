@@ -16,6 +16,7 @@ package diskcache
 
 import (
 	"errors"
+	"time"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/config"
@@ -28,14 +29,18 @@ import (
 // MultiDiskCache is a disk cache using multiple files. It exists primarily to allow caching across multiple physical disks, but may be used for other purposes. For example, it may be more performant to use multiple files, or it may be advantageous to keep each remap rule in its own file. Keys are evenly distributed across the given files via consistent hashing.
 type MultiDiskCache []*DiskCache
 
-func NewMulti(files []config.CacheFile) (*MultiDiskCache, error) {
+// NewMulti creates a MultiDiskCache of the given files, each syncing its index every indexSyncInterval and scrubbing corrupt objects every scrubInterval. See DiskCache.Start.
+func NewMulti(files []config.CacheFile, indexSyncInterval time.Duration, scrubInterval time.Duration) (*MultiDiskCache, error) {
 	caches := make([]*DiskCache, len(files), len(files))
 	for i, file := range files {
 		cache, err := New(file.Path, file.Bytes)
 		if err != nil {
+			for _, opened := range caches[:i] {
+				opened.Close()
+			}
 			return nil, errors.New("creating disk cache '" + file.Path + "': " + err.Error())
 		}
-		cache.ResetAfterRestart() // should this be optional?
+		cache.Start(indexSyncInterval, scrubInterval)
 		caches[i] = cache
 	}
 
@@ -66,6 +71,14 @@ func (c *MultiDiskCache) Peek(key string) (*cacheobj.CacheObj, bool) {
 	return (*c)[i].Peek(key)
 }
 
+func (c *MultiDiskCache) Remove(key string) bool {
+	return (*c)[c.keyIdx(key)].Remove(key)
+}
+
+func (c *MultiDiskCache) Invalidate(key string) bool {
+	return (*c)[c.keyIdx(key)].Invalidate(key)
+}
+
 func (c *MultiDiskCache) Size() uint64 {
 	sum := uint64(0)
 	for _, cache := range *c {
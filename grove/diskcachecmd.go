@@ -0,0 +1,188 @@
+package main
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/diskcache"
+	"github.com/apache/trafficcontrol/grove/icache"
+)
+
+// DiskCacheCommand is the first argument which runs the offline disk cache tool, rather than the service, e.g. `grove diskcache inspect /var/cache/grove/cache0.db`.
+const DiskCacheCommand = "diskcache"
+
+const diskCacheUsage = `usage: grove diskcache <command> [flags] <file>
+
+Inspects, exports, or evicts objects in a disk cache file. Grove must not be running with the file.
+
+commands:
+  inspect [-verify]                 print the file's objects, from the least to the most recently used
+  export [-regex REGEX] [-body]     print the file's objects as JSON, one per line
+  evict (-regex REGEX | -key KEY)   remove objects, with their chunks and variants in the file
+`
+
+// diskCacheExport is the JSON of an object printed by `grove diskcache export`.
+type diskCacheExport struct {
+	Key          string      `json:"key"`
+	Code         int         `json:"code"`
+	Headers      http.Header `json:"headers"`
+	SizeBytes    uint64      `json:"size_bytes"`
+	LastModified time.Time   `json:"last_modified"`
+	HitCount     uint64      `json:"hit_count"`
+	Invalidated  bool        `json:"invalidated"`
+	Body         []byte      `json:"body,omitempty"`
+}
+
+// diskCacheCmd runs the disk cache tool with the given arguments, after DiskCacheCommand, and returns the process exit code.
+func diskCacheCmd(args []string, w io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, diskCacheUsage)
+		return 2
+	}
+	cmd, args := args[0], args[1:]
+	flags := flag.NewFlagSet(DiskCacheCommand+" "+cmd, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, diskCacheUsage) }
+	verify := flags.Bool("verify", false, "inspect: check each object against its index checksum")
+	regexStr := flags.String("regex", "", "export, evict: only objects whose keys match this regular expression")
+	key := flags.String("key", "", "evict: the key of the object to evict")
+	body := flags.Bool("body", false, "export: include object bodies")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, diskCacheUsage)
+		return 2
+	}
+	keyRegex := (*regexp.Regexp)(nil)
+	if *regexStr != "" {
+		var err error
+		if keyRegex, err = regexp.Compile(*regexStr); err != nil {
+			fmt.Fprintln(os.Stderr, "malformed regex: "+err.Error())
+			return 2
+		}
+	}
+
+	path := flags.Arg(0)
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintln(os.Stderr, "opening disk cache: "+err.Error())
+		return 1
+	}
+	c, err := diskcache.New(path, math.MaxUint64) // never evict while loading
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "opening disk cache (is Grove running with it?): "+err.Error())
+		return 1
+	}
+	defer c.Close()
+
+	switch cmd {
+	case "inspect":
+		err = inspectDiskCache(w, c, path, *verify)
+	case "export":
+		err = exportDiskCache(w, c, keyRegex, *body)
+	case "evict":
+		err = evictDiskCache(w, c, keyRegex, *key)
+	default:
+		fmt.Fprint(os.Stderr, diskCacheUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, cmd+": "+err.Error())
+		return 1
+	}
+	return 0
+}
+
+func inspectDiskCache(w io.Writer, c *diskcache.DiskCache, path string, verify bool) error {
+	entries, err := c.Entries()
+	if err != nil {
+		return err
+	}
+	corrupt := 0
+	for _, entry := range entries {
+		line := fmt.Sprintf("%d\t%s", entry.Size, entry.Key)
+		if verify {
+			if err := c.Check(entry.Key); err != nil {
+				line += "\tcorrupt: " + err.Error()
+				corrupt++
+			}
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "file: %s\nobjects: %d\nsize_bytes: %d\n", path, len(entries), c.Size())
+	if verify {
+		fmt.Fprintf(w, "corrupt: %d\n", corrupt)
+	}
+	return nil
+}
+
+func exportDiskCache(w io.Writer, c *diskcache.DiskCache, keyRegex *regexp.Regexp, body bool) error {
+	enc := json.NewEncoder(w)
+	for _, key := range c.Keys() {
+		if cacheobj.IsChunkKey(key) || (keyRegex != nil && !keyRegex.MatchString(key)) {
+			continue
+		}
+		obj, ok := c.Peek(key)
+		if !ok {
+			continue // removed or corrupt, which Peek logs
+		}
+		export := diskCacheExport{
+			Key:          key,
+			Code:         obj.Code,
+			Headers:      obj.RespHeaders,
+			SizeBytes:    obj.Size,
+			LastModified: obj.LastModified,
+			HitCount:     obj.HitCount,
+			Invalidated:  obj.Invalidated,
+		}
+		if body {
+			export.Body = obj.Body
+		}
+		if err := enc.Encode(export); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func evictDiskCache(w io.Writer, c *diskcache.DiskCache, keyRegex *regexp.Regexp, key string) error {
+	if (keyRegex == nil) == (key == "") {
+		return errors.New("exactly one of -regex or -key is required")
+	}
+	evicted := 0
+	if key != "" {
+		if icache.Purge(c, key, false) {
+			evicted++
+		}
+	} else {
+		for _, key := range c.Keys() {
+			if !cacheobj.IsChunkKey(key) && keyRegex.MatchString(key) && icache.Purge(c, key, false) {
+				evicted++
+			}
+		}
+	}
+	fmt.Fprintf(w, "evicted: %d\n", evicted)
+	return nil
+}
@@ -52,6 +52,10 @@ import (
 const ShutdownTimeout = 60 * time.Second
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == DiskCacheCommand {
+		os.Exit(diskCacheCmd(os.Args[2:], os.Stdout))
+	}
+
 	runtime.GOMAXPROCS(32) // DEBUG
 	configFileName := flag.String("cfg", "", "The config file path")
 	pprof := flag.Bool("pprof", false, "Whether to profile")
@@ -81,7 +85,7 @@ func main() {
 	}
 	log.Init(eventW, errW, warnW, infoW, debugW)
 
-	caches, err := createCaches(cfg.CacheFiles, uint64(cfg.FileMemBytes), uint64(cfg.CacheSizeBytes))
+	caches, err := createCaches(cfg.CacheFiles, uint64(cfg.FileMemBytes), uint64(cfg.CacheSizeBytes), time.Duration(cfg.CacheFilesIndexSyncMS)*time.Millisecond, time.Duration(cfg.CacheFilesScrubIntervalMS)*time.Millisecond)
 	if err != nil {
 		log.Errorln("starting service: creating caches: " + err.Error())
 		os.Exit(1)
@@ -93,24 +97,28 @@ func main() {
 	reqIdleConnTimeout := time.Duration(cfg.ReqIdleConnTimeoutMS) * time.Millisecond
 	baseTransport := remap.NewRemappingTransport(reqTimeout, reqKeepAlive, reqMaxIdleConns, reqIdleConnTimeout)
 
+	parentHealth := remapdata.NewParentHealth(cfg.ParentFailThreshold, time.Duration(cfg.ParentRetryTimeMS)*time.Millisecond)
+
 	plugins := plugin.Get(cfg.Plugins)
-	remapper, err := remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport)
+	remapper, err := remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport, parentHealth)
 	if err != nil {
 		log.Errorf("starting service: loading remap rules: %v\n", err)
 		os.Exit(1)
 	}
 
-	certs, err := loadCerts(remapper.Rules())
+	certPairs, err := ruleCertPairs(remapper.Rules())
 	if err != nil {
 		log.Errorf("starting service: loading certificates: %v\n", err)
 		os.Exit(1)
 	}
-	defaultCert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
-	if err != nil {
-		log.Errorf("starting service: loading default certificate: %v\n", err)
+	certStore := web.NewCertStore(cfg.OCSPStapling)
+	if err := certStore.Load(certPairs, web.CertKeyPair{CertFile: cfg.CertFile, KeyFile: cfg.KeyFile}); err != nil {
+		log.Errorf("starting service: loading certificates: %v\n", err)
 		os.Exit(1)
 	}
-	certs = append(certs, defaultCert)
+	if _, err := certStore.Watch(); err != nil {
+		log.Errorf("starting service: watching certificates, certificates will only be reloaded with the config: %v\n", err)
+	}
 
 	httpListener, httpConns, httpConnStateCallback, err := web.InterceptListen("tcp", fmt.Sprintf(":%d", cfg.Port))
 	if err != nil {
@@ -124,14 +132,14 @@ func main() {
 	httpsConnStateCallback := (func(net.Conn, http.ConnState))(nil)
 	tlsConfig := (*tls.Config)(nil)
 	if cfg.CertFile != "" && cfg.KeyFile != "" {
-		if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certs, cfg.DisableHTTP2); err != nil {
+		if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certStore.GetCertificate, cfg.DisableHTTP2); err != nil {
 			log.Errorf("creating HTTPS listener %v: %v\n", cfg.HTTPSPort, err)
 			return
 		}
 	}
 
 	// TODO pass total size for all file groups?
-	stats := stat.New(remapper.Rules(), caches, uint64(cfg.CacheSizeBytes), httpConns, httpsConns, Version)
+	stats := stat.New(remapper.Rules(), caches, uint64(cfg.CacheSizeBytes), httpConns, httpsConns, Version, parentHealth)
 
 	buildHandler := func(scheme string, port string, conns *web.ConnMap, stats stat.Stats, pluginContext map[string]*interface{}) *cache.HandlerPointer {
 		return cache.NewHandlerPointer(cache.NewHandler(
@@ -148,6 +156,8 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			uint64(cfg.CacheChunkSizeBytes),
+			time.Duration(cfg.RequestCollapseTimeoutMS)*time.Millisecond,
 		))
 	}
 
@@ -193,9 +203,11 @@ func main() {
 			log.Warnln("reloading config: caches changed in new config! Dynamic cache reloading is not supported! Old cache files and sizes will be used, and new cache config will NOT be loaded! Restart service to apply cache changes!")
 		}
 
+		parentHealth.SetConfig(cfg.ParentFailThreshold, time.Duration(cfg.ParentRetryTimeMS)*time.Millisecond)
+
 		plugins = plugin.Get(cfg.Plugins)
 		oldRemapper := remapper
-		remapper, err = remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport)
+		remapper, err = remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport, parentHealth)
 		if err != nil {
 			log.Errorln("reloading config: failed to load remap rules, keeping existing rules: " + err.Error())
 			remapper = oldRemapper
@@ -209,17 +221,19 @@ func main() {
 			}
 		}
 
-		if (cfg.CertFile != oldCfg.CertFile || cfg.KeyFile != oldCfg.KeyFile) && cfg.HTTPSPort != oldCfg.HTTPSPort {
-			log.Warnln("config certificate changed, but port did not. Cannot recreate listener on same port without stopping the service. Restart the service to load the new certificate.")
+		if certPairs, err := ruleCertPairs(remapper.Rules()); err != nil {
+			log.Errorln("reloading config: failed to load certificates, keeping existing certificates: " + err.Error())
+		} else if err := certStore.Load(certPairs, web.CertKeyPair{CertFile: cfg.CertFile, KeyFile: cfg.KeyFile}); err != nil {
+			log.Errorln("reloading config: failed to load certificates, keeping existing certificates: " + err.Error())
 		}
 
 		if cfg.HTTPSPort != oldCfg.HTTPSPort {
-			if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certs, cfg.DisableHTTP2); err != nil {
+			if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certStore.GetCertificate, cfg.DisableHTTP2); err != nil {
 				log.Errorf("creating HTTPS listener %v: %v\n", cfg.HTTPSPort, err)
 			}
 		}
 
-		stats = stat.New(remapper.Rules(), caches, uint64(cfg.CacheSizeBytes), httpConns, httpsConns, Version) // TODO copy stats from old stats object?
+		stats = stat.New(remapper.Rules(), caches, uint64(cfg.CacheSizeBytes), httpConns, httpsConns, Version, parentHealth) // TODO copy stats from old stats object?
 
 		httpCacheHandler := cache.NewHandler(
 			remapper,
@@ -235,6 +249,8 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			uint64(cfg.CacheChunkSizeBytes),
+			time.Duration(cfg.RequestCollapseTimeoutMS)*time.Millisecond,
 		)
 		httpHandler.Set(httpCacheHandler)
 
@@ -252,6 +268,8 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			uint64(cfg.CacheChunkSizeBytes),
+			time.Duration(cfg.RequestCollapseTimeoutMS)*time.Millisecond,
 		)
 		httpsHandler.Set(httpsCacheHandler)
 
@@ -293,9 +311,22 @@ func main() {
 	if *pprof {
 		profile()
 	}
+	go closeCachesOnTerminate(caches)
 	signalReloader(unix.SIGHUP, reloadConfig)
 }
 
+// closeCachesOnTerminate waits for Grove to be terminated or interrupted, then closes the caches, so disk caches write their indexes and are reopened warm, and exits.
+func closeCachesOnTerminate(caches map[string]icache.Cache) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, unix.SIGTERM, unix.SIGINT)
+	sig := <-c
+	log.Infof("received %v, closing caches\n", sig)
+	for _, cache := range caches {
+		cache.Close()
+	}
+	os.Exit(0)
+}
+
 func profile() {
 	go func() {
 		count := 0
@@ -358,35 +389,31 @@ func startServer(handler http.Handler, listener net.Listener, connState func(net
 	return server
 }
 
-func loadCerts(rules []remapdata.RemapRule) ([]tls.Certificate, error) {
-	certs := []tls.Certificate{}
+// ruleCertPairs returns the certificate files of the given rules, or an error if any rule has only a certificate or a key.
+func ruleCertPairs(rules []remapdata.RemapRule) ([]web.CertKeyPair, error) {
+	pairs := []web.CertKeyPair{}
 	for _, rule := range rules {
 		if rule.CertificateFile == "" && rule.CertificateKeyFile == "" {
 			continue
 		}
 		if rule.CertificateFile == "" {
-			return nil, errors.New("rule " + rule.Name + " has a certificate but no key, using default certificate\n")
+			return nil, errors.New("rule " + rule.Name + " has a key but no certificate")
 		}
 		if rule.CertificateKeyFile == "" {
-			return nil, errors.New("rule " + rule.Name + " has a key but no certificate, using default certificate\n")
-		}
-
-		cert, err := tls.LoadX509KeyPair(rule.CertificateFile, rule.CertificateKeyFile)
-		if err != nil {
-			return nil, errors.New("loading rule " + rule.Name + " certificate: " + err.Error() + "\n")
+			return nil, errors.New("rule " + rule.Name + " has a certificate but no key")
 		}
-		certs = append(certs, cert)
+		pairs = append(pairs, web.CertKeyPair{CertFile: rule.CertificateFile, KeyFile: rule.CertificateKeyFile})
 	}
-	return certs, nil
+	return pairs, nil
 }
 
-// createCaches creates the caches specified in the config. The nameFiles is the map of names to groups of files, nameMemBytes is the amount of memory to use for each named group, and memCacheBytes is the amount of memory to use for the default memory cache.
-func createCaches(nameFiles map[string][]config.CacheFile, nameMemBytes uint64, memCacheBytes uint64) (map[string]icache.Cache, error) {
+// createCaches creates the caches specified in the config. The nameFiles is the map of names to groups of files, nameMemBytes is the amount of memory to use for each named group, and memCacheBytes is the amount of memory to use for the default memory cache. The indexSyncInterval and scrubInterval are passed to each group's diskcache.NewMulti.
+func createCaches(nameFiles map[string][]config.CacheFile, nameMemBytes uint64, memCacheBytes uint64, indexSyncInterval time.Duration, scrubInterval time.Duration) (map[string]icache.Cache, error) {
 	caches := map[string]icache.Cache{}
 	caches[""] = memcache.New(memCacheBytes) // default empty names to the mem cache
 
 	for name, files := range nameFiles {
-		multiDiskCache, err := diskcache.NewMulti(files)
+		multiDiskCache, err := diskcache.NewMulti(files, indexSyncInterval, scrubInterval)
 		if err != nil {
 			return nil, errors.New("creating cache '" + name + "': " + err.Error())
 		}
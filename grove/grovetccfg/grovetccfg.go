@@ -15,6 +15,7 @@ package main
 */
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
@@ -494,7 +495,7 @@ func createRulesOldAPI(toc *to.Session, host string, certDir string, servers map
 		os.Exit(1)
 	}
 
-	parents, err := getParents(host, servers, cachegroups)
+	parents, secondaryParents, err := getParents(host, servers, cachegroups)
 	if err != nil {
 		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting '" + host + "' parents: " + err.Error())
 		os.Exit(1)
@@ -513,6 +514,8 @@ func createRulesOldAPI(toc *to.Session, host string, certDir string, servers map
 
 	parents = filterParents(parents, sameCDN)
 	parents = filterParents(parents, serverAvailable)
+	secondaryParents = filterParents(secondaryParents, sameCDN)
+	secondaryParents = filterParents(secondaryParents, serverAvailable)
 
 	cdnSSLKeys, _, err := toc.GetCDNSSLKeys(hostServer.CDNName)
 	if err != nil {
@@ -521,7 +524,7 @@ func createRulesOldAPI(toc *to.Session, host string, certDir string, servers map
 	}
 	dsCerts := makeDSCertMap(cdnSSLKeys)
 
-	return createRulesOld(host, deliveryservices, parents, deliveryserviceRegexes, cdns, serverParameters, dsCerts, certDir)
+	return createRulesOld(host, deliveryservices, parents, secondaryParents, deliveryserviceRegexes, cdns, serverParameters, dsCerts, certDir)
 }
 
 // func createRulesNewAPI(toc *to.Session, host string, certDir string) (remap.RemapRules, error) {
@@ -696,24 +699,28 @@ func makeDSCertMap(sslKeys []tc.CDNSSLKeys) map[string]tc.CDNSSLKeys {
 	return m
 }
 
-func getParents(hostname string, servers map[string]tc.Server, cachegroups map[string]tc.CacheGroupNullable) ([]tc.Server, error) {
+// getParents returns the servers in the parent and secondary parent cachegroups of the given host's cachegroup.
+func getParents(hostname string, servers map[string]tc.Server, cachegroups map[string]tc.CacheGroupNullable) ([]tc.Server, []tc.Server, error) {
 	server, ok := servers[hostname]
 	if !ok {
-		return nil, fmt.Errorf("hostname not found in Servers")
+		return nil, nil, fmt.Errorf("hostname not found in Servers")
 	}
 
 	cachegroup, ok := cachegroups[server.Cachegroup]
 	if !ok {
-		return nil, fmt.Errorf("server cachegroup '%v' not found in Cachegroups", server.Cachegroup)
+		return nil, nil, fmt.Errorf("server cachegroup '%v' not found in Cachegroups", server.Cachegroup)
 	}
 
 	parents := []tc.Server{}
+	secondaryParents := []tc.Server{}
 	for _, server := range servers {
 		if cachegroup.ParentName != nil && server.Cachegroup == *cachegroup.ParentName {
 			parents = append(parents, server)
+		} else if cachegroup.SecondaryParentName != nil && server.Cachegroup == *cachegroup.SecondaryParentName {
+			secondaryParents = append(secondaryParents, server)
 		}
 	}
-	return parents, nil
+	return parents, secondaryParents, nil
 }
 
 func filterParents(parents []tc.Server, include func(tc.Server) bool) []tc.Server {
@@ -746,6 +753,12 @@ func trimLiteralRegex(s string) (string, bool) {
 	return s, false
 }
 
+// literalHost returns the host matched by the given delivery service host regex, with escaped dots unescaped, and whether it's a literal host, with no regex metacharacters other than dots. Delivery Services commonly have host regexes of this form, such as `cdn.example.net`, whose unescaped dots are meant literally.
+func literalHost(pattern string) (string, bool) {
+	host := strings.Replace(pattern, `\.`, ".", -1)
+	return host, !strings.ContainsAny(host, `\^$*+?()[]{}|`)
+}
+
 // buildFrom builds the remap "from" URI prefix. It assumes ttype is a delivery service type HTTP or DNS, behavior is undefined for any other ttype.
 func buildFrom(protocol string, pattern string, patternLiteralRegex bool, host string, dsType string, cdnDomain string) string {
 	if !patternLiteralRegex {
@@ -823,6 +836,35 @@ const DefaultTimeout = time.Millisecond * 5000
 const DefaultRuleConnectionClose = false
 const DefaultRuleParentSelection = remapdata.ParentSelectionTypeConsistentHash
 
+// ParentSelectionParamName is the name of the Parameter of the parent selection algorithm. This is the same as the ATS parent.config Parameter, and may be an ATS round_robin value, or a Grove parent selection.
+const ParentSelectionParamName = "algorithm"
+
+// ParentSelectionParamConfigFile is the config file of the parent selection algorithm Parameter.
+const ParentSelectionParamConfigFile = "parent.config"
+
+// getParentSelection returns the parent selection of the given profile Parameters, or DefaultRuleParentSelection if they have none, or it isn't supported.
+func getParentSelection(params []tc.Parameter) remapdata.ParentSelectionType {
+	for _, param := range params {
+		if param.Name != ParentSelectionParamName || param.ConfigFile != ParentSelectionParamConfigFile {
+			continue
+		}
+		switch value := strings.TrimSpace(param.Value); value {
+		case tc.AlgorithmConsistentHash:
+			return remapdata.ParentSelectionTypeConsistentHash
+		case "strict":
+			return remapdata.ParentSelectionTypeRoundRobin
+		case "true":
+			return remapdata.ParentSelectionTypeRoundRobinIP
+		default:
+			if ps := remapdata.ParentSelectionTypeFromString(strings.Replace(value, "_", "-", -1)); ps != remapdata.ParentSelectionTypeInvalid {
+				return ps
+			}
+			fmt.Fprintln(os.Stderr, time.Now().Format(time.RFC3339Nano)+" unsupported parent selection algorithm '"+value+"', using "+DefaultRuleParentSelection.String())
+		}
+	}
+	return DefaultRuleParentSelection
+}
+
 func getAllowIP(params []tc.Parameter) ([]*net.IPNet, error) {
 	ips := []string{}
 	for _, param := range params {
@@ -857,6 +899,7 @@ func createRulesOld(
 	hostname string,
 	dses []tc.DeliveryServiceNullable,
 	parents []tc.Server,
+	secondaryParents []tc.Server,
 	dsRegexes map[string][]tc.DeliveryServiceRegex,
 	cdns map[string]tc.CDN,
 	hostParams []tc.Parameter,
@@ -872,7 +915,8 @@ func createRulesOld(
 	weight := DefaultRuleWeight
 	retryNum := DefaultRetryNum
 	timeout := DefaultTimeout
-	parentSelection := DefaultRuleParentSelection
+	parentSelection := getParentSelection(hostParams)
+	allParents := append(append([]tc.Server{}, parents...), secondaryParents...)
 
 	for _, ds := range dses {
 		protocol := *ds.Protocol
@@ -941,10 +985,22 @@ func createRulesOld(
 			}
 
 			for _, dsRegex := range regexes {
+				if dsRegex.Type != string(tc.DSMatchTypeHostRegex) {
+					continue // path and header regexes are only used for routing by Traffic Router
+				}
 				rule := remapdata.RemapRule{}
 				pattern, patternLiteralRegex := trimLiteralRegex(dsRegex.Pattern)
 				rule.Name = fmt.Sprintf("%s.%s.%s.%s", *ds.XMLID, protocolStr.From, protocolStr.To, pattern)
-				rule.From = buildFrom(protocolStr.From, pattern, patternLiteralRegex, hostname, dsType, cdn.DomainName)
+				host, isLiteralHost := literalHost(pattern)
+				switch {
+				case patternLiteralRegex:
+					rule.From = buildFrom(protocolStr.From, pattern, patternLiteralRegex, hostname, dsType, cdn.DomainName)
+				case isLiteralHost:
+					rule.From = protocolStr.From + "://" + host
+				default:
+					rule.From = protocolStr.From + "://"
+					rule.HostRegex = dsRegex.Pattern
+				}
 
 				if protocolStr.From == "https" && hasCert {
 					rule.CertificateFile = getCertFileName(cert, certDir)
@@ -988,7 +1044,7 @@ func createRulesOld(
 					}
 					rule.PluginsShared[web.RemapTextKey] = remapTextJSON
 				} else {
-					for _, parent := range parents {
+					for i, parent := range allParents {
 						to, proxyURLStr := buildTo(parent, protocolStr.To, orgServerFQDN, dsType)
 						proxyURL, err := url.Parse(proxyURLStr)
 						if err != nil {
@@ -997,9 +1053,10 @@ func createRulesOld(
 
 						ruleTo := remapdata.RemapRuleTo{
 							RemapRuleToBase: remapdata.RemapRuleToBase{
-								URL:      to,
-								Weight:   &weight,
-								RetryNum: &retryNum,
+								URL:       to,
+								Weight:    &weight,
+								RetryNum:  &retryNum,
+								Secondary: i >= len(parents),
 							},
 							ProxyURL:   proxyURL,
 							RetryCodes: DefaultRetryCodes(),
@@ -1062,7 +1119,7 @@ func createCertificateFiles(cert tc.CDNSSLKeys, dir string) error {
 	if err != nil {
 		return errors.New("base64decoding certificate file " + certFileName + ": " + err.Error())
 	}
-	if err := ioutil.WriteFile(certFileName, crt, 0644); err != nil {
+	if err := writeCertFile(certFileName, crt); err != nil {
 		return errors.New("writing certificate file " + certFileName + ": " + err.Error())
 	}
 
@@ -1071,12 +1128,26 @@ func createCertificateFiles(cert tc.CDNSSLKeys, dir string) error {
 	if err != nil {
 		return errors.New("base64decoding certificate key " + keyFileName + ": " + err.Error())
 	}
-	if err := ioutil.WriteFile(keyFileName, key, 0644); err != nil {
+	if err := writeCertFile(keyFileName, key); err != nil {
 		return errors.New("writing certificate key file " + keyFileName + ": " + err.Error())
 	}
 	return nil
 }
 
+// writeCertFile writes the given certificate or key file, if it changed. The file is replaced atomically by renaming, so Grove, which reloads certificates when their files change, never loads a partially written file.
+func writeCertFile(path string, bts []byte) error {
+	if existing, err := ioutil.ReadFile(path); err == nil && bytes.Equal(existing, bts) {
+		return nil
+	}
+	if err := WriteNewFile(path, bts); err != nil {
+		return err
+	}
+	if err := os.Rename(NewFilename(path), path); err != nil {
+		return errors.New("renaming new file: " + err.Error())
+	}
+	return nil
+}
+
 // makeACL is a hack to take the very ATS/TrafficControl remap_text field ACLs, and turn them into grove ACLs
 // note that the astats ACL input already has CIDR notation, but the DS ACL input is IP ranges.
 func makeACL(remapTxt string) ([]*net.IPNet, error) {
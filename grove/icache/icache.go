@@ -26,6 +26,30 @@ type Cache interface {
 	Get(key string) (*cacheobj.CacheObj, bool)
 	Peek(key string) (*cacheobj.CacheObj, bool)
 	Keys() []string
+	// Remove removes the object with the given key, and returns whether it existed.
+	Remove(key string) bool
+	// Invalidate marks the object with the given key invalidated, so it must be revalidated with the parent before it's reused, and returns whether it existed.
+	Invalidate(key string) bool
 	Size() uint64
 	Close()
 }
+
+// Purge removes the object with the given key from the cache, along with its chunks, if it's chunked, or its variants, if it's a variant index. If soft, the object, or its variants, are instead invalidated, so they're revalidated with the parent before they're reused, and chunks are kept, to be reused if the object is unchanged. Returns whether the object existed.
+func Purge(c Cache, key string, soft bool) bool {
+	obj, ok := c.Peek(key)
+	if ok && obj.IsVariantIndex() {
+		for _, variant := range obj.Variants {
+			Purge(c, variant, soft)
+		}
+		if soft {
+			return true
+		}
+	} else if soft {
+		return c.Invalidate(key)
+	} else if ok && obj.Chunked() {
+		for chunk := uint64(1); chunk < obj.NumChunks(); chunk++ {
+			c.Remove(obj.ChunkKey(chunk))
+		}
+	}
+	return c.Remove(key)
+}
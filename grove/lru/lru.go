@@ -48,6 +48,30 @@ func (c *LRU) Add(key string, size uint64) uint64 {
 	return 0
 }
 
+// Touch moves the key to the front of the LRU, as the most recently used, without changing its size. Returns whether the key existed.
+func (c *LRU) Touch(key string) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	elem, ok := c.lElems[key]
+	if ok {
+		c.l.MoveToFront(elem)
+	}
+	return ok
+}
+
+// SetSize sets the size of the key, without changing its place in the LRU. Returns the old size, and whether the key existed.
+func (c *LRU) SetSize(key string, size uint64) (uint64, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	elem, ok := c.lElems[key]
+	if !ok {
+		return 0, false
+	}
+	oldSize := elem.Value.(*listObj).size
+	elem.Value.(*listObj).size = size
+	return oldSize, true
+}
+
 // RemoveOldest returns the key, size, and true if the LRU is nonempty; else false.
 func (c *LRU) RemoveOldest() (string, uint64, bool) {
 	c.m.Lock()
@@ -63,6 +87,19 @@ func (c *LRU) RemoveOldest() (string, uint64, bool) {
 	return obj.key, obj.size, true
 }
 
+// Remove removes the key from the LRU. Returns the size of the removed key, and whether it existed.
+func (c *LRU) Remove(key string) (uint64, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	elem, ok := c.lElems[key]
+	if !ok {
+		return 0, false
+	}
+	c.l.Remove(elem)
+	delete(c.lElems, key)
+	return elem.Value.(*listObj).size, true
+}
+
 // Keys returns a string array of the keys
 func (c *LRU) Keys() []string {
 	c.m.RLock()
@@ -82,6 +82,29 @@ func (c *MemCache) Add(key string, val *cacheobj.CacheObj) bool {
 	return false // TODO remove eviction from interface; it's unnecessary and expensive
 }
 
+// Remove removes the object with the given key, and returns whether it existed.
+func (c *MemCache) Remove(key string) bool {
+	c.cacheM.Lock()
+	_, ok := c.cache[key]
+	delete(c.cache, key)
+	c.cacheM.Unlock()
+	if sizeBytes, inLRU := c.lru.Remove(key); inLRU {
+		atomic.AddUint64(&c.sizeBytes, ^uint64(sizeBytes-1)) // subtract sizeBytes
+	}
+	return ok
+}
+
+// Invalidate replaces the object with the given key with an invalidated copy, and returns whether it existed.
+func (c *MemCache) Invalidate(key string) bool {
+	c.cacheM.Lock()
+	defer c.cacheM.Unlock()
+	obj, ok := c.cache[key]
+	if ok {
+		c.cache[key] = obj.Invalidate()
+	}
+	return ok
+}
+
 func (c *MemCache) Size() uint64 { return atomic.LoadUint64(&c.sizeBytes) }
 func (c *MemCache) Close()       {}
 
@@ -0,0 +1,101 @@
+package memcache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+)
+
+func testObj(body string) *cacheobj.CacheObj {
+	now := time.Now()
+	return cacheobj.New(http.Header{}, []byte(body), http.StatusOK, http.StatusOK, "", http.Header{}, now, now, now, now)
+}
+
+func TestRemove(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		key      string
+		expected bool
+		keys     []string
+	}{
+		{name: "existing", key: "a", expected: true, keys: []string{"b"}},
+		{name: "missing", key: "c", expected: false, keys: []string{"a", "b"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(1024 * 1024)
+			a, b := testObj("aaaa"), testObj("bb")
+			c.Add("a", a)
+			c.Add("b", b)
+
+			if actual := c.Remove(test.key); actual != test.expected {
+				t.Errorf("expected Remove '%v' %v, actual %v", test.key, test.expected, actual)
+			}
+			if _, ok := c.Peek(test.key); ok {
+				t.Errorf("expected '%v' not cached after Remove", test.key)
+			}
+			if actual := c.Keys(); !reflect.DeepEqual(test.keys, actual) {
+				t.Errorf("expected keys %v after Remove, actual %v", test.keys, actual)
+			}
+			expectedSize := uint64(0)
+			for _, key := range test.keys {
+				obj, _ := c.Peek(key)
+				expectedSize += obj.Size
+			}
+			if actual := c.Size(); actual != expectedSize {
+				t.Errorf("expected size %v after Remove, actual %v", expectedSize, actual)
+			}
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		key      string
+		expected bool
+	}{
+		{name: "existing", key: "a", expected: true},
+		{name: "missing", key: "c", expected: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(1024 * 1024)
+			a := testObj("aaaa")
+			c.Add("a", a)
+			c.Add("b", testObj("bb"))
+			size := c.Size()
+
+			if actual := c.Invalidate(test.key); actual != test.expected {
+				t.Errorf("expected Invalidate '%v' %v, actual %v", test.key, test.expected, actual)
+			}
+			if obj, ok := c.Peek(test.key); ok != test.expected || (ok && !obj.Invalidated) {
+				t.Errorf("expected '%v' cached and invalidated %v, actual cached %v obj %+v", test.key, test.expected, ok, obj)
+			}
+			if b, _ := c.Peek("b"); b.Invalidated {
+				t.Error("expected other objects not invalidated")
+			}
+			if a.Invalidated {
+				t.Error("expected Invalidate to not modify the cached object, which may be concurrently read")
+			}
+			if actual := c.Size(); actual != size {
+				t.Errorf("expected Invalidate to not change size %v, actual %v", size, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing,
+   software distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/stat"
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+func init() {
+	AddPlugin(10000, Funcs{onRequest: purge})
+}
+
+// PurgeEndpoint is the path of requests to purge all objects whose cache keys match a regex, or which have a cache tag.
+const PurgeEndpoint = "/_purge"
+
+// PurgeResp is the response of a purge, with the number of objects removed, or invalidated if Soft.
+type PurgeResp struct {
+	Purged uint64 `json:"purged"`
+	Soft   bool   `json:"soft"`
+}
+
+func purge(icfg interface{}, d OnRequestData) bool {
+	if !strings.HasPrefix(d.R.URL.Path, PurgeEndpoint) {
+		return false
+	}
+	reqTime := time.Now()
+
+	log.Debugf("plugin onrequest http_purge calling\n")
+
+	w := d.W
+	req := d.R
+
+	ip, err := web.GetIP(req)
+	if err != nil {
+		code := http.StatusInternalServerError
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		log.Errorln("http_purge failed to get IP: " + err.Error())
+		return true
+	}
+	if !d.StatRules.Allowed(ip) {
+		code := http.StatusForbidden
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		log.Debugln("http_purge IP " + ip.String() + " FORBIDDEN")
+		return true
+	}
+
+	if req.Method != "PURGE" && req.Method != http.MethodPost {
+		code := http.StatusMethodNotAllowed
+		w.Header().Set("Allow", "PURGE, POST")
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		return true
+	}
+
+	params := req.URL.Query()
+	tag := params.Get("tag")
+	keyRegex := (*regexp.Regexp)(nil)
+	if regexStr := params.Get("regex"); regexStr != "" {
+		if keyRegex, err = regexp.Compile(regexStr); err != nil {
+			code := http.StatusBadRequest
+			w.WriteHeader(code)
+			w.Write([]byte("malformed regex: " + err.Error()))
+			return true
+		}
+	}
+	if keyRegex == nil && tag == "" {
+		code := http.StatusBadRequest
+		w.WriteHeader(code)
+		w.Write([]byte("missing regex or tag parameter"))
+		return true
+	}
+
+	cacheNames := d.Stats.CacheNames()
+	if cacheName, ok := params["cache"]; ok {
+		if _, ok := d.Stats.CacheCapacityByName(cacheName[0]); !ok {
+			code := http.StatusNotFound
+			w.WriteHeader(code)
+			w.Write([]byte("cache '" + cacheName[0] + "' not found"))
+			return true
+		}
+		cacheNames = cacheName[:1]
+	}
+
+	resp := PurgeResp{Soft: strings.ToLower(params.Get("soft")) == "true"}
+	for _, cacheName := range cacheNames {
+		resp.Purged += purgeCache(d.Stats, cacheName, keyRegex, tag, resp.Soft)
+	}
+
+	bts, err := json.Marshal(resp)
+	if err != nil {
+		code := http.StatusInternalServerError
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+		return true
+	}
+	respCode := http.StatusOK
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(respCode)
+	w.Write(bts)
+
+	clientIP, _ := web.GetClientIPPort(req)
+	now := time.Now()
+	// log, so purges can be audited. Purging is expensive for both the cache and the parents.
+	log.EventRaw(atsEventLogStr(now, clientIP, d.Hostname, req.Host, d.Port, "-", d.Scheme, req.URL.String(), req.Method, req.Proto, respCode, now.Sub(reqTime), uint64(len(bts)), 0, 0, true, true, getCacheHitStr(true, false), "-", "-", req.UserAgent(), req.Header.Get("X-Money-Trace"), d.RequestID))
+	return true
+}
+
+// purgeCache purges the objects in the named cache whose keys match keyRegex, if it isn't nil, and which have the given tag, if it isn't empty. Returns the number of objects purged. Chunks aren't matched themselves, but are purged with their objects.
+func purgeCache(stats stat.Stats, cacheName string, keyRegex *regexp.Regexp, tag string, soft bool) uint64 {
+	purged := uint64(0)
+	for _, key := range stats.CacheKeys(cacheName) {
+		if cacheobj.IsChunkKey(key) {
+			continue
+		}
+		if keyRegex != nil && !keyRegex.MatchString(key) {
+			continue
+		}
+		if tag != "" {
+			if obj, ok := stats.CachePeek(key, cacheName); !ok || !obj.HasTag(tag) {
+				continue
+			}
+		}
+		if stats.CachePurge(key, cacheName, soft) {
+			purged++
+		}
+	}
+	return purged
+}
@@ -0,0 +1,146 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/stat"
+)
+
+func testPurgeObj(tags string) *cacheobj.CacheObj {
+	now := time.Now()
+	respHeader := http.Header{}
+	if tags != "" {
+		respHeader.Set("Surrogate-Key", tags)
+	}
+	return cacheobj.New(http.Header{}, []byte("body"), http.StatusOK, http.StatusOK, "", respHeader, now, now, now, now)
+}
+
+// newTestPurgeCache returns a cache with objects for two hosts, some tagged, and a chunked object with its chunks.
+func newTestPurgeCache() icache.Cache {
+	c := memcache.New(1024 * 1024)
+	c.Add("http://a.example.net/0", testPurgeObj("t0 t1"))
+	c.Add("http://a.example.net/1", testPurgeObj(""))
+	c.Add("http://b.example.net/0", testPurgeObj("t1"))
+
+	chunked := testPurgeObj("")
+	chunked.ChunkSize = 4
+	chunked.BodySize = 12
+	chunked.ChunkPrefix = "http://b.example.net/chunked" + cacheobj.ChunkKeySeparator + "0"
+	c.Add("http://b.example.net/chunked", chunked)
+	c.Add(chunked.ChunkKey(1), cacheobj.NewChunk([]byte("body")))
+	c.Add(chunked.ChunkKey(2), cacheobj.NewChunk([]byte("body")))
+	return c
+}
+
+func TestPurge(t *testing.T) {
+	_, denyAll, _ := net.ParseCIDR("0.0.0.0/0")
+	for _, test := range []struct {
+		name        string
+		method      string
+		path        string
+		denied      bool
+		code        int
+		purged      uint64
+		soft        bool
+		removedKeys []string
+	}{
+		{name: "regex", method: "PURGE", path: `/_purge?regex=^http://a\.example\.net/`, code: http.StatusOK, purged: 2, removedKeys: []string{"http://a.example.net/0", "http://a.example.net/1"}},
+		{name: "POST", method: http.MethodPost, path: `/_purge?regex=/1$`, code: http.StatusOK, purged: 1, removedKeys: []string{"http://a.example.net/1"}},
+		{name: "tag", method: "PURGE", path: "/_purge?tag=t1", code: http.StatusOK, purged: 2, removedKeys: []string{"http://a.example.net/0", "http://b.example.net/0"}},
+		{name: "regex and tag", method: "PURGE", path: `/_purge?tag=t1&regex=a\.example`, code: http.StatusOK, purged: 1, removedKeys: []string{"http://a.example.net/0"}},
+		{name: "soft", method: "PURGE", path: "/_purge?tag=t0&soft=true", code: http.StatusOK, purged: 1, soft: true},
+		{name: "chunked", method: "PURGE", path: "/_purge?regex=chunked", code: http.StatusOK, purged: 1, removedKeys: []string{"http://b.example.net/chunked", "http://b.example.net/chunked#0.1", "http://b.example.net/chunked#0.2"}},
+		{name: "no match", method: "PURGE", path: "/_purge?regex=nothing", code: http.StatusOK, purged: 0},
+		{name: "cache", method: "PURGE", path: "/_purge?regex=.&cache=mem", code: http.StatusOK, purged: 4, removedKeys: []string{"http://a.example.net/0", "http://a.example.net/1", "http://b.example.net/0", "http://b.example.net/chunked", "http://b.example.net/chunked#0.1", "http://b.example.net/chunked#0.2"}},
+		{name: "unknown cache", method: "PURGE", path: "/_purge?regex=.&cache=disk", code: http.StatusNotFound},
+		{name: "missing params", method: "PURGE", path: "/_purge", code: http.StatusBadRequest},
+		{name: "malformed regex", method: "PURGE", path: "/_purge?regex=(", code: http.StatusBadRequest},
+		{name: "GET", method: http.MethodGet, path: "/_purge?regex=.", code: http.StatusMethodNotAllowed},
+		{name: "forbidden", method: "PURGE", path: "/_purge?regex=.", denied: true, code: http.StatusForbidden},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestPurgeCache()
+			keys := c.Keys()
+			stats := stat.New(nil, map[string]icache.Cache{"mem": c}, 1024*1024, nil, nil, "", nil)
+			statRules := remapdata.RemapRulesStats{}
+			if test.denied {
+				statRules.Deny = []*net.IPNet{denyAll}
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(test.method, test.path, nil)
+			if handled := purge(nil, OnRequestData{W: w, R: r, Stats: stats, StatRules: statRules}); !handled {
+				t.Fatal("expected purge request to be handled")
+			}
+			if w.Code != test.code {
+				t.Fatalf("expected code %v, actual %v: %v", test.code, w.Code, w.Body.String())
+			}
+			if test.code != http.StatusOK {
+				if actual := c.Keys(); len(actual) != len(keys) {
+					t.Errorf("expected nothing purged on error, actual keys %v", actual)
+				}
+				return
+			}
+
+			resp := PurgeResp{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("expected JSON response, actual error %v: %v", err, w.Body.String())
+			}
+			if expected := (PurgeResp{Purged: test.purged, Soft: test.soft}); resp != expected {
+				t.Errorf("expected response %+v, actual %+v", expected, resp)
+			}
+
+			removedKeys := []string{}
+			for _, key := range keys {
+				obj, ok := c.Peek(key)
+				if !ok {
+					removedKeys = append(removedKeys, key)
+					continue
+				}
+				if expected := test.soft && obj.HasTag("t0"); obj.Invalidated != expected {
+					t.Errorf("expected '%v' invalidated %v, actual %v", key, expected, obj.Invalidated)
+				}
+			}
+			sort.Strings(removedKeys)
+			if test.removedKeys == nil {
+				test.removedKeys = []string{}
+			}
+			if !reflect.DeepEqual(test.removedKeys, removedKeys) {
+				t.Errorf("expected removed keys %v, actual %v", test.removedKeys, removedKeys)
+			}
+		})
+	}
+}
+
+func TestPurgeOtherPath(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PURGE", "/foo", nil)
+	if handled := purge(nil, OnRequestData{W: w, R: r}); handled {
+		t.Error("expected request not to the purge endpoint to not be handled")
+	}
+}
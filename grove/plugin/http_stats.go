@@ -25,6 +25,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/apache/trafficcontrol/grove/cachedata"
 	"github.com/apache/trafficcontrol/grove/stat"
 	"github.com/apache/trafficcontrol/grove/web"
 
@@ -103,8 +104,8 @@ func LoadSystemStats(stats stat.Stats, interfaceName string) stat.StatsSystemJSO
 func LoadRemapStats(stats stat.Stats, httpConns *web.ConnMap, httpsConns *web.ConnMap) map[string]interface{} {
 	statsRemaps := stats.Remap()
 	rules := statsRemaps.Rules()
-	jsonStats := make(map[string]interface{}, len(rules)*8) // remap has 8 members: in, out, 2xx, 3xx, 4xx, 5xx, hits, misses
-	jsonStats["server"] = "6.2.1"                           // emulate a good ATS version
+	jsonStats := make(map[string]interface{}, len(rules)*10) // remap has 10 members: in, out, 2xx, 3xx, 4xx, 5xx, hits, misses, stale while revalidate hits, stale if error hits
+	jsonStats["server"] = "6.2.1"                            // emulate a good ATS version
 	for _, rule := range rules {
 		ruleName := rule
 		statsRemap, ok := statsRemaps.Stats(ruleName)
@@ -119,11 +120,23 @@ func LoadRemapStats(stats stat.Stats, httpConns *web.ConnMap, httpsConns *web.Co
 		jsonStats["plugin.remap_stats."+ruleName+".status_5xx"] = statsRemap.Status5xx()
 		jsonStats["plugin.remap_stats."+ruleName+".cache_hits"] = statsRemap.CacheHits()
 		jsonStats["plugin.remap_stats."+ruleName+".cache_misses"] = statsRemap.CacheMisses()
+		jsonStats["plugin.remap_stats."+ruleName+".stale_while_revalidate_hits"] = statsRemap.StaleHits(cachedata.StaleWhileRevalidate)
+		jsonStats["plugin.remap_stats."+ruleName+".stale_if_error_hits"] = statsRemap.StaleHits(cachedata.StaleIfError)
+	}
+
+	for parent, status := range stats.ParentStatus() {
+		jsonStats["plugin.parent_stats."+parent+".available"] = status.Available
+		jsonStats["plugin.parent_stats."+parent+".failures"] = status.Failures
+		jsonStats["plugin.parent_stats."+parent+".down_since"] = status.DownSince
+		jsonStats["plugin.parent_stats."+parent+".mark_downs"] = status.MarkDowns
+		jsonStats["plugin.parent_stats."+parent+".latency_ms"] = status.LatencyMS
 	}
 
 	jsonStats["proxy.process.http.current_client_connections"] = httpConns.Len() + httpsConns.Len()
 	jsonStats["proxy.process.http.cache_hits"] = stats.CacheHits()
 	jsonStats["proxy.process.http.cache_misses"] = stats.CacheMisses()
+	jsonStats["proxy.process.http.stale_while_revalidate_hits"] = stats.StaleHits(cachedata.StaleWhileRevalidate)
+	jsonStats["proxy.process.http.stale_if_error_hits"] = stats.StaleHits(cachedata.StaleIfError)
 	jsonStats["proxy.process.http.cache_capacity_bytes"] = stats.CacheCapacity()
 	jsonStats["proxy.process.http.cache_size_bytes"] = stats.CacheSize()
 
@@ -149,6 +149,9 @@ func rangeReqHandleBeforeRespond(icfg interface{}, d BeforeRespondData) {
 	if cfg.Mode == "store_ranges" {
 		return // no need to do anything here.
 	}
+	if d.CacheObj != nil && d.CacheObj.Chunked() && *d.Code == d.CacheObj.Code {
+		return // the cache serves ranges of chunked objects from their chunks, and Body is only the first chunk
+	}
 
 	// mode != store_ranges
 	multipartBoundaryString := cfg.MultiPartBoundary
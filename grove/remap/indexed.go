@@ -0,0 +1,110 @@
+package remap
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+// indexedRemapper is a Remapper which supports literal prefix, wildcard host, host regex, and path regex rules, and indexes rules by host, so lookups don't scan every rule. As with literalPrefixRemapper, the first rule in the remap rules which matches is used.
+type indexedRemapper struct {
+	remap   []remapdata.RemapRule
+	plugins map[string]interface{}
+	// hosts maps the scheme and host, without any port, of literal rules to the indices of their rules, in order.
+	hosts map[string][]int
+	// wildcards maps the scheme and host suffix of wildcard host rules, for example "http://.example.net" for "http://*.example.net", to the indices of their rules, in order.
+	wildcards map[string][]int
+	// unindexed is the indices of the rules which can't be indexed by host, in order. These are host regex rules, and literal rules whose From has no path or query after the host, which as prefixes also match longer hosts and hosts with ports, for example "http://foo" matches "http://foo.example.net/".
+	unindexed []int
+}
+
+// NewIndexedRemapper returns a Remapper for the given rules, which may be literal prefix, wildcard host, host regex, or path regex rules. See remapdata.RemapRule.
+func NewIndexedRemapper(remap []remapdata.RemapRule, plugins map[string]interface{}) Remapper {
+	r := indexedRemapper{remap: remap, plugins: plugins, hosts: map[string][]int{}, wildcards: map[string][]int{}}
+	for i, rule := range remap {
+		scheme, host, rest, ok := remapdata.SplitURI(rule.From)
+		switch {
+		case rule.HostRegexp != nil || !ok || host == "":
+			r.unindexed = append(r.unindexed, i)
+		case strings.HasPrefix(host, remapdata.WildcardHostPrefix):
+			key := scheme + remapdata.StripPort(host[len(remapdata.WildcardHostPrefix)-1:])
+			r.wildcards[key] = append(r.wildcards[key], i)
+		case rest == "":
+			r.unindexed = append(r.unindexed, i)
+		default:
+			key := scheme + remapdata.StripPort(host)
+			r.hosts[key] = append(r.hosts[key], i)
+		}
+	}
+	return r
+}
+
+func (r indexedRemapper) PluginCfg() map[string]interface{} { return r.plugins }
+
+// PluginSharedCfg returns a map of remap rule names, to a map of keys to arbitrary JSON values. See literalPrefixRemapper.PluginSharedCfg.
+func (r indexedRemapper) PluginSharedCfg() map[string]map[string]json.RawMessage {
+	cfg := make(map[string]map[string]json.RawMessage, len(r.remap))
+	for _, rule := range r.remap {
+		cfg[rule.Name] = rule.PluginsShared
+	}
+	return cfg
+}
+
+// Remap returns the first rule which matches the given URI, and whether one was found. Only the rules indexed under the URI's host and its wildcard suffixes, and unindexed rules, are checked.
+func (r indexedRemapper) Remap(s string) (remapdata.RemapRule, bool) {
+	scheme, host, _, ok := remapdata.SplitURI(s)
+	if !ok {
+		return remapdata.RemapRule{}, false
+	}
+	host = remapdata.StripPort(host)
+
+	first := r.firstMatch(r.hosts[scheme+host], s, len(r.remap))
+	for i := strings.Index(host, "."); i != -1; {
+		first = r.firstMatch(r.wildcards[scheme+host[i:]], s, first)
+		next := strings.Index(host[i+1:], ".")
+		if next == -1 {
+			break
+		}
+		i += 1 + next
+	}
+	first = r.firstMatch(r.unindexed, s, first)
+
+	if first == len(r.remap) {
+		return remapdata.RemapRule{}, false
+	}
+	return r.remap[first], true
+}
+
+// firstMatch returns the first of the given rule indices, which must be in order, before the index before, whose rule matches the given URI, or before if none do.
+func (r indexedRemapper) firstMatch(indices []int, uri string, before int) int {
+	for _, i := range indices {
+		if i >= before {
+			break
+		}
+		if r.remap[i].Matches(uri) {
+			return i
+		}
+	}
+	return before
+}
+
+func (r indexedRemapper) Rules() []remapdata.RemapRule {
+	rules := make([]remapdata.RemapRule, len(r.remap))
+	copy(rules, r.remap)
+	return rules
+}
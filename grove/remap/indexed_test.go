@@ -0,0 +1,79 @@
+package remap
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+func indexedTestRule(name string, from string, hostRegex string, pathRegex string, to string) remapdata.RemapRule {
+	rule := remapdata.RemapRule{RemapRuleBase: remapdata.RemapRuleBase{Name: name, From: from, QueryString: remapdata.QueryStringRule{Remap: true}}}
+	if hostRegex != "" {
+		rule.HostRegexp = regexp.MustCompile(hostRegex)
+	}
+	if pathRegex != "" {
+		rule.PathRegexp = regexp.MustCompile(pathRegex)
+	}
+	ps := remapdata.ParentSelectionTypeConsistentHash
+	rule.ParentSelection = &ps
+	rule.To = []remapdata.RemapRuleTo{{RemapRuleToBase: remapdata.RemapRuleToBase{URL: to}}}
+	return rule
+}
+
+func TestIndexedRemapper(t *testing.T) {
+	remapper := NewIndexedRemapper([]remapdata.RemapRule{
+		indexedTestRule("images", "http://www.example.net", "", `^/images/(\w+)\.jpg$`, "http://images.origin.example/$1"),
+		indexedTestRule("www", "http://www.example.net", "", "", "http://origin.example"),
+		indexedTestRule("wildcard", "http://*.example.net/static", "", "", "http://static.origin.example"),
+		indexedTestRule("regex", "https://", `^cdn\d+\.example\.org$`, "", "https://origin.example.org"),
+		indexedTestRule("prefix", "http://foo", "", "", "http://origin.example/foo"),
+	}, nil)
+
+	tests := []struct {
+		uri  string
+		rule string
+		to   string
+	}{
+		{"http://www.example.net/images/foo.jpg?a=b", "images", "http://images.origin.example/foo?a=b"},
+		{"http://www.example.net/images/foo.png", "www", "http://origin.example/images/foo.png"},
+		{"http://www.example.net:8080/", "www", "http://origin.example:8080/"},
+		{"http://a.b.example.net/static/x", "wildcard", "http://static.origin.example/x"},
+		{"http://www.example.net/static/x", "www", "http://origin.example/static/x"},
+		{"http://example.net/static/x", "", ""},
+		{"https://cdn42.example.org/x", "regex", "https://origin.example.org/x"},
+		{"http://cdn42.example.org/x", "", ""},
+		{"http://foo.example.net/x", "prefix", "http://origin.example/foo.example.net/x"},
+		{"http://foo:8080/x", "prefix", "http://origin.example/foo:8080/x"},
+	}
+	for _, test := range tests {
+		rule, ok := remapper.Remap(test.uri)
+		if test.rule == "" {
+			if ok {
+				t.Errorf("expected '%v' not to match, actual rule '%v'", test.uri, rule.Name)
+			}
+			continue
+		}
+		if !ok || rule.Name != test.rule {
+			t.Errorf("expected '%v' to match rule '%v', actual '%v' %v", test.uri, test.rule, rule.Name, ok)
+			continue
+		}
+		if uri, _, _ := rule.URI(test.uri, rule.Parents("", "", nil), nil); uri != test.to {
+			t.Errorf("expected '%v' to remap to '%v', actual '%v'", test.uri, test.to, uri)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package remap
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+func TestParentHealth(t *testing.T) {
+	health := remapdata.NewParentHealth(2, time.Hour)
+	rule := remapdata.RemapRule{RemapRuleBase: remapdata.RemapRuleBase{Name: "foo", From: "http://foo.example.net"}, ParentHealth: health}
+	ps := remapdata.ParentSelectionTypeConsistentHash
+	rule.ParentSelection = &ps
+	weight := 1.0
+	for _, to := range []string{"http://a.example", "http://b.example", "http://c.example"} {
+		rule.To = append(rule.To, remapdata.RemapRuleTo{RemapRuleToBase: remapdata.RemapRuleToBase{URL: to, Weight: &weight}})
+	}
+	rule.ConsistentHash = makeRuleHash(rule.Name, rule.To)
+	parents := rule.Parents("/obj", "", nil)
+
+	_, first, err := rule.URI("http://foo.example.net/obj", parents, nil)
+	if err != nil {
+		t.Fatalf("selecting parent: %v", err)
+	}
+	_, second, err := rule.URI("http://foo.example.net/obj", parents, map[remapdata.Parent]int{first: 1})
+	if err != nil {
+		t.Fatalf("selecting parent after failure: %v", err)
+	}
+	if first.URL == second.URL {
+		t.Errorf("expected a different parent after a failure, actual %v both times", first.URL)
+	}
+
+	health.Failed(first.URL)
+	if !health.Available(first.URL) {
+		t.Errorf("expected parent %v available below the fail threshold", first.URL)
+	}
+	health.Failed(first.URL)
+	if health.Available(first.URL) {
+		t.Fatalf("expected parent %v down at the fail threshold", first.URL)
+	}
+	if _, parent, err := rule.URI("http://foo.example.net/obj", parents, nil); err != nil || parent.URL != second.URL {
+		t.Errorf("expected down parent %v skipped for %v, actual %v error %v", first.URL, second.URL, parent.URL, err)
+	}
+	if status := health.Status()[first.URL]; status.Available || status.MarkDowns != 1 || status.DownSince == 0 {
+		t.Errorf("expected status of down parent, actual %+v", status)
+	}
+
+	for _, to := range rule.To {
+		health.Failed(to.URL)
+		health.Failed(to.URL)
+	}
+	if _, _, err := rule.URI("http://foo.example.net/obj", parents, nil); err != nil {
+		t.Errorf("expected rule to go direct when all parents are down by default, actual error %v", err)
+	}
+	goDirect := false
+	rule.GoDirect = &goDirect
+	if _, _, err := rule.URI("http://foo.example.net/obj", parents, nil); err != remapdata.ErrAllParentsDown {
+		t.Errorf("expected ErrAllParentsDown with go_direct false, actual %v", err)
+	}
+
+	health.Succeeded(first.URL, time.Millisecond)
+	if _, parent, err := rule.URI("http://foo.example.net/obj", parents, nil); err != nil || parent.URL != first.URL {
+		t.Errorf("expected parent %v available after success, actual %v error %v", first.URL, parent.URL, err)
+	}
+
+	health.SetConfig(2, 0)
+	if _, _, err := rule.URI("http://foo.example.net/obj", parents, map[remapdata.Parent]int{first: 1}); err != nil {
+		t.Errorf("expected down parents retried after the retry interval, actual error %v", err)
+	}
+}
+
+func TestParentHealthRetrySkipsTriedParents(t *testing.T) {
+	health := remapdata.NewParentHealth(2, time.Hour)
+	rule := parentSelectionTestRule(remapdata.ParentSelectionTypeRoundRobin,
+		parentSelectionTestTo("http://a.example", 1, false),
+		parentSelectionTestTo("http://b.example", 1, false),
+		parentSelectionTestTo("http://c.example", 1, false),
+	)
+	rule.ParentHealth = health
+	retryNum := 2
+	timeout := time.Second
+	rule.RetryNum = &retryNum
+	rule.Timeout = &timeout
+
+	parents := rule.Parents("/obj", "", nil)
+	health.Failed(parents[0].URL)
+	health.Failed(parents[0].URL)
+
+	req, err := http.NewRequest(http.MethodGet, "http://foo.example.net/obj", nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	producer := &RemappingProducer{rule: rule, oldURI: "http://foo.example.net/obj", parents: parents}
+	for _, expected := range []string{parents[1].URL, parents[2].URL, parents[1].URL} {
+		remapping, _, err := producer.GetNext(req)
+		if err != nil {
+			t.Fatalf("getting next parent: %v", err)
+		}
+		if remapping.Parent != expected {
+			t.Errorf("expected parent %v with down parent %v and failed parents tried last, actual %v", expected, parents[0].URL, remapping.Parent)
+		}
+	}
+}
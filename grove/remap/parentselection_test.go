@@ -0,0 +1,124 @@
+package remap
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+func parentSelectionTestRule(ps remapdata.ParentSelectionType, tos ...remapdata.RemapRuleTo) remapdata.RemapRule {
+	rule := remapdata.RemapRule{RemapRuleBase: remapdata.RemapRuleBase{Name: "foo", From: "http://foo.example.net"}, To: tos, RoundRobin: new(uint64)}
+	rule.ParentSelection = &ps
+	return rule
+}
+
+func parentSelectionTestTo(url string, weight float64, secondary bool) remapdata.RemapRuleTo {
+	return remapdata.RemapRuleTo{RemapRuleToBase: remapdata.RemapRuleToBase{URL: url, Weight: &weight, Secondary: secondary}}
+}
+
+func parentURLs(parents []remapdata.Parent) []string {
+	urls := make([]string, len(parents))
+	for i, parent := range parents {
+		urls[i] = parent.URL
+	}
+	return urls
+}
+
+func TestParentSelection(t *testing.T) {
+	tos := []remapdata.RemapRuleTo{
+		parentSelectionTestTo("http://a.example", 1, false),
+		parentSelectionTestTo("http://b.example", 1, false),
+		parentSelectionTestTo("http://c.example", 1, false),
+		parentSelectionTestTo("http://secondary.example", 1, true),
+	}
+
+	rule := parentSelectionTestRule(remapdata.ParentSelectionTypeRoundRobin, tos...)
+	for i, expected := range []string{"http://a.example", "http://b.example", "http://c.example", "http://a.example"} {
+		parents := rule.Parents("/obj", "", nil)
+		if len(parents) != len(tos) || parents[0].URL != expected {
+			t.Errorf("round-robin request %v expected first parent %v, actual %v", i, expected, parentURLs(parents))
+		}
+		if last := parents[len(parents)-1].URL; last != "http://secondary.example" {
+			t.Errorf("round-robin request %v expected secondary parent last, actual %v", i, parentURLs(parents))
+		}
+	}
+
+	rule = parentSelectionTestRule(remapdata.ParentSelectionTypeRoundRobinIP, tos...)
+	clientIP := net.ParseIP("192.0.2.1")
+	first := rule.Parents("/obj", "", clientIP)[0].URL
+	for i := 0; i < 3; i++ {
+		if actual := rule.Parents("/other", "", clientIP)[0].URL; actual != first {
+			t.Errorf("round-robin-ip expected client to always get parent %v, actual %v", first, actual)
+		}
+	}
+
+	health := remapdata.NewParentHealth(1, time.Hour)
+	health.Succeeded("http://a.example", 30*time.Millisecond)
+	health.Succeeded("http://b.example", 10*time.Millisecond)
+	health.Succeeded("http://c.example", 20*time.Millisecond)
+	rule = parentSelectionTestRule(remapdata.ParentSelectionTypeFastest, tos...)
+	rule.ParentHealth = health
+	expected := []string{"http://b.example", "http://c.example", "http://a.example", "http://secondary.example"}
+	if actual := parentURLs(rule.Parents("/obj", "", nil)); !equalStrs(actual, expected) {
+		t.Errorf("fastest expected parents %v, actual %v", expected, actual)
+	}
+
+	rule = parentSelectionTestRule(remapdata.ParentSelectionTypeWeightedRandom,
+		parentSelectionTestTo("http://a.example", 1, false),
+		parentSelectionTestTo("http://unweighted.example", 0, false),
+		parentSelectionTestTo("http://c.example", 1, false),
+	)
+	seen := map[string]struct{}{}
+	for i := 0; i < 100; i++ {
+		parents := rule.Parents("/obj", "", nil)
+		if last := parents[len(parents)-1].URL; last != "http://unweighted.example" {
+			t.Fatalf("weighted-random expected parent with weight 0 last, actual %v", parentURLs(parents))
+		}
+		seen[parents[0].URL] = struct{}{}
+	}
+	if len(seen) != 2 {
+		t.Errorf("weighted-random expected both weighted parents selected first, actual %v", seen)
+	}
+
+	// secondary parents are requested after every primary fails, or when they're down
+	rule = parentSelectionTestRule(remapdata.ParentSelectionTypeRoundRobin, tos...)
+	rule.ParentHealth = remapdata.NewParentHealth(1, time.Hour)
+	parents := rule.Parents("/obj", "", nil)
+	if _, parent, err := rule.URI("http://foo.example.net/obj", parents, map[remapdata.Parent]int{parents[0]: 1, parents[1]: 1, parents[2]: 1}); err != nil || parent.URL != "http://secondary.example" {
+		t.Errorf("expected secondary parent after 3 failures, actual %v error %v", parent.URL, err)
+	}
+	for _, to := range tos[:3] {
+		rule.ParentHealth.Failed(to.URL)
+	}
+	if _, parent, err := rule.URI("http://foo.example.net/obj", parents, nil); err != nil || parent.URL != "http://secondary.example" {
+		t.Errorf("expected secondary parent with all primaries down, actual %v error %v", parent.URL, err)
+	}
+}
+
+func equalStrs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
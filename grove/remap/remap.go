@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -108,6 +109,9 @@ type Remapping struct {
 	RetryCodes      map[int]struct{}
 	Cache           icache.Cache
 	Transport       *http.Transport
+	MaxVariants     int
+	Parent          string
+	ParentHealth    *remapdata.ParentHealth
 }
 
 // RemappingProducer takes an HTTP Request and returns a Remapping to be used for that request.
@@ -117,6 +121,11 @@ type RemappingProducer struct {
 	rule     remapdata.RemapRule
 	cacheKey string
 	failures int
+	clientIP net.IP
+	// parents are the rule's parents in the order to request them, selected by the first GetNext.
+	parents []remapdata.Parent
+	// tried is the number of times each parent was requested, so failed parents aren't requested again until every available parent has been.
+	tried map[remapdata.Parent]int
 }
 
 func (p *RemappingProducer) CacheKey() string                  { return p.cacheKey }
@@ -126,6 +135,12 @@ func (p *RemappingProducer) Name() string                      { return p.rule.N
 func (p *RemappingProducer) DSCP() int                         { return p.rule.DSCP }
 func (p *RemappingProducer) PluginCfg() map[string]interface{} { return p.rule.Plugins }
 func (p *RemappingProducer) Cache() icache.Cache               { return p.rule.Cache }
+
+// StaleWhileRevalidate returns the rule's override of responses' stale-while-revalidate, or nil if it has none.
+func (p *RemappingProducer) StaleWhileRevalidate() *time.Duration { return p.rule.StaleWhileRevalidate }
+
+// StaleIfError returns the rule's override of requests' and responses' stale-if-error, or nil if it has none.
+func (p *RemappingProducer) StaleIfError() *time.Duration { return p.rule.StaleIfError }
 func (p *RemappingProducer) FirstFQDN() string {
 	// TODO verify To is not allowed to be constructed with < 1 element
 	return strings.TrimPrefix(strings.TrimPrefix(p.rule.To[0].URL, "http://"), "https://")
@@ -137,6 +152,16 @@ func (p *RemappingProducer) ProxyStr() string {
 	return "NONE" // TODO const?
 }
 
+// NormalizeAcceptEncoding returns whether the rule normalizes the Accept-Encoding request header. See remapdata.VaryRule.
+func (p *RemappingProducer) NormalizeAcceptEncoding() bool {
+	return p.rule.Vary.NormalizeAcceptEncoding
+}
+
+// MethodCacheKey returns the cache key of a request with the given method for the remapped URI.
+func (p *RemappingProducer) MethodCacheKey(method string) string {
+	return p.rule.CacheKey(method, p.oldURI)
+}
+
 var ErrRuleNotFound = errors.New("remap rule not found")
 var ErrIPNotAllowed = errors.New("IP not allowed")
 var ErrNoMoreRetries = errors.New("retry num exceeded")
@@ -152,7 +177,8 @@ func (hr simpleHTTPRequestRemapper) RemappingProducer(r *http.Request, scheme st
 		return nil, ErrRuleNotFound
 	}
 
-	if ip, err := web.GetIP(r); err != nil {
+	ip, err := web.GetIP(r)
+	if err != nil {
 		return nil, fmt.Errorf("parsing client IP: %v", err)
 	} else if !rule.Allowed(ip) {
 		return nil, ErrIPNotAllowed
@@ -166,6 +192,7 @@ func (hr simpleHTTPRequestRemapper) RemappingProducer(r *http.Request, scheme st
 		rule:     rule,
 		oldURI:   uri,
 		cacheKey: cacheKey,
+		clientIP: ip,
 	}, nil
 }
 
@@ -175,8 +202,18 @@ func (p *RemappingProducer) GetNext(r *http.Request) (Remapping, bool, error) {
 		return Remapping{}, false, ErrNoMoreRetries
 	}
 
-	newURI, proxyURL, transport := p.rule.URI(p.oldURI, r.URL.Path, r.URL.RawQuery, p.failures)
+	if p.parents == nil {
+		p.parents = p.rule.Parents(r.URL.Path, r.URL.RawQuery, p.clientIP)
+	}
+	newURI, parent, err := p.rule.URI(p.oldURI, p.parents, p.tried)
+	if err != nil {
+		return Remapping{}, false, err
+	}
 	p.failures++
+	if p.tried == nil {
+		p.tried = map[remapdata.Parent]int{}
+	}
+	p.tried[parent]++
 	newReq, err := http.NewRequest(r.Method, newURI, nil)
 	if err != nil {
 		return Remapping{}, false, fmt.Errorf("creating new request: %v\n", err)
@@ -192,7 +229,7 @@ func (p *RemappingProducer) GetNext(r *http.Request) (Remapping, bool, error) {
 	retryAllowed := *p.rule.RetryNum < p.failures
 	return Remapping{
 		Request:         newReq,
-		ProxyURL:        proxyURL,
+		ProxyURL:        parent.ProxyURL,
 		Name:            p.rule.Name,
 		CacheKey:        p.cacheKey,
 		ConnectionClose: p.rule.ConnectionClose,
@@ -200,7 +237,10 @@ func (p *RemappingProducer) GetNext(r *http.Request) (Remapping, bool, error) {
 		RetryNum:        *p.rule.RetryNum,
 		RetryCodes:      p.rule.RetryCodes,
 		Cache:           p.rule.Cache,
-		Transport:       transport,
+		Transport:       parent.Transport,
+		MaxVariants:     p.rule.Vary.MaxVariants,
+		Parent:          parent.ID(),
+		ParentHealth:    p.rule.ParentHealth,
 	}, retryAllowed, nil
 }
 
@@ -209,7 +249,7 @@ func RemapperToHTTP(r Remapper, statRules *remapdata.RemapRulesStats) HTTPReques
 }
 
 func NewHTTPRequestRemapper(remap []remapdata.RemapRule, plugins map[string]interface{}, statRules *remapdata.RemapRulesStats) HTTPRequestRemapper {
-	return RemapperToHTTP(NewLiteralPrefixRemapper(remap, plugins), statRules)
+	return RemapperToHTTP(NewIndexedRemapper(remap, plugins), statRules)
 }
 
 // Remapper provides a function which takes strings and maps them to other strings. This is designed for URL prefix remapping, for a reverse proxy.
@@ -316,10 +356,14 @@ type RemapRuleJSON struct {
 	RetryCodes      *[]int                     `json:"retry_codes"`
 	CacheName       *string                    `json:"cache_name"`
 	Plugins         map[string]json.RawMessage `json:"plugins"`
+	// StaleWhileRevalidateMS overrides the stale-while-revalidate of responses, in milliseconds.
+	StaleWhileRevalidateMS *int `json:"stale_while_revalidate_ms"`
+	// StaleIfErrorMS overrides the stale-if-error of requests and responses, in milliseconds.
+	StaleIfErrorMS *int `json:"stale_if_error_ms"`
 }
 
 // LoadRemapRules returns the loaded rules, the global plugins, the Stats remap rules, and any error
-func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport) ([]remapdata.RemapRule, map[string]interface{}, *remapdata.RemapRulesStats, error) {
+func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport, parentHealth *remapdata.ParentHealth) ([]remapdata.RemapRule, map[string]interface{}, *remapdata.RemapRulesStats, error) {
 	fmt.Println(time.Now().Format(time.RFC3339Nano) + " Loading Remap Rules")
 	defer func() {
 		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Loaded Remap Rules")
@@ -379,7 +423,7 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 	rules := make([]remapdata.RemapRule, len(remapRulesJSON.Rules))
 	for i, jsonRule := range remapRulesJSON.Rules {
 		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Creating Remap Rule " + jsonRule.Name)
-		rule := remapdata.RemapRule{RemapRuleBase: jsonRule.RemapRuleBase}
+		rule := remapdata.RemapRule{RemapRuleBase: jsonRule.RemapRuleBase, ParentHealth: parentHealth}
 
 		rule.Plugins = make(map[string]interface{}, len(jsonRule.Plugins))
 		for name, b := range jsonRule.Plugins {
@@ -414,6 +458,19 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 			rule.Timeout = remapRules.Timeout
 		}
 
+		if jsonRule.StaleWhileRevalidateMS != nil {
+			t := time.Duration(*jsonRule.StaleWhileRevalidateMS) * time.Millisecond
+			if rule.StaleWhileRevalidate = &t; *rule.StaleWhileRevalidate < 0 {
+				return nil, nil, nil, fmt.Errorf("error parsing rule %v stale_while_revalidate_ms must be positive: %v", rule.Name, rule.StaleWhileRevalidate)
+			}
+		}
+		if jsonRule.StaleIfErrorMS != nil {
+			t := time.Duration(*jsonRule.StaleIfErrorMS) * time.Millisecond
+			if rule.StaleIfError = &t; *rule.StaleIfError < 0 {
+				return nil, nil, nil, fmt.Errorf("error parsing rule %v stale_if_error_ms must be positive: %v", rule.Name, rule.StaleIfError)
+			}
+		}
+
 		if rule.RetryNum == nil {
 			rule.RetryNum = remapRules.RetryNum
 		}
@@ -422,6 +479,28 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 			rule.PluginsShared = remapRules.PluginsShared
 		}
 
+		if rule.HostRegex != "" {
+			if rule.From != "" && rule.From != "http://" && rule.From != "https://" {
+				return nil, nil, nil, fmt.Errorf("error parsing rule %v: from must be only the scheme with host_regex, but was '%v'", rule.Name, rule.From)
+			}
+			if rule.HostRegexp, err = regexp.Compile(rule.HostRegex); err != nil {
+				return nil, nil, nil, fmt.Errorf("error parsing rule %v host_regex: %v", rule.Name, err)
+			}
+		} else if rule.From == "" {
+			return nil, nil, nil, fmt.Errorf("error parsing rule %v - no from - must have from or host_regex", rule.Name)
+		}
+		if rule.PathRegex != "" {
+			if rule.PathRegexp, err = regexp.Compile(rule.PathRegex); err != nil {
+				return nil, nil, nil, fmt.Errorf("error parsing rule %v path_regex: %v", rule.Name, err)
+			}
+		}
+
+		if rule.Vary.MaxVariants < 0 {
+			return nil, nil, nil, fmt.Errorf("error parsing rule %v vary max_variants must be positive: %v", rule.Name, rule.Vary.MaxVariants)
+		} else if rule.Vary.MaxVariants == 0 {
+			rule.Vary.MaxVariants = remapdata.DefaultMaxVariants
+		}
+
 		cacheName := "" // default string is the default cache
 		if jsonRule.CacheName != nil {
 			cacheName = *jsonRule.CacheName
@@ -458,9 +537,22 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 		}
 
 		if *rule.ParentSelection == remapdata.ParentSelectionTypeConsistentHash {
-			rule.ConsistentHash = makeRuleHash(rule)
-		} else {
+			primaries, secondaries := []remapdata.RemapRuleTo{}, []remapdata.RemapRuleTo{}
+			for _, to := range rule.To {
+				if to.Secondary {
+					secondaries = append(secondaries, to)
+				} else {
+					primaries = append(primaries, to)
+				}
+			}
+			if len(primaries) > 0 {
+				rule.ConsistentHash = makeRuleHash(rule.Name, primaries)
+			}
+			if len(secondaries) > 0 {
+				rule.SecondaryConsistentHash = makeRuleHash(rule.Name, secondaries)
+			}
 		}
+		rule.RoundRobin = new(uint64)
 		rules[i] = rule
 	}
 
@@ -469,13 +561,13 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 
 const DefaultReplicas = 1024
 
-func makeRuleHash(rule remapdata.RemapRule) chash.ATSConsistentHash {
+func makeRuleHash(ruleName string, tos []remapdata.RemapRuleTo) chash.ATSConsistentHash {
 	h := chash.NewSimpleATSConsistentHash(DefaultReplicas)
-	for _, to := range rule.To {
+	for _, to := range tos {
 		h.Insert(&chash.ATSConsistentHashNode{Name: to.URL, ProxyURL: to.ProxyURL, Transport: to.Transport}, *to.Weight)
 	}
 	if h.First() == nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " ERROR  makeRuleHash " + rule.Name + " NodeMap empty!")
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " ERROR  makeRuleHash " + ruleName + " NodeMap empty!")
 	}
 
 	return h
@@ -563,8 +655,8 @@ func makeIPNet(cidr string) (*net.IPNet, error) {
 	return cidrnet, nil
 }
 
-func LoadRemapper(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport) (HTTPRequestRemapper, error) {
-	rules, plugins, statRules, err := LoadRemapRules(path, pluginConfigLoaders, caches, baseTransport)
+func LoadRemapper(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport, parentHealth *remapdata.ParentHealth) (HTTPRequestRemapper, error) {
+	rules, plugins, statRules, err := LoadRemapRules(path, pluginConfigLoaders, caches, baseTransport, parentHealth)
 	if err != nil {
 		return nil, err
 	}
@@ -618,6 +710,14 @@ func buildRemapRuleToJSON(r remapdata.RemapRule) RemapRuleJSON {
 		j.TimeoutMS = &t
 		*j.TimeoutMS = int(*r.Timeout / time.Millisecond)
 	}
+	if r.StaleWhileRevalidate != nil {
+		t := int(*r.StaleWhileRevalidate / time.Millisecond)
+		j.StaleWhileRevalidateMS = &t
+	}
+	if r.StaleIfError != nil {
+		t := int(*r.StaleIfError / time.Millisecond)
+		j.StaleIfErrorMS = &t
+	}
 	if r.ParentSelection != nil {
 		ps := ""
 		j.ParentSelection = &ps
@@ -0,0 +1,175 @@
+package remapdata
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// ErrAllParentsDown is returned when every parent of a remap rule is marked down, and the rule doesn't go direct.
+var ErrAllParentsDown = errors.New("all parents are marked down")
+
+// ParentHealth tracks the health and latency of parents, by ID, shared by all requests and remap rules. Parents which fail FailThreshold consecutive times are marked down, and skipped by parent selection, until they're retried after RetryInterval. This is the equivalent of the ATS parent proxy fail_threshold and retry_time.
+type ParentHealth struct {
+	parents       map[string]*parentState
+	failThreshold int
+	retryInterval time.Duration
+	m             sync.Mutex
+}
+
+type parentState struct {
+	failures int
+	down     bool
+	// downAt is when the parent was marked down, or last retried while down.
+	downAt    time.Time
+	markDowns uint64
+	latency   time.Duration
+}
+
+// ParentStatus is the health of a single parent, as served by the stats endpoint.
+type ParentStatus struct {
+	Available bool `json:"available"`
+	// Failures is the number of consecutive failures of the parent.
+	Failures int `json:"failures"`
+	// DownSince is when the parent was marked down, as a Unix timestamp, or 0 if it's available.
+	DownSince int64 `json:"down_since"`
+	// MarkDowns is the number of times the parent has been marked down.
+	MarkDowns uint64 `json:"mark_downs"`
+	// LatencyMS is the average latency of the parent's successful responses, in milliseconds.
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// NewParentHealth creates a new ParentHealth, with all parents available. If failThreshold is 0, parents are never marked down.
+func NewParentHealth(failThreshold int, retryInterval time.Duration) *ParentHealth {
+	return &ParentHealth{parents: map[string]*parentState{}, failThreshold: failThreshold, retryInterval: retryInterval}
+}
+
+// SetConfig sets the fail threshold and retry interval, for example when the config is reloaded. Parents' health is kept.
+func (h *ParentHealth) SetConfig(failThreshold int, retryInterval time.Duration) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.failThreshold = failThreshold
+	h.retryInterval = retryInterval
+}
+
+// Available returns whether the given parent may be requested: it isn't down, or RetryInterval has passed since it was marked down or last retried. If h is nil, all parents are available.
+func (h *ParentHealth) Available(parent string) bool {
+	if h == nil {
+		return true
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	state, ok := h.parents[parent]
+	return !ok || !state.down || time.Since(state.downAt) >= h.retryInterval
+}
+
+// Selected records that the given parent was selected to be requested. If it's down, this is a retry, and it won't be retried by other requests for another RetryInterval.
+func (h *ParentHealth) Selected(parent string) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	if state, ok := h.parents[parent]; ok && state.down {
+		state.downAt = time.Now()
+	}
+}
+
+// Failed records a failed request to the given parent, marking it down if it has failed FailThreshold consecutive times.
+func (h *ParentHealth) Failed(parent string) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	state, ok := h.parents[parent]
+	if !ok {
+		state = &parentState{}
+		h.parents[parent] = state
+	}
+	state.failures++
+	if state.down {
+		state.downAt = time.Now() // a failed retry
+		return
+	}
+	if h.failThreshold > 0 && state.failures >= h.failThreshold {
+		state.down = true
+		state.downAt = time.Now()
+		state.markDowns++
+		log.Warnf("parent %v marked down after %v consecutive failures, retrying in %v\n", parent, state.failures, h.retryInterval)
+	}
+}
+
+// Succeeded records a successful request to the given parent, which took the given latency to respond, marking it available.
+func (h *ParentHealth) Succeeded(parent string, latency time.Duration) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	state, ok := h.parents[parent]
+	if !ok {
+		state = &parentState{}
+		h.parents[parent] = state
+	}
+	if state.down {
+		log.Infof("parent %v marked available after successful retry\n", parent)
+	}
+	state.failures = 0
+	state.down = false
+	if state.latency == 0 {
+		state.latency = latency
+	} else {
+		state.latency += (latency - state.latency) / latencyDecay
+	}
+}
+
+// latencyDecay is the inverse of the weight of each response in a parent's average latency.
+const latencyDecay = 8
+
+// Latency returns the exponentially weighted moving average latency of the given parent's successful responses, or 0 if it has never succeeded.
+func (h *ParentHealth) Latency(parent string) time.Duration {
+	if h == nil {
+		return 0
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	if state, ok := h.parents[parent]; ok {
+		return state.latency
+	}
+	return 0
+}
+
+// Status returns the health of every parent which has been requested, by ID.
+func (h *ParentHealth) Status() map[string]ParentStatus {
+	status := map[string]ParentStatus{}
+	if h == nil {
+		return status
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	for parent, state := range h.parents {
+		parentStatus := ParentStatus{Available: !state.down, Failures: state.failures, MarkDowns: state.markDowns, LatencyMS: float64(state.latency) / float64(time.Millisecond)}
+		if state.down {
+			parentStatus.DownSince = state.downAt.Unix()
+		}
+		status[parent] = parentStatus
+	}
+	return status
+}
@@ -0,0 +1,153 @@
+package remapdata
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync/atomic"
+
+	"github.com/apache/trafficcontrol/grove/chash"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// Parent is a parent selected to request, with the proxy URL (if any) and transport to request it with.
+type Parent struct {
+	URL       string
+	ProxyURL  *url.URL
+	Transport *http.Transport
+}
+
+// ID returns the unique identifier of the parent, by which its health is tracked. This is the proxy URL, if the parent is requested through a proxy, because multiple parents may have the same URL with different proxies. Otherwise, it's the URL.
+func (p Parent) ID() string {
+	if p.ProxyURL != nil && p.ProxyURL.Host != "" {
+		return p.ProxyURL.String()
+	}
+	return p.URL
+}
+
+// Parents returns the parents of the rule, in the order they should be requested for a request with the given path, query, and client IP, according to the rule's ParentSelection. Primary parents are ordered before secondary parents, and each tier is ordered separately, so secondary parents are only requested after every primary parent has failed or is marked down.
+func (r RemapRule) Parents(path string, query string, clientIP net.IP) []Parent {
+	hashKey := path
+	if r.QueryString.Remap && query != "" {
+		hashKey += "?" + query
+	}
+	roundRobin := uint64(0)
+	if r.RoundRobin != nil {
+		roundRobin = atomic.AddUint64(r.RoundRobin, 1) - 1
+	}
+
+	primaries, secondaries := []RemapRuleTo{}, []RemapRuleTo{}
+	for _, to := range r.To {
+		if to.Secondary {
+			secondaries = append(secondaries, to)
+		} else {
+			primaries = append(primaries, to)
+		}
+	}
+	parents := r.orderParents(primaries, r.ConsistentHash, hashKey, clientIP, roundRobin)
+	return append(parents, r.orderParents(secondaries, r.SecondaryConsistentHash, hashKey, clientIP, roundRobin)...)
+}
+
+// orderParents is a helper func for Parents. It returns the given tier of parents in the order they should be requested, according to the rule's ParentSelection. In the event of failure, it logs the error and returns the parents in the order they're configured.
+func (r RemapRule) orderParents(tos []RemapRuleTo, ring chash.ATSConsistentHash, hashKey string, clientIP net.IP, roundRobin uint64) []Parent {
+	if len(tos) == 0 {
+		return nil
+	}
+	parents := make([]Parent, len(tos))
+	for i, to := range tos {
+		parents[i] = to.Parent()
+	}
+
+	switch *r.ParentSelection {
+	case ParentSelectionTypeConsistentHash:
+		return r.orderParentsConsistentHash(parents, ring, hashKey)
+	case ParentSelectionTypeRoundRobin:
+		return rotateParents(parents, roundRobin)
+	case ParentSelectionTypeRoundRobinIP:
+		h := fnv.New64a()
+		h.Write(clientIP)
+		return rotateParents(parents, h.Sum64())
+	case ParentSelectionTypeWeightedRandom:
+		return orderParentsWeightedRandom(parents, tos)
+	case ParentSelectionTypeFastest:
+		latencies := make(map[string]float64, len(parents))
+		for _, parent := range parents {
+			latencies[parent.ID()] = float64(r.ParentHealth.Latency(parent.ID()))
+		}
+		sort.SliceStable(parents, func(i, j int) bool { return latencies[parents[i].ID()] < latencies[parents[j].ID()] })
+		return parents
+	default:
+		log.Errorf("RemapRule.Parents: Rule '%v': Unknown Parent Selection type %v - using parents in configured order\n", r.Name, r.ParentSelection)
+		return parents
+	}
+}
+
+// orderParentsConsistentHash is a helper func for orderParents. It returns the distinct parents in the order they're first found walking the hash ring from the hash of hashKey. In the event of failure, it logs the error and returns the parents in the order they're configured.
+func (r RemapRule) orderParentsConsistentHash(parents []Parent, ring chash.ATSConsistentHash, hashKey string) []Parent {
+	if ring == nil {
+		log.Errorf("RemapRule.Parents: Rule '%v': Parent Selection Type ConsistentHash, but rule.ConsistentHash is nil! Using parents in configured order\n", r.Name)
+		return parents
+	}
+	iter, _, err := ring.Lookup(hashKey)
+	if err != nil {
+		log.Errorf("RemapRule.Parents: Rule '%v': Error looking up Consistent Hash! Using parents in configured order\n", r.Name)
+		return parents
+	}
+
+	ordered := make([]Parent, 0, len(parents))
+	seen := map[string]struct{}{}
+	for start := iter.Index(); ; {
+		node := iter.Val()
+		parent := Parent{URL: node.Name, ProxyURL: node.ProxyURL, Transport: node.Transport}
+		if _, ok := seen[parent.ID()]; !ok {
+			seen[parent.ID()] = struct{}{}
+			ordered = append(ordered, parent)
+		}
+		if iter = iter.NextWrap(); iter.Index() == start || len(ordered) == len(parents) {
+			return ordered
+		}
+	}
+}
+
+// rotateParents returns the parents rotated left by n, so the parent at index n modulo their number is first.
+func rotateParents(parents []Parent, n uint64) []Parent {
+	i := int(n % uint64(len(parents)))
+	return append(parents[i:], parents[:i]...)
+}
+
+// orderParentsWeightedRandom returns the parents in a random order, where each parent is more likely to be earlier in proportion to the weight of its To, using the Efraimidis-Spirakis algorithm. Parents with no weight are last.
+func orderParentsWeightedRandom(parents []Parent, tos []RemapRuleTo) []Parent {
+	keys := make(map[string]float64, len(parents))
+	for i, parent := range parents {
+		weight := 1.0
+		if tos[i].Weight != nil {
+			weight = *tos[i].Weight
+		}
+		key := 0.0
+		if weight > 0 {
+			key = math.Pow(rand.Float64(), 1/weight)
+		}
+		keys[parent.ID()] = key
+	}
+	sort.SliceStable(parents, func(i, j int) bool { return keys[parents[i].ID()] > keys[parents[j].ID()] })
+	return parents
+}
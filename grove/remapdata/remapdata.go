@@ -18,9 +18,11 @@ package remapdata
 
 import (
 	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
@@ -35,30 +37,33 @@ type ParentSelectionType string
 
 const (
 	ParentSelectionTypeConsistentHash = ParentSelectionType("consistent-hash")
-	ParentSelectionTypeRoundRobin     = ParentSelectionType("round-robin")
-	ParentSelectionTypeInvalid        = ParentSelectionType("")
+	// ParentSelectionTypeRoundRobin selects each parent in turn, for successive requests. This is ATS round_robin=strict.
+	ParentSelectionTypeRoundRobin = ParentSelectionType("round-robin")
+	// ParentSelectionTypeRoundRobinIP selects parents by the hash of the client IP, so each client always requests the same parent. This is ATS round_robin=true.
+	ParentSelectionTypeRoundRobinIP = ParentSelectionType("round-robin-ip")
+	// ParentSelectionTypeWeightedRandom selects parents randomly, in proportion to their weights.
+	ParentSelectionTypeWeightedRandom = ParentSelectionType("weighted-random")
+	// ParentSelectionTypeFastest selects the parent with the lowest average response latency. Parents which haven't been requested are selected first, so every parent's latency is measured.
+	ParentSelectionTypeFastest = ParentSelectionType("fastest")
+	ParentSelectionTypeInvalid = ParentSelectionType("")
 )
 
 func (t ParentSelectionType) String() string {
 	switch t {
-	case ParentSelectionTypeConsistentHash:
-		return "consistent-hash"
-	case ParentSelectionTypeRoundRobin:
-		return "round-robin"
+	case ParentSelectionTypeConsistentHash, ParentSelectionTypeRoundRobin, ParentSelectionTypeRoundRobinIP, ParentSelectionTypeWeightedRandom, ParentSelectionTypeFastest:
+		return string(t)
 	default:
 		return "invalid"
 	}
 }
 
 func ParentSelectionTypeFromString(s string) ParentSelectionType {
-	s = strings.ToLower(s)
-	if s == "consistent-hash" {
-		return ParentSelectionTypeConsistentHash
-	}
-	if s == "round-robin" {
-		return ParentSelectionTypeRoundRobin
+	switch t := ParentSelectionType(strings.ToLower(s)); t {
+	case ParentSelectionTypeConsistentHash, ParentSelectionTypeRoundRobin, ParentSelectionTypeRoundRobinIP, ParentSelectionTypeWeightedRandom, ParentSelectionTypeFastest:
+		return t
+	default:
+		return ParentSelectionTypeInvalid
 	}
-	return ParentSelectionTypeInvalid
 }
 
 type RemapRulesStats struct {
@@ -93,6 +98,14 @@ type RemapRuleBase struct {
 	CertificateKeyFile string          `json:"certificate-key-file"`
 	ConnectionClose    bool            `json:"connection-close"`
 	QueryString        QueryStringRule `json:"query-string"`
+	// Vary is how objects whose responses have a Vary header are cached.
+	Vary VaryRule `json:"vary"`
+	// HostRegex is a regular expression matching the request host, including any port, in place of the host of From. If it's set, From must be only the scheme, such as "https://", or empty to match any scheme.
+	HostRegex string `json:"host_regex"`
+	// PathRegex is a regular expression which must match the request path after From, or after the host of HostRegex. If it's set, its capture groups are substituted for $1, $2, etc. in the To URLs, which replace the whole path. The query string is appended unchanged.
+	PathRegex string `json:"path_regex"`
+	// GoDirect is whether to request parents when all of them are marked down, as if they were all available. If it's false, requests fail. If it's nil, it defaults to true.
+	GoDirect *bool `json:"go_direct"`
 	// ConcurrentRuleRequests is the number of concurrent requests permitted to a remap rule, that is, to an origin. If this is 0, the global config is used.
 	ConcurrentRuleRequests int                        `json:"concurrent_rule_requests"`
 	RetryNum               *int                       `json:"retry_num"`
@@ -111,6 +124,104 @@ type RemapRule struct {
 	ConsistentHash  chash.ATSConsistentHash
 	Cache           icache.Cache
 	Plugins         map[string]interface{}
+	HostRegexp      *regexp.Regexp
+	PathRegexp      *regexp.Regexp
+	ParentHealth    *ParentHealth
+	// SecondaryConsistentHash is the hash of the secondary parents in To, used by consistent hash parent selection once every primary parent has failed or is down.
+	SecondaryConsistentHash chash.ATSConsistentHash
+	// RoundRobin is the number of requests which have selected parents with the rule, shared by all copies of the rule, for round robin parent selection. It may be nil, in which case round robin always starts with the first parent.
+	RoundRobin *uint64
+	// StaleWhileRevalidate overrides the stale-while-revalidate of responses' Cache-Control, per RFC5861§3. If it's nil, responses' own are used. If it's 0, stale objects are never served while they're revalidated.
+	StaleWhileRevalidate *time.Duration
+	// StaleIfError overrides the stale-if-error of requests' and responses' Cache-Control, per RFC5861§4. If it's nil, their own are used. If it's 0, stale objects are never served when revalidating them fails, except as RFC7234§4.2.4 allows when the parent can't be reached.
+	StaleIfError *time.Duration
+}
+
+// WildcardHostPrefix is the prefix of a From host which matches any host ending with the rest of it, for example "*.example.net" matches "foo.example.net" and "foo.bar.example.net", but not "example.net".
+const WildcardHostPrefix = "*."
+
+// SplitURI splits the given URI into its scheme, including the "://" separator, its host, including any port, and the rest of the URI. If it has no scheme, ok is false.
+func SplitURI(uri string) (scheme string, host string, rest string, ok bool) {
+	schemeEnd := strings.Index(uri, "://")
+	if schemeEnd == -1 {
+		return "", "", "", false
+	}
+	scheme, uri = uri[:schemeEnd+len("://")], uri[schemeEnd+len("://"):]
+	hostEnd := strings.IndexAny(uri, "/?")
+	if hostEnd == -1 {
+		hostEnd = len(uri)
+	}
+	return scheme, uri[:hostEnd], uri[hostEnd:], true
+}
+
+// matchPrefix returns the length of the prefix of the given request URI matched by the rule's From, or HostRegexp, after which is the part remapped onto the To URL, and whether the rule's From or HostRegexp matched.
+func (r RemapRule) matchPrefix(uri string) (int, bool) {
+	if r.HostRegexp != nil {
+		scheme, host, rest, ok := SplitURI(uri)
+		if !ok || (r.From != "" && r.From != scheme) || !r.HostRegexp.MatchString(host) {
+			return 0, false
+		}
+		return len(uri) - len(rest), true
+	}
+
+	fromScheme, fromHost, fromRest, ok := SplitURI(r.From)
+	if !ok || !strings.HasPrefix(fromHost, WildcardHostPrefix) {
+		return len(r.From), strings.HasPrefix(uri, r.From)
+	}
+	scheme, host, rest, ok := SplitURI(uri)
+	if !ok || scheme != fromScheme || !strings.HasPrefix(rest, fromRest) {
+		return 0, false
+	}
+	if !strings.Contains(fromHost, ":") {
+		host = StripPort(host) // as with literal rules, a From without a port matches requests with any port
+	}
+	hostSuffix := fromHost[len(WildcardHostPrefix)-1:] // includes the leading '.'
+	if len(host) <= len(hostSuffix) || !strings.HasSuffix(host, hostSuffix) {
+		return 0, false
+	}
+	return len(uri) - len(rest) + len(fromRest), true
+}
+
+// StripPort returns the given host without any port.
+func StripPort(host string) string {
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		return host[:i]
+	}
+	return host
+}
+
+// Matches returns whether the rule matches the given request URI.
+func (r RemapRule) Matches(uri string) bool {
+	prefixLen, ok := r.matchPrefix(uri)
+	if !ok {
+		return false
+	}
+	if r.PathRegexp == nil {
+		return true
+	}
+	path := uri[prefixLen:]
+	if i := strings.Index(path, "?"); i != -1 {
+		path = path[:i]
+	}
+	return r.PathRegexp.MatchString(path)
+}
+
+// remapURI returns the given request URI remapped onto the given To URL. The rule must match the URI.
+func (r RemapRule) remapURI(to string, fromURI string) string {
+	prefixLen, _ := r.matchPrefix(fromURI)
+	rest := fromURI[prefixLen:]
+	if r.PathRegexp == nil {
+		return to + rest
+	}
+	path, query := rest, ""
+	if i := strings.Index(rest, "?"); i != -1 {
+		path, query = rest[:i], rest[i:]
+	}
+	match := r.PathRegexp.FindStringSubmatchIndex(path)
+	if match == nil {
+		return to + rest
+	}
+	return string(r.PathRegexp.ExpandString(nil, to, path, match)) + query
 }
 
 func (r *RemapRule) Allowed(ip net.IP) bool {
@@ -133,66 +244,56 @@ func (r *RemapRule) Allowed(ip net.IP) bool {
 	return false
 }
 
-// URI takes a request URI and maps it to the real URI to proxy-and-cache. The `failures` parameter indicates how many parents have tried and failed, indicating to skip to the nth hashed parent. Returns the URI to request, and the proxy URL (if any)
-func (r RemapRule) URI(fromURI string, path string, query string, failures int) (string, *url.URL, *http.Transport) {
-	fromHash := path
-	if r.QueryString.Remap && query != "" {
-		fromHash += "?" + query
+// URI takes a request URI and maps it to the real URI to proxy-and-cache. The parents are those of the rule in the order to request them, from Parents. The tried map is the number of times this request already tried each parent, so parents which failed are only tried again after the others. Parents marked down by the rule's ParentHealth are skipped. Returns the URI to request, and the parent selected, or ErrAllParentsDown if every parent is down and the rule doesn't go direct.
+func (r RemapRule) URI(fromURI string, parents []Parent, tried map[Parent]int) (string, Parent, error) {
+	parent, err := r.selectParent(parents, tried)
+	if err != nil {
+		return "", Parent{}, err
 	}
-
-	// fmt.Println("RemapRule.URI fromURI " + fromHash)
-	to, proxyURI, transport := r.uriGetTo(fromHash, failures)
-	uri := to + fromURI[len(r.From):]
+	r.ParentHealth.Selected(parent.ID())
+	uri := r.remapURI(parent.URL, fromURI)
 	if !r.QueryString.Remap {
 		if i := strings.Index(uri, "?"); i != -1 {
 			uri = uri[:i]
 		}
 	}
-	return uri, proxyURI, transport
+	return uri, parent, nil
 }
 
-// uriGetTo is a helper func for URI. It returns the To URL, based on the Parent Selection type. In the event of failure, it logs the error and returns the first parent. Also returns the URL's Proxy URI (if any).
-func (r RemapRule) uriGetTo(fromURI string, failures int) (string, *url.URL, *http.Transport) {
-	switch *r.ParentSelection {
-	case ParentSelectionTypeConsistentHash:
-		return r.uriGetToConsistentHash(fromURI, failures)
-	default:
-		log.Errorf("RemapRule.URI: Rule '%v': Unknown Parent Selection type %v - using first URI in rule\n", r.Name, r.ParentSelection)
-		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
+// selectParent is a helper func for URI. It returns the first available parent which has been tried the fewest times. If no parent is available, it returns the first parent tried the fewest times if the rule goes direct, else ErrAllParentsDown.
+func (r RemapRule) selectParent(parents []Parent, tried map[Parent]int) (Parent, error) {
+	if len(parents) == 0 {
+		return Parent{}, errors.New("rule has no parents")
 	}
-}
-
-// uriGetToConsistentHash is a helper func for URI, uriGetTo. It returns the To URL using Consistent Hashing. In the event of failure, it logs the error and returns the first parent. Also returns the Proxy URI (if any).
-func (r RemapRule) uriGetToConsistentHash(fromURI string, failures int) (string, *url.URL, *http.Transport) {
-	// fmt.Printf("DEBUGL uriGetToConsistentHash RemapRule %+v\n", r)
-	if r.ConsistentHash == nil {
-		log.Errorf("RemapRule.URI: Rule '%v': Parent Selection Type ConsistentHash, but rule.ConsistentHash is nil! Using first parent\n", r.Name)
-		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
+	if parent, ok := leastTriedParent(parents, tried, r.ParentHealth.Available); ok {
+		return parent, nil
 	}
-
-	// fmt.Printf("DEBUGL uriGetToConsistentHash\n")
-	iter, _, err := r.ConsistentHash.Lookup(fromURI)
-	if err != nil {
-		// if r.ConsistentHash.First() == nil {
-		// 	fmt.Printf("DEBUGL uriGetToConsistentHash NodeMap empty!\n")
-		// }
-		// fmt.Printf("DEBUGL uriGetToConsistentHash fromURI '%v' err %v returning '%v'\n", fromURI, err, r.To[0].URL)
-		log.Errorf("RemapRule.URI: Rule '%v': Error looking up Consistent Hash! Using first parent\n", r.Name)
-		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
+	if r.GoDirect != nil && !*r.GoDirect {
+		return Parent{}, ErrAllParentsDown
 	}
+	log.Warnf("RemapRule.URI: Rule '%v': all parents are down, going direct\n", r.Name)
+	parent, _ := leastTriedParent(parents, tried, func(string) bool { return true })
+	return parent, nil
+}
 
-	for i := 0; i < failures; i++ {
-		iter = iter.NextWrap()
+// leastTriedParent returns the first of the parents for which available returns true, which has been tried the fewest times, and false if none are available.
+func leastTriedParent(parents []Parent, tried map[Parent]int, available func(id string) bool) (Parent, bool) {
+	best, found := Parent{}, false
+	for _, parent := range parents {
+		if !available(parent.ID()) {
+			continue
+		}
+		if !found || tried[parent] < tried[best] {
+			best, found = parent, true
+		}
 	}
-
-	return iter.Val().Name, iter.Val().ProxyURL, iter.Val().Transport
+	return best, found
 }
 
 func (r RemapRule) CacheKey(method string, fromURI string) string {
 	// TODO don't cache on `to`, since it's affected by Parent Selection
 	// TODO add parent selection
-	to := r.To[0].URL
-	uri := to + fromURI[len(r.From):]
+	uri := r.remapURI(r.To[0].URL, fromURI)
 	if !r.QueryString.Cache {
 		if i := strings.Index(uri, "?"); i != -1 {
 			uri = uri[:i]
@@ -209,6 +310,8 @@ type RemapRuleToBase struct {
 	URL      string   `json:"url"`
 	Weight   *float64 `json:"weight"`
 	RetryNum *int     `json:"retry_num"`
+	// Secondary is whether this is a secondary parent, which is only requested after every primary parent has failed or is marked down.
+	Secondary bool `json:"secondary"`
 }
 
 type RemapRuleTo struct {
@@ -219,7 +322,23 @@ type RemapRuleTo struct {
 	Transport  *http.Transport
 }
 
+// Parent returns the Parent to request this To.
+func (t RemapRuleTo) Parent() Parent {
+	return Parent{URL: t.URL, ProxyURL: t.ProxyURL, Transport: t.Transport}
+}
+
 type QueryStringRule struct {
 	Remap bool `json:"remap"`
 	Cache bool `json:"cache"`
 }
+
+// DefaultMaxVariants is the default maximum number of variants of a single object stored in the cache.
+const DefaultMaxVariants = 8
+
+// VaryRule is how a remap rule caches the variants of objects whose responses have a Vary header. Each variant is stored under its own key, selected by the values of the request headers in its Vary.
+type VaryRule struct {
+	// NormalizeAcceptEncoding is whether to replace the Accept-Encoding request header with the single encoding of br or gzip it prefers, or remove it if it accepts neither, so clients with equivalent encodings share variants.
+	NormalizeAcceptEncoding bool `json:"normalize_accept_encoding"`
+	// MaxVariants is the maximum number of variants of a single object stored. When more are stored, the least recently stored are removed. If this is 0, DefaultMaxVariants is used.
+	MaxVariants int `json:"max_variants"`
+}
@@ -16,10 +16,12 @@ package stat
 
 import (
 	"net/http"
+	"regexp"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/apache/trafficcontrol/grove/cachedata"
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/remapdata"
@@ -54,20 +56,28 @@ type Stats interface {
 	CacheMisses() uint64
 	AddCacheMiss()
 
+	// StaleHits returns the number of cache hits which served stale objects for the given reason.
+	StaleHits(stale cachedata.Stale) uint64
+	AddStaleHit(stale cachedata.Stale)
+
 	CacheSize() uint64
 	CacheCapacity() uint64
 
 	// Write writes to the remapRuleStats of s, and returns the bytes written to the connection
-	Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQDN string, remoteAddr string, code int, bytesWritten uint64, cacheHit bool) uint64
+	Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQDN string, remoteAddr string, code int, bytesWritten uint64, cacheHit bool, stale cachedata.Stale) uint64
 
 	CacheKeys(string) []string
 	CacheSizeByName(string) (uint64, bool)
 	CacheCapacityByName(string) (uint64, bool)
 	CacheNames() []string
 	CachePeek(string, string) (*cacheobj.CacheObj, bool)
+	CachePurge(string, string, bool) bool
+
+	// ParentStatus returns the health of each parent which has failed, by URL.
+	ParentStatus() map[string]remapdata.ParentStatus
 }
 
-func New(remapRules []remapdata.RemapRule, caches map[string]icache.Cache, cacheCapacityBytes uint64, httpConns *web.ConnMap, httpsConns *web.ConnMap, version string) Stats {
+func New(remapRules []remapdata.RemapRule, caches map[string]icache.Cache, cacheCapacityBytes uint64, httpConns *web.ConnMap, httpsConns *web.ConnMap, version string, parentHealth *remapdata.ParentHealth) Stats {
 	cacheHits := uint64(0)
 	cacheMisses := uint64(0)
 	return &stats{
@@ -75,15 +85,17 @@ func New(remapRules []remapdata.RemapRule, caches map[string]icache.Cache, cache
 		remap:              NewStatsRemaps(remapRules),
 		cacheHits:          &cacheHits,
 		cacheMisses:        &cacheMisses,
+		staleHits:          &staleHits{},
 		caches:             caches,
 		cacheCapacityBytes: cacheCapacityBytes,
 		httpConns:          httpConns,
 		httpsConns:         httpsConns,
+		parentHealth:       parentHealth,
 	}
 }
 
 // Write writes to the remapRuleStats of s, and returns the bytes written to the connection
-func (stats *stats) Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQDN string, remoteAddr string, code int, bytesWritten uint64, cacheHit bool) uint64 {
+func (stats *stats) Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQDN string, remoteAddr string, code int, bytesWritten uint64, cacheHit bool, stale cachedata.Stale) uint64 {
 	remapRuleStats, ok := stats.Remap().Stats(reqFQDN)
 	if !ok {
 		log.Errorf("Remap rule %v not in Stats\n", reqFQDN)
@@ -114,6 +126,10 @@ func (stats *stats) Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQD
 		stats.AddCacheMiss()
 		remapRuleStats.AddCacheMiss()
 	}
+	if stale != cachedata.StaleNone {
+		stats.AddStaleHit(stale)
+		remapRuleStats.AddStaleHit(stale)
+	}
 
 	switch {
 	case code < 200:
@@ -138,10 +154,12 @@ type stats struct {
 	remap              StatsRemaps
 	cacheHits          *uint64
 	cacheMisses        *uint64
+	staleHits          *staleHits
 	caches             map[string]icache.Cache
 	cacheCapacityBytes uint64
 	httpConns          *web.ConnMap
 	httpsConns         *web.ConnMap
+	parentHealth       *remapdata.ParentHealth
 }
 
 func (s stats) Connections() uint64 {
@@ -161,6 +179,9 @@ func (s stats) AddCacheMiss()        { atomic.AddUint64(s.cacheMisses, 1) }
 func (s *stats) System() StatsSystem { return StatsSystem(s.system) }
 func (s *stats) Remap() StatsRemaps  { return s.remap }
 
+func (s stats) StaleHits(stale cachedata.Stale) uint64 { return s.staleHits.Get(stale) }
+func (s stats) AddStaleHit(stale cachedata.Stale)      { s.staleHits.Add(stale) }
+
 // CacheSizeByName returns the size of tha cache for a particular cache
 func (s stats) CacheSizeByName(cName string) (uint64, bool) {
 	if cache, ok := s.caches[cName]; ok {
@@ -197,6 +218,19 @@ func (s stats) CachePeek(key, cacheName string) (*cacheobj.CacheObj, bool) {
 	return s.caches[cacheName].Peek(key)
 }
 
+// CachePurge removes the object with the given key from the named cache, or invalidates it if soft. See icache.Purge.
+func (s stats) CachePurge(key, cacheName string, soft bool) bool {
+	cache, ok := s.caches[cacheName]
+	if !ok {
+		return false
+	}
+	return icache.Purge(cache, key, soft)
+}
+
+func (s stats) ParentStatus() map[string]remapdata.ParentStatus {
+	return s.parentHealth.Status()
+}
+
 func (s stats) CacheCapacityByName(cName string) (uint64, bool) {
 	if cache, ok := s.caches[cName]; ok {
 		return cache.Capacity(), true
@@ -229,6 +263,9 @@ type StatsRemap interface {
 	AddCacheHit()
 	CacheMisses() uint64
 	AddCacheMiss()
+
+	StaleHits(stale cachedata.Stale) uint64
+	AddStaleHit(stale cachedata.Stale)
 }
 
 func getFromFQDN(r remapdata.RemapRule) string {
@@ -245,24 +282,53 @@ func getFromFQDN(r remapdata.RemapRule) string {
 }
 
 func NewStatsRemaps(remapRules []remapdata.RemapRule) StatsRemaps {
-	m := make(map[string]StatsRemap, len(remapRules))
+	s := statsRemaps{hosts: make(map[string]StatsRemap, len(remapRules))}
 	for _, rule := range remapRules {
-		m[getFromFQDN(rule)] = NewStatsRemap() // must pre-allocate, for threadsafety, so users are never changing the map itself, only the value pointed to.
+		if rule.HostRegexp != nil {
+			s.hostRegexps = append(s.hostRegexps, rule.HostRegexp)
+			s.hosts[rule.HostRegex] = NewStatsRemap()
+			continue
+		}
+		s.hosts[getFromFQDN(rule)] = NewStatsRemap() // must pre-allocate, for threadsafety, so users are never changing the map itself, only the value pointed to.
 	}
-	return statsRemaps(m)
+	return s
 }
 
 // statsRemaps fulfills the StatsRemaps interface
-type statsRemaps map[string]StatsRemap
+type statsRemaps struct {
+	// hosts maps the FQDN of literal rules, the wildcard FQDN of wildcard host rules, and the host regex of host regex rules, to their stats.
+	hosts map[string]StatsRemap
+	// hostRegexps are the host regexes of host regex rules, whose stats are in hosts under their String.
+	hostRegexps []*regexp.Regexp
+}
 
+// Stats returns the stats of the given remap rule FQDN, or of the rule matching the given request host, if it's a wildcard or host regex rule.
 func (s statsRemaps) Stats(rule string) (StatsRemap, bool) {
-	r, ok := s[rule]
-	return r, ok
+	if r, ok := s.hosts[rule]; ok {
+		return r, true
+	}
+	host := remapdata.StripPort(rule)
+	for i := strings.Index(host, "."); i != -1; {
+		if r, ok := s.hosts[remapdata.WildcardHostPrefix[:1]+host[i:]]; ok {
+			return r, true
+		}
+		next := strings.Index(host[i+1:], ".")
+		if next == -1 {
+			break
+		}
+		i += 1 + next
+	}
+	for _, hostRegexp := range s.hostRegexps {
+		if hostRegexp.MatchString(rule) {
+			return s.hosts[hostRegexp.String()], true
+		}
+	}
+	return nil, false
 }
 
 func (s statsRemaps) Rules() []string {
-	rules := make([]string, len(s))
-	for rule := range s {
+	rules := make([]string, 0, len(s.hosts))
+	for rule := range s.hosts {
 		rules = append(rules, rule)
 	}
 	return rules
@@ -281,6 +347,7 @@ type statsRemap struct {
 	status5xx   uint64
 	cacheHits   uint64
 	cacheMisses uint64
+	staleHits   staleHits
 }
 
 func (r *statsRemap) InBytes() uint64       { return atomic.LoadUint64(&r.inBytes) }
@@ -302,6 +369,38 @@ func (r *statsRemap) AddCacheHit()      { atomic.AddUint64(&r.cacheHits, 1) }
 func (r *statsRemap) CacheMisses() uint64 { return atomic.LoadUint64(&r.cacheMisses) }
 func (r *statsRemap) AddCacheMiss()       { atomic.AddUint64(&r.cacheMisses, 1) }
 
+func (r *statsRemap) StaleHits(stale cachedata.Stale) uint64 { return r.staleHits.Get(stale) }
+func (r *statsRemap) AddStaleHit(stale cachedata.Stale)      { r.staleHits.Add(stale) }
+
+// staleHits counts the cache hits which served stale objects, by the reason they were stale.
+type staleHits struct {
+	whileRevalidate uint64
+	ifError         uint64
+}
+
+func (s *staleHits) counter(stale cachedata.Stale) *uint64 {
+	switch stale {
+	case cachedata.StaleWhileRevalidate:
+		return &s.whileRevalidate
+	case cachedata.StaleIfError:
+		return &s.ifError
+	}
+	return nil
+}
+
+func (s *staleHits) Get(stale cachedata.Stale) uint64 {
+	if c := s.counter(stale); c != nil {
+		return atomic.LoadUint64(c)
+	}
+	return 0
+}
+
+func (s *staleHits) Add(stale cachedata.Stale) {
+	if c := s.counter(stale); c != nil {
+		atomic.AddUint64(c, 1)
+	}
+}
+
 func NewStatsSystem(version string) StatsSystem {
 	return &statsSystem{version: version}
 }
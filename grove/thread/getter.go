@@ -16,6 +16,7 @@ package thread
 
 import (
 	"sync"
+	"time"
 
 	cacheobj "github.com/apache/trafficcontrol/grove/cacheobj"
 )
@@ -29,8 +30,9 @@ type GetterResp struct {
 	GetReqID uint64
 }
 
-func NewGetter() Getter {
-	return &getter{waiters: map[string][]chan GetterResp{}}
+// NewGetter creates a new Getter. The waitTimeout is the longest Waiters wait for the Author's response, before making their own requests. If it's 0, Waiters wait until the Author gets its response.
+func NewGetter(waitTimeout time.Duration) Getter {
+	return &getter{waiters: map[string][]chan GetterResp{}, waitTimeout: waitTimeout}
 }
 
 // getter implements Getter, and does a fan-in so only one real request is made to the parent at any given time, and then that object is given to all concurrent requesters.
@@ -40,13 +42,14 @@ func NewGetter() Getter {
 // Then, when other requests come in, they see that waiters[key] exists, and add themselves to it, and block reading from their chan.
 // Then, when the Author gets its response, it iterates over the Waiters and sends the response to all of them, at the same time (with the same lock, atomically) clearing the waiters for the next request that comes in.
 //
-// If the Author response can't be used, all Waiters make their own requests.
+// If the Author response can't be used, or it isn't received within the wait timeout, Waiters make their own requests.
 // Note this assumes an uncacheable response for one request is likely uncacheable for all, and it's faster and less load on the origin if so.
 // If it's likely the author request is uncacheable, but a different waiter is cacheable for all other waiters, this will be more network, more origin load, and more work. If that's the case for you, consider creating another type that fulfills the Getter interface, and making the Getter configurable.
 type getter struct {
 	// waiters is a map of cache keys to chans for getters.
-	waiters  map[string][]chan GetterResp
-	waitersM sync.Mutex
+	waiters     map[string][]chan GetterResp
+	waitersM    sync.Mutex
+	waitTimeout time.Duration
 }
 
 func (g *getter) Get(key string, actualGet func() *cacheobj.CacheObj, canUse func(*cacheobj.CacheObj) bool, reqID uint64) (*cacheobj.CacheObj, uint64) {
@@ -78,10 +81,22 @@ func (g *getter) Get(key string, actualGet func() *cacheobj.CacheObj, canUse fun
 		return obj, reqID
 	}
 
-	if waitResp := <-getChan; canUse(waitResp.CacheObj) {
-		return waitResp.CacheObj, waitResp.GetReqID
+	timeout := (<-chan time.Time)(nil) // nil blocks forever
+	if g.waitTimeout > 0 {
+		timer := time.NewTimer(g.waitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
 	}
 
-	// if the Author response can't be used, all Waiters make their own requests
+	select {
+	case waitResp := <-getChan:
+		if canUse(waitResp.CacheObj) {
+			return waitResp.CacheObj, waitResp.GetReqID
+		}
+	case <-timeout:
+		// getChan is buffered, so the Author won't block sending to it after we stop waiting
+	}
+
+	// if the Author response can't be used, or took too long, Waiters make their own requests
 	return actualGet(), reqID
 }
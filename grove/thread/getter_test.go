@@ -0,0 +1,68 @@
+package thread
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+)
+
+func getterTestObj(body string) *cacheobj.CacheObj {
+	return cacheobj.New(http.Header{}, []byte(body), http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now())
+}
+
+func TestGetterWaitTimeout(t *testing.T) {
+	g := NewGetter(10 * time.Millisecond)
+	canUse := func(*cacheobj.CacheObj) bool { return true }
+
+	authorStarted := make(chan struct{})
+	authorRelease := make(chan struct{})
+	authorDone := make(chan GetterResp)
+	go func() {
+		obj, reqID := g.Get("key", func() *cacheobj.CacheObj {
+			close(authorStarted)
+			<-authorRelease
+			return getterTestObj("author")
+		}, canUse, 1)
+		authorDone <- GetterResp{CacheObj: obj, GetReqID: reqID}
+	}()
+	<-authorStarted
+
+	obj, reqID := g.Get("key", func() *cacheobj.CacheObj { return getterTestObj("waiter") }, canUse, 2)
+	if string(obj.Body) != "waiter" || reqID != 2 {
+		t.Fatalf("expected waiter to make its own request after the wait timeout, actual body '%v' reqid %v", string(obj.Body), reqID)
+	}
+
+	close(authorRelease)
+	select {
+	case resp := <-authorDone:
+		if string(resp.CacheObj.Body) != "author" || resp.GetReqID != 1 {
+			t.Errorf("expected author its own response, actual body '%v' reqid %v", string(resp.CacheObj.Body), resp.GetReqID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected author not to block sending its late response to the waiter which stopped waiting")
+	}
+	if string(obj.Body) != "waiter" {
+		t.Errorf("expected waiter response unchanged by the author's late response, actual body '%v'", string(obj.Body))
+	}
+
+	// the late author must have removed the key's waiters, so the next request is an author
+	if obj, reqID := g.Get("key", func() *cacheobj.CacheObj { return getterTestObj("next") }, canUse, 3); string(obj.Body) != "next" || reqID != 3 {
+		t.Errorf("expected next request to be an author, actual body '%v' reqid %v", string(obj.Body), reqID)
+	}
+}
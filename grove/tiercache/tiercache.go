@@ -69,6 +69,20 @@ func (c *TierCache) Add(key string, val *cacheobj.CacheObj) bool {
 	return aevict || bevict
 }
 
+// Remove removes the object from both internal caches. Returns whether it existed in either.
+func (c *TierCache) Remove(key string) bool {
+	aexists := c.first.Remove(key)
+	bexists := c.second.Remove(key)
+	return aexists || bexists
+}
+
+// Invalidate invalidates the object in both internal caches. Returns whether it existed in either.
+func (c *TierCache) Invalidate(key string) bool {
+	aexists := c.first.Invalidate(key)
+	bexists := c.second.Invalidate(key)
+	return aexists || bexists
+}
+
 // Size returns the size of the second cache. This is because, since all objects are added to both, they are presumed to have the same content, and the second is presumed to be larger.
 //
 // For example, if the first is a memory cache and the second is a disk cache, it's most useful to report the size used on disk.
@@ -0,0 +1,95 @@
+package tiercache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/memcache"
+)
+
+func testObj(body string) *cacheobj.CacheObj {
+	now := time.Now()
+	return cacheobj.New(http.Header{}, []byte(body), http.StatusOK, http.StatusOK, "", http.Header{}, now, now, now, now)
+}
+
+// newTestTierCache returns a TierCache with the key 'both' in both caches, 'first' in only the first, and 'second' in only the second,
+// as when the first cache evicted it.
+func newTestTierCache() (*TierCache, *memcache.MemCache, *memcache.MemCache) {
+	first, second := memcache.New(1024*1024), memcache.New(1024*1024)
+	c := New(first, second)
+	c.Add("both", testObj("both"))
+	first.Add("first", testObj("first"))
+	second.Add("second", testObj("second"))
+	return c, first, second
+}
+
+func TestRemove(t *testing.T) {
+	for _, test := range []struct {
+		key      string
+		expected bool
+	}{
+		{key: "both", expected: true},
+		{key: "first", expected: true},
+		{key: "second", expected: true},
+		{key: "missing", expected: false},
+	} {
+		t.Run(test.key, func(t *testing.T) {
+			c, first, second := newTestTierCache()
+			if actual := c.Remove(test.key); actual != test.expected {
+				t.Errorf("expected Remove '%v' %v, actual %v", test.key, test.expected, actual)
+			}
+			if _, ok := first.Peek(test.key); ok {
+				t.Errorf("expected '%v' removed from the first cache", test.key)
+			}
+			if _, ok := second.Peek(test.key); ok {
+				t.Errorf("expected '%v' removed from the second cache", test.key)
+			}
+			if _, ok := c.Peek(test.key); ok {
+				t.Errorf("expected '%v' not cached after Remove", test.key)
+			}
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	for _, test := range []struct {
+		key      string
+		expected bool
+	}{
+		{key: "both", expected: true},
+		{key: "first", expected: true},
+		{key: "second", expected: true},
+		{key: "missing", expected: false},
+	} {
+		t.Run(test.key, func(t *testing.T) {
+			c, first, second := newTestTierCache()
+			if actual := c.Invalidate(test.key); actual != test.expected {
+				t.Errorf("expected Invalidate '%v' %v, actual %v", test.key, test.expected, actual)
+			}
+			for name, cache := range map[string]*memcache.MemCache{"first": first, "second": second} {
+				if obj, ok := cache.Peek(test.key); ok && !obj.Invalidated {
+					t.Errorf("expected '%v' invalidated in the %v cache", test.key, name)
+				}
+			}
+			if obj, ok := c.Peek(test.key); ok != test.expected || (ok && !obj.Invalidated) {
+				t.Errorf("expected '%v' cached and invalidated %v, actual cached %v obj %+v", test.key, test.expected, ok, obj)
+			}
+		})
+	}
+}
@@ -13,3 +13,36 @@ package web
    See the License for the specific language governing permissions and
    limitations under the License.
 */
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// StaleWhileRevalidate returns the stale-while-revalidate of the given response Cache-Control, per RFC5861§3, which is how long after the response becomes stale it may be served while it's revalidated in the background. Returns false if the response has no valid stale-while-revalidate.
+func StaleWhileRevalidate(respCC rfc.CacheControlMap) (time.Duration, bool) {
+	return getDeltaSeconds(respCC, "stale-while-revalidate")
+}
+
+// StaleIfError returns the stale-if-error of the given request or response Cache-Control, per RFC5861§4, which is how long after the response becomes stale it may be served if revalidating it fails. The request's takes precedence, because it's the client's limit on the staleness it accepts. Returns false if neither has a valid stale-if-error.
+func StaleIfError(reqCC rfc.CacheControlMap, respCC rfc.CacheControlMap) (time.Duration, bool) {
+	if staleIfError, ok := getDeltaSeconds(reqCC, "stale-if-error"); ok {
+		return staleIfError, true
+	}
+	return getDeltaSeconds(respCC, "stale-if-error")
+}
+
+// getDeltaSeconds returns the value of the given Cache-Control directive, as delta-seconds per RFC7234§1.2.1. Returns false if the directive doesn't exist, or isn't valid delta-seconds.
+func getDeltaSeconds(cc rfc.CacheControlMap, directive string) (time.Duration, bool) {
+	val, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseUint(val, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
@@ -13,3 +13,55 @@ package web
    See the License for the specific language governing permissions and
    limitations under the License.
 */
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+func TestStaleCacheControl(t *testing.T) {
+	cc := func(val string) rfc.CacheControlMap {
+		return rfc.ParseCacheControl(http.Header{"Cache-Control": {val}})
+	}
+
+	swrTests := []struct {
+		respCC   string
+		expected time.Duration
+		ok       bool
+	}{
+		{"max-age=60, stale-while-revalidate=30", 30 * time.Second, true},
+		{"stale-while-revalidate=0", 0, true},
+		{"max-age=60", 0, false},
+		{"stale-while-revalidate=-1", 0, false},
+		{"stale-while-revalidate=abc", 0, false},
+		{"stale-while-revalidate", 0, false},
+	}
+	for _, test := range swrTests {
+		actual, ok := StaleWhileRevalidate(cc(test.respCC))
+		if ok != test.ok || actual != test.expected {
+			t.Errorf("StaleWhileRevalidate('%v') expected %v %v, actual %v %v", test.respCC, test.expected, test.ok, actual, ok)
+		}
+	}
+
+	sieTests := []struct {
+		reqCC    string
+		respCC   string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", "max-age=60, stale-if-error=600", 600 * time.Second, true},
+		{"stale-if-error=10", "max-age=60, stale-if-error=600", 10 * time.Second, true},
+		{"stale-if-error=10", "max-age=60", 10 * time.Second, true},
+		{"max-stale", "max-age=60", 0, false},
+		{"stale-if-error=x", "stale-if-error=5", 5 * time.Second, true},
+	}
+	for _, test := range sieTests {
+		actual, ok := StaleIfError(cc(test.reqCC), cc(test.respCC))
+		if ok != test.ok || actual != test.expected {
+			t.Errorf("StaleIfError('%v', '%v') expected %v %v, actual %v %v", test.reqCC, test.respCC, test.expected, test.ok, actual, ok)
+		}
+	}
+}
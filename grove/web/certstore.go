@@ -0,0 +1,372 @@
+package web
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// CertKeyPair is the paths of a certificate file, which may include its chain, and its key file.
+type CertKeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// OCSPStapleFileSuffix is the suffix of the file, next to a certificate file, of a DER OCSP response to staple to the certificate. If the file exists, it's used instead of requesting the certificate's OCSP responder.
+const OCSPStapleFileSuffix = ".ocsp"
+
+// CertReloadDelay is how long the CertStore waits after a certificate file changes before reloading, so a certificate and key written together are loaded together.
+const CertReloadDelay = time.Second
+
+// OCSPRefreshInterval is how often the OCSP responses of certificates are checked, and requested if they're past half their validity.
+const OCSPRefreshInterval = time.Hour
+
+// DefaultOCSPValidity is how long an OCSP response with no NextUpdate is stapled.
+const DefaultOCSPValidity = time.Hour
+
+// CertStore selects the certificate for each TLS connection by its SNI server name, from certificates loaded from files. Certificates may be reloaded while serving, and are swapped in atomically, so no connections are dropped.
+type CertStore struct {
+	// certs is the current *certSet.
+	certs atomic.Value
+	// pairs and defaultPair are the files of the current certificates, and m must be locked to access them.
+	pairs       []CertKeyPair
+	defaultPair CertKeyPair
+	m           sync.Mutex
+	// ocspClient requests OCSP responses for certificates without staple files. If it's nil, OCSP responders aren't requested.
+	ocspClient *http.Client
+	staples    *ocspStaples
+	// loaded is signaled when certificates are loaded, so Watch watches any new files.
+	loaded chan struct{}
+}
+
+// certSet is an immutable set of loaded certificates.
+type certSet struct {
+	// names is the certificates by their lowercase DNS names, which may be wildcards such as *.example.net.
+	names map[string]*tls.Certificate
+	def   *tls.Certificate
+}
+
+// NewCertStore creates a new CertStore with no certificates. If ocspStapling is true, the OCSP responder of each certificate without an OCSPStapleFileSuffix file is requested when it's loaded, and by RefreshOCSP, and its responses are stapled.
+func NewCertStore(ocspStapling bool) *CertStore {
+	s := &CertStore{loaded: make(chan struct{}, 1), staples: &ocspStaples{staples: map[string][]byte{}, refreshes: map[string]time.Time{}, expirations: map[string]time.Time{}}}
+	if ocspStapling {
+		s.ocspClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	s.certs.Store(&certSet{names: map[string]*tls.Certificate{}})
+	return s
+}
+
+// Load loads the certificates of the given files, and the default certificate for connections whose server names match no certificate, and swaps them in atomically. If any certificate fails to load, the current certificates are kept, and an error is returned.
+func (s *CertStore) Load(pairs []CertKeyPair, defaultPair CertKeyPair) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	set := &certSet{names: map[string]*tls.Certificate{}}
+	for _, pair := range pairs {
+		cert, err := loadCert(pair)
+		if err != nil {
+			return err
+		}
+		for _, name := range cert.Leaf.DNSNames {
+			if _, ok := set.names[strings.ToLower(name)]; !ok {
+				set.names[strings.ToLower(name)] = cert
+			}
+		}
+		if len(cert.Leaf.DNSNames) == 0 && cert.Leaf.Subject.CommonName != "" {
+			set.names[strings.ToLower(cert.Leaf.Subject.CommonName)] = cert
+		}
+	}
+	def, err := loadCert(defaultPair)
+	if err != nil {
+		return err
+	}
+	set.def = def
+
+	s.certs.Store(set)
+	s.pairs = pairs
+	s.defaultPair = defaultPair
+	select {
+	case s.loaded <- struct{}{}:
+	default:
+	}
+	if s.ocspClient != nil {
+		go s.RefreshOCSP()
+	}
+	return nil
+}
+
+// Reload reloads the certificates from the files of the last successful Load.
+func (s *CertStore) Reload() error {
+	s.m.Lock()
+	pairs, defaultPair := s.pairs, s.defaultPair
+	s.m.Unlock()
+	return s.Load(pairs, defaultPair)
+}
+
+// loadCert loads the certificate and key of the given files, with its parsed Leaf, and the staple of its OCSPStapleFileSuffix file if it exists.
+func loadCert(pair CertKeyPair) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return nil, errors.New("loading certificate " + pair.CertFile + ": " + err.Error())
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, errors.New("parsing certificate " + pair.CertFile + ": " + err.Error())
+	}
+	staple, err := ioutil.ReadFile(pair.CertFile + OCSPStapleFileSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.New("reading certificate " + pair.CertFile + " OCSP staple: " + err.Error())
+	}
+	cert.OCSPStaple = staple
+	return &cert, nil
+}
+
+// GetCertificate returns the certificate for the server name of the given TLS handshake, or the default certificate if no certificate matches it. It's designed to be used as a tls.Config GetCertificate func.
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := s.certs.Load().(*certSet)
+	cert := set.def
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if named, ok := set.names[name]; ok {
+		cert = named
+	} else if i := strings.Index(name, "."); i != -1 {
+		if wildcard, ok := set.names["*"+name[i:]]; ok {
+			cert = wildcard
+		}
+	}
+	if cert == nil {
+		return nil, errors.New("no certificate")
+	}
+	if len(cert.OCSPStaple) == 0 {
+		if staple := s.staples.Get(cert.Leaf); staple != nil {
+			stapled := *cert
+			stapled.OCSPStaple = staple
+			return &stapled, nil
+		}
+	}
+	return cert, nil
+}
+
+// Watch reloads the certificates whenever their files change, and refreshes their OCSP responses every OCSPRefreshInterval, until the returned func is called. Certificate files may be replaced, for example by renaming a new file over them.
+func (s *CertStore) Watch() (func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.New("creating certificate watcher: " + err.Error())
+	}
+	die := make(chan struct{})
+	go func() {
+		defer watcher.Close()
+		ocspTicker := time.NewTicker(OCSPRefreshInterval)
+		defer ocspTicker.Stop()
+		dirs := map[string]struct{}{}
+		reload := (<-chan time.Time)(nil)
+		for {
+			for _, file := range s.files() {
+				dir := filepath.Dir(file)
+				if _, ok := dirs[dir]; ok {
+					continue
+				}
+				dirs[dir] = struct{}{}
+				// the directories are watched rather than the files, because files replaced by renaming aren't watched
+				if err := watcher.Add(dir); err != nil {
+					log.Errorf("watching certificate directory %v: %v\n", dir, err)
+				}
+			}
+
+			select {
+			case event := <-watcher.Events:
+				if s.isFile(event.Name) {
+					reload = time.After(CertReloadDelay)
+				}
+			case err := <-watcher.Errors:
+				log.Errorf("watching certificates: %v\n", err)
+			case <-reload:
+				reload = nil
+				if err := s.Reload(); err != nil {
+					log.Errorf("reloading changed certificates, keeping existing certificates: %v\n", err)
+				} else {
+					log.Infof("reloaded changed certificates\n")
+				}
+			case <-s.loaded:
+				// watch the directories of new files
+			case <-ocspTicker.C:
+				s.RefreshOCSP()
+			case <-die:
+				return
+			}
+		}
+	}()
+	return func() { close(die) }, nil
+}
+
+// files returns the paths of the current certificates' files, including their OCSP staple files.
+func (s *CertStore) files() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	files := []string{}
+	for _, pair := range append(s.pairs, s.defaultPair) {
+		files = append(files, pair.CertFile, pair.KeyFile, pair.CertFile+OCSPStapleFileSuffix)
+	}
+	return files
+}
+
+// isFile returns whether the given path is one of the current certificates' files.
+func (s *CertStore) isFile(path string) bool {
+	path = filepath.Clean(path)
+	for _, file := range s.files() {
+		if filepath.Clean(file) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// RefreshOCSP requests the OCSP responder of each current certificate which has an OCSP responder and no staple file, and whose last response is missing or will expire within half its validity, and staples the responses. Errors are logged, and the last response is kept until it expires.
+func (s *CertStore) RefreshOCSP() {
+	if s.ocspClient == nil {
+		return
+	}
+	set := s.certs.Load().(*certSet)
+	certs := map[*tls.Certificate]struct{}{}
+	for _, cert := range set.names {
+		certs[cert] = struct{}{}
+	}
+	if set.def != nil {
+		certs[set.def] = struct{}{}
+	}
+
+	leaves := []*x509.Certificate{}
+	for cert := range certs {
+		if len(cert.OCSPStaple) != 0 || len(cert.Leaf.OCSPServer) == 0 || len(cert.Certificate) < 2 {
+			continue // the issuer must be in the chain, to create the request
+		}
+		leaves = append(leaves, cert.Leaf)
+		if !s.staples.NeedsRefresh(cert.Leaf) {
+			continue
+		}
+		issuer, err := x509.ParseCertificate(cert.Certificate[1])
+		if err != nil {
+			log.Errorf("parsing certificate %v issuer for OCSP: %v\n", cert.Leaf.Subject.CommonName, err)
+			continue
+		}
+		staple, resp, err := requestOCSP(s.ocspClient, cert.Leaf, issuer)
+		if err != nil {
+			log.Errorf("requesting certificate %v OCSP staple: %v\n", cert.Leaf.Subject.CommonName, err)
+			continue
+		}
+		s.staples.Set(cert.Leaf, staple, resp)
+	}
+	s.staples.Keep(leaves)
+}
+
+// requestOCSP requests the OCSP response for the given certificate from its first OCSP responder, and returns the DER response to staple, and the parsed response.
+func requestOCSP(client *http.Client, leaf *x509.Certificate, issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, errors.New("creating request: " + err.Error())
+	}
+	httpResp, err := client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, errors.New("requesting " + leaf.OCSPServer[0] + ": " + err.Error())
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, nil, errors.New("requesting " + leaf.OCSPServer[0] + ": " + httpResp.Status)
+	}
+	staple, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, errors.New("reading response: " + err.Error())
+	}
+	resp, err := ocsp.ParseResponseForCert(staple, leaf, issuer)
+	if err != nil {
+		return nil, nil, errors.New("parsing response: " + err.Error())
+	}
+	if resp.Status != ocsp.Good {
+		return nil, nil, errors.New("certificate status is not good")
+	}
+	return staple, resp, nil
+}
+
+// ocspStaples is the OCSP responses requested for certificates, by their serialized certificate.
+type ocspStaples struct {
+	staples map[string][]byte
+	// refreshes and expirations are the times each staple should be refreshed, and expires.
+	refreshes   map[string]time.Time
+	expirations map[string]time.Time
+	m           sync.Mutex
+}
+
+// Get returns the unexpired staple of the given certificate, or nil if it has none.
+func (o *ocspStaples) Get(leaf *x509.Certificate) []byte {
+	o.m.Lock()
+	defer o.m.Unlock()
+	key := string(leaf.Raw)
+	if staple, ok := o.staples[key]; ok && time.Now().Before(o.expirations[key]) {
+		return staple
+	}
+	return nil
+}
+
+// NeedsRefresh returns whether the staple of the given certificate is missing, or past half its validity.
+func (o *ocspStaples) NeedsRefresh(leaf *x509.Certificate) bool {
+	o.m.Lock()
+	defer o.m.Unlock()
+	refresh, ok := o.refreshes[string(leaf.Raw)]
+	return !ok || time.Now().After(refresh)
+}
+
+// Set sets the staple of the given certificate, which is refreshed halfway between the response's ThisUpdate and NextUpdate, and expires at its NextUpdate.
+func (o *ocspStaples) Set(leaf *x509.Certificate, staple []byte, resp *ocsp.Response) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	key := string(leaf.Raw)
+	nextUpdate := resp.NextUpdate
+	if nextUpdate.IsZero() {
+		nextUpdate = time.Now().Add(DefaultOCSPValidity) // the responder has newer information available at all times
+	}
+	o.staples[key] = staple
+	o.refreshes[key] = resp.ThisUpdate.Add(nextUpdate.Sub(resp.ThisUpdate) / 2)
+	o.expirations[key] = nextUpdate
+}
+
+// Keep removes the staples of all certificates but the given certificates.
+func (o *ocspStaples) Keep(leaves []*x509.Certificate) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	keep := make(map[string]struct{}, len(leaves))
+	for _, leaf := range leaves {
+		keep[string(leaf.Raw)] = struct{}{}
+	}
+	for key := range o.staples {
+		if _, ok := keep[key]; !ok {
+			delete(o.staples, key)
+			delete(o.refreshes, key)
+			delete(o.expirations, key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package web
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a new self-signed certificate for the given DNS names, and its key, to files in dir with the given name, and returns their paths.
+func writeTestCert(t *testing.T, dir string, name string, dnsNames ...string) CertKeyPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+	pair := CertKeyPair{CertFile: filepath.Join(dir, name+".crt"), KeyFile: filepath.Join(dir, name+".key")}
+	if err := ioutil.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("writing certificate: %v", err)
+	}
+	if err := ioutil.WriteFile(pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+	return pair
+}
+
+func certName(t *testing.T, s *CertStore, serverName string) string {
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatalf("getting certificate for '%v': %v", serverName, err)
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestCertStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-certstore")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	def := writeTestCert(t, dir, "default", "default.example.net")
+	pairs := []CertKeyPair{
+		writeTestCert(t, dir, "foo", "foo.example.net"),
+		writeTestCert(t, dir, "wildcard", "*.bar.example.net"),
+	}
+	s := NewCertStore(false)
+	if err := s.Load(pairs, def); err != nil {
+		t.Fatalf("loading certificates: %v", err)
+	}
+
+	tests := map[string]string{
+		"foo.example.net":       "foo",
+		"FOO.example.net.":      "foo",
+		"a.bar.example.net":     "wildcard",
+		"bar.example.net":       "default",
+		"a.b.bar.example.net":   "default",
+		"unknown.example.net":   "default",
+		"":                      "default",
+		"default.example.net":   "default",
+		"foo.example.net.other": "default",
+	}
+	for serverName, expected := range tests {
+		if actual := certName(t, s, serverName); actual != expected {
+			t.Errorf("server name '%v' expected certificate '%v', actual '%v'", serverName, expected, actual)
+		}
+	}
+
+	// a broken certificate keeps the existing certificates
+	if err := ioutil.WriteFile(pairs[0].CertFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("writing certificate: %v", err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Error("expected error reloading a broken certificate")
+	}
+	if actual := certName(t, s, "foo.example.net"); actual != "foo" {
+		t.Errorf("expected existing certificate 'foo' after a failed reload, actual '%v'", actual)
+	}
+
+	pairs[0] = writeTestCert(t, dir, "foo", "foo.example.net", "baz.example.net")
+	if err := s.Reload(); err != nil {
+		t.Fatalf("reloading certificates: %v", err)
+	}
+	if actual := certName(t, s, "baz.example.net"); actual != "foo" {
+		t.Errorf("expected reloaded certificate 'foo' for a new name, actual '%v'", actual)
+	}
+}
@@ -66,15 +66,14 @@ func InterceptListen(network, laddr string) (net.Listener, *ConnMap, func(net.Co
 	return &InterceptListener{realListener: l, connMap: connMap}, connMap, getConnStateCallback(connMap), nil
 }
 
-// InterceptListenTLS is like InterceptListen but for serving HTTPS. It returns the tls.Config, which must be set on the http.Server using this listener for HTTP/2 to be set up.
-func InterceptListenTLS(network string, laddr string, certs []tls.Certificate, h2Disabled bool) (net.Listener, *ConnMap, func(net.Conn, http.ConnState), *tls.Config, error) {
+// InterceptListenTLS is like InterceptListen but for serving HTTPS. The certificate of each connection is selected by getCertificate, for example CertStore.GetCertificate. It returns the tls.Config, which must be set on the http.Server using this listener for HTTP/2 to be set up.
+func InterceptListenTLS(network string, laddr string, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error), h2Disabled bool) (net.Listener, *ConnMap, func(net.Conn, http.ConnState), *tls.Config, error) {
 	config := &tls.Config{}
 	// HTTP2 is enabled if config.DisableHTTP2 is false
 	if !h2Disabled {
 		config.NextProtos = []string{"h2"}
 	}
-	config.Certificates = certs
-	config.BuildNameToCertificate()
+	config.GetCertificate = getCertificate
 	l, err := net.Listen(network, laddr)
 	if err != nil {
 		return l, nil, nil, nil, err
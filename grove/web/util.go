@@ -16,9 +16,11 @@ package web
 
 import (
 	"errors"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -74,6 +76,40 @@ func CopyHeader(source http.Header) http.Header {
 	return dest
 }
 
+// NormalizeAcceptEncoding replaces the Accept-Encoding header with the single encoding of br or gzip it accepts, preferring br, or removes it if it accepts neither. Encodings with a q-value of 0 aren't accepted.
+func NormalizeAcceptEncoding(hdr http.Header) {
+	qs := map[string]float64{}
+	for _, val := range hdr["Accept-Encoding"] {
+		for _, enc := range strings.Split(val, ",") {
+			params := strings.Split(enc, ";")
+			q := 1.0
+			for _, param := range params[1:] {
+				if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+					if parsedQ, err := strconv.ParseFloat(param[len("q="):], 64); err == nil {
+						q = parsedQ
+					}
+				}
+			}
+			qs[strings.ToLower(strings.TrimSpace(params[0]))] = q
+		}
+	}
+	accepts := func(enc string) bool {
+		q, ok := qs[enc]
+		if !ok {
+			q, ok = qs["*"]
+		}
+		return ok && q > 0
+	}
+	switch {
+	case accepts("br"):
+		hdr.Set("Accept-Encoding", "br")
+	case accepts("gzip"):
+		hdr.Set("Accept-Encoding", "gzip")
+	default:
+		hdr.Del("Accept-Encoding")
+	}
+}
+
 // GetClientIPPort returns the client IP address of the given request, and the port. It returns the first x-forwarded-for IP if any, else the RemoteAddr.
 func GetClientIPPort(r *http.Request) (string, string) {
 	xForwardedFor := r.Header.Get("X-FORWARDED-FOR")
@@ -107,6 +143,18 @@ func TryFlush(w http.ResponseWriter) {
 	}
 }
 
+// RequestStream makes the given request and returns its response, without reading the body, the request time, response time, and any error. The caller must close the response body.
+func RequestStream(transport *http.Transport, r *http.Request) (*http.Response, time.Time, time.Time, error) {
+	log.Debugf("request streaming %v headers %v\n", r.RequestURI, r.Header)
+	reqTime := time.Now()
+	resp, err := transport.RoundTrip(r)
+	respTime := time.Now()
+	if err != nil {
+		return nil, reqTime, respTime, errors.New("request error: " + err.Error())
+	}
+	return resp, reqTime, respTime, nil
+}
+
 // request makes the given request and returns its response code, headers, body, the request time, response time, and any error.
 func Request(transport *http.Transport, r *http.Request) (int, http.Header, []byte, time.Time, time.Time, error) {
 	log.Debugf("request requesting %v headers %v\n", r.RequestURI, r.Header)
@@ -145,6 +193,17 @@ func Respond(w http.ResponseWriter, code int, header http.Header, body []byte, c
 	return uint64(bytesWritten), err
 }
 
+// RespondStream writes the given code and header to the ResponseWriter, and then calls writeBody to write the body. If connectionClose, a Connection: Close header is also written. Returns the body bytes written, and any error.
+func RespondStream(w http.ResponseWriter, code int, header http.Header, writeBody func(w io.Writer) (uint64, error), connectionClose bool) (uint64, error) {
+	dH := w.Header()
+	CopyHeaderTo(header, &dH)
+	if connectionClose {
+		dH.Add("Connection", "close")
+	}
+	w.WriteHeader(code)
+	return writeBody(w)
+}
+
 // ServeReqErr writes the appropriate response to the client, via given writer, for a generic request error. Returns the code sent, the body bytes written, and any write error.
 func ServeReqErr(w http.ResponseWriter) (int, uint64, error) {
 	code := http.StatusBadRequest
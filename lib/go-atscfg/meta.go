@@ -128,7 +128,10 @@ locationParamsFor:
 		configFiles = append(configFiles, atsCfg)
 	}
 
-	configFiles, configDirWarns, err := addMetaObjConfigDir(configFiles, configDir, server, tmURL, tmReverseProxyURL, locationParams, uriSignedDSes, dses, cacheGroupArr, topologies, atsMajorVer)
+	useStrategies, strategiesWarns := UseStrategies(serverParams)
+	warnings = append(warnings, strategiesWarns...)
+
+	configFiles, configDirWarns, err := addMetaObjConfigDir(configFiles, configDir, server, tmURL, tmReverseProxyURL, locationParams, uriSignedDSes, dses, cacheGroupArr, topologies, atsMajorVer, useStrategies)
 	warnings = append(warnings, configDirWarns...)
 	return configFiles, warnings, err
 }
@@ -150,6 +153,7 @@ func addMetaObjConfigDir(
 	cacheGroupArr []tc.CacheGroupNullable,
 	topologies []tc.Topology,
 	atsMajorVer int,
+	useStrategies bool, // whether Topology DSes use strategies.yaml instead of parent.config
 ) ([]CfgMeta, []string, error) {
 	warnings := []string{}
 
@@ -168,6 +172,20 @@ func addMetaObjConfigDir(
 		configFilesM[fi.Name] = append(configFilesM[fi.Path], fi)
 	}
 
+	// ATS 10 replaced records.config with records.yaml, which is generated from the same Parameters.
+	// So use any records.config location Parameter for records.yaml, rather than making a records.config ATS won't read.
+	if atsMajorVer >= RecordsYAMLMinATSMajorVersion {
+		if fis, ok := configFilesM[RecordsFileName]; ok {
+			if _, ok := configFilesM[RecordsYAMLFileName]; !ok {
+				for _, fi := range fis {
+					fi.Name = RecordsYAMLFileName
+					configFilesM[RecordsYAMLFileName] = append(configFilesM[RecordsYAMLFileName], fi)
+				}
+			}
+			delete(configFilesM, RecordsFileName)
+		}
+	}
+
 	// add all strictly required files, all of which should be in the base config directory.
 	// If they don't exist, create them.
 	// If they exist with a relative path, prepend configDir.
@@ -200,6 +218,12 @@ func addMetaObjConfigDir(
 		configFilesM[fileName] = newFis
 	}
 
+	if useStrategies {
+		if configFilesM, err = ensureConfigFile(configFilesM, StrategiesYAMLFileName, configDir); err != nil {
+			warnings = append(warnings, "ensuring config file '"+StrategiesYAMLFileName+"': "+err.Error())
+		}
+	}
+
 	nameTopologies := makeTopologyNameMap(topologies)
 
 	for _, ds := range dses {
@@ -415,6 +439,9 @@ type configProfileParams struct {
 }
 
 func requiredFiles(atsMajorVer int) []string {
+	if atsMajorVer >= RecordsYAMLMinATSMajorVersion {
+		return requiredFiles10()
+	}
 	if atsMajorVer >= 9 {
 		return requiredFiles9()
 	}
@@ -457,6 +484,24 @@ func requiredFiles9() []string {
 	}
 }
 
+// requiredFiles10 is the list of config files required by ATS 10.
+// Note these are not exhaustive. This is only used to error if these are missing.
+// The presence of these is no guarantee the location Parameters are complete and correct.
+func requiredFiles10() []string {
+	return []string{
+		"cache.config",
+		"hosting.config",
+		"ip_allow.yaml",
+		"parent.config",
+		"plugin.config",
+		"records.yaml",
+		"remap.config",
+		"sni.yaml",
+		"storage.config",
+		"volume.config",
+	}
+}
+
 // ensureConfigFile ensures files contains the given fileName. If so, returns files unmodified.
 // If not, if configDir is empty, returns an error.
 // If not, and configDir is nonempty, creates the given file, configDir location, and returns files.
@@ -200,3 +200,121 @@ func TestMakeMetaConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeMetaConfigStrategies(t *testing.T) {
+	server := &Server{}
+	server.CachegroupID = util.IntPtr(42)
+	server.Cachegroup = util.StrPtr("cg0")
+	server.CDNName = util.StrPtr("mycdn")
+	server.CDNID = util.IntPtr(43)
+	server.HostName = util.StrPtr("myserver")
+	server.ID = util.IntPtr(44)
+	server.ProfileID = util.IntPtr(46)
+	server.Profile = util.StrPtr("myserverprofile")
+	server.TCPPort = util.IntPtr(80)
+	server.Type = "EDGE"
+
+	cfgPath := "/etc/foo/trafficserver"
+
+	for _, useStrategies := range []bool{false, true} {
+		serverParams := []tc.Parameter{
+			tc.Parameter{
+				Name:       "trafficserver",
+				ConfigFile: "package",
+				Value:      "9",
+				Profiles:   []byte(`["global"]`),
+			},
+		}
+		if useStrategies {
+			serverParams = append(serverParams, tc.Parameter{
+				Name:       ParentSelectionParamName,
+				ConfigFile: ParentConfigFileName,
+				Value:      ParentSelectionStrategies,
+				Profiles:   []byte(`["` + *server.Profile + `"]`),
+			})
+		}
+
+		cfg, _, err := MakeConfigFilesList(cfgPath, server, serverParams, nil, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("MakeConfigFilesList: " + err.Error())
+		}
+
+		hasStrategies := false
+		hasParent := false
+		for _, fi := range cfg {
+			if fi.Name == StrategiesYAMLFileName {
+				hasStrategies = true
+				if fi.Path != cfgPath {
+					t.Errorf("expected location '%v', actual '%v'", cfgPath, fi.Path)
+				}
+			}
+			hasParent = hasParent || fi.Name == ParentConfigFileName
+		}
+		if hasStrategies != useStrategies {
+			t.Errorf("with strategies %v expected %v %v, actual %v", useStrategies, StrategiesYAMLFileName, useStrategies, hasStrategies)
+		}
+		if !hasParent {
+			t.Errorf("with strategies %v expected %v for Delivery Services without Topologies, actual %+v", useStrategies, ParentConfigFileName, cfg)
+		}
+	}
+}
+
+func TestMakeMetaConfigRecordsYAML(t *testing.T) {
+	server := &Server{}
+	server.CachegroupID = util.IntPtr(42)
+	server.Cachegroup = util.StrPtr("cg0")
+	server.CDNName = util.StrPtr("mycdn")
+	server.CDNID = util.IntPtr(43)
+	server.HostName = util.StrPtr("myserver")
+	server.ID = util.IntPtr(44)
+	server.ProfileID = util.IntPtr(46)
+	server.Profile = util.StrPtr("myserverprofile")
+	server.TCPPort = util.IntPtr(80)
+	server.Type = "EDGE"
+
+	cfgPath := "/etc/foo/trafficserver"
+	recordsPath := "/etc/bar/trafficserver"
+
+	for _, atsVersion := range []string{"9.1.2", "10.0.0"} {
+		serverParams := []tc.Parameter{
+			tc.Parameter{
+				Name:       "trafficserver",
+				ConfigFile: "package",
+				Value:      atsVersion,
+				Profiles:   []byte(`["global"]`),
+			},
+			tc.Parameter{
+				Name:       "location",
+				ConfigFile: RecordsFileName,
+				Value:      recordsPath,
+				Profiles:   []byte(`["` + *server.Profile + `"]`),
+			},
+		}
+
+		cfg, _, err := MakeConfigFilesList(cfgPath, server, serverParams, nil, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("MakeConfigFilesList: " + err.Error())
+		}
+
+		expected, notExpected := RecordsFileName, RecordsYAMLFileName
+		if atsVersion == "10.0.0" {
+			expected, notExpected = RecordsYAMLFileName, RecordsFileName
+		}
+		found := false
+		for _, fi := range cfg {
+			if fi.Name == notExpected {
+				t.Errorf("ATS %v expected no %v, actual %+v", atsVersion, notExpected, cfg)
+			}
+			if fi.Name != expected {
+				continue
+			}
+			found = true
+			if fi.Path != recordsPath {
+				t.Errorf("ATS %v expected %v location from the records.config location Parameter '%v', actual '%v'", atsVersion, expected, recordsPath, fi.Path)
+			}
+		}
+		if !found {
+			t.Errorf("ATS %v expected %v, actual %+v", atsVersion, expected, cfg)
+		}
+	}
+}
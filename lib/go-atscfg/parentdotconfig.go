@@ -112,6 +112,9 @@ func MakeParentDotConfig(
 	atsMajorVer, verWarns := getATSMajorVersion(tcServerParams)
 	warnings = append(warnings, verWarns...)
 
+	useStrategies, strategiesWarns := UseStrategies(tcServerParams)
+	warnings = append(warnings, strategiesWarns...)
+
 	cacheGroups, err := makeCGMap(cacheGroupArr)
 	if err != nil {
 		return Cfg{}, makeErr(warnings, "making CacheGroup map: "+err.Error())
@@ -300,7 +303,11 @@ func MakeParentDotConfig(
 		}
 
 		// TODO put these in separate functions. No if-statement should be this long.
-		if ds.Topology != nil && *ds.Topology != "" {
+		if ds.Topology != nil && *ds.Topology != "" && useStrategies {
+			if opt.AddComments {
+				textArr = append(textArr, "# ds '"+*ds.XMLID+"' topology '"+*ds.Topology+"' uses "+StrategiesYAMLFileName+"\n")
+			}
+		} else if ds.Topology != nil && *ds.Topology != "" {
 			txt, topoWarnings, err := getTopologyParentConfigLine(
 				server,
 				servers,
@@ -990,6 +997,48 @@ func getTopologyParents(
 		return []string{orgURI.Host}, nil, warnings, nil
 	}
 
+	parents, secondaryParents, parentWarns, err := getTopologyParentServers(server, ds, servers, parentConfigParams, topology, serverCapabilities, dsRequiredCapabilities, dsOrigins)
+	warnings = append(warnings, parentWarns...)
+	if err != nil {
+		return nil, nil, warnings, err
+	}
+
+	parentStrs := []string{}
+	secondaryParentStrs := []string{}
+	for _, sv := range parents {
+		parentStr, err := serverParentStr(&sv.Server, sv.Params)
+		if err != nil {
+			return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
+		}
+		if parentStr != "" { // will be empty if server is not_a_parent (possibly other reasons)
+			parentStrs = append(parentStrs, parentStr)
+		}
+	}
+	for _, sv := range secondaryParents {
+		parentStr, err := serverParentStr(&sv.Server, sv.Params)
+		if err != nil {
+			return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
+		}
+		secondaryParentStrs = append(secondaryParentStrs, parentStr)
+	}
+
+	return parentStrs, secondaryParentStrs, warnings, nil
+}
+
+// getTopologyParentServers returns the servers in the primary and secondary parent cachegroups of the given server's node in the topology, sorted by rank, any warnings, and any error.
+// The server must not be the last tier, whose parent is the origin.
+func getTopologyParentServers(
+	server *Server,
+	ds *DeliveryService,
+	servers []Server,
+	parentConfigParams []parameterWithProfilesMap, // all params with configFile parent.config
+	topology tc.Topology,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	dsOrigins map[ServerID]struct{}, // for Topology DSes, MSO still needs DeliveryServiceServer assignments.
+) ([]serverWithParams, []serverWithParams, []string, error) {
+	warnings := []string{}
+
 	svNode := tc.TopologyNode{}
 	for _, node := range topology.Nodes {
 		if node.Cachegroup == *server.Cachegroup {
@@ -1024,8 +1073,8 @@ func getTopologyParents(
 		return nil, nil, warnings, errors.New("Server '" + *server.HostName + "' DS " + *ds.XMLID + " topology '" + *ds.Topology + "' cachegroup '" + *server.Cachegroup + "' topology node parent " + strconv.Itoa(svNode.Parents[0]) + " is not in the topology!")
 	}
 
-	parentStrs := []string{}
-	secondaryParentStrs := []string{}
+	parents := []serverWithParams{}
+	secondaryParents := []serverWithParams{}
 
 	serversWithParams := []serverWithParams{}
 	for _, sv := range servers {
@@ -1070,24 +1119,14 @@ func getTopologyParents(
 			continue
 		}
 		if *sv.Cachegroup == parentCG {
-			parentStr, err := serverParentStr(&sv.Server, sv.Params)
-			if err != nil {
-				return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
-			}
-			if parentStr != "" { // will be empty if server is not_a_parent (possibly other reasons)
-				parentStrs = append(parentStrs, parentStr)
-			}
+			parents = append(parents, sv)
 		}
 		if *sv.Cachegroup == secondaryParentCG {
-			parentStr, err := serverParentStr(&sv.Server, sv.Params)
-			if err != nil {
-				return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
-			}
-			secondaryParentStrs = append(secondaryParentStrs, parentStr)
+			secondaryParents = append(secondaryParents, sv)
 		}
 	}
 
-	return parentStrs, secondaryParentStrs, warnings, nil
+	return parents, secondaryParents, warnings, nil
 }
 
 // getOriginURI returns the URL, any warnings, and any error.
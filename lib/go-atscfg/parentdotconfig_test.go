@@ -2653,3 +2653,47 @@ func makeParentDS() *DeliveryService {
 	ds.MultiSiteOrigin = util.BoolPtr(false)
 	return ds
 }
+
+func TestMakeParentDotConfigTopologiesStrategies(t *testing.T) {
+	dses, servers, topologies, cgs, parentConfigParams := makeTestStrategiesData()
+	server := servers[0]
+	cdn := &tc.CDN{
+		DomainName: "cdndomain.example",
+		Name:       "my-cdn-name",
+	}
+
+	for _, useStrategies := range []bool{false, true} {
+		serverParams := []tc.Parameter{
+			tc.Parameter{
+				Name:       "trafficserver",
+				ConfigFile: "package",
+				Value:      "9",
+				Profiles:   []byte(`["global"]`),
+			},
+		}
+		if useStrategies {
+			serverParams = append(serverParams, tc.Parameter{
+				Name:       ParentSelectionParamName,
+				ConfigFile: ParentConfigFileName,
+				Value:      ParentSelectionStrategies,
+				Profiles:   []byte(`["serverprofile"]`),
+			})
+		}
+
+		hdr := ParentConfigOpts{AddComments: true, HdrComment: "myHeaderComment"}
+		cfg, err := MakeParentDotConfig(dses, &server, servers, topologies, serverParams, parentConfigParams, nil, nil, cgs, nil, cdn, hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txt := cfg.Text
+
+		testComment(t, txt, hdr.HdrComment)
+
+		if hasLine := strings.Contains(txt, "dest_domain=ds0.example.net"); hasLine == useStrategies {
+			t.Errorf("with strategies %v expected Topology DS parent line %v, actual: '%v'", useStrategies, !useStrategies, txt)
+		}
+		if hasComment := strings.Contains(txt, "uses "+StrategiesYAMLFileName); hasComment != useStrategies {
+			t.Errorf("with strategies %v expected Topology DS strategies comment %v, actual: '%v'", useStrategies, useStrategies, txt)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const RecordsYAMLFileName = "records.yaml"
+const ContentTypeRecordsDotYAML = ContentTypeYAML
+const LineCommentRecordsDotYAML = LineCommentHash
+
+// RecordsYAMLMinATSMajorVersion is the first ATS major version which reads records.yaml instead of records.config.
+const RecordsYAMLMinATSMajorVersion = 10
+
+// recordsConfigPrefix is the prefix of records.config names, which records.yaml omits.
+const recordsConfigPrefix = "proxy.config."
+
+// recordsLocalPrefix is the prefix of LOCAL records.config names, which records.yaml writes under a 'local' node.
+const recordsLocalPrefix = "proxy.local."
+
+// recordsYAMLRenames are the records.config records which ATS 10 renamed, keyed by their legacy name,
+// the same as the ATS records.config to records.yaml converter.
+// Most were renamed because they are both a value and the parent of other records, which YAML can't represent.
+var recordsYAMLRenames = map[string]string{
+	"proxy.config.output.logfile":           "proxy.config.output.logfile.name",
+	"proxy.config.exec_thread.autoconfig":   "proxy.config.exec_thread.autoconfig.enabled",
+	"proxy.config.hostdb":                   "proxy.config.hostdb.enabled",
+	"proxy.config.tunnel.prewarm":           "proxy.config.tunnel.prewarm.enabled",
+	"proxy.config.ssl.origin_session_cache": "proxy.config.ssl.origin_session_cache.enabled",
+	"proxy.config.ssl.session_cache":        "proxy.config.ssl.session_cache.value",
+	"proxy.config.ssl.TLSv1_3":              "proxy.config.ssl.TLSv1_3.enabled",
+	"proxy.config.ssl.client.TLSv1_3":       "proxy.config.ssl.client.TLSv1_3.enabled",
+}
+
+// recordsLineRe matches a records.config line, e.g. 'CONFIG proxy.config.diags.debug.enabled INT 1'.
+// The value may be empty or contain spaces, e.g. 'CONFIG proxy.config.http.server_ports STRING 80 80:ipv6'.
+var recordsLineRe = regexp.MustCompile(`^(\S+)\s+(\S+)\s+(\S+)\s*(.*)$`)
+
+// recordsPlainValueRe matches INT and FLOAT values which can be written to YAML unquoted, e.g. '1', '-1', '0.5', or '10M'.
+var recordsPlainValueRe = regexp.MustCompile(`^-?[0-9][0-9A-Za-z.]*$`)
+
+// MakeRecordsDotYAML makes the ATS 10 records.yaml.
+//
+// Parameters are the same legacy records.config Parameters used by MakeRecordsDotConfig,
+// e.g. name 'CONFIG proxy.config.diags.debug.enabled' value 'INT 1', which are translated
+// into the nested records.yaml structure. Records which ATS 10 renamed are written with their new names.
+// Parameters with the config file records.yaml
+// are also used, in the same format, and override records.config Parameters of the same name.
+func MakeRecordsDotYAML(
+	server *Server,
+	serverParams []tc.Parameter,
+	hdrComment string,
+	opt RecordsConfigOpts,
+) (Cfg, error) {
+	warnings := []string{}
+	if server.Profile == nil {
+		return Cfg{}, makeErr(warnings, "server profile missing")
+	}
+
+	params, paramWarns := paramsToMap(filterParams(serverParams, RecordsFileName, "", "", "location"))
+	warnings = append(warnings, paramWarns...)
+
+	yamlParams, paramWarns := paramsToMap(filterParams(serverParams, RecordsYAMLFileName, "", "", "location"))
+	warnings = append(warnings, paramWarns...)
+	for name, val := range yamlParams {
+		params[name] = val
+	}
+
+	txt := genericProfileConfig(params, RecordsSeparator)
+	txt = replaceLineSuffixes(txt, "STRING __HOSTNAME__", "STRING __FULL_HOSTNAME__")
+
+	txt, overrideWarns := addRecordsDotConfigOverrides(txt, server, opt)
+	warnings = append(warnings, overrideWarns...)
+
+	yml, yamlWarns := recordsConfigToYAML(txt)
+	warnings = append(warnings, yamlWarns...)
+
+	return Cfg{
+		Text:        makeHdrComment(hdrComment) + yml,
+		ContentType: ContentTypeRecordsDotYAML,
+		LineComment: LineCommentRecordsDotYAML,
+		Warnings:    warnings,
+	}, nil
+}
+
+// recordsNode is a node in the records.yaml tree.
+// Leaves have a value and no children.
+type recordsNode struct {
+	val      string
+	children map[string]*recordsNode
+}
+
+// recordsConfigToYAML translates records.config text into records.yaml text.
+// Returns the YAML, and warnings for any lines which couldn't be translated.
+func recordsConfigToYAML(txt string) (string, []string) {
+	warnings := []string{}
+	root := &recordsNode{children: map[string]*recordsNode{}}
+
+	for _, line := range strings.Split(txt, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, LineCommentRecordsDotConfig) {
+			continue
+		}
+		match := recordsLineRe.FindStringSubmatch(line)
+		if match == nil {
+			warnings = append(warnings, "malformed records.config line '"+line+"', expected e.g. 'CONFIG proxy.config.name INT 1', skipping!")
+			continue
+		}
+		name, typ, val := match[2], match[3], strings.TrimSpace(match[4])
+		if newName, ok := recordsYAMLRenames[name]; ok {
+			name = newName
+		}
+
+		path := ""
+		if strings.HasPrefix(name, recordsConfigPrefix) {
+			path = strings.TrimPrefix(name, recordsConfigPrefix)
+		} else if strings.HasPrefix(name, recordsLocalPrefix) {
+			path = "local." + strings.TrimPrefix(name, recordsLocalPrefix)
+		} else {
+			warnings = append(warnings, "records.config record '"+name+"' is not a '"+recordsConfigPrefix+"' or '"+recordsLocalPrefix+"' record, skipping!")
+			continue
+		}
+
+		yamlVal, ok := recordsYAMLValue(typ, val)
+		if !ok {
+			warnings = append(warnings, "records.config record '"+name+"' has unknown type '"+typ+"', skipping!")
+			continue
+		}
+
+		if err := root.insert(strings.Split(path, "."), yamlVal); err != "" {
+			warnings = append(warnings, "records.config record '"+name+"' "+err+", skipping!")
+		}
+	}
+
+	if len(root.children) == 0 {
+		return "records: {}\n", warnings
+	}
+	sb := strings.Builder{}
+	sb.WriteString("records:\n")
+	root.write(&sb, "  ")
+	return sb.String(), warnings
+}
+
+// recordsYAMLValue returns the YAML scalar for the records.config type and value, and false if the type is unknown.
+func recordsYAMLValue(typ string, val string) (string, bool) {
+	switch strings.ToUpper(typ) {
+	case "INT", "FLOAT", "COUNTER":
+		if recordsPlainValueRe.MatchString(val) {
+			return val, true
+		}
+		return quoteYAMLString(val), true
+	case "STRING":
+		return quoteYAMLString(val), true
+	}
+	return "", false
+}
+
+// quoteYAMLString returns str as a single-quoted YAML scalar.
+func quoteYAMLString(str string) string {
+	return `'` + strings.Replace(str, `'`, `''`, -1) + `'`
+}
+
+// insert adds the value at the given path under the node.
+// Returns a description of the conflict if the path is both a value and a parent of other values, or the empty string on success.
+// A record which already exists is replaced, the same as a repeated records.config line.
+func (n *recordsNode) insert(path []string, val string) string {
+	for i, key := range path {
+		if key == "" {
+			return "has an empty name segment"
+		}
+		child, ok := n.children[key]
+		if i == len(path)-1 {
+			if ok && child.children != nil {
+				return "conflicts with records under it"
+			}
+			n.children[key] = &recordsNode{val: val}
+			return ""
+		}
+		if !ok {
+			child = &recordsNode{children: map[string]*recordsNode{}}
+			n.children[key] = child
+		} else if child.children == nil {
+			return "conflicts with the record '" + strings.Join(path[:i+1], ".") + "'"
+		}
+		n = child
+	}
+	return ""
+}
+
+// write writes the node's children in sorted order, each prefixed by indent.
+func (n *recordsNode) write(sb *strings.Builder, indent string) {
+	keys := make([]string, 0, len(n.children))
+	for key := range n.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child := n.children[key]
+		if child.children == nil {
+			sb.WriteString(indent + key + ": " + child.val + "\n")
+			continue
+		}
+		sb.WriteString(indent + key + ":\n")
+		child.write(sb, indent+"  ")
+	}
+}
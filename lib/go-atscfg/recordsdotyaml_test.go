@@ -0,0 +1,147 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestMakeRecordsDotYAML(t *testing.T) {
+	hdr := "myHeaderComment"
+
+	paramData := makeParamsFromMap("serverProfile", RecordsFileName, map[string]string{
+		"CONFIG proxy.config.diags.debug.enabled":          "INT 1",
+		"CONFIG proxy.config.diags.debug.tags":             "STRING http|dns",
+		"CONFIG proxy.config.http.server_ports":            "STRING 80 80:ipv6",
+		"CONFIG proxy.config.cache.ram_cache.size":         "INT 10M",
+		"CONFIG proxy.config.exec_thread.autoconfig.scale": "FLOAT 1.5",
+		"CONFIG proxy.config.proxy_name":                   "STRING __HOSTNAME__",
+		"CONFIG proxy.config.exec_thread.autoconfig":       "INT 1",
+		"CONFIG proxy.config.log.hostname":                 "STRING it's",
+	})
+	paramData = append(paramData, makeParamsFromMap("serverProfile", RecordsYAMLFileName, map[string]string{
+		"CONFIG proxy.config.diags.debug.enabled": "INT 2",
+	})...)
+
+	server := makeTestRemapServer()
+	server.Interfaces = nil
+	ipStr := "192.163.2.99"
+	setIP(server, ipStr+"/30")
+	ip6Str := "2001:db8::9"
+	setIP6(server, ip6Str+"/48")
+	server.Profile = util.StrPtr("myProfile")
+
+	cfg, err := MakeRecordsDotYAML(server, paramData, hdr, RecordsConfigOpts{DNSLocalBindServiceAddr: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := cfg.Text
+
+	testComment(t, txt, hdr)
+
+	cfgYAML := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(txt), &cfgYAML); err != nil {
+		t.Fatalf("expected valid YAML, actual error '%v': '%v'", err, txt)
+	}
+
+	expected := map[string]interface{}{
+		"records": map[interface{}]interface{}{
+			"diags": map[interface{}]interface{}{
+				"debug": map[interface{}]interface{}{
+					"enabled": 2,
+					"tags":    "http|dns",
+				},
+			},
+			"http": map[interface{}]interface{}{
+				"server_ports": "80 80:ipv6",
+			},
+			"exec_thread": map[interface{}]interface{}{
+				"autoconfig": map[interface{}]interface{}{
+					"enabled": 1,
+					"scale":   1.5,
+				},
+			},
+			"cache": map[interface{}]interface{}{
+				"ram_cache": map[interface{}]interface{}{
+					"size": "10M",
+				},
+			},
+			"proxy_name": "__FULL_HOSTNAME__",
+			"log": map[interface{}]interface{}{
+				"hostname": "it's",
+			},
+			"dns": map[interface{}]interface{}{
+				"local_ipv4": ipStr,
+				"local_ipv6": "[" + ip6Str + "]",
+			},
+			"local": map[interface{}]interface{}{
+				"outgoing_ip_to_bind": ipStr + " [" + ip6Str + "]",
+			},
+		},
+	}
+	if !reflect.DeepEqual(expected, cfgYAML) {
+		t.Errorf("expected %+v, actual %+v: '%v'", expected, cfgYAML, txt)
+	}
+
+	// proxy.config.exec_thread.autoconfig is renamed, so it doesn't conflict with proxy.config.exec_thread.autoconfig.scale
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("expected no warnings, actual %+v", cfg.Warnings)
+	}
+}
+
+func TestRecordsConfigToYAMLConflict(t *testing.T) {
+	txt := `CONFIG proxy.config.example INT 1
+CONFIG proxy.config.example.child INT 2
+`
+	yml, warnings := recordsConfigToYAML(txt)
+	cfgYAML := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(yml), &cfgYAML); err != nil {
+		t.Fatalf("expected valid YAML, actual error '%v': '%v'", err, yml)
+	}
+	expected := map[string]interface{}{"records": map[interface{}]interface{}{"example": 1}}
+	if !reflect.DeepEqual(expected, cfgYAML) {
+		t.Errorf("expected %+v, actual %+v", expected, cfgYAML)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected 1 warning for the record which isn't renamed and conflicts with a record under it, actual %+v", warnings)
+	}
+}
+
+func TestMakeRecordsDotYAMLEmpty(t *testing.T) {
+	server := makeTestRemapServer()
+	server.Interfaces = nil
+
+	cfg, err := MakeRecordsDotYAML(server, nil, "", RecordsConfigOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgYAML := map[string]map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(cfg.Text), &cfgYAML); err != nil {
+		t.Fatalf("expected valid YAML, actual error '%v': '%v'", err, cfg.Text)
+	}
+	if records, ok := cfgYAML["records"]; !ok || len(records) != 0 {
+		t.Errorf("expected empty records, actual: '%v'", cfg.Text)
+	}
+}
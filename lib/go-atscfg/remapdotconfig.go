@@ -87,13 +87,16 @@ func MakeRemapDotConfig(
 
 	nameTopologies := makeTopologyNameMap(topologies)
 
+	useStrategies, strategiesWarns := UseStrategies(serverParams)
+	warnings = append(warnings, strategiesWarns...)
+
 	hdr := makeHdrComment(hdrComment)
 	txt := ""
 	typeWarns := []string{}
 	if tc.CacheTypeFromString(server.Type) == tc.CacheTypeMid {
-		txt, typeWarns, err = getServerConfigRemapDotConfigForMid(atsMajorVersion, dsProfilesCacheKeyConfigParams, dses, dsRegexes, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities)
+		txt, typeWarns, err = getServerConfigRemapDotConfigForMid(atsMajorVersion, dsProfilesCacheKeyConfigParams, dses, dsRegexes, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities, useStrategies)
 	} else {
-		txt, typeWarns, err = getServerConfigRemapDotConfigForEdge(cacheURLConfigParams, dsProfilesCacheKeyConfigParams, serverPackageParamData, dses, dsRegexes, atsMajorVersion, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities, cdnDomain)
+		txt, typeWarns, err = getServerConfigRemapDotConfigForEdge(cacheURLConfigParams, dsProfilesCacheKeyConfigParams, serverPackageParamData, dses, dsRegexes, atsMajorVersion, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities, cdnDomain, useStrategies)
 	}
 	warnings = append(warnings, typeWarns...)
 	if err != nil {
@@ -120,6 +123,7 @@ func getServerConfigRemapDotConfigForMid(
 	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
 	serverCapabilities map[int]map[ServerCapability]struct{},
 	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	useStrategies bool, // whether Topology DSes use strategies.yaml instead of parent.config
 ) (string, []string, error) {
 	warnings := []string{}
 	midRemaps := map[string]string{}
@@ -158,6 +162,12 @@ func getServerConfigRemapDotConfigForMid(
 
 		midRemap := ""
 
+		if *ds.Topology != "" && useStrategies {
+			strategyTxt, strategyWarns := makeDSStrategyTxt(server, &ds, nameTopologies, cacheGroups)
+			warnings = append(warnings, strategyWarns...)
+			midRemap += strategyTxt
+		}
+
 		if *ds.Topology != "" {
 			topoTxt, err := makeDSTopologyHeaderRewriteTxt(ds, tc.CacheGroupName(*server.Cachegroup), topology, cacheGroups)
 			if err != nil {
@@ -228,6 +238,7 @@ func getServerConfigRemapDotConfigForEdge(
 	serverCapabilities map[int]map[ServerCapability]struct{},
 	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
 	cdnDomain string,
+	useStrategies bool, // whether Topology DSes use strategies.yaml instead of parent.config
 ) (string, []string, error) {
 	warnings := []string{}
 	textLines := []string{}
@@ -277,7 +288,7 @@ func getServerConfigRemapDotConfigForEdge(
 					profilecacheKeyConfigParams = profilesCacheKeyConfigParams[*ds.ProfileID]
 				}
 				remapWarns := []string{}
-				remapText, remapWarns, err = buildEdgeRemapLine(cacheURLConfigParams, atsMajorVersion, server, serverPackageParamData, remapText, ds, line.From, line.To, profilecacheKeyConfigParams, cacheGroups, nameTopologies)
+				remapText, remapWarns, err = buildEdgeRemapLine(cacheURLConfigParams, atsMajorVersion, server, serverPackageParamData, remapText, ds, line.From, line.To, profilecacheKeyConfigParams, cacheGroups, nameTopologies, useStrategies)
 				warnings = append(warnings, remapWarns...)
 				if err != nil {
 					return "", warnings, err
@@ -312,15 +323,23 @@ func buildEdgeRemapLine(
 	cacheKeyConfigParams map[string]string,
 	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
 	nameTopologies map[TopologyName]tc.Topology,
+	useStrategies bool,
 ) (string, []string, error) {
 	warnings := []string{}
 	// ds = 'remap' in perl
 	mapFrom = strings.Replace(mapFrom, `__http__`, *server.HostName, -1)
 
+	text += "map	" + mapFrom + "     " + mapTo
+	if *ds.Topology != "" && useStrategies {
+		strategyTxt, strategyWarns := makeDSStrategyTxt(server, &ds, nameTopologies, cacheGroups)
+		warnings = append(warnings, strategyWarns...)
+		text += strategyTxt
+	}
+
 	if _, hasDSCPRemap := pData["dscp_remap"]; hasDSCPRemap {
-		text += "map	" + mapFrom + "     " + mapTo + ` @plugin=dscp_remap.so @pparam=` + strconv.Itoa(*ds.DSCP)
+		text += ` @plugin=dscp_remap.so @pparam=` + strconv.Itoa(*ds.DSCP)
 	} else {
-		text += "map	" + mapFrom + "     " + mapTo + ` @plugin=header_rewrite.so @pparam=dscp/set_dscp_` + strconv.Itoa(*ds.DSCP) + ".config"
+		text += ` @plugin=header_rewrite.so @pparam=dscp/set_dscp_` + strconv.Itoa(*ds.DSCP) + ".config"
 	}
 
 	if *ds.Topology != "" {
@@ -442,6 +461,19 @@ type remapLine struct {
 	To   string
 }
 
+// makeDSStrategyTxt returns the @strategy remap text of the given Topology DS on the given server, and any warnings.
+// Returns the empty string if strategies.yaml has no strategy for the DS, because ATS rejects remap.config if it references a missing strategy.
+func makeDSStrategyTxt(server *Server, ds *DeliveryService, nameTopologies map[TopologyName]tc.Topology, cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable) (string, []string) {
+	_, _, placement, _, err := getStrategyPlacement(server, ds, nameTopologies, cacheGroups)
+	if err != nil {
+		return "", []string{err.Error() + " Omitting its strategy from remap.config!"}
+	}
+	if !placement.InTopology {
+		return "", []string{"DS '" + *ds.XMLID + "' topology doesn't contain the server's cachegroup! Omitting its strategy from remap.config!"}
+	}
+	return ` @strategy=` + StrategyName(*ds.XMLID), nil
+}
+
 // makeEdgeDSDataRemapLines returns the remap lines for the given server and delivery service.
 // Returns nil, if the given server and ds have no remap lines, i.e. the DS match is not a host regex, or has no origin FQDN.
 func makeEdgeDSDataRemapLines(
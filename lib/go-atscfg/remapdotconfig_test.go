@@ -8299,3 +8299,116 @@ func TestMakeRemapDotConfigMidNoNoCacheRemapLine(t *testing.T) {
 		t.Errorf("expected remap line for HTTP_NO_CACHE to not exist on Mid server, regardless of Mid Header Rewrite, actual '%v'", txt)
 	}
 }
+
+func TestMakeRemapDotConfigStrategies(t *testing.T) {
+	hdr := "myHeaderComment"
+
+	ds := DeliveryService{}
+	ds.ID = util.IntPtr(48)
+	dsType := tc.DSType("HTTP")
+	ds.Type = &dsType
+	ds.OrgServerFQDN = util.StrPtr("http://origin.example.test")
+	ds.XMLID = util.StrPtr("mydsname")
+	ds.DSCP = util.IntPtr(0)
+	ds.Protocol = util.IntPtr(int(tc.DSProtocolHTTP))
+	ds.Active = util.BoolPtr(true)
+	ds.Topology = util.StrPtr("t0")
+
+	// strategies.yaml has no strategy for a DS with a malformed origin, so remap.config must not reference one
+	badDS := ds
+	badDS.ID = util.IntPtr(49)
+	badDS.OrgServerFQDN = util.StrPtr("badorigin.example.test")
+	badDS.XMLID = util.StrPtr("mybaddsname")
+
+	dses := []DeliveryService{ds, badDS}
+
+	dsRegexes := []tc.DeliveryServiceRegexes{
+		tc.DeliveryServiceRegexes{
+			DSName: *ds.XMLID,
+			Regexes: []tc.DeliveryServiceRegex{
+				tc.DeliveryServiceRegex{
+					Type:      string(tc.DSMatchTypeHostRegex),
+					SetNumber: 0,
+					Pattern:   `.*\.mypattern\..*`,
+				},
+			},
+		},
+		tc.DeliveryServiceRegexes{
+			DSName: *badDS.XMLID,
+			Regexes: []tc.DeliveryServiceRegex{
+				tc.DeliveryServiceRegex{
+					Type:      string(tc.DSMatchTypeHostRegex),
+					SetNumber: 0,
+					Pattern:   `.*\.mybadpattern\..*`,
+				},
+			},
+		},
+	}
+
+	cdn := &tc.CDN{
+		DomainName: "cdndomain.example",
+		Name:       "my-cdn-name",
+	}
+
+	topologies := []tc.Topology{
+		tc.Topology{
+			Name: "t0",
+			Nodes: []tc.TopologyNode{
+				tc.TopologyNode{Cachegroup: "cg0", Parents: []int{1}},
+				tc.TopologyNode{Cachegroup: "midCG"},
+			},
+		},
+	}
+
+	edgeCGType := tc.CacheGroupEdgeTypeName
+	midCGType := tc.CacheGroupMidTypeName
+	cgs := []tc.CacheGroupNullable{
+		tc.CacheGroupNullable{Name: util.StrPtr("cg0"), Type: &edgeCGType},
+		tc.CacheGroupNullable{Name: util.StrPtr("midCG"), Type: &midCGType},
+	}
+
+	for _, useStrategies := range []bool{false, true} {
+		serverParams := []tc.Parameter{
+			tc.Parameter{
+				Name:       "trafficserver",
+				ConfigFile: "package",
+				Value:      "9",
+				Profiles:   []byte(`["global"]`),
+			},
+		}
+		if useStrategies {
+			serverParams = append(serverParams, tc.Parameter{
+				Name:       ParentSelectionParamName,
+				ConfigFile: ParentConfigFileName,
+				Value:      ParentSelectionStrategies,
+				Profiles:   []byte(`["MyProfile"]`),
+			})
+		}
+
+		for _, serverType := range []string{"EDGE", "MID"} {
+			server := makeTestRemapServer()
+			server.Type = serverType
+			if serverType == "MID" {
+				server.Cachegroup = util.StrPtr("midCG")
+			}
+
+			cfg, err := MakeRemapDotConfig(server, dses, nil, dsRegexes, serverParams, cdn, nil, topologies, cgs, nil, nil, hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txt := cfg.Text
+
+			testComment(t, txt, hdr)
+
+			if hasStrategy := strings.Contains(txt, " @strategy="+StrategyName("mydsname")); hasStrategy != useStrategies {
+				t.Errorf("%v with strategies %v expected @strategy directive %v, actual '%v'", serverType, useStrategies, useStrategies, txt)
+			}
+			if serverType == "EDGE" && !strings.Contains(txt, "badorigin.example.test") {
+				t.Errorf("%v with strategies %v expected remap rule for the DS with a malformed origin, actual '%v'", serverType, useStrategies, txt)
+			}
+			if strings.Contains(txt, " @strategy="+StrategyName("mybaddsname")) {
+				t.Errorf("%v with strategies %v expected no @strategy directive for the DS with a malformed origin, actual '%v'", serverType, useStrategies, txt)
+			}
+		}
+	}
+}
@@ -0,0 +1,652 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const StrategiesYAMLFileName = "strategies.yaml"
+const ContentTypeStrategiesDotYAML = ContentTypeYAML
+const LineCommentStrategiesDotYAML = LineCommentHash
+
+// ParentSelectionParamName is the Parameter on the server's Profile, with the ConfigFile ParentConfigFileName, which selects whether Topology Delivery Services use parent.config or strategies.yaml.
+// Its value must be ParentSelectionParentDotConfig or ParentSelectionStrategies. If it doesn't exist, parent.config is used.
+const ParentSelectionParamName = "parent_selection"
+
+const ParentSelectionParentDotConfig = ParentConfigFileName
+const ParentSelectionStrategies = StrategiesYAMLFileName
+
+// StrategiesParamHealthCheck is the Delivery Service Profile Parameter, with the ConfigFile ParentConfigFileName, of the comma-delimited strategies.yaml health checks, e.g. "passive,active".
+// If it doesn't exist, StrategiesDefaultHealthCheck is used.
+const StrategiesParamHealthCheck = "health_check"
+
+const StrategiesHealthCheckPassive = "passive"
+const StrategiesHealthCheckActive = "active"
+const StrategiesDefaultHealthCheck = StrategiesHealthCheckPassive
+
+// StrategiesDefaultSimpleRetryResponseCodes are the response codes for which a simple retry is made, matching parent.config parent_retry=simple_retry.
+var StrategiesDefaultSimpleRetryResponseCodes = []int{404}
+
+// StrategiesDefaultMarkdownCodes are the response codes which mark a parent down, matching the parent.config unavailable_server_retry_responses default.
+var StrategiesDefaultMarkdownCodes = []int{503}
+
+// StrategiesYAMLOpts contains settings to configure strategies.yaml generation options.
+type StrategiesYAMLOpts struct {
+	// AddComments is whether to add informative comments to the generated file, about what was generated and why.
+	// Note this does not include the header comment, which is configured separately with HdrComment.
+	// These comments are human-readable and not guaranteed to be consistent between versions. Automating anything based on them is strongly discouraged.
+	AddComments bool
+
+	// HdrComment is the header comment to include at the beginning of the file.
+	// This should be the text desired, without comment syntax (like # or //). The file's comment syntax will be added.
+	// To omit the header comment, pass the empty string.
+	HdrComment string
+}
+
+// StrategyName returns the name of the strategies.yaml strategy of the given Delivery Service, which remap.config references with @strategy.
+func StrategyName(dsName string) string {
+	return "strategy-" + dsName
+}
+
+// MakeStrategiesDotYAML creates the strategies.yaml ATS 9+ config file, with a next hop strategy for each Topology Delivery Service on the server.
+// Delivery Services without Topologies are not included, and continue to use parent.config.
+func MakeStrategiesDotYAML(
+	dses []DeliveryService,
+	server *Server,
+	servers []Server,
+	topologies []tc.Topology,
+	tcServerParams []tc.Parameter,
+	tcParentConfigParams []tc.Parameter,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroupArr []tc.CacheGroupNullable,
+	dss []DeliveryServiceServer,
+	opt StrategiesYAMLOpts,
+) (Cfg, error) {
+	warnings := []string{}
+
+	if server.HostName == nil || *server.HostName == "" {
+		return Cfg{}, makeErr(warnings, "server HostName missing")
+	} else if server.CDNName == nil || *server.CDNName == "" {
+		return Cfg{}, makeErr(warnings, "server CDNName missing")
+	} else if server.Cachegroup == nil || *server.Cachegroup == "" {
+		return Cfg{}, makeErr(warnings, "server Cachegroup missing")
+	} else if server.Profile == nil || *server.Profile == "" {
+		return Cfg{}, makeErr(warnings, "server Profile missing")
+	} else if server.ID == nil {
+		return Cfg{}, makeErr(warnings, "server ID missing")
+	}
+
+	atsMajorVer, verWarns := getATSMajorVersion(tcServerParams)
+	warnings = append(warnings, verWarns...)
+	if atsMajorVer < 9 {
+		warnings = append(warnings, "server ATS version "+strconv.Itoa(atsMajorVer)+" doesn't support "+StrategiesYAMLFileName+", which requires ATS 9! Generating anyway!")
+	}
+
+	cacheGroups, err := makeCGMap(cacheGroupArr)
+	if err != nil {
+		return Cfg{}, makeErr(warnings, "making CacheGroup map: "+err.Error())
+	}
+
+	parentConfigParamsWithProfiles, err := tcParamsToParamsWithProfiles(tcParentConfigParams)
+	if err != nil {
+		warnings = append(warnings, "error getting profiles from Traffic Ops Parameters, Parameters will not be considered for generation! : "+err.Error())
+		parentConfigParamsWithProfiles = []parameterWithProfiles{}
+	}
+	parentConfigParams := parameterWithProfilesToMap(parentConfigParamsWithProfiles)
+
+	profileParentConfigParams := map[string]map[string]string{} // map[profileName][paramName]paramVal
+	for _, param := range parentConfigParamsWithProfiles {
+		for _, profile := range param.ProfileNames {
+			if _, ok := profileParentConfigParams[profile]; !ok {
+				profileParentConfigParams[profile] = map[string]string{}
+			}
+			profileParentConfigParams[profile][param.Name] = param.Value
+		}
+	}
+
+	serverParams := map[string]string{}
+	for name, val := range profileParentConfigParams[*server.Profile] {
+		if name == ParentConfigParamQStringHandling ||
+			name == ParentConfigParamAlgorithm ||
+			name == ParentConfigParamQString {
+			serverParams[name] = val
+		}
+	}
+
+	nameTopologies := makeTopologyNameMap(topologies)
+
+	dsOrigins, dsOriginWarns := makeDSOrigins(dss, dses, servers)
+	warnings = append(warnings, dsOriginWarns...)
+
+	sort.Sort(dsesSortByName(dses))
+
+	hosts := strategyHosts{}
+	strategies := []strategy{}
+	for _, ds := range dses {
+		if ds.XMLID == nil || *ds.XMLID == "" {
+			warnings = append(warnings, "got ds with missing XMLID, skipping!")
+			continue
+		} else if ds.ID == nil {
+			warnings = append(warnings, "got ds with missing ID, skipping!")
+			continue
+		} else if ds.Type == nil {
+			warnings = append(warnings, "got ds with missing Type, skipping!")
+			continue
+		}
+		if ds.Topology == nil || *ds.Topology == "" {
+			continue // non-Topology DSes use parent.config
+		}
+		if !ds.Type.IsHTTP() && !ds.Type.IsDNS() {
+			continue // skip ANY_MAP, STEERING, etc
+		}
+		if ds.OrgServerFQDN == nil || *ds.OrgServerFQDN == "" {
+			warnings = append(warnings, "DS '"+*ds.XMLID+"' has no origin server! Skipping!")
+			continue
+		}
+
+		dsParams, dsParamsWarnings := getParentDSParams(ds, profileParentConfigParams)
+		warnings = append(warnings, dsParamsWarnings...)
+
+		st, stWarns, err := getTopologyStrategy(
+			server,
+			servers,
+			&ds,
+			serverParams,
+			profileParentConfigParams,
+			parentConfigParams,
+			nameTopologies,
+			serverCapabilities,
+			dsRequiredCapabilities,
+			cacheGroups,
+			dsParams,
+			dsOrigins[DeliveryServiceID(*ds.ID)],
+			hosts,
+		)
+		warnings = append(warnings, stWarns...)
+		if err != nil {
+			// we don't want to fail generation with an error if one ds is malformed
+			warnings = append(warnings, err.Error()) // getTopologyStrategy includes error context
+			continue
+		}
+		if st == nil {
+			continue // server isn't in the Topology, or doesn't have the Required Capabilities
+		}
+		strategies = append(strategies, *st)
+	}
+
+	text := ""
+	if opt.HdrComment != "" {
+		text += makeHdrComment(opt.HdrComment)
+	}
+	text += makeStrategiesText(hosts, strategies, opt.AddComments)
+
+	return Cfg{
+		Text:        text,
+		ContentType: ContentTypeStrategiesDotYAML,
+		LineComment: LineCommentStrategiesDotYAML,
+		Warnings:    warnings,
+	}, nil
+}
+
+// UseStrategies returns whether the server's Topology Delivery Services use strategies.yaml instead of parent.config, from its Profile Parameters, and any warnings.
+func UseStrategies(serverParams []tc.Parameter) (bool, []string) {
+	warnings := []string{}
+	params := filterParams(serverParams, ParentConfigFileName, ParentSelectionParamName, "", "")
+	if len(params) == 0 {
+		return false, warnings
+	}
+	if len(params) > 1 {
+		warnings = append(warnings, "server had multiple "+ParentSelectionParamName+" Parameters, using the first!")
+	}
+	val := strings.TrimSpace(params[0].Value)
+	switch val {
+	case ParentSelectionParentDotConfig:
+		return false, warnings
+	case ParentSelectionStrategies:
+	default:
+		warnings = append(warnings, "server had unknown "+ParentSelectionParamName+" Parameter '"+val+"', using "+ParentSelectionParentDotConfig+"!")
+		return false, warnings
+	}
+	if atsMajorVer, _ := getATSMajorVersion(serverParams); atsMajorVer < 9 {
+		warnings = append(warnings, "server had "+ParentSelectionParamName+" Parameter '"+val+"', but ATS version "+strconv.Itoa(atsMajorVer)+" doesn't support it until 9! Using "+ParentSelectionParentDotConfig+"!")
+		return false, warnings
+	}
+	return true, warnings
+}
+
+type strategy struct {
+	Name              string
+	DS                string
+	Topology          string
+	Policy            string
+	HashKey           string
+	GoDirect          bool
+	ParentIsProxy     bool
+	Scheme            string
+	Groups            [][]strategyGroupHost
+	Failover          bool
+	RingMode          string
+	MaxSimpleRetries  string
+	MaxUnavailRetries string
+	ResponseCodes     []int
+	MarkdownCodes     []int
+	HealthChecks      []string
+}
+
+type strategyHost struct {
+	Anchor string
+	Host   string
+	Scheme string
+	Port   int
+}
+
+type strategyGroupHost struct {
+	Anchor string
+	Weight string
+}
+
+// strategyHosts is the set of hosts of all strategies, keyed on their anchor.
+type strategyHosts map[string]strategyHost
+
+var strategyAnchorInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// add adds the given host, if it doesn't exist, and returns its anchor.
+func (hs strategyHosts) add(host string, scheme string, port int) string {
+	sh := strategyHost{Host: host, Scheme: scheme, Port: port}
+	baseAnchor := strategyAnchorInvalidChars.ReplaceAllString(host+"-"+scheme+"-"+strconv.Itoa(port), "_")
+	anchor := baseAnchor
+	for i := 1; ; i++ {
+		existing, ok := hs[anchor]
+		if !ok {
+			break
+		}
+		existing.Anchor = ""
+		if existing == sh {
+			return anchor
+		}
+		anchor = baseAnchor + "-" + strconv.Itoa(i) // different hosts may have the same anchor after removing invalid characters
+	}
+	sh.Anchor = anchor
+	hs[anchor] = sh
+	return anchor
+}
+
+// getTopologyStrategy returns the strategy of the given DS for the server, any warnings, and any error.
+// The returned strategy is nil with no error if the server isn't in the Topology or doesn't have the DS's Required Capabilities.
+// Parent hosts are added to hosts.
+func getTopologyStrategy(
+	server *Server,
+	servers []Server,
+	ds *DeliveryService,
+	serverParams map[string]string,
+	profileParentConfigParams map[string]map[string]string, // map[profileName][paramName]paramVal
+	parentConfigParams []parameterWithProfilesMap, // all params with configFile parent.config
+	nameTopologies map[TopologyName]tc.Topology,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
+	dsParams parentDSParams,
+	dsOrigins map[ServerID]struct{},
+	hosts strategyHosts,
+) (*strategy, []string, error) {
+	warnings := []string{}
+
+	if !hasRequiredCapabilities(serverCapabilities[*server.ID], dsRequiredCapabilities[*ds.ID]) {
+		return nil, warnings, nil
+	}
+
+	orgURI, orgPort, serverPlacement, placementWarns, err := getStrategyPlacement(server, ds, nameTopologies, cacheGroups)
+	warnings = append(warnings, placementWarns...)
+	if err != nil {
+		return nil, warnings, errors.New(err.Error() + " Skipping!")
+	}
+	if !serverPlacement.InTopology {
+		return nil, warnings, nil // server isn't in topology, no error
+	}
+	topology := nameTopologies[TopologyName(*ds.Topology)]
+
+	st := &strategy{
+		Name:          StrategyName(*ds.XMLID),
+		DS:            *ds.XMLID,
+		Topology:      *ds.Topology,
+		Policy:        getStrategyPolicy(getTopologyRoundRobin(ds, serverParams, serverPlacement.IsLastCacheTier, dsParams.Algorithm)),
+		HashKey:       getStrategyHashKey(getTopologyQueryString(ds, serverParams, serverPlacement.IsLastCacheTier, dsParams.Algorithm, dsParams.QueryStringHandling)),
+		GoDirect:      getTopologyGoDirect(ds, serverPlacement.IsLastTier) == "true",
+		ParentIsProxy: !serverPlacement.IsLastCacheTier,
+		Scheme:        "http",
+	}
+	if serverPlacement.IsLastCacheTier {
+		st.Scheme = orgURI.Scheme
+	}
+
+	if !serverPlacement.IsLastTier {
+		groups, groupWarns, err := getStrategyParentGroups(server, ds, servers, parentConfigParams, topology, serverCapabilities, dsRequiredCapabilities, dsOrigins, st.Scheme, hosts)
+		warnings = append(warnings, groupWarns...)
+		if err != nil {
+			// remap.config references the strategy of every DS with a valid origin, so it must exist; go to the origin instead of the parents.
+			warnings = append(warnings, "getting topology parents for '"+*ds.XMLID+"': going direct to the origin! "+err.Error())
+			st.GoDirect = true
+			st.ParentIsProxy = false
+			st.Scheme = orgURI.Scheme
+		}
+		st.Groups = groups
+	}
+	if len(st.Groups) == 0 {
+		st.Groups = [][]strategyGroupHost{{{Anchor: hosts.add(orgURI.Hostname(), st.Scheme, orgPort)}}}
+	}
+
+	if len(st.Groups) > 1 {
+		st.RingMode = "alternate_ring"
+		if dsParams.TryAllPrimariesBeforeSecondary {
+			st.RingMode = "exhaust_ring"
+		}
+	}
+
+	// parent.config only uses retries on the last cache tier, and so does strategies.yaml.
+	if serverPlacement.IsLastCacheTier && dsParams.ParentRetry != "" {
+		st.Failover = true
+		st.MaxSimpleRetries = dsParams.MaxSimpleRetries
+		if st.MaxSimpleRetries == "" {
+			st.MaxSimpleRetries = ParentConfigDSParamDefaultMaxSimpleRetries
+		}
+		if dsParams.ParentRetry == "simple_retry" || dsParams.ParentRetry == "both" {
+			st.ResponseCodes = StrategiesDefaultSimpleRetryResponseCodes
+		}
+		if dsParams.ParentRetry == "unavailable_server_retry" || dsParams.ParentRetry == "both" {
+			st.MaxUnavailRetries = dsParams.MaxUnavailableServerRetries
+			if st.MaxUnavailRetries == "" {
+				st.MaxUnavailRetries = ParentConfigDSParamDefaultMaxUnavailableServerRetries
+			}
+			st.MarkdownCodes = StrategiesDefaultMarkdownCodes
+			if dsParams.UnavailableServerRetryResponses != "" {
+				st.MarkdownCodes = parseStrategyResponseCodes(dsParams.UnavailableServerRetryResponses)
+			}
+		}
+	}
+
+	healthChecks, healthCheckWarns := getStrategyHealthChecks(ds, profileParentConfigParams)
+	warnings = append(warnings, healthCheckWarns...)
+	st.HealthChecks = healthChecks
+	st.Failover = st.Failover || len(st.Groups) > 1 || len(st.HealthChecks) > 0
+
+	return st, warnings, nil
+}
+
+// getStrategyPlacement returns the origin URI and port of the given Topology DS, the server's placement in its Topology, any warnings, and any error.
+// An error means the DS can't have a strategy, and a placement not InTopology means the server has none for it.
+// Both remap.config and strategies.yaml use this to decide whether the server has a strategy for the DS,
+// so remap.config only references the strategies which exist in strategies.yaml.
+func getStrategyPlacement(
+	server *Server,
+	ds *DeliveryService,
+	nameTopologies map[TopologyName]tc.Topology,
+	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
+) (*url.URL, int, TopologyPlacement, []string, error) {
+	orgURI, orgPort, warnings, err := getStrategyOrigin(ds, nameTopologies)
+	if err != nil {
+		return nil, 0, TopologyPlacement{}, warnings, err
+	}
+	placement, err := getTopologyPlacement(tc.CacheGroupName(*server.Cachegroup), nameTopologies[TopologyName(*ds.Topology)], cacheGroups, ds)
+	if err != nil {
+		return nil, 0, TopologyPlacement{}, warnings, errors.New("DS '" + *ds.XMLID + "' getting topology placement: " + err.Error())
+	}
+	return orgURI, orgPort, placement, warnings, nil
+}
+
+// getStrategyOrigin returns the origin URI and port of the given Topology DS, any warnings, and any error.
+// An error means the DS can't have a strategy. See getStrategyPlacement.
+func getStrategyOrigin(ds *DeliveryService, nameTopologies map[TopologyName]tc.Topology) (*url.URL, int, []string, error) {
+	if ds.OrgServerFQDN == nil || *ds.OrgServerFQDN == "" {
+		return nil, 0, nil, errors.New("DS '" + *ds.XMLID + "' has no origin server!")
+	}
+	if _, ok := nameTopologies[TopologyName(*ds.Topology)]; !ok {
+		return nil, 0, nil, errors.New("DS '" + *ds.XMLID + "' topology '" + *ds.Topology + "' not found in Topologies!")
+	}
+	orgURI, warnings, err := getOriginURI(*ds.OrgServerFQDN)
+	if err != nil {
+		return nil, 0, warnings, errors.New("DS '" + *ds.XMLID + "' has malformed origin URI '" + *ds.OrgServerFQDN + "': " + err.Error())
+	}
+	port, err := strconv.Atoi(orgURI.Port())
+	if err != nil || orgURI.Hostname() == "" {
+		return nil, 0, warnings, errors.New("DS '" + *ds.XMLID + "' origin '" + *ds.OrgServerFQDN + "' has no host, or no port and unknown scheme!")
+	}
+	return orgURI, port, warnings, nil
+}
+
+// getStrategyParentGroups returns the strategy groups of the primary and secondary parents of the server for the given DS,
+// any warnings, and any error. Parent hosts are added to hosts.
+func getStrategyParentGroups(
+	server *Server,
+	ds *DeliveryService,
+	servers []Server,
+	parentConfigParams []parameterWithProfilesMap,
+	topology tc.Topology,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	dsOrigins map[ServerID]struct{},
+	scheme string,
+	hosts strategyHosts,
+) ([][]strategyGroupHost, []string, error) {
+	parents, secondaryParents, warnings, err := getTopologyParentServers(server, ds, servers, parentConfigParams, topology, serverCapabilities, dsRequiredCapabilities, dsOrigins)
+	if err != nil {
+		return nil, warnings, err
+	}
+	groups := [][]strategyGroupHost{}
+	for _, group := range [][]serverWithParams{parents, secondaryParents} {
+		groupHosts, err := makeStrategyGroup(group, scheme, hosts)
+		if err != nil {
+			return nil, warnings, err
+		}
+		if len(groupHosts) == 0 {
+			continue
+		}
+		groups = append(groups, groupHosts)
+	}
+	if len(groups) == 0 || len(parents) == 0 {
+		return nil, warnings, errors.New("no parents found! (Does your Topology have a CacheGroup with no servers in it?)")
+	}
+	return groups, warnings, nil
+}
+
+// makeStrategyGroup adds the given parent servers to hosts, and returns the group of their anchors and weights, and any error.
+// Servers which are not_a_parent are omitted.
+func makeStrategyGroup(servers []serverWithParams, scheme string, hosts strategyHosts) ([]strategyGroupHost, error) {
+	group := []strategyGroupHost{}
+	for _, sv := range servers {
+		if sv.Params.NotAParent {
+			continue
+		}
+		host := ""
+		if sv.Params.UseIP {
+			ip := getServerIPAddress(&sv.Server)
+			if ip == nil {
+				return nil, errors.New("server params Use IP, but has no valid IPv4 Service Address")
+			}
+			host = ip.String()
+		} else {
+			host = *sv.HostName + "." + *sv.DomainName
+		}
+		group = append(group, strategyGroupHost{
+			Anchor: hosts.add(host, scheme, sv.Params.Port),
+			Weight: sv.Params.Weight,
+		})
+	}
+	return group, nil
+}
+
+// getStrategyPolicy returns the strategies.yaml policy for the given parent.config round_robin value.
+func getStrategyPolicy(roundRobin string) string {
+	switch roundRobin {
+	case "true":
+		return "rr_ip"
+	case "strict":
+		return "rr_strict"
+	case "false":
+		return "first_live"
+	case "latched":
+		return "latched"
+	}
+	return "consistent_hash"
+}
+
+// getStrategyHashKey returns the strategies.yaml hash_key for the given parent.config qstring value.
+func getStrategyHashKey(qstring string) string {
+	if qstring == "consider" {
+		return "path+query"
+	}
+	return "path"
+}
+
+// parseStrategyResponseCodes parses a parent.config quoted list of response codes, e.g. `"502,503"`, which must have been validated by unavailableServerRetryResponsesValid.
+func parseStrategyResponseCodes(s string) []int {
+	codes := []int{}
+	for _, codeStr := range strings.Split(strings.Trim(strings.TrimSpace(s), `"`), ",") {
+		code, err := strconv.Atoi(codeStr)
+		if err != nil {
+			continue // should never happen, unavailableServerRetryResponsesValid guarantees 3 digits
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// getStrategyHealthChecks returns the DS's strategies.yaml health checks, and any warnings.
+func getStrategyHealthChecks(ds *DeliveryService, profileParentConfigParams map[string]map[string]string) ([]string, []string) {
+	warnings := []string{}
+	val := StrategiesDefaultHealthCheck
+	if ds.ProfileName != nil {
+		if v, ok := profileParentConfigParams[*ds.ProfileName][StrategiesParamHealthCheck]; ok {
+			val = v
+		}
+	}
+	healthChecks := []string{}
+	for _, check := range strings.Split(val, ",") {
+		check = strings.TrimSpace(check)
+		if check == "" {
+			continue
+		}
+		if check != StrategiesHealthCheckPassive && check != StrategiesHealthCheckActive {
+			warnings = append(warnings, "DS '"+*ds.XMLID+"' had unknown "+StrategiesParamHealthCheck+" Parameter value '"+check+"', not using!")
+			continue
+		}
+		healthChecks = append(healthChecks, check)
+	}
+	return healthChecks, warnings
+}
+
+// makeStrategiesText returns the strategies.yaml text of the given hosts and strategies.
+func makeStrategiesText(hosts strategyHosts, strategies []strategy, addComments bool) string {
+	anchors := []string{}
+	for anchor := range hosts {
+		anchors = append(anchors, anchor)
+	}
+	sort.Strings(anchors)
+
+	text := ""
+	if len(anchors) > 0 {
+		text += "hosts:\n"
+	}
+	for _, anchor := range anchors {
+		host := hosts[anchor]
+		text += `  - &` + host.Anchor + `
+    host: ` + host.Host + `
+    protocol:
+      - scheme: ` + host.Scheme + `
+        port: ` + strconv.Itoa(host.Port) + "\n"
+	}
+
+	if len(strategies) == 0 {
+		return text + "strategies: []\n"
+	}
+
+	text += "strategies:\n"
+	for _, st := range strategies {
+		if addComments {
+			text += "  # ds '" + st.DS + "' topology '" + st.Topology + "'\n"
+		}
+		text += `  - strategy: '` + st.Name + `'
+    policy: ` + st.Policy + `
+    hash_key: ` + st.HashKey + `
+    go_direct: ` + strconv.FormatBool(st.GoDirect) + `
+    parent_is_proxy: ` + strconv.FormatBool(st.ParentIsProxy) + `
+    ignore_self_detect: false
+    groups:
+`
+		for _, group := range st.Groups {
+			for i, host := range group {
+				prefix := "        "
+				if i == 0 {
+					prefix = "      - "
+				}
+				text += prefix + `- <<: *` + host.Anchor + "\n"
+				if host.Weight != "" {
+					text += `          weight: ` + host.Weight + "\n"
+				}
+			}
+		}
+		text += `    scheme: ` + st.Scheme + "\n"
+		if !st.Failover {
+			continue
+		}
+		text += "    failover:\n"
+		if st.MaxSimpleRetries != "" {
+			text += `      max_simple_retries: ` + st.MaxSimpleRetries + "\n"
+		}
+		if st.MaxUnavailRetries != "" {
+			text += `      max_unavailable_retries: ` + st.MaxUnavailRetries + "\n"
+		}
+		if st.RingMode != "" {
+			text += `      ring_mode: ` + st.RingMode + "\n"
+		}
+		text += makeStrategyList("response_codes", intsToStrs(st.ResponseCodes))
+		text += makeStrategyList("markdown_codes", intsToStrs(st.MarkdownCodes))
+		text += makeStrategyList("health_check", st.HealthChecks)
+	}
+	return text
+}
+
+// makeStrategyList returns the strategy failover list of the given name and values, or the empty string if there are no values.
+func makeStrategyList(name string, vals []string) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	text := `      ` + name + ":\n"
+	for _, val := range vals {
+		text += `        - ` + val + "\n"
+	}
+	return text
+}
+
+func intsToStrs(is []int) []string {
+	strs := []string{}
+	for _, i := range is {
+		strs = append(strs, strconv.Itoa(i))
+	}
+	return strs
+}
@@ -0,0 +1,384 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+type testStrategiesYAML struct {
+	Strategies []struct {
+		Strategy      string `yaml:"strategy"`
+		Policy        string `yaml:"policy"`
+		HashKey       string `yaml:"hash_key"`
+		GoDirect      bool   `yaml:"go_direct"`
+		ParentIsProxy bool   `yaml:"parent_is_proxy"`
+		Scheme        string `yaml:"scheme"`
+		Groups        [][]struct {
+			Host     string `yaml:"host"`
+			Weight   string `yaml:"weight"`
+			Protocol []struct {
+				Scheme string `yaml:"scheme"`
+				Port   int    `yaml:"port"`
+			} `yaml:"protocol"`
+		} `yaml:"groups"`
+		Failover struct {
+			MaxSimpleRetries      int      `yaml:"max_simple_retries"`
+			MaxUnavailableRetries int      `yaml:"max_unavailable_retries"`
+			RingMode              string   `yaml:"ring_mode"`
+			ResponseCodes         []int    `yaml:"response_codes"`
+			MarkdownCodes         []int    `yaml:"markdown_codes"`
+			HealthCheck           []string `yaml:"health_check"`
+		} `yaml:"failover"`
+	} `yaml:"strategies"`
+}
+
+func makeTestStrategiesData() ([]DeliveryService, []Server, []tc.Topology, []tc.CacheGroupNullable, []tc.Parameter) {
+	ds0 := makeParentDS()
+	ds0.ID = util.IntPtr(42)
+	ds0.XMLID = util.StrPtr("ds0")
+	ds0.OrgServerFQDN = util.StrPtr("https://ds0.example.net")
+	ds0.Topology = util.StrPtr("t0")
+	ds0.ProfileName = util.StrPtr("ds0Profile")
+
+	ds1 := makeParentDS()
+	ds1.ID = util.IntPtr(43)
+	ds1.XMLID = util.StrPtr("ds1")
+	ds1.OrgServerFQDN = util.StrPtr("http://ds1.example.net")
+
+	edge := makeTestParentServer()
+	edge.Cachegroup = util.StrPtr("edgeCG")
+	edge.CachegroupID = util.IntPtr(400)
+
+	mid0 := makeTestParentServer()
+	mid0.Cachegroup = util.StrPtr("midCG")
+	mid0.CachegroupID = util.IntPtr(500)
+	mid0.HostName = util.StrPtr("mymid0")
+	mid0.ID = util.IntPtr(45)
+	mid0.Type = tc.MidTypePrefix
+	setIP(mid0, "192.168.2.2")
+
+	mid1 := makeTestParentServer()
+	mid1.Cachegroup = util.StrPtr("midCG2")
+	mid1.CachegroupID = util.IntPtr(501)
+	mid1.HostName = util.StrPtr("mymid1")
+	mid1.ID = util.IntPtr(46)
+	mid1.Type = tc.MidTypePrefix
+	setIP(mid1, "192.168.2.3")
+
+	topologies := []tc.Topology{
+		tc.Topology{
+			Name: "t0",
+			Nodes: []tc.TopologyNode{
+				tc.TopologyNode{Cachegroup: "edgeCG", Parents: []int{1, 2}},
+				tc.TopologyNode{Cachegroup: "midCG"},
+				tc.TopologyNode{Cachegroup: "midCG2"},
+			},
+		},
+	}
+
+	cgs := []tc.CacheGroupNullable{}
+	for _, sv := range []*Server{edge, mid0, mid1} {
+		cg := tc.CacheGroupNullable{}
+		cg.Name = sv.Cachegroup
+		cg.ID = sv.CachegroupID
+		cgType := tc.CacheGroupMidTypeName
+		if sv == edge {
+			cgType = tc.CacheGroupEdgeTypeName
+		}
+		cg.Type = &cgType
+		cgs = append(cgs, cg)
+	}
+
+	parentConfigParams := []tc.Parameter{
+		tc.Parameter{
+			Name:       ParentConfigParamParentRetry,
+			ConfigFile: "parent.config",
+			Value:      "both",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamUnavailableServerRetryResponses,
+			ConfigFile: "parent.config",
+			Value:      `"502,503"`,
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamMaxSimpleRetries,
+			ConfigFile: "parent.config",
+			Value:      "3",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamSecondaryMode,
+			ConfigFile: "parent.config",
+			Value:      "",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+		tc.Parameter{
+			Name:       StrategiesParamHealthCheck,
+			ConfigFile: "parent.config",
+			Value:      "passive,active,invalid",
+			Profiles:   []byte(`["ds0Profile"]`),
+		},
+	}
+
+	return []DeliveryService{*ds0, *ds1}, []Server{*edge, *mid0, *mid1}, topologies, cgs, parentConfigParams
+}
+
+func TestMakeStrategiesDotYAML(t *testing.T) {
+	opt := StrategiesYAMLOpts{HdrComment: "myHeaderComment"}
+	dses, servers, topologies, cgs, parentConfigParams := makeTestStrategiesData()
+	serverParams := []tc.Parameter{
+		tc.Parameter{
+			Name:       "trafficserver",
+			ConfigFile: "package",
+			Value:      "9",
+			Profiles:   []byte(`["global"]`),
+		},
+	}
+
+	for _, test := range []struct {
+		name          string
+		server        Server
+		parentIsProxy bool
+		goDirect      bool
+		scheme        string
+		groups        [][]string
+		ringMode      string
+		responseCodes []int
+		markdownCodes []int
+	}{
+		{
+			name:          "edge",
+			server:        servers[0],
+			parentIsProxy: true,
+			scheme:        "http",
+			groups:        [][]string{{"mymid0.mydomain.example.net"}, {"mymid1.mydomain.example.net"}},
+			ringMode:      "exhaust_ring",
+		},
+		{
+			name:          "mid",
+			server:        servers[1],
+			goDirect:      true,
+			scheme:        "https",
+			groups:        [][]string{{"ds0.example.net"}},
+			responseCodes: []int{404},
+			markdownCodes: []int{502, 503},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := test.server
+			cfg, err := MakeStrategiesDotYAML(dses, &server, servers, topologies, serverParams, parentConfigParams, nil, nil, cgs, nil, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txt := cfg.Text
+			testComment(t, txt, opt.HdrComment)
+
+			cfgYAML := testStrategiesYAML{}
+			if err := yaml.Unmarshal([]byte(txt), &cfgYAML); err != nil {
+				t.Fatalf("expected valid YAML, actual error '%v': '%v'", err, txt)
+			}
+			if len(cfgYAML.Strategies) != 1 {
+				t.Fatalf("expected 1 strategy for the Topology DS only, actual: '%v'", txt)
+			}
+			st := cfgYAML.Strategies[0]
+			if st.Strategy != StrategyName("ds0") {
+				t.Errorf("expected strategy '%v', actual: '%v'", StrategyName("ds0"), st.Strategy)
+			}
+			if st.Policy != "consistent_hash" || st.HashKey != "path" {
+				t.Errorf("expected policy consistent_hash with hash_key path, actual: '%v'", txt)
+			}
+			if st.ParentIsProxy != test.parentIsProxy || st.GoDirect != test.goDirect || st.Scheme != test.scheme {
+				t.Errorf("expected parent_is_proxy %v go_direct %v scheme %v, actual: '%v'", test.parentIsProxy, test.goDirect, test.scheme, txt)
+			}
+			groups := [][]string{}
+			for _, group := range st.Groups {
+				hosts := []string{}
+				for _, host := range group {
+					hosts = append(hosts, host.Host)
+					if len(host.Protocol) != 1 || host.Protocol[0].Scheme != test.scheme {
+						t.Errorf("expected host '%v' protocol scheme %v, actual: '%v'", host.Host, test.scheme, txt)
+					}
+				}
+				groups = append(groups, hosts)
+			}
+			if !reflect.DeepEqual(groups, test.groups) {
+				t.Errorf("expected groups %v, actual %v", test.groups, groups)
+			}
+			if st.Failover.RingMode != test.ringMode {
+				t.Errorf("expected ring_mode '%v', actual: '%v'", test.ringMode, txt)
+			}
+			if !reflect.DeepEqual(st.Failover.ResponseCodes, test.responseCodes) {
+				t.Errorf("expected response_codes %v, actual %v", test.responseCodes, st.Failover.ResponseCodes)
+			}
+			if !reflect.DeepEqual(st.Failover.MarkdownCodes, test.markdownCodes) {
+				t.Errorf("expected markdown_codes %v, actual %v", test.markdownCodes, st.Failover.MarkdownCodes)
+			}
+			if !reflect.DeepEqual(st.Failover.HealthCheck, []string{"passive", "active"}) {
+				t.Errorf("expected health_check [passive active], actual %v", st.Failover.HealthCheck)
+			}
+		})
+	}
+}
+
+func TestMakeStrategiesDotYAMLNotInTopology(t *testing.T) {
+	dses, servers, topologies, cgs, parentConfigParams := makeTestStrategiesData()
+	server := makeTestParentServer()
+	server.Cachegroup = util.StrPtr("otherCG")
+
+	cfg, err := MakeStrategiesDotYAML(dses, server, servers, topologies, nil, parentConfigParams, nil, nil, cgs, nil, StrategiesYAMLOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgYAML := testStrategiesYAML{}
+	if err := yaml.Unmarshal([]byte(cfg.Text), &cfgYAML); err != nil {
+		t.Fatalf("expected valid YAML, actual error '%v': '%v'", err, cfg.Text)
+	}
+	if len(cfgYAML.Strategies) != 0 {
+		t.Errorf("expected no strategies for a server not in the Topology, actual: '%v'", cfg.Text)
+	}
+}
+
+func TestMakeStrategiesDotYAMLInvalidDS(t *testing.T) {
+	dses, servers, topologies, cgs, parentConfigParams := makeTestStrategiesData()
+	server := servers[0]
+
+	badDS := *makeParentDS()
+	badDS.ID = util.IntPtr(44)
+	badDS.XMLID = util.StrPtr("badds")
+	badDS.OrgServerFQDN = util.StrPtr("badorigin.example.net")
+	badDS.Topology = util.StrPtr("t0")
+	ds0 := dses[0]
+	dses = append(dses, badDS)
+
+	// without parents, the strategy must still exist, because remap.config references it
+	cfg, err := MakeStrategiesDotYAML(dses, &server, servers[:1], topologies, nil, parentConfigParams, nil, nil, cgs, nil, StrategiesYAMLOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgYAML := testStrategiesYAML{}
+	if err := yaml.Unmarshal([]byte(cfg.Text), &cfgYAML); err != nil {
+		t.Fatalf("expected valid YAML, actual error '%v': '%v'", err, cfg.Text)
+	}
+	if len(cfgYAML.Strategies) != 1 {
+		t.Fatalf("expected 1 strategy for the DS with a valid origin only, actual: '%v'", cfg.Text)
+	}
+	st := cfgYAML.Strategies[0]
+	if st.Strategy != StrategyName("ds0") {
+		t.Errorf("expected strategy '%v', actual: '%v'", StrategyName("ds0"), st.Strategy)
+	}
+	if !st.GoDirect || st.ParentIsProxy || st.Scheme != "https" {
+		t.Errorf("expected a strategy going direct to the origin without parents, actual: '%v'", cfg.Text)
+	}
+	if len(st.Groups) != 1 || len(st.Groups[0]) != 1 || st.Groups[0][0].Host != "ds0.example.net" {
+		t.Errorf("expected the origin as the only group without parents, actual: '%v'", cfg.Text)
+	}
+	if len(cfg.Warnings) == 0 {
+		t.Error("expected warnings for the missing parents and the malformed origin, actual none")
+	}
+
+	// remap.config and strategies.yaml must agree on which DSes have strategies
+	nameTopologies := makeTopologyNameMap(topologies)
+	cacheGroups, err := makeCGMap(cgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt, _ := makeDSStrategyTxt(&server, &ds0, nameTopologies, cacheGroups); txt == "" {
+		t.Errorf("expected remap.config @strategy for DS '%v', actual none", *ds0.XMLID)
+	}
+	if txt, _ := makeDSStrategyTxt(&server, &badDS, nameTopologies, cacheGroups); txt != "" {
+		t.Errorf("expected no remap.config @strategy for the DS with a malformed origin, actual '%v'", txt)
+	}
+}
+
+func TestMakeStrategiesDotYAMLPlacementError(t *testing.T) {
+	dses, servers, topologies, cgs, parentConfigParams := makeTestStrategiesData()
+	server := servers[0]
+	ds0 := dses[0]
+
+	// the server's parent cachegroup is missing, so its placement in the topology can't be determined
+	validCGs := []tc.CacheGroupNullable{}
+	for _, cg := range cgs {
+		if *cg.Name != "midCG" {
+			validCGs = append(validCGs, cg)
+		}
+	}
+
+	cfg, err := MakeStrategiesDotYAML(dses, &server, servers, topologies, nil, parentConfigParams, nil, nil, validCGs, nil, StrategiesYAMLOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgYAML := testStrategiesYAML{}
+	if err := yaml.Unmarshal([]byte(cfg.Text), &cfgYAML); err != nil {
+		t.Fatalf("expected valid YAML, actual error '%v': '%v'", err, cfg.Text)
+	}
+	if len(cfgYAML.Strategies) != 0 {
+		t.Errorf("expected no strategy for the DS whose topology placement errors, actual: '%v'", cfg.Text)
+	}
+	if len(cfg.Warnings) == 0 {
+		t.Error("expected a warning for the topology placement error, actual none")
+	}
+
+	// remap.config and strategies.yaml must agree on which DSes have strategies
+	cacheGroups, err := makeCGMap(validCGs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt, _ := makeDSStrategyTxt(&server, &ds0, makeTopologyNameMap(topologies), cacheGroups); txt != "" {
+		t.Errorf("expected no remap.config @strategy for the DS whose topology placement errors, actual '%v'", txt)
+	}
+}
+
+func TestUseStrategies(t *testing.T) {
+	makeParams := func(atsVersion string, parentSelection string) []tc.Parameter {
+		params := []tc.Parameter{{Name: "trafficserver", ConfigFile: "package", Value: atsVersion}}
+		if parentSelection != "" {
+			params = append(params, tc.Parameter{Name: ParentSelectionParamName, ConfigFile: ParentConfigFileName, Value: parentSelection})
+		}
+		return params
+	}
+	for _, test := range []struct {
+		params   []tc.Parameter
+		expected bool
+		warns    bool
+	}{
+		{params: makeParams("9", ""), expected: false},
+		{params: makeParams("9", ParentSelectionParentDotConfig), expected: false},
+		{params: makeParams("9", ParentSelectionStrategies), expected: true},
+		{params: makeParams("8", ParentSelectionStrategies), expected: false, warns: true},
+		{params: makeParams("9", "unknown"), expected: false, warns: true},
+	} {
+		actual, warns := UseStrategies(test.params)
+		if actual != test.expected {
+			t.Errorf("params %+v expected %v, actual %v", test.params, test.expected, actual)
+		}
+		if (len(warns) > 0) != test.warns {
+			t.Errorf("params %+v expected warnings %v, actual %v", test.params, test.warns, warns)
+		}
+	}
+}
@@ -451,6 +451,80 @@ type TMParameters struct {
 	// a JSON object.
 	Thresholds map[string]HealthThreshold `json:"health_threshold,omitempty"`
 	HealthThresholdJSONParameters
+	TMPrometheusParameters
+	TMDampeningParameters
+}
+
+// TMDampeningParameters contains the Parameters which configure the flap
+// dampening of the availability of cache servers, which keeps a cache server
+// whose health is bouncing around a threshold from repeatedly being marked
+// available and unavailable. Any that are zero are disabled.
+type TMDampeningParameters struct {
+	// ConsecutiveFailures is the number of consecutive unhealthy poll results
+	// required to mark an available cache server unavailable.
+	ConsecutiveFailures int `json:"health.dampening.consecutive.failures,omitempty"`
+	// ConsecutiveSuccesses is the number of consecutive healthy poll results
+	// required to mark an unavailable cache server available.
+	ConsecutiveSuccesses int `json:"health.dampening.consecutive.successes,omitempty"`
+	// Penalty is the penalty added each time a cache server is marked
+	// unavailable.
+	Penalty float64 `json:"health.dampening.penalty,omitempty"`
+	// Suppress is the penalty at or above which a cache server is kept
+	// unavailable, even if it's healthy.
+	Suppress float64 `json:"health.dampening.suppress,omitempty"`
+	// Reuse is the penalty below which a suppressed cache server may be
+	// marked available again.
+	Reuse float64 `json:"health.dampening.reuse,omitempty"`
+	// HalfLife is the time, in milliseconds, it takes for the penalty to decay
+	// to half its value.
+	HalfLife int `json:"health.dampening.halflife,omitempty"`
+}
+
+// TMPrometheusParameters contains the Parameters which map the names of the
+// metrics served by cache servers with the "prometheus"
+// health.polling.format to the statistics Traffic Monitor uses. Any that are
+// empty use the Traffic Monitor default.
+type TMPrometheusParameters struct {
+	// LoadAvgOne is the name of the metric containing the cache server's
+	// one-minute load average.
+	LoadAvgOne string `json:"health.polling.prometheus.loadavg.one,omitempty"`
+	// LoadAvgFive is the name of the metric containing the cache server's
+	// five-minute load average.
+	LoadAvgFive string `json:"health.polling.prometheus.loadavg.five,omitempty"`
+	// LoadAvgFifteen is the name of the metric containing the cache server's
+	// fifteen-minute load average.
+	LoadAvgFifteen string `json:"health.polling.prometheus.loadavg.fifteen,omitempty"`
+	// InterfaceLabel is the name of the label containing the network
+	// interface name, on interface metrics.
+	InterfaceLabel string `json:"health.polling.prometheus.interface.label,omitempty"`
+	// InterfaceBytesIn is the name of the metric containing the number of
+	// bytes received by a network interface.
+	InterfaceBytesIn string `json:"health.polling.prometheus.interface.bytes_in,omitempty"`
+	// InterfaceBytesOut is the name of the metric containing the number of
+	// bytes transmitted by a network interface.
+	InterfaceBytesOut string `json:"health.polling.prometheus.interface.bytes_out,omitempty"`
+	// InterfaceSpeed is the name of the metric containing the speed of a
+	// network interface.
+	InterfaceSpeed string `json:"health.polling.prometheus.interface.speed,omitempty"`
+	// Connections is the name of the metric containing the number of open
+	// client connections.
+	Connections string `json:"health.polling.prometheus.connections,omitempty"`
+	// DeliveryServiceLabel is the name of the label containing the Delivery
+	// Service XMLID, on Delivery Service metrics.
+	DeliveryServiceLabel string `json:"health.polling.prometheus.ds.label,omitempty"`
+	// DeliveryServiceBytesIn is the name of the metric containing the number
+	// of bytes received for a Delivery Service.
+	DeliveryServiceBytesIn string `json:"health.polling.prometheus.ds.bytes_in,omitempty"`
+	// DeliveryServiceBytesOut is the name of the metric containing the number
+	// of bytes served for a Delivery Service.
+	DeliveryServiceBytesOut string `json:"health.polling.prometheus.ds.bytes_out,omitempty"`
+	// DeliveryServiceResponses is the name of the metric containing the number
+	// of responses served for a Delivery Service.
+	DeliveryServiceResponses string `json:"health.polling.prometheus.ds.responses,omitempty"`
+	// StatusLabel is the name of the label containing the HTTP response status
+	// code or class (e.g. "200" or "2xx"), on Delivery Service response
+	// metrics.
+	StatusLabel string `json:"health.polling.prometheus.ds.status.label,omitempty"`
 }
 
 // HealthThresholdJSONParameters contains Parameters whose Thresholds must be met in order for
@@ -556,6 +630,61 @@ func (params *TMParameters) UnmarshalJSON(bytes []byte) (err error) {
 		}
 	}
 
+	dampeningIntParams := map[string]*int{
+		"health.dampening.consecutive.failures":  &params.ConsecutiveFailures,
+		"health.dampening.consecutive.successes": &params.ConsecutiveSuccesses,
+		"health.dampening.halflife":              &params.HalfLife,
+	}
+	for name, param := range dampeningIntParams {
+		if vi, ok := raw[name]; ok {
+			if v, ok := vi.(float64); !ok {
+				return fmt.Errorf("Unmarshalling TMParameters %s expected integer, got %v", name, vi)
+			} else {
+				*param = int(v)
+			}
+		}
+	}
+
+	dampeningFloatParams := map[string]*float64{
+		"health.dampening.penalty":  &params.Penalty,
+		"health.dampening.suppress": &params.Suppress,
+		"health.dampening.reuse":    &params.Reuse,
+	}
+	for name, param := range dampeningFloatParams {
+		if vi, ok := raw[name]; ok {
+			if v, ok := vi.(float64); !ok {
+				return fmt.Errorf("Unmarshalling TMParameters %s expected number, got %v", name, vi)
+			} else {
+				*param = v
+			}
+		}
+	}
+
+	prometheusParams := map[string]*string{
+		"health.polling.prometheus.loadavg.one":         &params.LoadAvgOne,
+		"health.polling.prometheus.loadavg.five":        &params.LoadAvgFive,
+		"health.polling.prometheus.loadavg.fifteen":     &params.LoadAvgFifteen,
+		"health.polling.prometheus.interface.label":     &params.InterfaceLabel,
+		"health.polling.prometheus.interface.bytes_in":  &params.InterfaceBytesIn,
+		"health.polling.prometheus.interface.bytes_out": &params.InterfaceBytesOut,
+		"health.polling.prometheus.interface.speed":     &params.InterfaceSpeed,
+		"health.polling.prometheus.connections":         &params.Connections,
+		"health.polling.prometheus.ds.label":            &params.DeliveryServiceLabel,
+		"health.polling.prometheus.ds.bytes_in":         &params.DeliveryServiceBytesIn,
+		"health.polling.prometheus.ds.bytes_out":        &params.DeliveryServiceBytesOut,
+		"health.polling.prometheus.ds.responses":        &params.DeliveryServiceResponses,
+		"health.polling.prometheus.ds.status.label":     &params.StatusLabel,
+	}
+	for name, param := range prometheusParams {
+		if vi, ok := raw[name]; ok {
+			if v, ok := vi.(string); !ok {
+				return fmt.Errorf("Unmarshalling TMParameters %s expected string, got %v", name, vi)
+			} else {
+				*param = v
+			}
+		}
+	}
+
 	params.Thresholds = make(map[string]HealthThreshold, len(raw))
 	for k, v := range raw {
 		if strings.HasPrefix(k, ThresholdPrefix) {
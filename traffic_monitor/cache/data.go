@@ -69,6 +69,33 @@ type AvailableStatus struct {
 	UnavailableStat string
 	// Poller is the name of the poller which set this availability status.
 	Poller string
+	// Dampening is the flap dampening state of the cache server.
+	Dampening DampeningState
+}
+
+// DampeningState is the flap dampening state of a cache server, which is used
+// to hold its availability while its health changes back and forth.
+type DampeningState struct {
+	// HealthAvailable is whether the latest poll result, by itself, would
+	// have made the cache server available.
+	HealthAvailable bool
+	// ConsecutiveFailures is the number of consecutive unhealthy poll results.
+	ConsecutiveFailures uint64
+	// ConsecutiveSuccesses is the number of consecutive healthy poll results.
+	ConsecutiveSuccesses uint64
+	// Penalty is the accumulated flap penalty, as of PenaltyTime.
+	Penalty float64
+	// PenaltyTime is the time the Penalty was last decayed.
+	PenaltyTime time.Time
+	// Suppressed is whether the cache server is being kept unavailable
+	// because its Penalty reached the suppress threshold.
+	Suppressed bool
+	// Pending is whether the health of the cache server differs from its
+	// availability, i.e. whether an availability change is being held.
+	Pending bool
+	// SuppressedTransitions is the number of availability changes which have
+	// been held by dampening.
+	SuppressedTransitions uint64
 }
 
 // CacheAvailableStatuses is the available status of each cache.
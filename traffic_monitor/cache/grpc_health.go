@@ -0,0 +1,70 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// grpc-health is a parser designed to work with the grpc-health poller, which
+// only reports whether a cache is serving. No statistics are gathered; the
+// cache's monitored interfaces are reported as present, without traffic.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// GRPCHealthStatusStat is the name of the stat holding the gRPC health
+// check status of a cache polled with the grpc-health poller.
+const GRPCHealthStatusStat = "grpc.health.status"
+
+func init() {
+	registerDecoder(poller.PollerTypeGRPCHealth, grpcHealthParse, grpcHealthPrecompute)
+}
+
+func grpcHealthParse(cacheName string, data io.Reader, pollCTX interface{}) (Statistics, map[string]interface{}, error) {
+	stats := Statistics{}
+	if data == nil {
+		return stats, nil, errors.New("handler got nil reader")
+	}
+	body, err := ioutil.ReadAll(data)
+	if err != nil {
+		return stats, nil, errors.New("reading health check status: " + err.Error())
+	}
+	status := strings.TrimSpace(string(body))
+	if status != poller.GRPCHealthStatusNames[poller.GRPCHealthStatusServing] {
+		return stats, nil, fmt.Errorf("cache '%s' gRPC health check status %s", cacheName, status)
+	}
+
+	stats.Interfaces = map[string]Interface{}
+	if ctx, ok := pollCTX.(*poller.GRPCHealthPollCtx); ok && ctx != nil {
+		for _, name := range ctx.Interfaces {
+			stats.Interfaces[name] = Interface{}
+		}
+	}
+	return stats, map[string]interface{}{GRPCHealthStatusStat: status}, nil
+}
+
+func grpcHealthPrecompute(cache string, toData todata.TOData, stats Statistics, rawStats map[string]interface{}) PrecomputedData {
+	return PrecomputedData{DeliveryServiceStats: map[string]*DSStat{}}
+}
@@ -0,0 +1,45 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+)
+
+func TestGRPCHealthParse(t *testing.T) {
+	ctx := &poller.GRPCHealthPollCtx{Interfaces: []string{"eth0", "eth1"}}
+	stats, misc, err := grpcHealthParse("test", strings.NewReader("SERVING"), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Interfaces) != 2 {
+		t.Errorf("Expected the 2 monitored interfaces, got %+v", stats.Interfaces)
+	}
+	if misc[GRPCHealthStatusStat] != "SERVING" {
+		t.Errorf("Expected status stat SERVING, got %v", misc[GRPCHealthStatusStat])
+	}
+
+	if _, _, err := grpcHealthParse("test", strings.NewReader("NOT_SERVING"), ctx); err == nil {
+		t.Error("Expected an error for NOT_SERVING, got none")
+	}
+}
@@ -0,0 +1,410 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// These are the default names of the metrics and labels read from caches
+// using the "prometheus" format, used when the corresponding
+// health.polling.prometheus Parameter is not set. They match the metrics
+// served by the Prometheus node_exporter, and the Apache Traffic Server
+// stats_over_http plugin's Prometheus output.
+const (
+	PrometheusDefaultLoadAvgOne               = "node_load1"
+	PrometheusDefaultLoadAvgFive              = "node_load5"
+	PrometheusDefaultLoadAvgFifteen           = "node_load15"
+	PrometheusDefaultInterfaceLabel           = "device"
+	PrometheusDefaultInterfaceBytesIn         = "node_network_receive_bytes_total"
+	PrometheusDefaultInterfaceBytesOut        = "node_network_transmit_bytes_total"
+	PrometheusDefaultInterfaceSpeed           = "node_network_speed_bytes"
+	PrometheusDefaultConnections              = "proxy_process_http_current_client_connections"
+	PrometheusDefaultDeliveryServiceLabel     = "deliveryservice"
+	PrometheusDefaultDeliveryServiceBytesIn   = "deliveryservice_in_bytes_total"
+	PrometheusDefaultDeliveryServiceBytesOut  = "deliveryservice_out_bytes_total"
+	PrometheusDefaultDeliveryServiceResponses = "deliveryservice_responses_total"
+	PrometheusDefaultStatusLabel              = "code"
+)
+
+// prometheusConnectionsStat is the name under which the connections metric is
+// stored, which is the name of the stat used by the astats and
+// stats_over_http formats.
+const prometheusConnectionsStat = "proxy.process.http.current_client_connections"
+
+// prometheusDSStatPrefix is prepended to the normalized names of Delivery
+// Service stats, which the Parser creates for the Precomputer to read.
+const prometheusDSStatPrefix = "prometheus.ds."
+
+func init() {
+	registerDecoder("prometheus", prometheusParse, prometheusPrecompute)
+}
+
+// prometheusSample is a single sample from a Prometheus text exposition.
+type prometheusSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// prometheusSeries returns the name and sorted labels of the sample, in the
+// Prometheus text format, which uniquely identifies the sample.
+func (s prometheusSample) series() string {
+	if len(s.Labels) == 0 {
+		return s.Name
+	}
+	names := make([]string, 0, len(s.Labels))
+	for name := range s.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b := strings.Builder{}
+	b.WriteString(s.Name)
+	b.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(s.Labels[name]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// prometheusNames returns the metric name mapping from the given Parameters,
+// with defaults substituted for any which are not set.
+func prometheusNames(params tc.TMPrometheusParameters) tc.TMPrometheusParameters {
+	setDefault := func(name *string, def string) {
+		if *name == "" {
+			*name = def
+		}
+	}
+	setDefault(&params.LoadAvgOne, PrometheusDefaultLoadAvgOne)
+	setDefault(&params.LoadAvgFive, PrometheusDefaultLoadAvgFive)
+	setDefault(&params.LoadAvgFifteen, PrometheusDefaultLoadAvgFifteen)
+	setDefault(&params.InterfaceLabel, PrometheusDefaultInterfaceLabel)
+	setDefault(&params.InterfaceBytesIn, PrometheusDefaultInterfaceBytesIn)
+	setDefault(&params.InterfaceBytesOut, PrometheusDefaultInterfaceBytesOut)
+	setDefault(&params.InterfaceSpeed, PrometheusDefaultInterfaceSpeed)
+	setDefault(&params.Connections, PrometheusDefaultConnections)
+	setDefault(&params.DeliveryServiceLabel, PrometheusDefaultDeliveryServiceLabel)
+	setDefault(&params.DeliveryServiceBytesIn, PrometheusDefaultDeliveryServiceBytesIn)
+	setDefault(&params.DeliveryServiceBytesOut, PrometheusDefaultDeliveryServiceBytesOut)
+	setDefault(&params.DeliveryServiceResponses, PrometheusDefaultDeliveryServiceResponses)
+	setDefault(&params.StatusLabel, PrometheusDefaultStatusLabel)
+	return params
+}
+
+func prometheusParse(cacheName string, data io.Reader, pollCTX interface{}) (Statistics, map[string]interface{}, error) {
+	var stats Statistics
+	if data == nil {
+		log.Warnf("Cannot read stats data for cache '%s' - nil data reader", cacheName)
+		return stats, nil, errors.New("handler got nil reader")
+	}
+
+	params := tc.TMPrometheusParameters{}
+	if ctx, ok := pollCTX.(*poller.HTTPPollCtx); ok && ctx != nil {
+		params = ctx.Prometheus
+	}
+	names := prometheusNames(params)
+
+	samples, err := prometheusParseText(data)
+	if err != nil {
+		return stats, nil, fmt.Errorf("parsing prometheus stats for cache '%s': %v", cacheName, err)
+	}
+
+	foundLoadAvg := false
+	statMap := make(map[string]interface{}, len(samples))
+	for _, sample := range samples {
+		switch sample.Name {
+		case names.LoadAvgOne:
+			stats.Loadavg.One = sample.Value
+			foundLoadAvg = true
+			continue
+		case names.LoadAvgFive:
+			stats.Loadavg.Five = sample.Value
+			continue
+		case names.LoadAvgFifteen:
+			stats.Loadavg.Fifteen = sample.Value
+			continue
+		case names.InterfaceBytesIn, names.InterfaceBytesOut, names.InterfaceSpeed:
+			if err := prometheusAddInterfaceStat(&stats, names, sample); err != nil {
+				log.Warnf("cache '%s' prometheus stat '%s': %v", cacheName, sample.series(), err)
+			}
+			continue
+		case names.Connections:
+			statMap[prometheusConnectionsStat] = sample.Value
+			continue
+		case names.DeliveryServiceBytesIn:
+			prometheusAddDSStat(statMap, names, sample, "in_bytes")
+		case names.DeliveryServiceBytesOut:
+			prometheusAddDSStat(statMap, names, sample, "out_bytes")
+		case names.DeliveryServiceResponses:
+			status := sample.Labels[names.StatusLabel]
+			if status == "" || status[0] < '2' || status[0] > '5' {
+				log.Infof("cache '%s' prometheus stat '%s' has no 2xx-5xx '%s' label, skipping", cacheName, sample.series(), names.StatusLabel)
+				continue
+			}
+			prometheusAddDSStat(statMap, names, sample, "status_"+status[:1]+"xx")
+		}
+		statMap[sample.series()] = sample.Value
+	}
+
+	if !foundLoadAvg {
+		return stats, nil, fmt.Errorf("cache '%s' prometheus data was missing '%s'", cacheName, names.LoadAvgOne)
+	}
+	if len(stats.Interfaces) < 1 {
+		return stats, nil, fmt.Errorf("cache '%s' had no interfaces", cacheName)
+	}
+
+	return stats, statMap, nil
+}
+
+// prometheusAddInterfaceStat adds the given interface metric sample to the
+// interfaces of the given Statistics.
+func prometheusAddInterfaceStat(stats *Statistics, names tc.TMPrometheusParameters, sample prometheusSample) error {
+	name := sample.Labels[names.InterfaceLabel]
+	if name == "" {
+		return fmt.Errorf("missing interface label '%s'", names.InterfaceLabel)
+	}
+	if sample.Value < 0 || math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+		return fmt.Errorf("invalid value %v", sample.Value)
+	}
+	if stats.Interfaces == nil {
+		stats.Interfaces = map[string]Interface{}
+	}
+	iface := stats.Interfaces[name]
+	switch sample.Name {
+	case names.InterfaceBytesIn:
+		iface.BytesIn = uint64(sample.Value)
+	case names.InterfaceBytesOut:
+		iface.BytesOut = uint64(sample.Value)
+	case names.InterfaceSpeed:
+		// Interface speeds are in megabits per second. By Prometheus naming
+		// convention, a metric ending in "_bytes" is in bytes per second.
+		if strings.HasSuffix(sample.Name, "_bytes") {
+			iface.Speed = int64(sample.Value * 8 / 1000000)
+		} else {
+			iface.Speed = int64(sample.Value)
+		}
+	}
+	stats.Interfaces[name] = iface
+	return nil
+}
+
+// prometheusAddDSStat adds the given Delivery Service metric sample to the
+// stat map, under its normalized name, summing it with any other samples for
+// the same Delivery Service and stat.
+func prometheusAddDSStat(statMap map[string]interface{}, names tc.TMPrometheusParameters, sample prometheusSample, stat string) {
+	ds := sample.Labels[names.DeliveryServiceLabel]
+	if ds == "" {
+		return
+	}
+	key := prometheusDSStatPrefix + ds + "." + stat
+	sum, _ := statMap[key].(float64)
+	statMap[key] = sum + sample.Value
+}
+
+// prometheusParseText parses the Prometheus text exposition format, which is
+// also valid for the OpenMetrics text format. Comments, including TYPE and
+// HELP metadata, are ignored, as are sample timestamps.
+func prometheusParseText(data io.Reader) ([]prometheusSample, error) {
+	samples := []prometheusSample{}
+	scanner := bufio.NewScanner(data)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		sample, err := prometheusParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, errors.New("no samples found")
+	}
+	return samples, nil
+}
+
+// prometheusParseLine parses a single sample line, of the form
+// `name{label="value",...} value [timestamp]`.
+func prometheusParseLine(line string) (prometheusSample, error) {
+	sample := prometheusSample{}
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return sample, errors.New("malformed sample")
+	}
+	sample.Name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	if rest[0] == '{' {
+		labels, labelsEnd, err := prometheusParseLabels(rest)
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		rest = rest[labelsEnd:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return sample, errors.New("malformed sample value")
+	}
+	val, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("malformed sample value '%s': %v", fields[0], err)
+	}
+	sample.Value = val
+	return sample, nil
+}
+
+// prometheusParseLabels parses the label set at the start of the given string,
+// which must begin with '{'. It returns the labels, and the index just past the
+// closing '}'.
+func prometheusParseLabels(s string) (map[string]string, int, error) {
+	labels := map[string]string{}
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, errors.New("unterminated label set")
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+		eq := strings.IndexByte(s[i:], '=')
+		if eq <= 0 {
+			return nil, 0, errors.New("malformed label")
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		if i >= len(s) || s[i] != '"' {
+			return nil, 0, fmt.Errorf("label '%s' value is not quoted", name)
+		}
+		i++
+		val := strings.Builder{}
+		for {
+			if i >= len(s) {
+				return nil, 0, fmt.Errorf("label '%s' value is unterminated", name)
+			}
+			c := s[i]
+			i++
+			if c == '"' {
+				break
+			}
+			if c == '\\' && i < len(s) {
+				c = s[i]
+				i++
+				if c == 'n' {
+					c = '\n'
+				}
+			}
+			val.WriteByte(c)
+		}
+		labels[name] = val.String()
+	}
+}
+
+func prometheusPrecompute(cacheName string, data todata.TOData, stats Statistics, miscStats map[string]interface{}) PrecomputedData {
+	precomputed := PrecomputedData{}
+	precomputed.DeliveryServiceStats = make(map[string]*DSStat)
+
+	for _, iface := range stats.Interfaces {
+		precomputed.OutBytes += iface.BytesOut
+		if iface.Speed > precomputed.MaxKbps {
+			precomputed.MaxKbps = iface.Speed
+		}
+	}
+	precomputed.MaxKbps *= 1000
+
+	for stat, value := range miscStats {
+		if !strings.HasPrefix(stat, prometheusDSStatPrefix) {
+			continue
+		}
+		trimmedStat := strings.TrimPrefix(stat, prometheusDSStatPrefix)
+		dot := strings.LastIndexByte(trimmedStat, '.')
+		if dot <= 0 {
+			continue
+		}
+		dsName := trimmedStat[:dot]
+		if _, ok := data.DeliveryServiceTypes[tc.DeliveryServiceName(dsName)]; !ok {
+			err := errors.New("No Delivery Service match for stat")
+			log.Infof("precomputing cache %s stat %s value %v error %v", cacheName, stat, value, err)
+			precomputed.Errors = append(precomputed.Errors, err)
+			continue
+		}
+
+		parsedStat, err := parseNumericStat(value)
+		if err != nil {
+			err = fmt.Errorf("couldn't parse numeric stat: %v", err)
+			log.Infof("precomputing cache %s stat %s value %v error %v", cacheName, stat, value, err)
+			precomputed.Errors = append(precomputed.Errors, err)
+			continue
+		}
+
+		dsStat, ok := precomputed.DeliveryServiceStats[dsName]
+		if !ok || dsStat == nil {
+			dsStat = new(DSStat)
+		}
+
+		switch trimmedStat[dot+1:] {
+		case "status_2xx":
+			dsStat.Status2xx = parsedStat
+		case "status_3xx":
+			dsStat.Status3xx = parsedStat
+		case "status_4xx":
+			dsStat.Status4xx = parsedStat
+		case "status_5xx":
+			dsStat.Status5xx = parsedStat
+		case "out_bytes":
+			dsStat.OutBytes = parsedStat
+		case "in_bytes":
+			dsStat.InBytes = parsedStat
+		default:
+			continue
+		}
+		precomputed.DeliveryServiceStats[dsName] = dsStat
+	}
+	return precomputed
+}
@@ -0,0 +1,147 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+const prometheusTestData = `# HELP node_load1 1m load average.
+# TYPE node_load1 gauge
+node_load1 0.25
+node_load5 0.5
+node_load15 0.75 1600000000000
+# TYPE node_network_receive_bytes_total counter
+node_network_receive_bytes_total{device="eth0"} 1000
+node_network_transmit_bytes_total{device="eth0"} 2.5e+06
+node_network_speed_bytes{device="eth0"} 1.25e+09
+node_network_receive_bytes_total{device="lo"} 10
+node_network_transmit_bytes_total{device="lo"} 20
+proxy_process_http_current_client_connections 42
+deliveryservice_out_bytes_total{deliveryservice="demo1",host="edge"} 300
+deliveryservice_in_bytes_total{deliveryservice="demo1"} 100
+deliveryservice_responses_total{deliveryservice="demo1",code="200"} 7
+deliveryservice_responses_total{deliveryservice="demo1",code="206"} 3
+deliveryservice_responses_total{deliveryservice="demo1",code="503"} 1
+deliveryservice_responses_total{deliveryservice="unknown",code="200"} 1
+custom_metric{label="a \"quoted\", value"} 5
+`
+
+func TestPrometheusParse(t *testing.T) {
+	ctx := &poller.HTTPPollCtx{}
+	stats, misc, err := prometheusParse("test", strings.NewReader(prometheusTestData), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Loadavg.One != 0.25 || stats.Loadavg.Five != 0.5 || stats.Loadavg.Fifteen != 0.75 {
+		t.Errorf("Incorrect loadavg, expected {0.25 0.5 0.75}, got %+v", stats.Loadavg)
+	}
+
+	if len(stats.Interfaces) != 2 {
+		t.Fatalf("Expected exactly two interfaces, got %d", len(stats.Interfaces))
+	}
+	eth0 := stats.Interfaces["eth0"]
+	if eth0.BytesIn != 1000 {
+		t.Errorf("Incorrect eth0 bytes in, expected 1000, got %d", eth0.BytesIn)
+	}
+	if eth0.BytesOut != 2500000 {
+		t.Errorf("Incorrect eth0 bytes out, expected 2500000, got %d", eth0.BytesOut)
+	}
+	if eth0.Speed != 10000 {
+		t.Errorf("Incorrect eth0 speed, expected 10000, got %d", eth0.Speed)
+	}
+
+	if misc[prometheusConnectionsStat] != float64(42) {
+		t.Errorf("Incorrect connections, expected 42, got %v", misc[prometheusConnectionsStat])
+	}
+	if misc[prometheusDSStatPrefix+"demo1.status_2xx"] != float64(10) {
+		t.Errorf("Incorrect demo1 2xx responses, expected 10, got %v", misc[prometheusDSStatPrefix+"demo1.status_2xx"])
+	}
+	if misc[`custom_metric{label="a \"quoted\", value"}`] != float64(5) {
+		t.Errorf("Expected custom metric to be kept, got %+v", misc)
+	}
+
+	data := todata.New()
+	data.DeliveryServiceTypes["demo1"] = tc.DSTypeCategoryHTTP
+	precomputed := prometheusPrecompute("test", *data, stats, misc)
+
+	if precomputed.OutBytes != 2500020 {
+		t.Errorf("Incorrect out bytes, expected 2500020, got %d", precomputed.OutBytes)
+	}
+	if precomputed.MaxKbps != 10000000 {
+		t.Errorf("Incorrect max kbps, expected 10000000, got %d", precomputed.MaxKbps)
+	}
+	if len(precomputed.DeliveryServiceStats) != 1 {
+		t.Fatalf("Expected exactly one delivery service, got %d", len(precomputed.DeliveryServiceStats))
+	}
+	ds := precomputed.DeliveryServiceStats["demo1"]
+	if ds == nil {
+		t.Fatal("Expected stats for delivery service demo1, got none")
+	}
+	if ds.InBytes != 100 || ds.OutBytes != 300 || ds.Status2xx != 10 || ds.Status5xx != 1 {
+		t.Errorf("Incorrect demo1 stats, expected in 100 out 300 2xx 10 5xx 1, got %+v", *ds)
+	}
+}
+
+func TestPrometheusParseCustomNames(t *testing.T) {
+	data := `load{period="1m"} 1.5
+load_one 2
+iface_out{name="bond0"} 123
+`
+	ctx := &poller.HTTPPollCtx{
+		Prometheus: tc.TMPrometheusParameters{
+			LoadAvgOne:        "load_one",
+			InterfaceLabel:    "name",
+			InterfaceBytesOut: "iface_out",
+		},
+	}
+	stats, _, err := prometheusParse("test", strings.NewReader(data), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Loadavg.One != 2 {
+		t.Errorf("Incorrect one-minute loadavg, expected 2, got %v", stats.Loadavg.One)
+	}
+	if stats.Interfaces["bond0"].BytesOut != 123 {
+		t.Errorf("Incorrect bond0 bytes out, expected 123, got %+v", stats.Interfaces)
+	}
+}
+
+func TestPrometheusParseErrors(t *testing.T) {
+	ctx := &poller.HTTPPollCtx{}
+	inputs := map[string]string{
+		"no samples":         "# only a comment\n",
+		"no loadavg":         `node_network_transmit_bytes_total{device="eth0"} 1` + "\n",
+		"no interfaces":      "node_load1 1\n",
+		"bad value":          "node_load1 one\n",
+		"unterminated label": `node_load1{a="b 1` + "\n",
+	}
+	for name, input := range inputs {
+		if _, _, err := prometheusParse("test", strings.NewReader(input), ctx); err == nil {
+			t.Errorf("Expected an error for %s, got none", name)
+		}
+	}
+}
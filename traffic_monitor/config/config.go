@@ -97,37 +97,62 @@ func (t *PollingProtocol) UnmarshalJSON(b []byte) error {
 
 // Config is the configuration for the application. It includes myriad data, such as polling intervals and log locations.
 type Config struct {
-	CacheHealthPollingInterval   time.Duration   `json:"-"`
-	CacheStatPollingInterval     time.Duration   `json:"-"`
-	MonitorConfigPollingInterval time.Duration   `json:"-"`
-	HTTPTimeout                  time.Duration   `json:"-"`
-	PeerPollingInterval          time.Duration   `json:"-"`
-	PeerOptimistic               bool            `json:"peer_optimistic"`
-	PeerOptimisticQuorumMin      int             `json:"peer_optimistic_quorum_min"`
-	MaxEvents                    uint64          `json:"max_events"`
-	MaxStatHistory               uint64          `json:"max_stat_history"`
-	MaxHealthHistory             uint64          `json:"max_health_history"`
-	HealthFlushInterval          time.Duration   `json:"-"`
-	StatFlushInterval            time.Duration   `json:"-"`
-	StatBufferInterval           time.Duration   `json:"-"`
-	LogLocationError             string          `json:"log_location_error"`
-	LogLocationWarning           string          `json:"log_location_warning"`
-	LogLocationInfo              string          `json:"log_location_info"`
-	LogLocationDebug             string          `json:"log_location_debug"`
-	LogLocationEvent             string          `json:"log_location_event"`
-	ServeReadTimeout             time.Duration   `json:"-"`
-	ServeWriteTimeout            time.Duration   `json:"-"`
-	HealthToStatRatio            uint64          `json:"health_to_stat_ratio"`
-	StaticFileDir                string          `json:"static_file_dir"`
-	CRConfigHistoryCount         uint64          `json:"crconfig_history_count"`
-	TrafficOpsMinRetryInterval   time.Duration   `json:"-"`
-	TrafficOpsMaxRetryInterval   time.Duration   `json:"-"`
-	CRConfigBackupFile           string          `json:"crconfig_backup_file"`
-	TMConfigBackupFile           string          `json:"tmconfig_backup_file"`
-	TrafficOpsDiskRetryMax       uint64          `json:"-"`
-	CachePollingProtocol         PollingProtocol `json:"cache_polling_protocol"`
-	PeerPollingProtocol          PollingProtocol `json:"peer_polling_protocol"`
-	HTTPPollingFormat            string          `json:"http_polling_format"`
+	CacheHealthPollingInterval   time.Duration      `json:"-"`
+	CacheStatPollingInterval     time.Duration      `json:"-"`
+	MonitorConfigPollingInterval time.Duration      `json:"-"`
+	HTTPTimeout                  time.Duration      `json:"-"`
+	PeerPollingInterval          time.Duration      `json:"-"`
+	PeerOptimistic               bool               `json:"peer_optimistic"`
+	PeerOptimisticQuorumMin      int                `json:"peer_optimistic_quorum_min"`
+	PeerWeights                  map[string]float64 `json:"peer_weights"`
+	PeerOptimisticWeightMin      float64            `json:"peer_optimistic_weight_min"`
+	PeerMinorityHold             bool               `json:"peer_minority_hold"`
+	MaxEvents                    uint64             `json:"max_events"`
+	MaxStatHistory               uint64             `json:"max_stat_history"`
+	MaxHealthHistory             uint64             `json:"max_health_history"`
+	HealthFlushInterval          time.Duration      `json:"-"`
+	StatFlushInterval            time.Duration      `json:"-"`
+	StatBufferInterval           time.Duration      `json:"-"`
+	LogLocationError             string             `json:"log_location_error"`
+	LogLocationWarning           string             `json:"log_location_warning"`
+	LogLocationInfo              string             `json:"log_location_info"`
+	LogLocationDebug             string             `json:"log_location_debug"`
+	LogLocationEvent             string             `json:"log_location_event"`
+	ServeReadTimeout             time.Duration      `json:"-"`
+	ServeWriteTimeout            time.Duration      `json:"-"`
+	HealthToStatRatio            uint64             `json:"health_to_stat_ratio"`
+	StaticFileDir                string             `json:"static_file_dir"`
+	CRConfigHistoryCount         uint64             `json:"crconfig_history_count"`
+	TrafficOpsMinRetryInterval   time.Duration      `json:"-"`
+	TrafficOpsMaxRetryInterval   time.Duration      `json:"-"`
+	CRConfigBackupFile           string             `json:"crconfig_backup_file"`
+	TMConfigBackupFile           string             `json:"tmconfig_backup_file"`
+	TrafficOpsDiskRetryMax       uint64             `json:"-"`
+	CachePollingProtocol         PollingProtocol    `json:"cache_polling_protocol"`
+	PeerPollingProtocol          PollingProtocol    `json:"peer_polling_protocol"`
+	HTTPPollingFormat            string             `json:"http_polling_format"`
+	HistoryPersistFile           string             `json:"history_persist_file"`
+	HistoryPersistInterval       time.Duration      `json:"-"`
+	HistoryPersistRetention      time.Duration      `json:"-"`
+	DSProbeURLs                  map[string]string  `json:"ds_probe_urls"`
+	DSProbeInterval              time.Duration      `json:"-"`
+	DSProbeCachesPerCacheGroup   int                `json:"ds_probe_caches_per_cachegroup"`
+}
+
+// PeerWeight returns the weight of the vote of the Traffic Monitor with the
+// given hostname and Cache Group in the peer quorum.
+func (c Config) PeerWeight(hostName string, cacheGroup string) float64 {
+	weight, ok := c.PeerWeights[hostName]
+	if !ok {
+		weight, ok = c.PeerWeights[cacheGroup]
+	}
+	if !ok {
+		return 1
+	}
+	if weight < 0 {
+		return 0
+	}
+	return weight
 }
 
 func (c Config) ErrorLog() log.LogLocation   { return log.LogLocation(c.LogLocationError) }
@@ -145,6 +170,9 @@ var DefaultConfig = Config{
 	PeerPollingInterval:          5 * time.Second,
 	PeerOptimistic:               true,
 	PeerOptimisticQuorumMin:      0,
+	PeerWeights:                  nil,
+	PeerOptimisticWeightMin:      0,
+	PeerMinorityHold:             false,
 	MaxEvents:                    200,
 	MaxStatHistory:               5,
 	MaxHealthHistory:             5,
@@ -169,6 +197,12 @@ var DefaultConfig = Config{
 	CachePollingProtocol:         Both,
 	PeerPollingProtocol:          Both,
 	HTTPPollingFormat:            HTTPPollingFormat,
+	HistoryPersistFile:           "",
+	HistoryPersistInterval:       30 * time.Second,
+	HistoryPersistRetention:      10 * time.Minute,
+	DSProbeURLs:                  nil,
+	DSProbeInterval:              30 * time.Second,
+	DSProbeCachesPerCacheGroup:   1,
 }
 
 // MarshalJSON marshals custom millisecond durations. Aliasing inspired by http://choly.ca/post/go-json-marshalling/
@@ -188,6 +222,9 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		StatBufferIntervalMs           uint64 `json:"stat_buffer_interval_ms"`
 		ServeReadTimeoutMs             uint64 `json:"serve_read_timeout_ms"`
 		ServeWriteTimeoutMs            uint64 `json:"serve_write_timeout_ms"`
+		HistoryPersistIntervalMs       uint64 `json:"history_persist_interval_ms"`
+		HistoryPersistRetentionMs      uint64 `json:"history_persist_retention_ms"`
+		DSProbeIntervalMs              uint64 `json:"ds_probe_interval_ms"`
 		*Alias
 	}{
 		CacheHealthPollingIntervalMs:   uint64(c.CacheHealthPollingInterval / time.Millisecond),
@@ -200,6 +237,9 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		HealthFlushIntervalMs:          uint64(c.HealthFlushInterval / time.Millisecond),
 		StatFlushIntervalMs:            uint64(c.StatFlushInterval / time.Millisecond),
 		StatBufferIntervalMs:           uint64(c.StatBufferInterval / time.Millisecond),
+		HistoryPersistIntervalMs:       uint64(c.HistoryPersistInterval / time.Millisecond),
+		HistoryPersistRetentionMs:      uint64(c.HistoryPersistRetention / time.Millisecond),
+		DSProbeIntervalMs:              uint64(c.DSProbeInterval / time.Millisecond),
 		Alias:                          (*Alias)(c),
 	})
 }
@@ -226,6 +266,9 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		CRConfigBackupFile             *string `json:"crconfig_backup_file"`
 		TMConfigBackupFile             *string `json:"tmconfig_backup_file"`
 		HTTPPollingFormat              *string `json:"http_polling_format"`
+		HistoryPersistIntervalMs       *uint64 `json:"history_persist_interval_ms"`
+		HistoryPersistRetentionMs      *uint64 `json:"history_persist_retention_ms"`
+		DSProbeIntervalMs              *uint64 `json:"ds_probe_interval_ms"`
 		*Alias
 	}{
 		Alias: (*Alias)(c),
@@ -289,6 +332,15 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	if aux.HTTPPollingFormat != nil {
 		c.HTTPPollingFormat = *aux.HTTPPollingFormat
 	}
+	if aux.HistoryPersistIntervalMs != nil {
+		c.HistoryPersistInterval = time.Duration(*aux.HistoryPersistIntervalMs) * time.Millisecond
+	}
+	if aux.HistoryPersistRetentionMs != nil {
+		c.HistoryPersistRetention = time.Duration(*aux.HistoryPersistRetentionMs) * time.Millisecond
+	}
+	if aux.DSProbeIntervalMs != nil {
+		c.DSProbeInterval = time.Duration(*aux.DSProbeIntervalMs) * time.Millisecond
+	}
 	return nil
 }
 
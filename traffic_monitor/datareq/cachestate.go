@@ -73,6 +73,22 @@ type CacheStatus struct {
 	CombinedAvailable     *bool    `json:"combined_available,omitempty"`
 
 	Interfaces *map[string]CacheInterfaceStatus `json:"interfaces,omitempty"`
+
+	// Dampening is the flap dampening state of the cache server.
+	Dampening *CacheDampeningStatus `json:"dampening,omitempty"`
+}
+
+// CacheDampeningStatus represents the flap dampening state of a cache server.
+type CacheDampeningStatus struct {
+	// HealthAvailable is whether the latest poll result, by itself, would have
+	// made the cache server available.
+	HealthAvailable       bool    `json:"health_available"`
+	ConsecutiveFailures   uint64  `json:"consecutive_failures"`
+	ConsecutiveSuccesses  uint64  `json:"consecutive_successes"`
+	Penalty               float64 `json:"penalty"`
+	Suppressed            bool    `json:"suppressed"`
+	Pending               bool    `json:"pending"`
+	SuppressedTransitions uint64  `json:"suppressed_transitions"`
 }
 
 // CacheInterfaceStatus represents the status of a single network interface of a
@@ -250,6 +266,19 @@ func createCacheStatuses(
 			cacheStatus.ProcessedAvailable = cacheStatus.Available.IPv4 || cacheStatus.Available.IPv6
 		}
 
+		var dampening *CacheDampeningStatus
+		if statusOk {
+			dampening = &CacheDampeningStatus{
+				HealthAvailable:       cacheStatus.Dampening.HealthAvailable,
+				ConsecutiveFailures:   cacheStatus.Dampening.ConsecutiveFailures,
+				ConsecutiveSuccesses:  cacheStatus.Dampening.ConsecutiveSuccesses,
+				Penalty:               cacheStatus.Dampening.Penalty,
+				Suppressed:            cacheStatus.Dampening.Suppressed,
+				Pending:               cacheStatus.Dampening.Pending,
+				SuppressedTransitions: cacheStatus.Dampening.SuppressedTransitions,
+			}
+		}
+
 		statii[cacheName] = CacheStatus{
 			Type:                   &cacheTypeStr,
 			LoadAverage:            &loadAverage,
@@ -267,6 +296,7 @@ func createCacheStatuses(
 			IPv6Available:          &cacheStatus.Available.IPv6,
 			CombinedAvailable:      &cacheStatus.ProcessedAvailable,
 			Interfaces:             &interfaceStatuses,
+			Dampening:              dampening,
 		}
 	}
 	return statii
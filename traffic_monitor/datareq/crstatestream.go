@@ -0,0 +1,239 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+)
+
+// ContentTypeEventStream is the Content-Type of a Server-Sent Events stream.
+const ContentTypeEventStream = "text/event-stream"
+
+// CRStatesStreamKeepAlive is how often a comment is sent on an idle CRStates
+// stream, so clients and proxies don't consider the connection dead.
+const CRStatesStreamKeepAlive = 15 * time.Second
+
+// CRStatesStreamWriteTimeout is the time allowed for writing a single event to
+// a CRStates stream subscriber.
+const CRStatesStreamWriteTimeout = 10 * time.Second
+
+// CRStatesStreamRetryMS is the reconnection delay sent to Server-Sent Events
+// clients, in milliseconds.
+const CRStatesStreamRetryMS = 1000
+
+// The Server-Sent Event types sent on a CRStates stream.
+const (
+	CRStatesStreamEventSnapshot = "snapshot"
+	CRStatesStreamEventDelta    = "delta"
+)
+
+// eventStream writes Server-Sent Events to a client.
+type eventStream struct {
+	w     io.Writer
+	flush func() error
+	// deadline, if not nil, sets the deadline for the next write.
+	deadline func(time.Time) error
+	// closed is closed when the client disconnects.
+	closed <-chan struct{}
+	// close releases the underlying connection, if it was taken over from the HTTP server.
+	close func()
+}
+
+// newEventStream starts a Server-Sent Events response.
+//
+// The HTTP server's write timeout applies to the entire response, which would
+// end a long-lived stream after a few seconds. So, where possible, the
+// connection is hijacked, and a deadline is set for each individual event
+// instead. Otherwise (for example, for HTTP/2 requests), the stream is served
+// normally and will end when the server write timeout elapses, at which point
+// clients are expected to reconnect.
+func newEventStream(w http.ResponseWriter, r *http.Request) (*eventStream, error) {
+	w.Header().Set(rfc.ContentType, ContentTypeEventStream)
+	w.Header().Set(rfc.CacheControl, "no-cache")
+
+	if hijacker, ok := w.(http.Hijacker); ok {
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			return nil, errors.New("hijacking connection: " + err.Error())
+		}
+		return newHijackedEventStream(w.Header(), conn, rw)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("response writer does not support streaming")
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &eventStream{
+		w:      w,
+		flush:  func() error { flusher.Flush(); return nil },
+		closed: r.Context().Done(),
+		close:  func() {},
+	}, nil
+}
+
+func newHijackedEventStream(header http.Header, conn net.Conn, rw *bufio.ReadWriter) (*eventStream, error) {
+	// The client isn't expected to send anything more, so reading only serves
+	// to detect when it goes away.
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, rw)
+		close(closed)
+	}()
+
+	header.Set("Connection", "close")
+	if err := conn.SetWriteDeadline(time.Now().Add(CRStatesStreamWriteTimeout)); err != nil {
+		conn.Close()
+		return nil, errors.New("setting write deadline: " + err.Error())
+	}
+	if _, err := rw.WriteString("HTTP/1.1 200 OK\r\n"); err != nil {
+		conn.Close()
+		return nil, errors.New("writing status line: " + err.Error())
+	}
+	if err := header.Write(rw); err != nil {
+		conn.Close()
+		return nil, errors.New("writing headers: " + err.Error())
+	}
+	if _, err := rw.WriteString("\r\n"); err != nil {
+		conn.Close()
+		return nil, errors.New("writing headers: " + err.Error())
+	}
+	return &eventStream{
+		w:        rw,
+		flush:    rw.Flush,
+		deadline: conn.SetWriteDeadline,
+		closed:   closed,
+		close:    func() { conn.Close() },
+	}, nil
+}
+
+// write writes the given raw bytes to the stream, and flushes them to the client.
+func (s *eventStream) write(b []byte) error {
+	if s.deadline != nil {
+		if err := s.deadline(time.Now().Add(CRStatesStreamWriteTimeout)); err != nil {
+			return err
+		}
+	}
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// Event sends a single event, with the given event type and data, which must not
+// contain newlines.
+func (s *eventStream) Event(event string, data []byte) error {
+	msg := make([]byte, 0, len(event)+len(data)+16)
+	msg = append(msg, "event: "+event+"\ndata: "...)
+	msg = append(msg, data...)
+	msg = append(msg, "\n\n"...)
+	return s.write(msg)
+}
+
+// Retry tells the client how long to wait before reconnecting, if the stream ends.
+func (s *eventStream) Retry(ms int) error {
+	return s.write([]byte(fmt.Sprintf("retry: %d\n\n", ms)))
+}
+
+// KeepAlive sends a comment, which clients ignore.
+func (s *eventStream) KeepAlive() error {
+	return s.write([]byte(": keepalive\n\n"))
+}
+
+// srvTRStateStream returns a handler which streams the combined CRStates as
+// Server-Sent Events. A "snapshot" event containing the complete CRStates is
+// sent first, followed by a "delta" event each time the availability of a cache
+// or delivery service changes.
+//
+// If the client falls too far behind, the stream is closed; clients should
+// reconnect, and will receive a new snapshot.
+func srvTRStateStream(broadcaster peer.CRStatesBroadcaster) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot, deltas, unsubscribe := broadcaster.Subscribe()
+		defer unsubscribe()
+
+		snapshotBytes, err := tc.CRStatesMarshall(snapshot)
+		if err != nil {
+			log.Errorf("CRStates stream: marshalling snapshot: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Write(w, []byte(http.StatusText(http.StatusInternalServerError)), r.URL.EscapedPath())
+			return
+		}
+
+		stream, err := newEventStream(w, r)
+		if err != nil {
+			log.Errorf("CRStates stream: starting stream for %s: %v", r.RemoteAddr, err)
+			return
+		}
+		defer stream.close()
+
+		if err := stream.Retry(CRStatesStreamRetryMS); err != nil {
+			log.Infof("CRStates stream: writing to %s: %v", r.RemoteAddr, err)
+			return
+		}
+		if err := stream.Event(CRStatesStreamEventSnapshot, snapshotBytes); err != nil {
+			log.Infof("CRStates stream: writing to %s: %v", r.RemoteAddr, err)
+			return
+		}
+
+		keepAlive := time.NewTicker(CRStatesStreamKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-stream.closed:
+				return
+			case <-keepAlive.C:
+				if err := stream.KeepAlive(); err != nil {
+					log.Infof("CRStates stream: writing to %s: %v", r.RemoteAddr, err)
+					return
+				}
+			case delta, ok := <-deltas:
+				if !ok {
+					log.Infof("CRStates stream: subscriber %s fell behind, closing stream", r.RemoteAddr)
+					return
+				}
+				deltaBytes, err := json.Marshal(delta)
+				if err != nil {
+					log.Errorf("CRStates stream: marshalling delta: %v", err)
+					return
+				}
+				if err := stream.Event(CRStatesStreamEventDelta, deltaBytes); err != nil {
+					log.Infof("CRStates stream: writing to %s: %v", r.RemoteAddr, err)
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+)
+
+func TestSrvTRStateStream(t *testing.T) {
+	broadcaster := peer.NewCRStatesBroadcaster()
+	states := tc.NewCRStates()
+	states.Caches["cache0"] = tc.IsAvailable{IsAvailable: true}
+	broadcaster.Publish(states)
+
+	srv := httptest.NewServer(srvTRStateStream(broadcaster))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected no error getting stream, actual: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != ContentTypeEventStream {
+		t.Errorf("expected Content-Type %s, actual %s", ContentTypeEventStream, contentType)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	// nextData returns the data of the next event of the given type.
+	nextData := func(event string) string {
+		timeout := time.After(5 * time.Second)
+		found := false
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("expected %s event, actual: stream closed", event)
+				}
+				if line == "event: "+event {
+					found = true
+				} else if found && strings.HasPrefix(line, "data: ") {
+					return strings.TrimPrefix(line, "data: ")
+				}
+			case <-timeout:
+				t.Fatalf("expected %s event, actual: timed out", event)
+			}
+		}
+	}
+
+	if data := nextData(CRStatesStreamEventSnapshot); !strings.Contains(data, `"cache0":{"isAvailable":true`) {
+		t.Errorf("expected snapshot with available cache0, actual: %s", data)
+	}
+
+	// Wait for the subscription to be set up, so the change isn't lost.
+	for broadcaster.SubscriberCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	changed := states.Copy()
+	changed.Caches["cache0"] = tc.IsAvailable{}
+	broadcaster.Publish(changed)
+
+	if data := nextData(CRStatesStreamEventDelta); !strings.Contains(data, `"cache0":{"isAvailable":false`) {
+		t.Errorf("expected delta with unavailable cache0, actual: %s", data)
+	}
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-rfc"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsprobe"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
@@ -46,11 +47,13 @@ func MakeDispatchMap(
 	localStates peer.CRStatesThreadsafe,
 	peerStates peer.CRStatesPeersThreadsafe,
 	combinedStates peer.CRStatesThreadsafe,
+	combinedStatesBroadcaster peer.CRStatesBroadcaster,
 	statInfoHistory threadsafe.ResultInfoHistory,
 	statResultHistory threadsafe.ResultStatHistory,
 	statMaxKbpses threadsafe.CacheKbpses,
 	healthHistory threadsafe.ResultHistory,
 	dsStats threadsafe.DSStatsReader,
+	dsProbes dsprobe.ThreadsafeResults,
 	events health.ThreadsafeEvents,
 	staticAppData config.StaticAppData,
 	healthPollInterval time.Duration,
@@ -78,6 +81,7 @@ func MakeDispatchMap(
 			bytes, statusCode, err := srvTRState(params, localStates, combinedStates, peerStates)
 			return WrapErrStatusCode(errorCount, path, bytes, statusCode, err)
 		}, rfc.ApplicationJSON)),
+		"/publish/CrStatesStream": wrap(srvTRStateStream(combinedStatesBroadcaster)),
 		"/publish/CacheStatsNew": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
 			return srvCacheStats(params, errorCount, path, toData, statResultHistory, statInfoHistory, monitorConfig, combinedStates, statMaxKbpses)
 		}, rfc.ApplicationJSON)),
@@ -85,7 +89,7 @@ func MakeDispatchMap(
 			return srvLegacyCacheStats(params, errorCount, path, toData, statResultHistory, statInfoHistory, monitorConfig, combinedStates, statMaxKbpses)
 		}, rfc.ApplicationJSON)),
 		"/publish/DsStats": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
-			return srvDSStats(params, errorCount, path, toData, dsStats)
+			return srvDSStats(params, errorCount, path, toData, dsStats, dsProbes)
 		}, rfc.ApplicationJSON)),
 		"/publish/EventLog": wrap(WrapErr(errorCount, func() ([]byte, error) {
 			return srvEventLog(events)
@@ -93,6 +97,9 @@ func MakeDispatchMap(
 		"/publish/PeerStates": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
 			return srvPeerStates(params, errorCount, path, toData, peerStates)
 		}, rfc.ApplicationJSON)),
+		"/publish/PeerQuorum": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
+			return srvPeerQuorum(params, errorCount, path, peerStates, monitorConfig)
+		}, rfc.ApplicationJSON)),
 		"/publish/Stats": wrap(WrapErr(errorCount, func() ([]byte, error) {
 			return srvStats(staticAppData, healthPollInterval, lastHealthDurations, fetchCount, healthIteration, errorCount, peerStates)
 		}, rfc.ApplicationJSON)),
@@ -132,6 +139,13 @@ func MakeDispatchMap(
 		"/api/crconfig-history": wrap(WrapErr(errorCount, func() ([]byte, error) {
 			return srvAPICRConfigHist(toSession)
 		}, rfc.ApplicationJSON)),
+		"/api/events": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
+			return srvAPIEvents(params, errorCount, path, events, opsConfig, monitorConfig)
+		}, rfc.ApplicationJSON)),
+		"/api/simulate": wrap(srvAPISimulate(errorCount, statInfoHistory, statResultHistory, monitorConfig)),
+		"/metrics": wrap(WrapErr(errorCount, func() ([]byte, error) {
+			return srvMetrics(staticAppData, opsConfig, toData, monitorConfig, combinedStates, statInfoHistory, statResultHistory, dsStats, lastHealthDurations, fetchCount, healthIteration, errorCount)
+		}, ContentTypeOpenMetrics)),
 	}
 	return addTrailingSlashEndpoints(dispatchMap)
 }
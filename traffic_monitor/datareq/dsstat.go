@@ -22,20 +22,55 @@ package datareq
 import (
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"time"
 
+	"github.com/apache/trafficcontrol/traffic_monitor/dsdata"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsprobe"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 
 	"github.com/json-iterator/go"
 )
 
-func srvDSStats(params url.Values, errorCount threadsafe.Uint, path string, toData todata.TODataThreadsafe, dsStats threadsafe.DSStatsReader) ([]byte, int) {
+func srvDSStats(params url.Values, errorCount threadsafe.Uint, path string, toData todata.TODataThreadsafe, dsStats threadsafe.DSStatsReader, dsProbes dsprobe.ThreadsafeResults) ([]byte, int) {
 	filter, err := NewDSStatFilter(path, params, toData.Get().DeliveryServiceTypes)
 	if err != nil {
 		HandleErr(errorCount, path, err)
 		return []byte(err.Error()), http.StatusBadRequest
 	}
+	stats := dsStats.Get().JSON(filter, params)
+	addDSProbeStats(&stats, dsProbes.Get(), filter)
 	json := jsoniter.ConfigFastest
-	bytes, err := json.Marshal(dsStats.Get().JSON(filter, params))
+	bytes, err := json.Marshal(stats)
 	return WrapErrCode(errorCount, path, bytes, err)
 }
+
+// addDSProbeStats adds the latest synthetic probe results of each Delivery
+// Service in the given stats to them, as the stats
+// location.<cachegroup>.probe-cache, probe-status-code, probe-latency-ms, and
+// probe-error. Each stat has one value per probe, ordered by cache server.
+func addDSProbeStats(stats *dsdata.StatsOld, probes dsprobe.Results, filter dsdata.Filter) {
+	for ds, dsStats := range stats.DeliveryService {
+		for cg, results := range probes[ds] {
+			results = append([]dsprobe.Result(nil), results...)
+			sort.Slice(results, func(i, j int) bool { return results[i].Cache < results[j].Cache })
+			prefix := "location." + string(cg) + "."
+			add := func(name string, val func(dsprobe.Result) string) {
+				if !filter.UseStat(name) {
+					return
+				}
+				vals := make([]dsdata.StatOld, 0, len(results))
+				for _, result := range results {
+					vals = append(vals, dsdata.StatOld{Time: result.Time.UnixNano() / int64(time.Millisecond), Value: val(result)})
+				}
+				dsStats[dsdata.StatName(prefix+name)] = vals
+			}
+			add("probe-cache", func(r dsprobe.Result) string { return string(r.Cache) })
+			add("probe-status-code", func(r dsprobe.Result) string { return strconv.Itoa(r.StatusCode) })
+			add("probe-latency-ms", func(r dsprobe.Result) string { return strconv.FormatInt(int64(r.Latency/time.Millisecond), 10) })
+			add("probe-error", func(r dsprobe.Result) string { return r.Error })
+		}
+	}
+}
@@ -0,0 +1,242 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// EventQueryDefaultLimit is the number of events returned by an event query
+// which doesn't specify a limit.
+const EventQueryDefaultLimit = 100
+
+// EventQueryMaxLimit is the maximum number of events returned by a single
+// event query.
+const EventQueryMaxLimit = 1000
+
+// The values of the "transition" event query parameter.
+const (
+	EventTransitionAvailable   = "available"
+	EventTransitionUnavailable = "unavailable"
+)
+
+// EventQueryResponse is the response to an event query.
+type EventQueryResponse struct {
+	// Events is the requested page of matching events, newest first.
+	Events []health.Event `json:"events"`
+	// Total is the number of matching events, across all pages.
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	// FlapCounts is the number of times each matching cache (or other event
+	// source, such as a Delivery Service) changed availability within the
+	// queried time range, regardless of the transition filter or pagination.
+	FlapCounts map[string]uint64 `json:"flapCounts"`
+}
+
+// eventFilter selects events by their source and time. The transition type is
+// filtered separately, because it doesn't apply to flap counts.
+type eventFilter struct {
+	hosts       map[string]struct{}
+	cacheGroups map[string]struct{}
+	// cdnMatch is whether the requested CDN, if any, is the one monitored.
+	cdnMatch bool
+	start    time.Time
+	end      time.Time
+	servers  map[string]tc.TrafficServer
+}
+
+func (f eventFilter) use(e health.Event) bool {
+	if !f.cdnMatch {
+		return false
+	}
+	if len(f.hosts) > 0 {
+		if _, ok := f.hosts[e.Hostname]; !ok {
+			return false
+		}
+	}
+	if len(f.cacheGroups) > 0 {
+		if _, ok := f.cacheGroups[f.servers[e.Hostname].CacheGroup]; !ok {
+			return false
+		}
+	}
+	t := time.Time(e.Time)
+	if !f.start.IsZero() && t.Before(f.start) {
+		return false
+	}
+	if !f.end.IsZero() && t.After(f.end) {
+		return false
+	}
+	return true
+}
+
+// paramSet returns the set of values of the given query parameter, which may
+// be given multiple times, and may contain comma-delimited lists.
+func paramSet(params url.Values, name string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, param := range params[name] {
+		for _, val := range strings.Split(param, ",") {
+			if val = strings.TrimSpace(val); val != "" {
+				set[val] = struct{}{}
+			}
+		}
+	}
+	return set
+}
+
+// parseEventTime parses a time query parameter, which may be either a Unix
+// epoch timestamp in seconds, or an RFC3339 timestamp.
+func parseEventTime(s string) (time.Time, error) {
+	if unixTime, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unixTime, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseNonNegativeIntParam parses the given query parameter, returning def if
+// it's absent.
+func parseNonNegativeIntParam(params url.Values, name string, def int) (int, error) {
+	s := params.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 {
+		return 0, errors.New(name + " must be a non-negative integer")
+	}
+	return i, nil
+}
+
+// queryEvents returns the events matching the given query parameters. The
+// events must be ordered newest first, as they are stored. The cdn is the name
+// of the CDN being monitored, and servers is the monitored servers, for
+// filtering by Cache Group.
+func queryEvents(events []health.Event, params url.Values, cdn string, servers map[string]tc.TrafficServer) (EventQueryResponse, error) {
+	filter := eventFilter{
+		hosts:       paramSet(params, "cache"),
+		cacheGroups: paramSet(params, "cachegroup"),
+		cdnMatch:    true,
+		servers:     servers,
+	}
+	if cdns := paramSet(params, "cdn"); len(cdns) > 0 {
+		_, filter.cdnMatch = cdns[cdn]
+	}
+	var err error
+	if start := params.Get("start"); start != "" {
+		if filter.start, err = parseEventTime(start); err != nil {
+			return EventQueryResponse{}, errors.New("start must be a Unix timestamp or RFC3339 time")
+		}
+	}
+	if end := params.Get("end"); end != "" {
+		if filter.end, err = parseEventTime(end); err != nil {
+			return EventQueryResponse{}, errors.New("end must be a Unix timestamp or RFC3339 time")
+		}
+	}
+
+	var transition *bool
+	switch t := params.Get("transition"); t {
+	case "":
+	case EventTransitionAvailable, EventTransitionUnavailable:
+		available := t == EventTransitionAvailable
+		transition = &available
+	default:
+		return EventQueryResponse{}, errors.New("transition must be '" + EventTransitionAvailable + "' or '" + EventTransitionUnavailable + "'")
+	}
+
+	resp := EventQueryResponse{FlapCounts: map[string]uint64{}}
+	if resp.Limit, err = parseNonNegativeIntParam(params, "limit", EventQueryDefaultLimit); err != nil {
+		return EventQueryResponse{}, err
+	}
+	if resp.Limit == 0 || resp.Limit > EventQueryMaxLimit {
+		resp.Limit = EventQueryMaxLimit
+	}
+	if resp.Offset, err = parseNonNegativeIntParam(params, "offset", 0); err != nil {
+		return EventQueryResponse{}, err
+	}
+
+	// Flaps are counted oldest first, as changes from each source's previous
+	// event. The previous event may be outside the queried time range, but a
+	// source's first known event is never counted, because what it changed
+	// from is unknown.
+	lastAvailable := map[string]bool{}
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		last, seen := lastAvailable[e.Hostname]
+		lastAvailable[e.Hostname] = e.Available
+		if !filter.use(e) {
+			continue
+		}
+		if _, ok := resp.FlapCounts[e.Hostname]; !ok {
+			resp.FlapCounts[e.Hostname] = 0
+		}
+		if seen && last != e.Available {
+			resp.FlapCounts[e.Hostname]++
+		}
+	}
+
+	matched := []health.Event{}
+	for _, e := range events {
+		if !filter.use(e) {
+			continue
+		}
+		if transition != nil && e.Available != *transition {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	resp.Total = len(matched)
+	if resp.Offset < len(matched) {
+		matched = matched[resp.Offset:]
+		if len(matched) > resp.Limit {
+			matched = matched[:resp.Limit]
+		}
+		resp.Events = matched
+	} else {
+		resp.Events = []health.Event{}
+	}
+	return resp, nil
+}
+
+func srvAPIEvents(
+	params url.Values,
+	errorCount threadsafe.Uint,
+	path string,
+	events health.ThreadsafeEvents,
+	opsConfig threadsafe.OpsConfig,
+	monitorConfig threadsafe.TrafficMonitorConfigMap,
+) ([]byte, int) {
+	resp, err := queryEvents(events.Get(), params, opsConfig.Get().CdnName, monitorConfig.Get().TrafficServer)
+	if err != nil {
+		HandleErr(errorCount, path, err)
+		return []byte(err.Error()), http.StatusBadRequest
+	}
+	bytes, err := json.Marshal(resp)
+	return WrapErrCode(errorCount, path, bytes, err)
+}
@@ -0,0 +1,99 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+)
+
+func TestQueryEvents(t *testing.T) {
+	base := time.Unix(1600000000, 0)
+	event := func(index uint64, minutes int, host string, available bool) health.Event {
+		return health.Event{Index: index, Time: health.Time(base.Add(time.Duration(minutes) * time.Minute)), Hostname: host, Name: host, Available: available}
+	}
+	// newest first, as stored
+	events := []health.Event{
+		event(6, 6, "edge0", true),
+		event(5, 5, "mid0", false),
+		event(4, 4, "edge0", false),
+		event(3, 3, "edge0", true),
+		event(2, 2, "edge1", false),
+		event(1, 1, "edge0", false),
+		event(0, 0, "edge0", true),
+	}
+	servers := map[string]tc.TrafficServer{
+		"edge0": {HostName: "edge0", CacheGroup: "edge-cg"},
+		"edge1": {HostName: "edge1", CacheGroup: "edge-cg"},
+		"mid0":  {HostName: "mid0", CacheGroup: "mid-cg"},
+	}
+
+	query := func(q string) EventQueryResponse {
+		params, err := url.ParseQuery(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := queryEvents(events, params, "cdn0", servers)
+		if err != nil {
+			t.Fatalf("expected no error for query '%s', actual: %v", q, err)
+		}
+		return resp
+	}
+
+	resp := query("")
+	if resp.Total != len(events) || len(resp.Events) != len(events) {
+		t.Errorf("expected all %d events with no filter, actual total %d events %d", len(events), resp.Total, len(resp.Events))
+	}
+	if resp.FlapCounts["edge0"] != 4 || resp.FlapCounts["edge1"] != 0 {
+		t.Errorf("expected flap counts edge0 4 and edge1 0, actual %+v", resp.FlapCounts)
+	}
+
+	resp = query("cachegroup=edge-cg&transition=unavailable")
+	if resp.Total != 3 {
+		t.Errorf("expected 3 unavailable edge-cg events, actual %d: %+v", resp.Total, resp.Events)
+	}
+	if _, ok := resp.FlapCounts["mid0"]; ok {
+		t.Errorf("expected no flap count for mid0 outside the cache group, actual %+v", resp.FlapCounts)
+	}
+
+	resp = query("cache=edge0&start=" + base.Add(3*time.Minute).Format(time.RFC3339) + "&end=1600000300&limit=1&offset=1")
+	if resp.Total != 2 || len(resp.Events) != 1 || resp.Events[0].Index != 3 {
+		t.Errorf("expected the second of 2 edge0 events in range, actual total %d events %+v", resp.Total, resp.Events)
+	}
+	// the change at minute 3 counts, because the previous event is known even though it's out of range.
+	if resp.FlapCounts["edge0"] != 2 {
+		t.Errorf("expected 2 edge0 flaps in range, actual %+v", resp.FlapCounts)
+	}
+
+	if resp := query("cdn=other"); resp.Total != 0 || len(resp.Events) != 0 {
+		t.Errorf("expected no events for another CDN, actual %+v", resp)
+	}
+
+	for _, q := range []string{"transition=flapping", "limit=-1", "start=yesterday"} {
+		params, _ := url.ParseQuery(q)
+		if _, err := queryEvents(events, params, "cdn0", servers); err == nil {
+			t.Errorf("expected error for query '%s', actual nil", q)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsdata"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// ContentTypeOpenMetrics is the Content-Type of the OpenMetrics text
+// exposition format, as served by the /metrics endpoint.
+const ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// MetricsPrefix is prepended to the name of every metric family served by the
+// /metrics endpoint.
+const MetricsPrefix = "traffic_monitor_"
+
+const (
+	metricTypeGauge   = "gauge"
+	metricTypeCounter = "counter"
+)
+
+// metricLabel is a single name/value label pair of a metric sample.
+type metricLabel struct {
+	Name  string
+	Value string
+}
+
+// metricsWriter builds an OpenMetrics text exposition. All samples of a metric
+// family must be written immediately after that family's header, as required
+// by the format.
+type metricsWriter struct {
+	buf bytes.Buffer
+	// counter is whether the family currently being written is a counter,
+	// whose sample names carry the "_total" suffix.
+	counter bool
+	name    string
+}
+
+// family writes the TYPE and HELP metadata of a new metric family. The name
+// must not include the MetricsPrefix or, for counters, the "_total" suffix.
+func (w *metricsWriter) family(name string, metricType string, help string) {
+	w.name = MetricsPrefix + name
+	w.counter = metricType == metricTypeCounter
+	w.buf.WriteString("# TYPE " + w.name + " " + metricType + "\n")
+	w.buf.WriteString("# HELP " + w.name + " " + escapeMetricHelp(help) + "\n")
+}
+
+// sample writes a single sample of the family most recently started with
+// family.
+func (w *metricsWriter) sample(labels []metricLabel, val float64) {
+	w.buf.WriteString(w.name)
+	if w.counter {
+		w.buf.WriteString("_total")
+	}
+	if len(labels) > 0 {
+		w.buf.WriteString("{")
+		for i, label := range labels {
+			if i > 0 {
+				w.buf.WriteString(",")
+			}
+			w.buf.WriteString(label.Name + `="` + escapeMetricLabelValue(label.Value) + `"`)
+		}
+		w.buf.WriteString("}")
+	}
+	w.buf.WriteString(" " + formatMetricValue(val) + "\n")
+}
+
+// Bytes terminates the exposition and returns it.
+func (w *metricsWriter) Bytes() []byte {
+	w.buf.WriteString("# EOF\n")
+	return w.buf.Bytes()
+}
+
+var metricLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeMetricLabelValue(s string) string {
+	return metricLabelValueReplacer.Replace(s)
+}
+
+var metricHelpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeMetricHelp(s string) string {
+	return metricHelpReplacer.Replace(s)
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolMetricValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// statMetricValue returns the numeric value of a polled stat, and whether it
+// has one. Stats which are not numbers, booleans, or numeric strings can't be
+// represented as a metric, and are skipped.
+func statMetricValue(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		return boolMetricValue(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func srvMetrics(
+	staticAppData config.StaticAppData,
+	opsConfig threadsafe.OpsConfig,
+	toData todata.TODataThreadsafe,
+	monitorConfig threadsafe.TrafficMonitorConfigMap,
+	combinedStates peer.CRStatesThreadsafe,
+	statInfoHistory threadsafe.ResultInfoHistory,
+	statResultHistory threadsafe.ResultStatHistory,
+	dsStats threadsafe.DSStatsReader,
+	lastHealthDurations threadsafe.DurationMap,
+	fetchCount threadsafe.Uint,
+	healthIteration threadsafe.Uint,
+	errorCount threadsafe.Uint,
+) ([]byte, error) {
+	return createMetrics(
+		staticAppData,
+		opsConfig.Get().CdnName,
+		toData.Get(),
+		monitorConfig.Get().TrafficServer,
+		combinedStates.Get(),
+		statInfoHistory.Get(),
+		statResultHistory,
+		dsStats.Get(),
+		lastHealthDurations.Get(),
+		fetchCount.Get(),
+		healthIteration.Get(),
+		errorCount.Get(),
+	), nil
+}
+
+// createMetrics renders the cache, interface, delivery service, and Traffic
+// Monitor stats in the OpenMetrics text exposition format. Samples are sorted
+// by their labels, so the output for identical data is identical.
+func createMetrics(
+	staticAppData config.StaticAppData,
+	cdn string,
+	toData todata.TOData,
+	servers map[string]tc.TrafficServer,
+	crStates tc.CRStates,
+	statInfoHistory cache.ResultInfoHistory,
+	statResultHistory threadsafe.ResultStatHistory,
+	dsStats dsdata.StatsReadonly,
+	lastHealthDurations map[tc.CacheName]time.Duration,
+	fetchCount uint64,
+	healthIteration uint64,
+	errorCount uint64,
+) []byte {
+	w := &metricsWriter{}
+
+	cacheNames := make([]string, 0, len(servers))
+	for name := range servers {
+		cacheNames = append(cacheNames, name)
+	}
+	sort.Strings(cacheNames)
+
+	cacheLabels := func(name string, extra ...metricLabel) []metricLabel {
+		labels := []metricLabel{
+			{Name: "cdn", Value: cdn},
+			{Name: "cachegroup", Value: servers[name].CacheGroup},
+			{Name: "cache", Value: name},
+		}
+		return append(labels, extra...)
+	}
+
+	// latestInfo returns the most recent non-stat poll result for the given cache.
+	latestInfo := func(name string) (cache.ResultInfo, bool) {
+		infos := statInfoHistory[tc.CacheName(name)]
+		if len(infos) == 0 {
+			return cache.ResultInfo{}, false
+		}
+		return infos[0], true
+	}
+
+	w.family("cache_available", metricTypeGauge, "Whether the cache server is available, as reported to Traffic Router.")
+	for _, name := range cacheNames {
+		if state, ok := crStates.Caches[tc.CacheName(name)]; ok {
+			w.sample(cacheLabels(name), boolMetricValue(state.IsAvailable))
+		}
+	}
+
+	w.family("cache_ipv4_available", metricTypeGauge, "Whether the cache server is available over IPv4.")
+	for _, name := range cacheNames {
+		if state, ok := crStates.Caches[tc.CacheName(name)]; ok {
+			w.sample(cacheLabels(name), boolMetricValue(state.Ipv4Available))
+		}
+	}
+
+	w.family("cache_ipv6_available", metricTypeGauge, "Whether the cache server is available over IPv6.")
+	for _, name := range cacheNames {
+		if state, ok := crStates.Caches[tc.CacheName(name)]; ok {
+			w.sample(cacheLabels(name), boolMetricValue(state.Ipv6Available))
+		}
+	}
+
+	w.family("cache_load_average", metricTypeGauge, "The one-minute load average of the cache server.")
+	for _, name := range cacheNames {
+		if info, ok := latestInfo(name); ok {
+			w.sample(cacheLabels(name), info.Vitals.LoadAvg)
+		}
+	}
+
+	w.family("cache_kbps_out", metricTypeGauge, "The outgoing bandwidth of the cache server, in kilobits per second.")
+	for _, name := range cacheNames {
+		if info, ok := latestInfo(name); ok {
+			w.sample(cacheLabels(name), float64(info.Vitals.KbpsOut))
+		}
+	}
+
+	w.family("cache_max_kbps_out", metricTypeGauge, "The maximum outgoing bandwidth of the cache server, in kilobits per second.")
+	for _, name := range cacheNames {
+		if info, ok := latestInfo(name); ok {
+			w.sample(cacheLabels(name), float64(info.Vitals.MaxKbpsOut))
+		}
+	}
+
+	w.family("cache_stat_request_seconds", metricTypeGauge, "The duration of the most recent stat poll request to the cache server.")
+	for _, name := range cacheNames {
+		if info, ok := latestInfo(name); ok {
+			w.sample(cacheLabels(name), info.RequestTime.Seconds())
+		}
+	}
+
+	w.family("cache_health_seconds", metricTypeGauge, "The end-to-end duration of the most recent health poll of the cache server.")
+	for _, name := range cacheNames {
+		if dur, ok := lastHealthDurations[tc.CacheName(name)]; ok {
+			w.sample(cacheLabels(name), dur.Seconds())
+		}
+	}
+
+	w.family("cache_stat", metricTypeGauge, "The most recently polled value of a numeric stat of the cache server.")
+	for _, name := range cacheNames {
+		v, ok := statResultHistory.Load(name)
+		if !ok {
+			continue
+		}
+		history, ok := v.(threadsafe.CacheStatHistory)
+		if !ok {
+			continue
+		}
+		stats := map[string]float64{}
+		history.Stats.Range(func(stat string, vals []tc.ResultStatVal) bool {
+			if len(vals) == 0 {
+				return true
+			}
+			if val, ok := statMetricValue(vals[0].Val); ok {
+				stats[stat] = val
+			}
+			return true
+		})
+		statNames := make([]string, 0, len(stats))
+		for stat := range stats {
+			statNames = append(statNames, stat)
+		}
+		sort.Strings(statNames)
+		for _, stat := range statNames {
+			w.sample(cacheLabels(name, metricLabel{Name: "stat", Value: stat}), stats[stat])
+		}
+	}
+
+	// interfaceNames returns the sorted names of the interfaces in the given
+	// cache's most recent poll result.
+	interfaceNames := func(info cache.ResultInfo) []string {
+		names := make([]string, 0, len(info.Statistics.Interfaces))
+		for inf := range info.Statistics.Interfaces {
+			names = append(names, inf)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	w.family("cache_interface_kbps_out", metricTypeGauge, "The outgoing bandwidth of the cache server network interface, in kilobits per second.")
+	for _, name := range cacheNames {
+		info, ok := latestInfo(name)
+		if !ok {
+			continue
+		}
+		for _, inf := range interfaceNames(info) {
+			if vitals, ok := info.InterfaceVitals[inf]; ok {
+				w.sample(cacheLabels(name, metricLabel{Name: "interface", Value: inf}), float64(vitals.KbpsOut))
+			}
+		}
+	}
+
+	w.family("cache_interface_speed", metricTypeGauge, "The speed of the cache server network interface, as reported by the cache server.")
+	for _, name := range cacheNames {
+		info, ok := latestInfo(name)
+		if !ok {
+			continue
+		}
+		for _, inf := range interfaceNames(info) {
+			w.sample(cacheLabels(name, metricLabel{Name: "interface", Value: inf}), float64(info.Statistics.Interfaces[inf].Speed))
+		}
+	}
+
+	w.family("cache_interface_in_bytes", metricTypeCounter, "The number of bytes received by the cache server network interface.")
+	for _, name := range cacheNames {
+		info, ok := latestInfo(name)
+		if !ok {
+			continue
+		}
+		for _, inf := range interfaceNames(info) {
+			w.sample(cacheLabels(name, metricLabel{Name: "interface", Value: inf}), float64(info.Statistics.Interfaces[inf].BytesIn))
+		}
+	}
+
+	w.family("cache_interface_out_bytes", metricTypeCounter, "The number of bytes transmitted by the cache server network interface.")
+	for _, name := range cacheNames {
+		info, ok := latestInfo(name)
+		if !ok {
+			continue
+		}
+		for _, inf := range interfaceNames(info) {
+			w.sample(cacheLabels(name, metricLabel{Name: "interface", Value: inf}), float64(info.Statistics.Interfaces[inf].BytesOut))
+		}
+	}
+
+	dsNames := make([]string, 0, len(toData.DeliveryServiceTypes))
+	for ds := range toData.DeliveryServiceTypes {
+		dsNames = append(dsNames, string(ds))
+	}
+	sort.Strings(dsNames)
+
+	dsLabels := func(ds string, extra ...metricLabel) []metricLabel {
+		labels := []metricLabel{
+			{Name: "cdn", Value: cdn},
+			{Name: "ds", Value: ds},
+		}
+		return append(labels, extra...)
+	}
+
+	w.family("ds_available", metricTypeGauge, "Whether the delivery service is available, as reported to Traffic Router.")
+	for _, ds := range dsNames {
+		if state, ok := crStates.DeliveryService[tc.DeliveryServiceName(ds)]; ok {
+			w.sample(dsLabels(ds), boolMetricValue(state.IsAvailable))
+		}
+	}
+
+	w.family("ds_disabled_locations", metricTypeGauge, "The number of cache groups disabled for the delivery service.")
+	for _, ds := range dsNames {
+		if state, ok := crStates.DeliveryService[tc.DeliveryServiceName(ds)]; ok {
+			w.sample(dsLabels(ds), float64(len(state.DisabledLocations)))
+		}
+	}
+
+	// dsStat returns the computed stats of the given delivery service.
+	dsStat := func(ds string) (dsdata.StatReadonly, bool) {
+		return dsStats.Get(tc.DeliveryServiceName(ds))
+	}
+
+	w.family("ds_caches_configured", metricTypeGauge, "The number of cache servers assigned to the delivery service.")
+	for _, ds := range dsNames {
+		if stat, ok := dsStat(ds); ok {
+			w.sample(dsLabels(ds), float64(stat.Common().CachesConfigured().Value))
+		}
+	}
+
+	w.family("ds_caches_available", metricTypeGauge, "The number of available cache servers assigned to the delivery service.")
+	for _, ds := range dsNames {
+		if stat, ok := dsStat(ds); ok {
+			w.sample(dsLabels(ds), float64(stat.Common().CachesAvailable().Value))
+		}
+	}
+
+	w.family("ds_kbps", metricTypeGauge, "The bandwidth served for the delivery service, in kilobits per second.")
+	for _, ds := range dsNames {
+		if stat, ok := dsStat(ds); ok {
+			w.sample(dsLabels(ds), stat.Total().Kbps.Value)
+		}
+	}
+
+	w.family("ds_tps", metricTypeGauge, "The transactions per second served for the delivery service, by response status class.")
+	for _, ds := range dsNames {
+		stat, ok := dsStat(ds)
+		if !ok {
+			continue
+		}
+		total := stat.Total()
+		w.sample(dsLabels(ds, metricLabel{Name: "class", Value: "2xx"}), total.Tps2xx.Value)
+		w.sample(dsLabels(ds, metricLabel{Name: "class", Value: "3xx"}), total.Tps3xx.Value)
+		w.sample(dsLabels(ds, metricLabel{Name: "class", Value: "4xx"}), total.Tps4xx.Value)
+		w.sample(dsLabels(ds, metricLabel{Name: "class", Value: "5xx"}), total.Tps5xx.Value)
+		w.sample(dsLabels(ds, metricLabel{Name: "class", Value: "all"}), total.TpsTotal.Value)
+	}
+
+	w.family("ds_responses", metricTypeCounter, "The number of responses served for the delivery service, by response status class.")
+	for _, ds := range dsNames {
+		stat, ok := dsStat(ds)
+		if !ok {
+			continue
+		}
+		total := stat.Total()
+		w.sample(dsLabels(ds, metricLabel{Name: "class", Value: "2xx"}), float64(total.Status2xx.Value))
+		w.sample(dsLabels(ds, metricLabel{Name: "class", Value: "3xx"}), float64(total.Status3xx.Value))
+		w.sample(dsLabels(ds, metricLabel{Name: "class", Value: "4xx"}), float64(total.Status4xx.Value))
+		w.sample(dsLabels(ds, metricLabel{Name: "class", Value: "5xx"}), float64(total.Status5xx.Value))
+	}
+
+	w.family("ds_out_bytes", metricTypeCounter, "The number of bytes served for the delivery service.")
+	for _, ds := range dsNames {
+		if stat, ok := dsStat(ds); ok {
+			w.sample(dsLabels(ds), float64(stat.Total().OutBytes.Value))
+		}
+	}
+
+	monitorLabels := []metricLabel{
+		{Name: "cdn", Value: cdn},
+	}
+
+	w.family("info", metricTypeGauge, "Information about this Traffic Monitor. The value is always 1.")
+	w.sample([]metricLabel{
+		{Name: "cdn", Value: cdn},
+		{Name: "name", Value: staticAppData.Name},
+		{Name: "version", Value: staticAppData.Version},
+		{Name: "git_revision", Value: staticAppData.GitRevision},
+	}, 1)
+
+	w.family("uptime_seconds", metricTypeGauge, "The time since this Traffic Monitor was started.")
+	w.sample(monitorLabels, time.Since(staticAppData.StartTime).Seconds())
+
+	w.family("fetches", metricTypeCounter, "The number of health polls made by this Traffic Monitor.")
+	w.sample(monitorLabels, float64(fetchCount))
+
+	w.family("health_iterations", metricTypeCounter, "The number of health poll results processed by this Traffic Monitor.")
+	w.sample(monitorLabels, float64(healthIteration))
+
+	w.family("errors", metricTypeCounter, "The number of errors encountered by this Traffic Monitor.")
+	w.sample(monitorLabels, float64(errorCount))
+
+	return w.Bytes()
+}
@@ -0,0 +1,108 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsdata"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+func TestCreateMetrics(t *testing.T) {
+	servers := map[string]tc.TrafficServer{
+		"edge0": {CacheGroup: "cg0", HostName: "edge0"},
+		"edge1": {CacheGroup: "cg\"1", HostName: "edge1"},
+	}
+	crStates := tc.NewCRStates()
+	crStates.Caches["edge0"] = tc.IsAvailable{IsAvailable: true, Ipv4Available: true}
+	crStates.Caches["edge1"] = tc.IsAvailable{}
+	crStates.DeliveryService["ds0"] = tc.CRStatesDeliveryService{IsAvailable: true}
+
+	infoHistory := cache.ResultInfoHistory{
+		"edge0": {{
+			RequestTime: 250 * time.Millisecond,
+			Vitals:      cache.Vitals{LoadAvg: 1.5, KbpsOut: 42},
+			Statistics: cache.Statistics{
+				Interfaces: map[string]cache.Interface{
+					"eth0": {Speed: 10000, BytesIn: 100, BytesOut: 200},
+				},
+			},
+			InterfaceVitals: map[string]cache.Vitals{"eth0": {KbpsOut: 42}},
+		}},
+	}
+
+	statHistory := threadsafe.NewResultStatHistory()
+	edge0Stats := statHistory.LoadOrStore("edge0")
+	edge0Stats.Stats.Store("proxy.process.http.current_client_connections", []tc.ResultStatVal{{Val: float64(7)}})
+	edge0Stats.Stats.Store("ats.version", []tc.ResultStatVal{{Val: "9.0.0-beta"}})
+
+	toData := *todata.New()
+	toData.DeliveryServiceTypes["ds0"] = tc.DSTypeCategoryHTTP
+
+	dsStats := dsdata.NewStats(1)
+	dsStat := dsdata.NewStat()
+	dsStat.CommonStats.CachesConfiguredNum.Value = 2
+	dsStat.TotalStats.Kbps.Value = 12.5
+	dsStat.TotalStats.Status2xx.Value = 99
+	dsStats.DeliveryService["ds0"] = dsStat
+
+	metrics := string(createMetrics(getMockStaticAppData(), "cdn0", toData, servers, crStates, infoHistory, statHistory, *dsStats, map[tc.CacheName]time.Duration{}, 3, 2, 1))
+
+	if !strings.HasSuffix(metrics, "# EOF\n") {
+		t.Errorf("expected metrics to end with EOF marker, actual: %q", metrics)
+	}
+
+	expected := []string{
+		"# TYPE traffic_monitor_cache_available gauge\n",
+		`traffic_monitor_cache_available{cdn="cdn0",cachegroup="cg0",cache="edge0"} 1` + "\n",
+		`traffic_monitor_cache_available{cdn="cdn0",cachegroup="cg\"1",cache="edge1"} 0` + "\n",
+		`traffic_monitor_cache_load_average{cdn="cdn0",cachegroup="cg0",cache="edge0"} 1.5` + "\n",
+		`traffic_monitor_cache_stat_request_seconds{cdn="cdn0",cachegroup="cg0",cache="edge0"} 0.25` + "\n",
+		`traffic_monitor_cache_stat{cdn="cdn0",cachegroup="cg0",cache="edge0",stat="proxy.process.http.current_client_connections"} 7` + "\n",
+		`traffic_monitor_cache_interface_kbps_out{cdn="cdn0",cachegroup="cg0",cache="edge0",interface="eth0"} 42` + "\n",
+		"# TYPE traffic_monitor_cache_interface_out_bytes counter\n",
+		`traffic_monitor_cache_interface_out_bytes_total{cdn="cdn0",cachegroup="cg0",cache="edge0",interface="eth0"} 200` + "\n",
+		`traffic_monitor_ds_available{cdn="cdn0",ds="ds0"} 1` + "\n",
+		`traffic_monitor_ds_caches_configured{cdn="cdn0",ds="ds0"} 2` + "\n",
+		`traffic_monitor_ds_kbps{cdn="cdn0",ds="ds0"} 12.5` + "\n",
+		`traffic_monitor_ds_responses_total{cdn="cdn0",ds="ds0",class="2xx"} 99` + "\n",
+		`traffic_monitor_fetches_total{cdn="cdn0"} 3` + "\n",
+		`traffic_monitor_health_iterations_total{cdn="cdn0"} 2` + "\n",
+		`traffic_monitor_errors_total{cdn="cdn0"} 1` + "\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("expected metrics to contain %q, actual: %s", line, metrics)
+		}
+	}
+
+	if strings.Contains(metrics, "ats.version") {
+		t.Errorf("expected non-numeric stat to be omitted, actual: %s", metrics)
+	}
+	if strings.Contains(metrics, `cache_load_average{cdn="cdn0",cachegroup="cg\"1"`) {
+		t.Errorf("expected unpolled cache to have no vitals, actual: %s", metrics)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// The votes a peer can cast in the peer quorum.
+const (
+	PeerVoteReachable   = "reachable"
+	PeerVoteUnreachable = "unreachable"
+	PeerVoteNone        = "none"
+)
+
+// PeerQuorumResponse is the response to a request for the peer quorum.
+type PeerQuorumResponse struct {
+	// Minority is whether this Traffic Monitor is in a minority partition.
+	Minority bool `json:"minority"`
+	// Holding is whether the combined states are being held, rather than
+	// combined, because this Traffic Monitor is in a minority partition.
+	Holding         bool                                     `json:"holding"`
+	SelfWeight      float64                                  `json:"selfWeight"`
+	ReachableWeight float64                                  `json:"reachableWeight"`
+	TotalWeight     float64                                  `json:"totalWeight"`
+	Peers           map[tc.TrafficMonitorName]PeerQuorumVote `json:"peers"`
+}
+
+// PeerQuorumVote is a single peer's vote in the peer quorum.
+type PeerQuorumVote struct {
+	// Location is the Cache Group of the peer.
+	Location string  `json:"location"`
+	Weight   float64 `json:"weight"`
+	// Vote is one of PeerVoteReachable, PeerVoteUnreachable, or
+	// PeerVoteNone, if the peer isn't ONLINE.
+	Vote string `json:"vote"`
+	// CacheAvailable is whether the peer reports the requested cache server
+	// available. It's omitted if no cache server was requested, or the peer
+	// hasn't reported it.
+	CacheAvailable *bool `json:"cacheAvailable,omitempty"`
+}
+
+func srvPeerQuorum(params url.Values, errorCount threadsafe.Uint, path string, peerStates peer.CRStatesPeersThreadsafe, monitorConfig threadsafe.TrafficMonitorConfigMap) ([]byte, int) {
+	cacheName := tc.CacheName(params.Get("cache"))
+	var crStates map[tc.TrafficMonitorName]tc.CRStates
+	if cacheName != "" {
+		crStates = peerStates.GetCrstates()
+	}
+	resp := createPeerQuorum(peerStates.GetQuorum(), monitorConfig.Get().TrafficMonitor, cacheName, crStates)
+	bytes, err := json.Marshal(resp)
+	return WrapErrCode(errorCount, path, bytes, err)
+}
+
+// createPeerQuorum builds the response to a peer quorum request. If cacheName
+// isn't empty, each peer's vote includes its state for that cache server,
+// from crStates.
+func createPeerQuorum(quorum peer.Quorum, monitors map[string]tc.TrafficMonitor, cacheName tc.CacheName, crStates map[tc.TrafficMonitorName]tc.CRStates) PeerQuorumResponse {
+	resp := PeerQuorumResponse{
+		Minority:        quorum.Minority(),
+		Holding:         quorum.Holding,
+		SelfWeight:      quorum.SelfWeight,
+		ReachableWeight: quorum.ReachableWeight,
+		TotalWeight:     quorum.TotalWeight,
+		Peers:           make(map[tc.TrafficMonitorName]PeerQuorumVote, len(quorum.Peers)),
+	}
+	for name, peerVote := range quorum.Peers {
+		vote := PeerQuorumVote{
+			Location: monitors[string(name)].Location,
+			Weight:   peerVote.Weight,
+			Vote:     PeerVoteNone,
+		}
+		if peerVote.Online && peerVote.Available {
+			vote.Vote = PeerVoteReachable
+		} else if peerVote.Online {
+			vote.Vote = PeerVoteUnreachable
+		}
+		if cacheName != "" {
+			if cacheState, ok := crStates[name].Caches[cacheName]; ok {
+				available := cacheState.IsAvailable
+				vote.CacheAvailable = &available
+			}
+		}
+		resp.Peers[name] = vote
+	}
+	return resp
+}
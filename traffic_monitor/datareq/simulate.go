@@ -0,0 +1,169 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datareq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// SimulateMaxBodyBytes is the maximum size of a request to simulate a
+// candidate monitoring configuration.
+const SimulateMaxBodyBytes = 32 << 20
+
+// SimulateRequest is a request to simulate the effect of a candidate
+// monitoring configuration on the availability of cache servers.
+type SimulateRequest struct {
+	// Config is the candidate monitoring configuration. Only its TrafficServer
+	// and Profile are used, and Profile Parameters are in the same form as in
+	// Traffic Ops. If it's nil, the current monitoring configuration is used,
+	// with Thresholds applied.
+	Config *tc.TrafficMonitorConfigMap `json:"config"`
+	// Thresholds maps Profile names to health threshold Parameters to set on
+	// that Profile, in the same form as the Parameters in Traffic Ops, e.g.
+	// {"EDGE": {"health.threshold.loadavg": "25.0"}}. A Parameter with an
+	// empty value removes that threshold.
+	Thresholds map[string]map[string]string `json:"thresholds"`
+}
+
+// srvAPISimulate returns the handler which evaluates a candidate monitoring
+// configuration, POSTed as a SimulateRequest, against the stat history, and
+// responds with the health.Simulation. It never modifies live state.
+func srvAPISimulate(errorCount threadsafe.Uint, statInfoHistory threadsafe.ResultInfoHistory, statResultHistory threadsafe.ResultStatHistory, monitorConfig threadsafe.TrafficMonitorConfigMap) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.EscapedPath()
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			log.Write(w, []byte(http.StatusText(http.StatusMethodNotAllowed)), path)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, SimulateMaxBodyBytes))
+		if err != nil {
+			HandleErr(errorCount, path, err)
+			w.WriteHeader(http.StatusBadRequest)
+			log.Write(w, []byte("reading request body: "+err.Error()), path)
+			return
+		}
+
+		sim, err := simulate(body, statInfoHistory.Get(), statResultHistory, monitorConfig.Get())
+		if err != nil {
+			HandleErr(errorCount, path, err)
+			w.WriteHeader(http.StatusBadRequest)
+			log.Write(w, []byte(err.Error()), path)
+			return
+		}
+
+		bytes, err := json.Marshal(sim)
+		code := http.StatusOK
+		if err == nil {
+			bytes, err = gzipIfAccepts(r, w, bytes)
+		}
+		bytes, code = WrapErrCode(errorCount, path, bytes, err)
+		w.Header().Set("Content-Type", rfc.ApplicationJSON)
+		w.WriteHeader(code)
+		log.Write(w, bytes, path)
+	}
+}
+
+// simulate parses the given SimulateRequest body, builds the candidate
+// monitoring configuration from it and the current one, and evaluates it. The
+// returned error is safe to return to the client.
+func simulate(body []byte, infoHistory cache.ResultInfoHistory, statHistory threadsafe.ResultStatHistory, current tc.TrafficMonitorConfigMap) (health.Simulation, error) {
+	req := SimulateRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return health.Simulation{}, errors.New("malformed request: " + err.Error())
+	}
+	if req.Config == nil && len(req.Thresholds) == 0 {
+		return health.Simulation{}, errors.New("request must have a config or thresholds")
+	}
+
+	candidate := current
+	if req.Config != nil {
+		candidate = *req.Config
+		if len(candidate.TrafficServer) == 0 {
+			return health.Simulation{}, errors.New("invalid config: TrafficServer empty")
+		}
+		if len(candidate.Profile) == 0 {
+			return health.Simulation{}, errors.New("invalid config: Profile empty")
+		}
+	}
+
+	candidate, err := applySimulatedThresholds(candidate, req.Thresholds)
+	if err != nil {
+		return health.Simulation{}, err
+	}
+	return health.SimulateAvailability(infoHistory, statHistory, current, candidate), nil
+}
+
+// applySimulatedThresholds returns a copy of the given monitoring
+// configuration with the given threshold Parameters set on its Profiles. The
+// given configuration isn't modified.
+func applySimulatedThresholds(mc tc.TrafficMonitorConfigMap, thresholds map[string]map[string]string) (tc.TrafficMonitorConfigMap, error) {
+	if len(thresholds) == 0 {
+		return mc, nil
+	}
+	profiles := make(map[string]tc.TMProfile, len(mc.Profile))
+	for name, profile := range mc.Profile {
+		profiles[name] = profile
+	}
+
+	for profileName, params := range thresholds {
+		profile, ok := profiles[profileName]
+		if !ok {
+			return mc, fmt.Errorf("profile '%s' not found in config", profileName)
+		}
+		profileThresholds := make(map[string]tc.HealthThreshold, len(profile.Parameters.Thresholds)+len(params))
+		for stat, threshold := range profile.Parameters.Thresholds {
+			profileThresholds[stat] = threshold
+		}
+		for param, val := range params {
+			if !strings.HasPrefix(param, tc.ThresholdPrefix) {
+				return mc, fmt.Errorf("profile '%s' parameter '%s' is not a health threshold, which must start with '%s'", profileName, param, tc.ThresholdPrefix)
+			}
+			stat := strings.TrimPrefix(param, tc.ThresholdPrefix)
+			if val == "" {
+				delete(profileThresholds, stat)
+				continue
+			}
+			threshold, err := tc.StrToThreshold(val)
+			if err != nil {
+				return mc, fmt.Errorf("profile '%s' parameter '%s' value '%s' is not a threshold: %v", profileName, param, val, err)
+			}
+			profileThresholds[stat] = threshold
+		}
+		profile.Parameters.Thresholds = profileThresholds
+		profiles[profileName] = profile
+	}
+	mc.Profile = profiles
+	return mc, nil
+}
@@ -0,0 +1,130 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+func simulateTestConfig() tc.TrafficMonitorConfigMap {
+	threshold, _ := tc.StrToThreshold("<50")
+	server := func(name string) tc.TrafficServer {
+		return tc.TrafficServer{
+			HostName:     name,
+			Profile:      "EDGE",
+			ServerStatus: string(tc.CacheStatusReported),
+			Interfaces:   []tc.ServerInterfaceInfo{{Name: "eth0", Monitor: true}},
+		}
+	}
+	return tc.TrafficMonitorConfigMap{
+		TrafficServer: map[string]tc.TrafficServer{"edge0": server("edge0"), "edge1": server("edge1"), "edge2": server("edge2")},
+		Profile: map[string]tc.TMProfile{
+			"EDGE": {Name: "EDGE", Parameters: tc.TMParameters{Thresholds: map[string]tc.HealthThreshold{"loadavg": threshold}}},
+		},
+	}
+}
+
+func simulateTestHistory() cache.ResultInfoHistory {
+	info := func(name string, loadavg float64, kbps int64) []cache.ResultInfo {
+		return []cache.ResultInfo{{
+			ID:              name,
+			Available:       true,
+			Vitals:          cache.Vitals{LoadAvg: loadavg},
+			InterfaceVitals: map[string]cache.Vitals{"eth0": {KbpsOut: kbps}},
+		}}
+	}
+	return cache.ResultInfoHistory{"edge0": info("edge0", 10, 500), "edge1": info("edge1", 30, 50)}
+}
+
+func TestSimulateThresholds(t *testing.T) {
+	current := simulateTestConfig()
+	body := []byte(`{"thresholds": {"EDGE": {"health.threshold.loadavg": "<20"}}}`)
+
+	sim, err := simulate(body, simulateTestHistory(), threadsafe.NewResultStatHistory(), current)
+	if err != nil {
+		t.Fatalf("simulate: %v", err)
+	}
+	if sim.Evaluated != 2 {
+		t.Errorf("expected 2 caches evaluated, got %d", sim.Evaluated)
+	}
+	if len(sim.Unevaluated) != 1 || sim.Unevaluated[0] != "edge2" {
+		t.Errorf("expected edge2 unevaluated, got %v", sim.Unevaluated)
+	}
+	if len(sim.Changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", sim.Changes)
+	}
+	change := sim.Changes[0]
+	if change.Cache != "edge1" || !change.WasAvailable || change.Available || change.UnavailableStat != "loadavg" {
+		t.Errorf("expected edge1 to become unavailable from loadavg, got %+v", change)
+	}
+
+	if current.Profile["EDGE"].Parameters.Thresholds["loadavg"].Val != 50 {
+		t.Error("expected simulation not to modify the current config")
+	}
+}
+
+func TestSimulateConfig(t *testing.T) {
+	body := []byte(`{"config": {
+		"TrafficServer": {
+			"edge0": {"hostName": "edge0", "profile": "EDGE", "status": "REPORTED", "interfaces": [{"name": "eth0", "monitor": true, "maxBandwidth": 100}]},
+			"edge1": {"hostName": "edge1", "profile": "EDGE", "status": "REPORTED", "interfaces": [{"name": "eth0", "monitor": true}]}
+		},
+		"Profile": {
+			"EDGE": {"name": "EDGE", "parameters": {"health.threshold.loadavg": "<50"}}
+		}
+	}}`)
+
+	sim, err := simulate(body, simulateTestHistory(), threadsafe.NewResultStatHistory(), simulateTestConfig())
+	if err != nil {
+		t.Fatalf("simulate: %v", err)
+	}
+	if sim.Evaluated != 2 || len(sim.Unevaluated) != 0 {
+		t.Errorf("expected 2 caches evaluated and none unevaluated, got %d and %v", sim.Evaluated, sim.Unevaluated)
+	}
+	if len(sim.Changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", sim.Changes)
+	}
+	if sim.Changes[0].Cache != "edge0" || sim.Changes[0].Interface != "" || sim.Changes[0].Available {
+		t.Errorf("expected edge0 to become unavailable, got %+v", sim.Changes[0])
+	}
+	if sim.Changes[1].Cache != "edge0" || sim.Changes[1].Interface != "eth0" || sim.Changes[1].Available {
+		t.Errorf("expected edge0 eth0 to become unavailable, got %+v", sim.Changes[1])
+	}
+}
+
+func TestSimulateInvalid(t *testing.T) {
+	bodies := map[string]string{
+		"empty":             `{}`,
+		"malformed":         `{"thresholds":`,
+		"empty config":      `{"config": {}}`,
+		"unknown profile":   `{"thresholds": {"MID": {"health.threshold.loadavg": "<20"}}}`,
+		"not a threshold":   `{"thresholds": {"EDGE": {"history.count": "5"}}}`,
+		"invalid threshold": `{"thresholds": {"EDGE": {"health.threshold.loadavg": "<twenty"}}}`,
+	}
+	for name, body := range bodies {
+		if _, err := simulate([]byte(body), simulateTestHistory(), threadsafe.NewResultStatHistory(), simulateTestConfig()); err == nil {
+			t.Errorf("expected %s request to fail", name)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Package dsprobe actively checks Delivery Services, by requesting a probe URL
+// of each Delivery Service through a sample of its assigned cache servers in
+// each Cache Group.
+package dsprobe
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// Result is the result of a single probe of a Delivery Service, through a
+// single cache server.
+type Result struct {
+	Cache tc.CacheName
+	Time  time.Time
+	// StatusCode is the HTTP status code of the response, or 0 if there was
+	// no response.
+	StatusCode int
+	Latency    time.Duration
+	// Error is the reason the probe failed, or empty if it succeeded.
+	Error string
+}
+
+// Succeeded returns whether the probe succeeded.
+func (r Result) Succeeded() bool {
+	return r.Error == ""
+}
+
+// Results are the latest probe results of each Delivery Service, in each
+// Cache Group.
+type Results map[tc.DeliveryServiceName]map[tc.CacheGroupName][]Result
+
+// FailedLocations returns the Cache Groups in which every probe of the given
+// Delivery Service failed, sorted by name.
+func (r Results) FailedLocations(ds tc.DeliveryServiceName) []tc.CacheGroupName {
+	failed := []tc.CacheGroupName{}
+	for cg, results := range r[ds] {
+		if len(results) == 0 {
+			continue
+		}
+		cgFailed := true
+		for _, result := range results {
+			if result.Succeeded() {
+				cgFailed = false
+				break
+			}
+		}
+		if cgFailed {
+			failed = append(failed, cg)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i] < failed[j] })
+	return failed
+}
+
+// ThreadsafeResults provides safe access for multiple goroutine readers and a
+// single writer to the latest probe Results.
+type ThreadsafeResults struct {
+	results *Results
+	m       *sync.RWMutex
+}
+
+// NewThreadsafeResults creates a new ThreadsafeResults, with no results.
+func NewThreadsafeResults() ThreadsafeResults {
+	results := Results{}
+	return ThreadsafeResults{results: &results, m: &sync.RWMutex{}}
+}
+
+// Get returns the latest Results. The returned Results MUST NOT be modified.
+func (t ThreadsafeResults) Get() Results {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return *t.results
+}
+
+// Set sets the latest Results. This MUST NOT be called by multiple goroutines.
+func (t ThreadsafeResults) Set(results Results) {
+	t.m.Lock()
+	*t.results = results
+	t.m.Unlock()
+}
+
+// SelectCaches returns up to n randomly chosen servers of a Delivery Service
+// in each Cache Group, of those which are available. The servers are the
+// Delivery Service's assigned servers, and cachegroups maps servers to their
+// Cache Groups.
+func SelectCaches(servers []tc.CacheName, cachegroups map[tc.CacheName]tc.CacheGroupName, states map[tc.CacheName]tc.IsAvailable, n int) map[tc.CacheGroupName][]tc.CacheName {
+	available := map[tc.CacheGroupName][]tc.CacheName{}
+	for _, server := range servers {
+		if !states[server].IsAvailable {
+			continue
+		}
+		cg, ok := cachegroups[server]
+		if !ok {
+			continue
+		}
+		available[cg] = append(available[cg], server)
+	}
+
+	selected := make(map[tc.CacheGroupName][]tc.CacheName, len(available))
+	for cg, cgServers := range available {
+		rand.Shuffle(len(cgServers), func(i, j int) { cgServers[i], cgServers[j] = cgServers[j], cgServers[i] })
+		if len(cgServers) > n {
+			cgServers = cgServers[:n]
+		}
+		selected[cg] = cgServers
+	}
+	return selected
+}
+
+type dialAddrKey struct{}
+
+// NewClient returns an HTTP client for probing, with the given timeout. The
+// client sends each request to the address of the cache server in the
+// request's context, rather than to the host in its URL, so the Host header
+// and TLS server name are those of the Delivery Service.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if cacheAddr, ok := ctx.Value(dialAddrKey{}).(string); ok {
+					addr = cacheAddr
+				}
+				return dialer.DialContext(ctx, network, addr)
+			},
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse // redirects are the response of the cache, and aren't followed
+		},
+	}
+}
+
+// CacheAddr returns the address to which a probe through the given cache
+// server with the given URL scheme is sent, or an error if it has no service
+// address.
+func CacheAddr(server tc.TrafficServer, scheme string) (string, error) {
+	ip := server.IPv4()
+	if ip == "" {
+		ip = server.IPv6()
+	}
+	if i := strings.Index(ip, "/"); i != -1 {
+		ip = ip[:i]
+	}
+	if ip == "" {
+		return "", errors.New("server has no service address")
+	}
+	port := server.Port
+	if scheme == "https" {
+		port = server.HTTPSPort
+	}
+	if port == 0 {
+		return "", errors.New("server has no " + scheme + " port")
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port)), nil
+}
+
+// Probe requests the given probe URL through the given cache server. The probe
+// succeeds if the response has a status code under 400.
+func Probe(client *http.Client, probeURL string, cacheName tc.CacheName, server tc.TrafficServer, userAgent string) Result {
+	result := Result{Cache: cacheName, Time: time.Now()}
+
+	u, err := url.Parse(probeURL)
+	if err != nil {
+		result.Error = "parsing probe URL: " + err.Error()
+		return result
+	}
+	addr, err := CacheAddr(server, u.Scheme)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	req, err := http.NewRequest(http.MethodGet, probeURL, nil)
+	if err != nil {
+		result.Error = "creating request: " + err.Error()
+		return result
+	}
+	req = req.WithContext(context.WithValue(req.Context(), dialAddrKey{}, addr))
+	req.Header.Set("User-Agent", userAgent)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.Error = "requesting: " + err.Error()
+		return result
+	}
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	result.Latency = time.Since(start)
+	result.StatusCode = resp.StatusCode
+	if err != nil {
+		result.Error = "reading body: " + err.Error()
+	} else if resp.StatusCode >= 400 {
+		result.Error = "bad status: " + strconv.Itoa(resp.StatusCode)
+	}
+	return result
+}
+
+// Run probes each Delivery Service with a probe URL through up to n of its
+// available servers in each Cache Group, concurrently, and returns the
+// results.
+func Run(
+	client *http.Client,
+	probeURLs map[tc.DeliveryServiceName]string,
+	n int,
+	userAgent string,
+	dsServers map[tc.DeliveryServiceName][]tc.CacheName,
+	serverCachegroups map[tc.CacheName]tc.CacheGroupName,
+	servers map[string]tc.TrafficServer,
+	states map[tc.CacheName]tc.IsAvailable,
+) Results {
+	results := Results{}
+	m := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for ds, probeURL := range probeURLs {
+		results[ds] = map[tc.CacheGroupName][]Result{}
+		for cg, caches := range SelectCaches(dsServers[ds], serverCachegroups, states, n) {
+			for _, cache := range caches {
+				wg.Add(1)
+				go func(ds tc.DeliveryServiceName, cg tc.CacheGroupName, cache tc.CacheName, probeURL string) {
+					defer wg.Done()
+					result := Probe(client, probeURL, cache, servers[string(cache)], userAgent)
+					m.Lock()
+					results[ds][cg] = append(results[ds][cg], result)
+					m.Unlock()
+				}(ds, cg, cache, probeURL)
+			}
+		}
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,151 @@
+package dsprobe
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func testServer(t *testing.T, cg string, addr string) tc.TrafficServer {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("splitting test server address '%s': %v", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("parsing test server port '%s': %v", portStr, err)
+	}
+	return tc.TrafficServer{
+		CacheGroup: cg,
+		Port:       port,
+		Interfaces: []tc.ServerInterfaceInfo{
+			{Name: "eth0", IPAddresses: []tc.ServerIPAddress{{Address: host, ServiceAddress: true}}},
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "probe.ds1.example.net" {
+			t.Errorf("expected probe Host 'probe.ds1.example.net', got '%s'", r.Host)
+		}
+		if r.UserAgent() != "test-agent" {
+			t.Errorf("expected probe User-Agent 'test-agent', got '%s'", r.UserAgent())
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+
+	servers := map[string]tc.TrafficServer{
+		"good": testServer(t, "cg-good", good.Listener.Addr().String()),
+		"bad":  testServer(t, "cg-bad", bad.Listener.Addr().String()),
+		"down": testServer(t, "cg-down", bad.Listener.Addr().String()),
+	}
+	cachegroups := map[tc.CacheName]tc.CacheGroupName{"good": "cg-good", "bad": "cg-bad", "down": "cg-down"}
+	states := map[tc.CacheName]tc.IsAvailable{"good": {IsAvailable: true}, "bad": {IsAvailable: true}, "down": {IsAvailable: false}}
+	dsServers := map[tc.DeliveryServiceName][]tc.CacheName{"ds1": {"good", "bad", "down"}}
+	probeURLs := map[tc.DeliveryServiceName]string{"ds1": "http://probe.ds1.example.net/probe.txt"}
+
+	results := Run(NewClient(time.Second), probeURLs, 1, "test-agent", dsServers, cachegroups, servers, states)
+
+	if _, ok := results["ds1"]["cg-down"]; ok {
+		t.Error("expected cachegroup with no available caches not to be probed")
+	}
+	if len(results["ds1"]["cg-good"]) != 1 || results["ds1"]["cg-good"][0].StatusCode != http.StatusOK || !results["ds1"]["cg-good"][0].Succeeded() {
+		t.Errorf("expected one successful probe in cg-good, got %+v", results["ds1"]["cg-good"])
+	}
+	if len(results["ds1"]["cg-bad"]) != 1 || results["ds1"]["cg-bad"][0].StatusCode != http.StatusBadGateway || results["ds1"]["cg-bad"][0].Succeeded() {
+		t.Errorf("expected one failed probe in cg-bad, got %+v", results["ds1"]["cg-bad"])
+	}
+
+	failed := results.FailedLocations("ds1")
+	if len(failed) != 1 || failed[0] != "cg-bad" {
+		t.Errorf("expected failed locations [cg-bad], got %v", failed)
+	}
+}
+
+func TestFailedLocations(t *testing.T) {
+	results := Results{
+		"ds1": {
+			"cg-some": {{Cache: "a", Error: "bad status: 503"}, {Cache: "b"}},
+			"cg-all":  {{Cache: "c", Error: "requesting: timeout"}, {Cache: "d", Error: "bad status: 404"}},
+			"cg-none": {},
+		},
+	}
+	failed := results.FailedLocations("ds1")
+	if len(failed) != 1 || failed[0] != "cg-all" {
+		t.Errorf("expected only the cachegroup with every probe failed to fail, got %v", failed)
+	}
+	if failed := results.FailedLocations("ds2"); len(failed) != 0 {
+		t.Errorf("expected unprobed delivery service to have no failed locations, got %v", failed)
+	}
+}
+
+func TestSelectCaches(t *testing.T) {
+	servers := []tc.CacheName{"a", "b", "c", "d"}
+	cachegroups := map[tc.CacheName]tc.CacheGroupName{"a": "cg1", "b": "cg1", "c": "cg1", "d": "cg2"}
+	states := map[tc.CacheName]tc.IsAvailable{"a": {IsAvailable: true}, "b": {IsAvailable: true}, "c": {IsAvailable: false}, "d": {IsAvailable: true}}
+
+	selected := SelectCaches(servers, cachegroups, states, 1)
+	if len(selected["cg1"]) != 1 || (selected["cg1"][0] != "a" && selected["cg1"][0] != "b") {
+		t.Errorf("expected one available cache selected in cg1, got %v", selected["cg1"])
+	}
+	if len(selected["cg2"]) != 1 || selected["cg2"][0] != "d" {
+		t.Errorf("expected cache d selected in cg2, got %v", selected["cg2"])
+	}
+
+	selected = SelectCaches(servers, cachegroups, states, 5)
+	if len(selected["cg1"]) != 2 {
+		t.Errorf("expected both available caches selected in cg1, got %v", selected["cg1"])
+	}
+}
+
+func TestCacheAddr(t *testing.T) {
+	for _, test := range []struct {
+		addr     string
+		expected string
+	}{
+		{addr: "192.0.2.1", expected: "192.0.2.1:80"},
+		{addr: "192.0.2.1/24", expected: "192.0.2.1:80"},
+		{addr: "2001:db8::1/64", expected: "[2001:db8::1]:80"},
+	} {
+		server := tc.TrafficServer{
+			Port:       80,
+			Interfaces: []tc.ServerInterfaceInfo{{Name: "eth0", IPAddresses: []tc.ServerIPAddress{{Address: test.addr, ServiceAddress: true}}}},
+		}
+		actual, err := CacheAddr(server, "http")
+		if err != nil {
+			t.Errorf("address '%s': unexpected error: %v", test.addr, err)
+		} else if actual != test.expected {
+			t.Errorf("address '%s': expected '%s', got '%s'", test.addr, test.expected, actual)
+		}
+	}
+}
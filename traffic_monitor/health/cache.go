@@ -29,6 +29,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-util"
 	"github.com/apache/trafficcontrol/traffic_monitor/cache"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsprobe"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
@@ -276,6 +277,7 @@ func CalcAvailability(
 	toData todata.TOData,
 	localCacheStatusThreadsafe threadsafe.CacheAvailableStatus,
 	localStates peer.CRStatesThreadsafe,
+	dsProbes dsprobe.ThreadsafeResults,
 	events ThreadsafeEvents,
 	protocol config.PollingProtocol,
 ) {
@@ -300,8 +302,8 @@ func CalcAvailability(
 			Status:             serverInfo.ServerStatus,
 		}
 
-		lastStatus, ok := localCacheStatuses[result.ID]
-		if ok {
+		lastStatus, lastStatusOk := localCacheStatuses[result.ID]
+		if lastStatusOk {
 			if result.UsingIPv4 {
 				availStatus.Available.IPv4 = true
 				availStatus.Available.IPv6 = serverInfo.IPv6() != "" && lastStatus.Available.IPv6
@@ -356,6 +358,25 @@ func CalcAvailability(
 			availStatus.UnavailableStat = aggUnavailableStat
 		}
 
+		if lastStatusOk {
+			var hold string
+			availStatus, hold = dampen(mc.Profile[serverInfo.Profile].Parameters.TMDampeningParameters, lastStatus, availStatus, time.Now())
+			if hold != "" {
+				log.Infof("Dampening state change for %s: %s poller: %v", result.ID, hold, pollerName)
+				events.Add(Event{
+					Time:          Time(time.Now()),
+					Description:   "Dampened: " + hold + " (" + pollerName + ")",
+					Name:          result.ID,
+					Hostname:      result.ID,
+					Type:          toData.ServerTypes[tc.CacheName(result.ID)].String(),
+					Available:     availStatus.ProcessedAvailable,
+					IPv4Available: availStatus.Available.IPv4,
+					IPv6Available: availStatus.Available.IPv6,
+					Dampened:      true,
+				})
+			}
+		}
+
 		localStates.SetCache(tc.CacheName(result.ID), tc.IsAvailable{
 			IsAvailable:   availStatus.ProcessedAvailable,
 			Ipv4Available: availStatus.Available.IPv4,
@@ -385,7 +406,7 @@ func CalcAvailability(
 
 		localCacheStatuses[result.ID] = availStatus
 	}
-	calculateDeliveryServiceState(toData.DeliveryServiceServers, localStates, toData)
+	calculateDeliveryServiceState(toData.DeliveryServiceServers, localStates, toData, dsProbes.Get())
 	localCacheStatusThreadsafe.Set(localCacheStatuses)
 }
 
@@ -435,7 +456,8 @@ func eventDesc(status tc.CacheStatus, message string) string {
 }
 
 //calculateDeliveryServiceState calculates the state of delivery services from the new cache state data `cacheState` and the CRConfig data `deliveryServiceServers` and puts the calculated state in the outparam `deliveryServiceStates`
-func calculateDeliveryServiceState(deliveryServiceServers map[tc.DeliveryServiceName][]tc.CacheName, states peer.CRStatesThreadsafe, toData todata.TOData) {
+// Cache Groups in which every synthetic probe of a delivery service failed are also disabled.
+func calculateDeliveryServiceState(deliveryServiceServers map[tc.DeliveryServiceName][]tc.CacheName, states peer.CRStatesThreadsafe, toData todata.TOData, probes dsprobe.Results) {
 	cacheStates := states.GetCaches()
 
 	deliveryServices := states.GetDeliveryServices()
@@ -445,6 +467,7 @@ func calculateDeliveryServiceState(deliveryServiceServers map[tc.DeliveryService
 			continue
 		}
 		deliveryServiceState.DisabledLocations = getDisabledLocations(deliveryServiceName, toData.DeliveryServiceServers[deliveryServiceName], cacheStates, toData.ServerCachegroups)
+		deliveryServiceState.DisabledLocations = addProbeFailedLocations(deliveryServiceState.DisabledLocations, probes.FailedLocations(deliveryServiceName))
 		states.SetDeliveryService(deliveryServiceName, deliveryServiceState)
 	}
 }
@@ -462,6 +485,25 @@ func getDisabledLocations(deliveryService tc.DeliveryServiceName, deliveryServic
 	return disabledLocations
 }
 
+// addProbeFailedLocations returns the given disabled locations, with the given
+// locations in which synthetic probes failed added, if they aren't already
+// disabled.
+func addProbeFailedLocations(disabledLocations []tc.CacheGroupName, probeFailedLocations []tc.CacheGroupName) []tc.CacheGroupName {
+	for _, failed := range probeFailedLocations {
+		found := false
+		for _, disabled := range disabledLocations {
+			if disabled == failed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			disabledLocations = append(disabledLocations, failed)
+		}
+	}
+	return disabledLocations
+}
+
 func getDeliveryServiceCacheAvailability(cacheStates map[tc.CacheName]tc.IsAvailable, deliveryServiceServers []tc.CacheName) map[tc.CacheName]tc.IsAvailable {
 	dsCacheStates := map[tc.CacheName]tc.IsAvailable{}
 	for _, server := range deliveryServiceServers {
@@ -0,0 +1,141 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+)
+
+// dampeningPenaltyEnabled returns whether the exponential penalty model of the
+// given dampening parameters is enabled. It requires a penalty, a suppress
+// threshold, and a half-life; without a half-life, a suppressed cache server
+// would never be reused.
+func dampeningPenaltyEnabled(params tc.TMDampeningParameters) bool {
+	return params.Penalty > 0 && params.Suppress > 0 && params.HalfLife > 0
+}
+
+// dampeningReuse returns the penalty below which a suppressed cache server may
+// be reused. If the reuse threshold isn't set below the suppress threshold,
+// half the suppress threshold is used.
+func dampeningReuse(params tc.TMDampeningParameters) float64 {
+	if params.Reuse <= 0 || params.Reuse >= params.Suppress {
+		return params.Suppress / 2
+	}
+	return params.Reuse
+}
+
+// decayPenalty returns the given penalty, decayed exponentially with the given
+// half-life over the time since it was last decayed.
+func decayPenalty(penalty float64, halfLife time.Duration, since time.Time, now time.Time) float64 {
+	if penalty == 0 || halfLife <= 0 || since.IsZero() || !now.After(since) {
+		return penalty
+	}
+	return penalty * math.Pow(0.5, float64(now.Sub(since))/float64(halfLife))
+}
+
+// dampen applies the flap dampening configured by params to the availability
+// status calculated from a poll result, given the last status of the cache
+// server.
+//
+// If the result would change the cache server's availability, but dampening
+// holds the change, the returned status keeps the last availability, and its
+// Why describes the hold. The returned string describes the hold, if this
+// result began one; otherwise, it's empty.
+func dampen(params tc.TMDampeningParameters, last cache.AvailableStatus, status cache.AvailableStatus, now time.Time) (cache.AvailableStatus, string) {
+	state := last.Dampening
+	// The first result for a cache server isn't counted, because it has no
+	// last availability to hold.
+	evaluated := state.ConsecutiveFailures > 0 || state.ConsecutiveSuccesses > 0
+
+	healthy := status.ProcessedAvailable
+	state.HealthAvailable = healthy
+	if healthy {
+		state.ConsecutiveSuccesses++
+		state.ConsecutiveFailures = 0
+	} else {
+		state.ConsecutiveFailures++
+		state.ConsecutiveSuccesses = 0
+	}
+
+	penaltyEnabled := dampeningPenaltyEnabled(params)
+	if penaltyEnabled {
+		halfLife := time.Duration(params.HalfLife) * time.Millisecond
+		state.Penalty = decayPenalty(state.Penalty, halfLife, state.PenaltyTime, now)
+		state.PenaltyTime = now
+		if state.Suppressed && state.Penalty < dampeningReuse(params) {
+			state.Suppressed = false
+		}
+	} else {
+		state.Penalty = 0
+		state.Suppressed = false
+	}
+
+	hold := ""
+	if evaluated && healthy != last.ProcessedAvailable {
+		if healthy {
+			if state.Suppressed {
+				hold = fmt.Sprintf("held unavailable: penalty %.2f not below reuse %.2f", state.Penalty, dampeningReuse(params))
+			} else if uint64(params.ConsecutiveSuccesses) > state.ConsecutiveSuccesses {
+				hold = fmt.Sprintf("held unavailable: %d of %d consecutive successes", state.ConsecutiveSuccesses, params.ConsecutiveSuccesses)
+			}
+		} else if uint64(params.ConsecutiveFailures) > state.ConsecutiveFailures {
+			hold = fmt.Sprintf("held available: %d of %d consecutive failures", state.ConsecutiveFailures, params.ConsecutiveFailures)
+		}
+
+		if hold == "" && !healthy && penaltyEnabled {
+			state.Penalty += params.Penalty
+			if state.Penalty >= params.Suppress {
+				state.Suppressed = true
+			}
+		}
+	}
+
+	if hold == "" {
+		state.Pending = false
+		status.Dampening = state
+		return status, ""
+	}
+
+	newHold := !state.Pending
+	if newHold {
+		state.SuppressedTransitions++
+	}
+	state.Pending = true
+
+	why := "dampened (" + hold + ")"
+	if status.Why != "" {
+		why += "; " + status.Why
+	}
+	status.Available = last.Available
+	status.ProcessedAvailable = last.ProcessedAvailable
+	status.UnavailableStat = last.UnavailableStat
+	status.Why = why
+	status.Dampening = state
+
+	if !newHold {
+		return status, ""
+	}
+	return status, hold
+}
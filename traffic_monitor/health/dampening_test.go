@@ -0,0 +1,119 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+)
+
+func dampeningTestStatus(available bool) cache.AvailableStatus {
+	return cache.AvailableStatus{
+		Available:          cache.AvailableTuple{IPv4: available, IPv6: available},
+		ProcessedAvailable: available,
+	}
+}
+
+func TestDampenConsecutive(t *testing.T) {
+	params := tc.TMDampeningParameters{ConsecutiveFailures: 3, ConsecutiveSuccesses: 2}
+	now := time.Now()
+
+	// the first counted result isn't dampened, so a cache isn't held unavailable on startup
+	status, hold := dampen(params, dampeningTestStatus(false), dampeningTestStatus(true), now)
+	if !status.ProcessedAvailable || hold != "" {
+		t.Fatalf("expected first result to be available without a hold, got available %t hold '%s'", status.ProcessedAvailable, hold)
+	}
+
+	status, hold = dampen(params, status, dampeningTestStatus(false), now)
+	if !status.ProcessedAvailable || !status.Available.IPv4 || !status.Available.IPv6 {
+		t.Errorf("expected first failure to be held available, got %+v", status)
+	}
+	if !strings.Contains(hold, "1 of 3 consecutive failures") {
+		t.Errorf("expected hold for 1 of 3 consecutive failures, got '%s'", hold)
+	}
+	if !strings.HasPrefix(status.Why, "dampened") {
+		t.Errorf("expected Why to describe the hold, got '%s'", status.Why)
+	}
+
+	status, hold = dampen(params, status, dampeningTestStatus(false), now)
+	if !status.ProcessedAvailable || hold != "" {
+		t.Errorf("expected second failure to continue the hold without a new one, got available %t hold '%s'", status.ProcessedAvailable, hold)
+	}
+
+	status, _ = dampen(params, status, dampeningTestStatus(false), now)
+	if status.ProcessedAvailable {
+		t.Error("expected third consecutive failure to mark unavailable")
+	}
+	if status.Dampening.Pending {
+		t.Error("expected no pending change after marking unavailable")
+	}
+
+	status, hold = dampen(params, status, dampeningTestStatus(true), now)
+	if status.ProcessedAvailable || !strings.Contains(hold, "1 of 2 consecutive successes") {
+		t.Errorf("expected first success to be held unavailable, got available %t hold '%s'", status.ProcessedAvailable, hold)
+	}
+
+	status, _ = dampen(params, status, dampeningTestStatus(true), now)
+	if !status.ProcessedAvailable {
+		t.Error("expected second consecutive success to mark available")
+	}
+	if status.Dampening.SuppressedTransitions != 2 {
+		t.Errorf("expected 2 suppressed transitions, got %d", status.Dampening.SuppressedTransitions)
+	}
+}
+
+func TestDampenPenalty(t *testing.T) {
+	params := tc.TMDampeningParameters{Penalty: 1000, Suppress: 2000, Reuse: 750, HalfLife: 60000}
+	now := time.Now()
+
+	status := dampeningTestStatus(true)
+	status.Dampening.ConsecutiveSuccesses = 1
+
+	status, _ = dampen(params, status, dampeningTestStatus(false), now)
+	status, _ = dampen(params, status, dampeningTestStatus(true), now)
+	if !status.ProcessedAvailable || status.Dampening.Suppressed {
+		t.Fatalf("expected one flap not to suppress, got %+v", status)
+	}
+
+	status, _ = dampen(params, status, dampeningTestStatus(false), now)
+	if !status.Dampening.Suppressed || status.Dampening.Penalty != 2000 {
+		t.Fatalf("expected second flap to suppress with penalty 2000, got %+v", status.Dampening)
+	}
+
+	now = now.Add(time.Minute)
+	status, hold := dampen(params, status, dampeningTestStatus(true), now)
+	if status.ProcessedAvailable || !strings.Contains(hold, "penalty") {
+		t.Errorf("expected suppressed cache to be held unavailable, got available %t hold '%s'", status.ProcessedAvailable, hold)
+	}
+	if math.Abs(status.Dampening.Penalty-1000) > 0.001 {
+		t.Errorf("expected penalty to decay to 1000 after one half-life, got %f", status.Dampening.Penalty)
+	}
+
+	now = now.Add(time.Minute)
+	status, _ = dampen(params, status, dampeningTestStatus(true), now)
+	if !status.ProcessedAvailable || status.Dampening.Suppressed {
+		t.Errorf("expected cache to be reused after penalty decayed below reuse, got %+v", status)
+	}
+}
@@ -55,6 +55,9 @@ type Event struct {
 	Available     bool   `json:"isAvailable"`
 	IPv4Available bool   `json:"ipv4Available"`
 	IPv6Available bool   `json:"ipv6Available"`
+	// Dampened is whether the event is an availability change which was held
+	// by flap dampening, rather than one which was made.
+	Dampened bool `json:"dampened,omitempty"`
 }
 
 // Events provides safe access for multiple goroutines readers and a single writer to a stored Events slice.
@@ -100,3 +103,20 @@ func (o *ThreadsafeEvents) Add(e Event) {
 	*o.nextIndex++
 	o.m.Unlock()
 }
+
+// Restore replaces the events with the given events, which must be ordered
+// newest first, e.g. events which were saved before a restart. New events are
+// indexed after the newest restored event. This MUST NOT be called concurrently
+// with Add.
+func (o *ThreadsafeEvents) Restore(events []Event) {
+	events = copyEvents(events)
+	if uint64(len(events)) > o.max {
+		events = events[:o.max]
+	}
+	o.m.Lock()
+	defer o.m.Unlock()
+	*o.events = events
+	if len(events) > 0 && events[0].Index >= *o.nextIndex {
+		*o.nextIndex = events[0].Index + 1
+	}
+}
@@ -0,0 +1,165 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// SimulatedChange is a change in the availability of a cache server, or of one
+// of its network interfaces, which a candidate monitoring configuration would
+// make.
+type SimulatedChange struct {
+	Cache tc.CacheName `json:"cache"`
+	// Interface is the name of the network interface whose availability would
+	// change, or empty if the change is of the cache server itself.
+	Interface       string `json:"interface,omitempty"`
+	WasAvailable    bool   `json:"wasAvailable"`
+	Available       bool   `json:"available"`
+	Why             string `json:"why"`
+	UnavailableStat string `json:"unavailableStat,omitempty"`
+}
+
+// Simulation is the result of evaluating a candidate monitoring configuration
+// against the stat history.
+type Simulation struct {
+	// Evaluated is the number of cache servers evaluated.
+	Evaluated int `json:"evaluated"`
+	// Unevaluated are the cache servers in the candidate configuration without
+	// any stat results to evaluate.
+	Unevaluated []tc.CacheName    `json:"unevaluated"`
+	Changes     []SimulatedChange `json:"changes"`
+}
+
+// simulatedAvailability is the availability of a cache server evaluated by
+// SimulateAvailability.
+type simulatedAvailability struct {
+	available       bool
+	why             string
+	unavailableStat string
+	interfaces      map[string]bool
+	interfaceWhys   map[string]string
+}
+
+// evalSimulated evaluates the availability of the given cache server from the
+// given result and stats, with the given monitoring configuration, in the same
+// way as CalcAvailability.
+func evalSimulated(name tc.CacheName, result cache.ResultInfo, stats *threadsafe.ResultStatValHistory, mc tc.TrafficMonitorConfigMap) simulatedAvailability {
+	avail := simulatedAvailability{interfaces: map[string]bool{}, interfaceWhys: map[string]string{}}
+	reasons := []string{}
+	interfacesAvailable := true
+	for _, inf := range mc.TrafficServer[string(name)].Interfaces {
+		if !inf.Monitor {
+			continue
+		}
+		available, why := EvalInterface(result.InterfaceVitals, inf)
+		avail.interfaces[inf.Name] = available
+		avail.interfaceWhys[inf.Name] = why
+		interfacesAvailable = interfacesAvailable && available
+		if why != "" {
+			reasons = append(reasons, inf.Name+": "+why)
+		}
+	}
+
+	aggAvailable, aggWhy, aggStat := EvalAggregate(result, stats, &mc)
+	if aggWhy != "" {
+		reasons = append([]string{aggWhy}, reasons...)
+	}
+	avail.available = aggAvailable && interfacesAvailable
+	avail.why = strings.Join(reasons, "; ")
+	avail.unavailableStat = aggStat
+	return avail
+}
+
+// SimulateAvailability evaluates the latest stat results of each cache server
+// in the candidate monitoring configuration with both the current and the
+// candidate configuration, and returns the cache servers and interfaces whose
+// availability would change. It doesn't modify any of its arguments, or any
+// live state.
+//
+// Both evaluations use the same results, so changes reflect only the
+// differences in configuration, and not e.g. results since the last poll, or
+// flap dampening.
+func SimulateAvailability(infoHistory cache.ResultInfoHistory, statHistory threadsafe.ResultStatHistory, current tc.TrafficMonitorConfigMap, candidate tc.TrafficMonitorConfigMap) Simulation {
+	names := make([]string, 0, len(candidate.TrafficServer))
+	for name := range candidate.TrafficServer {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sim := Simulation{Unevaluated: []tc.CacheName{}, Changes: []SimulatedChange{}}
+	for _, nameStr := range names {
+		name := tc.CacheName(nameStr)
+		infos := infoHistory[name]
+		if len(infos) == 0 {
+			sim.Unevaluated = append(sim.Unevaluated, name)
+			continue
+		}
+		result := infos[0]
+
+		var stats *threadsafe.ResultStatValHistory
+		if v, ok := statHistory.Load(nameStr); ok {
+			if cacheStats, ok := v.(threadsafe.CacheStatHistory); ok {
+				stats = &cacheStats.Stats
+			}
+		}
+
+		sim.Evaluated++
+		was := evalSimulated(name, result, stats, current)
+		now := evalSimulated(name, result, stats, candidate)
+		if was.available != now.available {
+			sim.Changes = append(sim.Changes, SimulatedChange{
+				Cache:           name,
+				WasAvailable:    was.available,
+				Available:       now.available,
+				Why:             now.why,
+				UnavailableStat: now.unavailableStat,
+			})
+		}
+
+		infNames := make([]string, 0, len(now.interfaces))
+		for infName := range now.interfaces {
+			infNames = append(infNames, infName)
+		}
+		sort.Strings(infNames)
+		for _, infName := range infNames {
+			wasAvailable, ok := was.interfaces[infName]
+			if !ok {
+				wasAvailable = true // interfaces which weren't monitored are never unavailable
+			}
+			if wasAvailable == now.interfaces[infName] {
+				continue
+			}
+			sim.Changes = append(sim.Changes, SimulatedChange{
+				Cache:        name,
+				Interface:    infName,
+				WasAvailable: wasAvailable,
+				Available:    now.interfaces[infName],
+				Why:          now.interfaceWhys[infName],
+			})
+		}
+	}
+	return sim
+}
@@ -0,0 +1,110 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsprobe"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// StartDSProbes starts the goroutine which periodically probes each Delivery
+// Service with a configured probe URL through a sample of its available cache
+// servers in each Cache Group, and returns the latest probe results. If no
+// probe URLs are configured, it does nothing, and the results are always
+// empty.
+func StartDSProbes(
+	cfg config.Config,
+	appData config.StaticAppData,
+	toData todata.TODataThreadsafe,
+	monitorConfig threadsafe.TrafficMonitorConfigMap,
+	localStates peer.CRStatesThreadsafe,
+	events health.ThreadsafeEvents,
+) dsprobe.ThreadsafeResults {
+	results := dsprobe.NewThreadsafeResults()
+	if len(cfg.DSProbeURLs) == 0 {
+		return results
+	}
+	if cfg.DSProbeInterval <= 0 {
+		log.Errorf("ds_probe_interval_ms must be positive, delivery services will not be probed")
+		return results
+	}
+	n := cfg.DSProbeCachesPerCacheGroup
+	if n < 1 {
+		log.Warnf("ds_probe_caches_per_cachegroup %d is less than 1, probing 1 cache per cachegroup", n)
+		n = 1
+	}
+
+	probeURLs := make(map[tc.DeliveryServiceName]string, len(cfg.DSProbeURLs))
+	for ds, probeURL := range cfg.DSProbeURLs {
+		probeURLs[tc.DeliveryServiceName(ds)] = probeURL
+	}
+	client := dsprobe.NewClient(cfg.HTTPTimeout)
+
+	go func() {
+		tick := time.NewTicker(cfg.DSProbeInterval)
+		defer tick.Stop()
+		for range tick.C {
+			toDataCopy := toData.Get()
+			newResults := dsprobe.Run(client, probeURLs, n, appData.UserAgent, toDataCopy.DeliveryServiceServers, toDataCopy.ServerCachegroups, monitorConfig.Get().TrafficServer, localStates.GetCaches())
+			addDSProbeEvents(events, results.Get(), newResults)
+			results.Set(newResults)
+		}
+	}()
+	return results
+}
+
+// addDSProbeEvents adds an event for each Delivery Service Cache Group in which
+// probes began or stopped failing, between the old and new probe results.
+func addDSProbeEvents(events health.ThreadsafeEvents, oldResults dsprobe.Results, newResults dsprobe.Results) {
+	for ds := range newResults {
+		oldFailed := map[tc.CacheGroupName]struct{}{}
+		for _, cg := range oldResults.FailedLocations(ds) {
+			oldFailed[cg] = struct{}{}
+		}
+		newFailed := map[tc.CacheGroupName]struct{}{}
+		for _, cg := range newResults.FailedLocations(ds) {
+			newFailed[cg] = struct{}{}
+			if _, ok := oldFailed[cg]; ok {
+				continue
+			}
+			desc := fmt.Sprintf("probe failed in cachegroup %s: %s", cg, newResults[ds][cg][0].Error)
+			events.Add(health.Event{Time: health.Time(time.Now()), Description: desc, Name: ds.String(), Hostname: ds.String(), Type: "Delivery Service", Available: false})
+		}
+		for cg := range oldFailed {
+			if _, ok := newFailed[cg]; ok {
+				continue
+			}
+			if _, ok := newResults[ds][cg]; !ok {
+				continue // not probed, because the cachegroup has no available caches
+			}
+			desc := fmt.Sprintf("probe succeeded in cachegroup %s", cg)
+			events.Add(health.Event{Time: health.Time(time.Now()), Description: desc, Name: ds.String(), Hostname: ds.String(), Type: "Delivery Service", Available: true})
+		}
+	}
+}
@@ -26,8 +26,10 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/cache"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsprobe"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/persist"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 )
@@ -36,11 +38,13 @@ import (
 // Note this polls the brief stat endpoint from ATS Astats, not the full stats.
 // This poll should be quicker and less computationally expensive for ATS, but
 // doesn't include all stat data needed for e.g. delivery service calculations.4
+// The health result history is restored from the given history, which may be empty.
 // Returns the last health durations, events, the local cache statuses, and the health result history.
 func StartHealthResultManager(
 	cacheHealthChan <-chan cache.Result,
 	toData todata.TODataThreadsafe,
 	localStates peer.CRStatesThreadsafe,
+	dsProbes dsprobe.ThreadsafeResults,
 	monitorConfig threadsafe.TrafficMonitorConfigMap,
 	combinedStates peer.CRStatesThreadsafe,
 	fetchCount threadsafe.Uint,
@@ -48,13 +52,16 @@ func StartHealthResultManager(
 	cfg config.Config,
 	events health.ThreadsafeEvents,
 	localCacheStatus threadsafe.CacheAvailableStatus,
+	history persist.Snapshot,
 ) (threadsafe.DurationMap, threadsafe.ResultHistory) {
 	lastHealthDurations := threadsafe.NewDurationMap()
 	healthHistory := threadsafe.NewResultHistory()
+	healthHistory.Set(history.ResultHistory())
 	go healthResultManagerListen(
 		cacheHealthChan,
 		toData,
 		localStates,
+		dsProbes,
 		lastHealthDurations,
 		healthHistory,
 		monitorConfig,
@@ -72,6 +79,7 @@ func healthResultManagerListen(
 	cacheHealthChan <-chan cache.Result,
 	toData todata.TODataThreadsafe,
 	localStates peer.CRStatesThreadsafe,
+	dsProbes dsprobe.ThreadsafeResults,
 	lastHealthDurations threadsafe.DurationMap,
 	healthHistory threadsafe.ResultHistory,
 	monitorConfig threadsafe.TrafficMonitorConfigMap,
@@ -91,6 +99,7 @@ func healthResultManagerListen(
 			cacheHealthChan,
 			toData,
 			localStates,
+			dsProbes,
 			lastHealthDurations,
 			monitorConfig,
 			combinedStates,
@@ -137,6 +146,7 @@ func processHealthResult(
 	cacheHealthChan <-chan cache.Result,
 	toData todata.TODataThreadsafe,
 	localStates peer.CRStatesThreadsafe,
+	dsProbes dsprobe.ThreadsafeResults,
 	lastHealthDurationsThreadsafe threadsafe.DurationMap,
 	monitorConfig threadsafe.TrafficMonitorConfigMap,
 	combinedStates peer.CRStatesThreadsafe,
@@ -186,7 +196,7 @@ func processHealthResult(
 
 	pollerName := "health"
 	statResultHistoryNil := (*threadsafe.ResultStatHistory)(nil) // health poller doesn't have stats
-	health.CalcAvailability(results, pollerName, statResultHistoryNil, monitorConfigCopy, toDataCopy, localCacheStatusThreadsafe, localStates, events, cfg.CachePollingProtocol)
+	health.CalcAvailability(results, pollerName, statResultHistoryNil, monitorConfigCopy, toDataCopy, localCacheStatusThreadsafe, localStates, dsProbes, events, cfg.CachePollingProtocol)
 
 	healthHistory.Set(healthHistoryCopy)
 	// TODO determine if we should combineCrStates() here
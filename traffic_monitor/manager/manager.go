@@ -66,7 +66,10 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 	go cacheStatPoller.Poll()
 	go peerPoller.Poll()
 
+	history := loadHistory(cfg)
+
 	events := health.NewThreadsafeEvents(cfg.MaxEvents)
+	events.Restore(history.HealthEvents())
 
 	cachesChanged := make(chan struct{})
 	peerStates := peer.NewCRStatesPeersThreadsafe(cfg.PeerOptimisticQuorumMin) // each peer's last state is saved in this map
@@ -86,7 +89,7 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		toData,
 	)
 
-	combinedStates, combineStateFunc := StartStateCombiner(events, peerStates, localStates, toData)
+	combinedStates, combinedStatesBroadcaster, combineStateFunc := StartStateCombiner(events, peerStates, localStates, toData, cfg)
 
 	StartPeerManager(
 		peerHandler.ResultChannel,
@@ -95,6 +98,8 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		combineStateFunc,
 	)
 
+	dsProbes := StartDSProbes(cfg, appData, toData, monitorConfig, localStates, events)
+
 	statInfoHistory, statResultHistory, statMaxKbpses, _, lastKbpsStats, dsStats, unpolledCaches, localCacheStatus := StartStatHistoryManager(
 		cacheStatHandler.ResultChan(),
 		localStates,
@@ -106,12 +111,15 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		monitorConfig,
 		events,
 		combineStateFunc,
+		history,
+		dsProbes,
 	)
 
 	lastHealthDurations, healthHistory := StartHealthResultManager(
 		cacheHealthHandler.ResultChan(),
 		toData,
 		localStates,
+		dsProbes,
 		monitorConfig,
 		combinedStates,
 		fetchCount,
@@ -119,8 +127,11 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		cfg,
 		events,
 		localCacheStatus,
+		history,
 	)
 
+	StartHistoryPersister(cfg, statResultHistory, statInfoHistory, healthHistory, events)
+
 	StartOpsConfigManager(
 		opsConfigFile,
 		toSession,
@@ -130,12 +141,14 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		localStates,
 		peerStates,
 		combinedStates,
+		combinedStatesBroadcaster,
 		statInfoHistory,
 		statResultHistory,
 		statMaxKbpses,
 		healthHistory,
 		lastKbpsStats,
 		dsStats,
+		dsProbes,
 		events,
 		appData,
 		cacheHealthPoller.Config.Interval,
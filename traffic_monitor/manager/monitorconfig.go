@@ -257,18 +257,22 @@ func monitorConfigListen(
 				continue
 			}
 
-			format := monitorConfig.Profile[srv.Profile].Parameters.HealthPollingFormat
-			if format == "" {
-				format = cache.DefaultStatsType
-				log.Infof("health.polling.format for '%v' is empty, using default '%v'", srv.HostName, format)
-			}
-
 			pollType := monitorConfig.Profile[srv.Profile].Parameters.HealthPollingType
 			if pollType == "" {
 				pollType = poller.DefaultPollerType
 				log.Infof("health.polling.type for '%v' is empty, using default '%v'", srv.HostName, pollType)
 			}
 
+			format := monitorConfig.Profile[srv.Profile].Parameters.HealthPollingFormat
+			if format == "" {
+				format = cache.DefaultStatsType
+				if pollType == poller.PollerTypeGRPCHealth {
+					// the gRPC health poller only produces data the grpc-health format can parse
+					format = poller.PollerTypeGRPCHealth
+				}
+				log.Infof("health.polling.format for '%v' is empty, using default '%v'", srv.HostName, format)
+			}
+
 			pollURL4Str, pollURL6Str := createServerHealthPollURLs(pollURLStr, srv)
 
 			connTimeout := trafficOpsHealthConnectionTimeoutToDuration(monitorConfig.Profile[srv.Profile].Parameters.HealthConnectionTimeout)
@@ -277,16 +281,29 @@ func monitorConfigListen(
 				log.Warnln("profile " + srv.Profile + " health.connection.timeout Parameter is missing or zero, using default " + DefaultHealthConnectionTimeout.String())
 			}
 
-			healthURLs[srv.HostName] = poller.PollConfig{URL: pollURL4Str, URLv6: pollURL6Str, Host: srv.FQDN, Timeout: connTimeout, Format: format, PollType: pollType}
+			prometheusParams := monitorConfig.Profile[srv.Profile].Parameters.TMPrometheusParameters
+
+			monitoredInterfaces := []string{}
+			for _, iface := range srv.Interfaces {
+				if iface.Monitor {
+					monitoredInterfaces = append(monitoredInterfaces, iface.Name)
+				}
+			}
+			monitoredInterfacesStr := strings.Join(monitoredInterfaces, ",")
+
+			healthURLs[srv.HostName] = poller.PollConfig{URL: pollURL4Str, URLv6: pollURL6Str, Host: srv.FQDN, Timeout: connTimeout, Format: format, PollType: pollType, Prometheus: prometheusParams, MonitoredInterfaces: monitoredInterfacesStr}
 
 			statURL4 := createServerStatPollURL(pollURL4Str)
 			statURL6 := createServerStatPollURL(pollURL6Str)
-			statURLs[srv.HostName] = poller.PollConfig{URL: statURL4, URLv6: statURL6, Host: srv.FQDN, Timeout: connTimeout, Format: format, PollType: pollType}
+			statURLs[srv.HostName] = poller.PollConfig{URL: statURL4, URLv6: statURL6, Host: srv.FQDN, Timeout: connTimeout, Format: format, PollType: pollType, Prometheus: prometheusParams, MonitoredInterfaces: monitoredInterfacesStr}
 		}
 
 		peerSet := map[tc.TrafficMonitorName]struct{}{}
+		peerWeights := map[tc.TrafficMonitorName]float64{}
+		selfWeight := cfg.PeerWeight(staticAppData.Hostname, "")
 		for _, srv := range monitorConfig.TrafficMonitor {
 			if srv.HostName == staticAppData.Hostname {
+				selfWeight = cfg.PeerWeight(srv.HostName, srv.Location)
 				continue
 			}
 			if tc.CacheStatusFromString(srv.ServerStatus) != tc.CacheStatusOnline {
@@ -297,6 +314,7 @@ func monitorConfigListen(
 			url6 := fmt.Sprintf("http://[%s]:%d/publish/CrStates?raw", ipv6CIDRStrToAddr(srv.IP6), srv.Port)
 			peerURLs[srv.HostName] = poller.PollConfig{URL: url4, URLv6: url6, Host: srv.FQDN} // TODO determine timeout.
 			peerSet[tc.TrafficMonitorName(srv.HostName)] = struct{}{}
+			peerWeights[tc.TrafficMonitorName(srv.HostName)] = cfg.PeerWeight(srv.HostName, srv.Location)
 		}
 
 		statURLSubscriber <- poller.CachePollerConfig{Urls: statURLs, PollingProtocol: cfg.CachePollingProtocol, Interval: intervals.Stat, NoKeepAlive: intervals.StatNoKeepAlive}
@@ -305,6 +323,7 @@ func monitorConfigListen(
 		toIntervalSubscriber <- intervals.TO
 		peerStates.SetTimeout((intervals.Peer + cfg.HTTPTimeout) * 2)
 		peerStates.SetPeers(peerSet)
+		peerStates.SetWeights(selfWeight, peerWeights)
 
 		for cacheName := range localStates.GetCaches() {
 			if _, exists := monitorConfig.TrafficServer[string(cacheName)]; !exists {
@@ -31,6 +31,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-util"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/datareq"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsprobe"
 	"github.com/apache/trafficcontrol/traffic_monitor/handler"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
@@ -53,12 +54,14 @@ func StartOpsConfigManager(
 	localStates peer.CRStatesThreadsafe,
 	peerStates peer.CRStatesPeersThreadsafe,
 	combinedStates peer.CRStatesThreadsafe,
+	combinedStatesBroadcaster peer.CRStatesBroadcaster,
 	statInfoHistory threadsafe.ResultInfoHistory,
 	statResultHistory threadsafe.ResultStatHistory,
 	statMaxKbpses threadsafe.CacheKbpses,
 	healthHistory threadsafe.ResultHistory,
 	lastStats threadsafe.LastStats,
 	dsStats threadsafe.DSStatsReader,
+	dsProbes dsprobe.ThreadsafeResults,
 	events health.ThreadsafeEvents,
 	staticAppData config.StaticAppData,
 	healthPollInterval time.Duration,
@@ -109,11 +112,13 @@ func StartOpsConfigManager(
 			localStates,
 			peerStates,
 			combinedStates,
+			combinedStatesBroadcaster,
 			statInfoHistory,
 			statResultHistory,
 			statMaxKbpses,
 			healthHistory,
 			dsStats,
+			dsProbes,
 			events,
 			staticAppData,
 			healthPollInterval,
@@ -0,0 +1,80 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"os"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/persist"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// loadHistory loads the history persisted before the last restart, if history
+// persistence is enabled. If it isn't enabled, or the history can't be loaded,
+// an empty history is returned.
+func loadHistory(cfg config.Config) persist.Snapshot {
+	if cfg.HistoryPersistFile == "" {
+		return persist.Snapshot{}
+	}
+	history, err := persist.Load(cfg.HistoryPersistFile, cfg.HistoryPersistRetention)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Infof("history persist file '%s' does not exist, starting with empty history", cfg.HistoryPersistFile)
+		} else {
+			log.Errorf("loading history persist file '%s', starting with empty history: %v", cfg.HistoryPersistFile, err)
+		}
+		return persist.Snapshot{}
+	}
+	log.Infof("loaded history from '%s' saved at %v: %d stat caches, %d health caches, %d events", cfg.HistoryPersistFile, history.Time, len(history.StatHistory), len(history.HealthHistory), len(history.Events))
+	return history
+}
+
+// StartHistoryPersister starts the goroutine which periodically saves the stat
+// and health history and events to the configured history persist file. If no
+// file is configured, it does nothing.
+func StartHistoryPersister(
+	cfg config.Config,
+	statResultHistory threadsafe.ResultStatHistory,
+	statInfoHistory threadsafe.ResultInfoHistory,
+	healthHistory threadsafe.ResultHistory,
+	events health.ThreadsafeEvents,
+) {
+	if cfg.HistoryPersistFile == "" {
+		return
+	}
+	if cfg.HistoryPersistInterval <= 0 {
+		log.Errorf("history_persist_interval_ms must be positive, history will not be persisted")
+		return
+	}
+	go func() {
+		tick := time.NewTicker(cfg.HistoryPersistInterval)
+		defer tick.Stop()
+		for range tick.C {
+			snapshot := persist.NewSnapshot(statResultHistory, statInfoHistory.Get(), healthHistory.Get(), events.Get())
+			if err := persist.Save(cfg.HistoryPersistFile, snapshot); err != nil {
+				log.Errorf("saving history to '%s': %v", cfg.HistoryPersistFile, err)
+			}
+		}
+	}()
+}
@@ -27,14 +27,17 @@ import (
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 )
 
-// StartStateCombiner starts the State Combiner goroutine, and returns the threadsafe CombinedStates, and a func to signal to combine states.
-func StartStateCombiner(events health.ThreadsafeEvents, peerStates peer.CRStatesPeersThreadsafe, localStates peer.CRStatesThreadsafe, toData todata.TODataThreadsafe) (peer.CRStatesThreadsafe, func()) {
+// StartStateCombiner starts the State Combiner goroutine, and returns the threadsafe CombinedStates, a broadcaster of changes to the CombinedStates, and a func to signal to combine states.
+// If the config's PeerMinorityHold is set, the combined states are held, rather than combined, while this Traffic Monitor is in a minority partition.
+func StartStateCombiner(events health.ThreadsafeEvents, peerStates peer.CRStatesPeersThreadsafe, localStates peer.CRStatesThreadsafe, toData todata.TODataThreadsafe, cfg config.Config) (peer.CRStatesThreadsafe, peer.CRStatesBroadcaster, func()) {
 	combinedStates := peer.NewCRStatesThreadsafe()
+	combinedStatesBroadcaster := peer.NewCRStatesBroadcaster()
 
 	// the chan buffer just reduces the number of goroutines on our infinite buffer hack in combineState(), no real writer will block, since combineState() writes in a goroutine.
 	combineStateChan := make(chan struct{}, 5)
@@ -56,13 +59,40 @@ func StartStateCombiner(events health.ThreadsafeEvents, peerStates peer.CRStates
 
 	go func() {
 		overrideMap := map[tc.CacheName]bool{}
+		combined := false // there's no last-known state to hold until states have been combined once
 		for range combineStateChan {
 			drain(combineStateChan)
-			combineCrStates(events, true, peerStates, localStates.Get(), combinedStates, overrideMap, toData.Get())
+			if holdMinorityPartition(events, cfg.PeerMinorityHold && combined, peerStates) {
+				continue
+			}
+			combineCrStates(events, true, cfg.PeerOptimisticWeightMin, peerStates, localStates.Get(), combinedStates, overrideMap, toData.Get())
+			combined = true
+			combinedStatesBroadcaster.Publish(combinedStates.Get())
 		}
 	}()
 
-	return combinedStates, combineState
+	return combinedStates, combinedStatesBroadcaster, combineState
+}
+
+// PeerQuorumEventName is the name of the events added when the peer quorum is lost or regained.
+const PeerQuorumEventName = "peer-quorum"
+
+// holdMinorityPartition returns whether the combined states should be held, because this Traffic Monitor is in a minority partition and enabled is true. It adds an event whenever holding starts or stops.
+func holdMinorityPartition(events health.ThreadsafeEvents, enabled bool, peerStates peer.CRStatesPeersThreadsafe) bool {
+	quorum := peerStates.GetQuorum()
+	hold := enabled && quorum.Minority()
+	if hold == quorum.Holding {
+		return hold
+	}
+	peerStates.SetHolding(hold)
+
+	description := fmt.Sprintf("Peer quorum regained (reachable weight %.2f of %.2f); combining states", quorum.ReachableWeight, quorum.TotalWeight)
+	if hold {
+		description = fmt.Sprintf("Peer quorum lost, in minority partition (reachable weight %.2f of %.2f); holding last-known states", quorum.ReachableWeight, quorum.TotalWeight)
+	}
+	log.Warnln(description)
+	events.Add(health.Event{Time: health.Time(time.Now()), Description: description, Name: PeerQuorumEventName, Hostname: PeerQuorumEventName, Type: "PEER", Available: !hold})
+	return hold
 }
 
 func combineCacheState(
@@ -70,6 +100,7 @@ func combineCacheState(
 	localCacheState tc.IsAvailable,
 	events health.ThreadsafeEvents,
 	peerOptimistic bool,
+	peerOptimisticWeightMin float64,
 	peerStates peer.CRStatesPeersThreadsafe,
 	combinedStates peer.CRStatesThreadsafe,
 	overrideMap map[tc.CacheName]bool,
@@ -98,11 +129,13 @@ func combineCacheState(
 			onlineOnPeers := make([]string, 0)
 			ipv4OnlineOnPeers := make([]string, 0)
 			ipv6OnlineOnPeers := make([]string, 0)
+			onlineWeight := 0.0
 
 			for peer, peerCrStates := range peerStates.GetCrstates() {
 				if peerStates.GetPeerAvailability(peer) {
 					if peerCrStates.Caches[cacheName].IsAvailable {
 						onlineOnPeers = append(onlineOnPeers, peer.String())
+						onlineWeight += peerStates.GetPeerWeight(peer)
 					}
 					if peerCrStates.Caches[cacheName].Ipv4Available {
 						ipv4OnlineOnPeers = append(ipv4OnlineOnPeers, peer.String())
@@ -113,7 +146,7 @@ func combineCacheState(
 				}
 			}
 
-			if len(onlineOnPeers) > 0 {
+			if len(onlineOnPeers) > 0 && onlineWeight >= peerOptimisticWeightMin {
 				available = true
 				ipv4Available = ipv4Available || len(ipv4OnlineOnPeers) > 0 // optimistically accept true from local or peer
 				ipv6Available = ipv6Available || len(ipv6OnlineOnPeers) > 0 // optimistically accept true from local or peer
@@ -199,9 +232,9 @@ func pruneCombinedCaches(combinedStates peer.CRStatesThreadsafe, localStates tc.
 	}
 }
 
-func combineCrStates(events health.ThreadsafeEvents, peerOptimistic bool, peerStates peer.CRStatesPeersThreadsafe, localStates tc.CRStates, combinedStates peer.CRStatesThreadsafe, overrideMap map[tc.CacheName]bool, toData todata.TOData) {
+func combineCrStates(events health.ThreadsafeEvents, peerOptimistic bool, peerOptimisticWeightMin float64, peerStates peer.CRStatesPeersThreadsafe, localStates tc.CRStates, combinedStates peer.CRStatesThreadsafe, overrideMap map[tc.CacheName]bool, toData todata.TOData) {
 	for cacheName, localCacheState := range localStates.Caches { // localStates gets pruned when servers are disabled, it's the source of truth
-		combineCacheState(cacheName, localCacheState, events, peerOptimistic, peerStates, combinedStates, overrideMap, toData)
+		combineCacheState(cacheName, localCacheState, events, peerOptimistic, peerOptimisticWeightMin, peerStates, combinedStates, overrideMap, toData)
 	}
 
 	for deliveryServiceName, localDeliveryService := range localStates.DeliveryService {
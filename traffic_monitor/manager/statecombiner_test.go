@@ -87,7 +87,7 @@ func TestCombineCacheState(t *testing.T) {
 	}
 
 	for _, localCacheState := range localCacheStates {
-		combineCacheState(cacheName, localCacheState, events, peerOptimistic, peerStates, combinedStates, overrideMap, toData)
+		combineCacheState(cacheName, localCacheState, events, peerOptimistic, 0, peerStates, combinedStates, overrideMap, toData)
 
 		if !combinedStates.Get().Caches[cacheName].IsAvailable {
 			t.Fatalf("cache is unavailable and should be available")
@@ -142,7 +142,7 @@ func TestCombineCacheStateCacheDown(t *testing.T) {
 		cacheName: tc.CacheTypeEdge,
 	}
 
-	combineCacheState(cacheName, localCacheState, events, peerOptimistic, peerStates, combinedStates, overrideMap, toData)
+	combineCacheState(cacheName, localCacheState, events, peerOptimistic, 0, peerStates, combinedStates, overrideMap, toData)
 
 	if !combinedStates.Get().Caches[cacheName].IsAvailable {
 		t.Fatalf("cache is unavailable and should be available")
@@ -154,3 +154,73 @@ func TestCombineCacheStateCacheDown(t *testing.T) {
 		t.Fatalf("cache IPv6 is unavailable and should be available")
 	}
 }
+
+func TestCombineCacheStatePeerWeightMin(t *testing.T) {
+	cacheName := tc.CacheName("testCache")
+	localCacheState := tc.IsAvailable{}
+
+	events := health.NewThreadsafeEvents(1)
+	peerStates := peer.NewCRStatesPeersThreadsafe(1)
+	peerStates.SetTimeout(time.Hour)
+	peerStates.Set(peer.Result{
+		ID:        tc.TrafficMonitorName("TestTM-01"),
+		Available: true,
+		PeerStates: tc.CRStates{
+			Caches: map[tc.CacheName]tc.IsAvailable{
+				cacheName: tc.IsAvailable{IsAvailable: true, Ipv4Available: true, Ipv6Available: true},
+			},
+		},
+		Time: time.Now(),
+	})
+	peerStates.SetPeers(map[tc.TrafficMonitorName]struct{}{tc.TrafficMonitorName("TestTM-01"): struct{}{}})
+	peerStates.SetWeights(1, map[tc.TrafficMonitorName]float64{tc.TrafficMonitorName("TestTM-01"): 0.5})
+
+	combinedStates := peer.NewCRStatesThreadsafe()
+	overrideMap := map[tc.CacheName]bool{}
+	toData := todata.TOData{ServerTypes: map[tc.CacheName]tc.CacheType{cacheName: tc.CacheTypeEdge}}
+
+	combineCacheState(cacheName, localCacheState, events, true, 1, peerStates, combinedStates, overrideMap, toData)
+	if combinedStates.Get().Caches[cacheName].IsAvailable {
+		t.Error("cache is available and should be unavailable, with peer weight below the minimum")
+	}
+
+	combineCacheState(cacheName, localCacheState, events, true, 0.5, peerStates, combinedStates, overrideMap, toData)
+	if !combinedStates.Get().Caches[cacheName].IsAvailable {
+		t.Error("cache is unavailable and should be available, with peer weight at the minimum")
+	}
+}
+
+func TestHoldMinorityPartition(t *testing.T) {
+	events := health.NewThreadsafeEvents(10)
+	peerStates := peer.NewCRStatesPeersThreadsafe(0)
+	peerStates.SetTimeout(time.Hour)
+	peerSet := map[tc.TrafficMonitorName]struct{}{}
+	for _, name := range []tc.TrafficMonitorName{"TestTM-01", "TestTM-02"} {
+		peerStates.Set(peer.Result{ID: name, Available: false, Time: time.Now()})
+		peerSet[name] = struct{}{}
+	}
+	peerStates.SetPeers(peerSet)
+
+	if holdMinorityPartition(events, false, peerStates) {
+		t.Error("expected no hold when minority hold is disabled")
+	}
+	if !holdMinorityPartition(events, true, peerStates) {
+		t.Fatal("expected a hold with all peers unreachable")
+	}
+	if !peerStates.GetQuorum().Holding {
+		t.Error("expected the quorum to be holding")
+	}
+
+	peerStates.Set(peer.Result{ID: "TestTM-01", Available: true, Time: time.Now()})
+	if holdMinorityPartition(events, true, peerStates) {
+		t.Error("expected no hold with half the weight reachable")
+	}
+
+	evts := events.Get()
+	if len(evts) != 2 {
+		t.Fatalf("expected 2 events, for losing and regaining the quorum, got %d", len(evts))
+	}
+	if !evts[0].Available || evts[1].Available || evts[0].Name != PeerQuorumEventName {
+		t.Errorf("expected quorum lost then regained events, got %+v", evts)
+	}
+}
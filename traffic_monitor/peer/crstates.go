@@ -124,6 +124,9 @@ type CRStatesPeersThreadsafe struct {
 	peerCount  *int
 	quorumMin  *int
 	timeout    *time.Duration
+	weights    map[tc.TrafficMonitorName]float64
+	selfWeight *float64
+	holding    *bool
 	m          *sync.RWMutex
 }
 
@@ -131,6 +134,8 @@ type CRStatesPeersThreadsafe struct {
 func NewCRStatesPeersThreadsafe(quorumMin int) CRStatesPeersThreadsafe {
 	count := 0
 	timeout := time.Hour // default to a large timeout
+	selfWeight := 1.0
+	holding := false
 	return CRStatesPeersThreadsafe{
 		m:          &sync.RWMutex{},
 		timeout:    &timeout,
@@ -140,6 +145,9 @@ func NewCRStatesPeersThreadsafe(quorumMin int) CRStatesPeersThreadsafe {
 		peerTimes:  map[tc.TrafficMonitorName]time.Time{},
 		peerCount:  &count,
 		quorumMin:  &quorumMin,
+		weights:    map[tc.TrafficMonitorName]float64{},
+		selfWeight: &selfWeight,
+		holding:    &holding,
 	}
 }
 
@@ -167,6 +175,72 @@ func (t *CRStatesPeersThreadsafe) SetPeers(newPeers map[tc.TrafficMonitorName]st
 	*t.peerCount = peerCount
 }
 
+// SetWeights sets the weights of the votes of this Traffic Monitor and its peers in the peer quorum. Peers not in the given map have a weight of 1.
+func (t *CRStatesPeersThreadsafe) SetWeights(selfWeight float64, weights map[tc.TrafficMonitorName]float64) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	*t.selfWeight = selfWeight
+	for peer := range t.weights {
+		delete(t.weights, peer)
+	}
+	for peer, weight := range weights {
+		t.weights[peer] = weight
+	}
+}
+
+// GetPeerWeight returns the weight of the given peer's vote in the peer quorum.
+func (t *CRStatesPeersThreadsafe) GetPeerWeight(peer tc.TrafficMonitorName) float64 {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return t.peerWeight(peer)
+}
+
+// peerWeight is a private function to get the weight of a peer; callers must lock t
+func (t *CRStatesPeersThreadsafe) peerWeight(peer tc.TrafficMonitorName) float64 {
+	if weight, ok := t.weights[peer]; ok {
+		return weight
+	}
+	return 1
+}
+
+// SetHolding sets whether the combined states are being held, because this Traffic Monitor is in a minority partition. This MUST NOT be called by multiple goroutines.
+func (t *CRStatesPeersThreadsafe) SetHolding(holding bool) {
+	t.m.Lock()
+	*t.holding = holding
+	t.m.Unlock()
+}
+
+// GetQuorum returns the current weighted vote of this Traffic Monitor's peers on whether it is reachable.
+func (t *CRStatesPeersThreadsafe) GetQuorum() Quorum {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	quorum := Quorum{
+		SelfWeight:      *t.selfWeight,
+		ReachableWeight: *t.selfWeight,
+		TotalWeight:     *t.selfWeight,
+		Holding:         *t.holding,
+		Peers:           make(map[tc.TrafficMonitorName]PeerVote, len(t.peerOnline)),
+	}
+	for peer, online := range t.peerOnline {
+		vote := PeerVote{
+			Weight:    t.peerWeight(peer),
+			Online:    online,
+			Available: t.peerStates[peer] && online && time.Since(t.peerTimes[peer]) < *t.timeout,
+		}
+		quorum.Peers[peer] = vote
+		if !online {
+			continue
+		}
+		quorum.PeerCount++
+		quorum.TotalWeight += vote.Weight
+		if vote.Available {
+			quorum.ReachableWeight += vote.Weight
+		}
+	}
+	return quorum
+}
+
 // GetCrstates returns the internal Traffic Monitor peer Crstates data. This MUST NOT be modified.
 func (t *CRStatesPeersThreadsafe) GetCrstates() map[tc.TrafficMonitorName]tc.CRStates {
 	t.m.RLock()
@@ -0,0 +1,188 @@
+package peer
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"sync"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// CRStatesSubscriberBuffer is the number of deltas which may be queued for a
+// single subscriber. A subscriber which falls further behind than this is
+// disconnected, and must re-subscribe to get a new snapshot.
+const CRStatesSubscriberBuffer = 64
+
+// CRStatesDelta is the set of changes between two CRStates. Caches and
+// delivery services which were added or whose availability changed are in
+// Caches and DeliveryService; those which were removed are in RemovedCaches
+// and RemovedDeliveryServices.
+type CRStatesDelta struct {
+	Caches                  map[tc.CacheName]tc.IsAvailable                       `json:"caches"`
+	DeliveryService         map[tc.DeliveryServiceName]tc.CRStatesDeliveryService `json:"deliveryServices"`
+	RemovedCaches           []tc.CacheName                                        `json:"removedCaches,omitempty"`
+	RemovedDeliveryServices []tc.DeliveryServiceName                              `json:"removedDeliveryServices,omitempty"`
+}
+
+// Empty returns whether the delta contains no changes.
+func (d CRStatesDelta) Empty() bool {
+	return len(d.Caches) == 0 && len(d.DeliveryService) == 0 && len(d.RemovedCaches) == 0 && len(d.RemovedDeliveryServices) == 0
+}
+
+// NewCRStatesDelta returns the changes needed to turn the old CRStates into the
+// new CRStates.
+func NewCRStatesDelta(old tc.CRStates, new tc.CRStates) CRStatesDelta {
+	delta := CRStatesDelta{
+		Caches:          map[tc.CacheName]tc.IsAvailable{},
+		DeliveryService: map[tc.DeliveryServiceName]tc.CRStatesDeliveryService{},
+	}
+	for name, newCache := range new.Caches {
+		if oldCache, ok := old.Caches[name]; !ok || oldCache != newCache {
+			delta.Caches[name] = newCache
+		}
+	}
+	for name := range old.Caches {
+		if _, ok := new.Caches[name]; !ok {
+			delta.RemovedCaches = append(delta.RemovedCaches, name)
+		}
+	}
+	for name, newDS := range new.DeliveryService {
+		if oldDS, ok := old.DeliveryService[name]; !ok || !crStatesDeliveryServiceEqual(oldDS, newDS) {
+			delta.DeliveryService[name] = newDS
+		}
+	}
+	for name := range old.DeliveryService {
+		if _, ok := new.DeliveryService[name]; !ok {
+			delta.RemovedDeliveryServices = append(delta.RemovedDeliveryServices, name)
+		}
+	}
+	return delta
+}
+
+// ApplyCRStatesDelta returns a copy of the given CRStates, with the given delta
+// applied.
+func ApplyCRStatesDelta(states tc.CRStates, delta CRStatesDelta) tc.CRStates {
+	states = states.Copy()
+	for name, cache := range delta.Caches {
+		states.Caches[name] = cache
+	}
+	for _, name := range delta.RemovedCaches {
+		delete(states.Caches, name)
+	}
+	for name, ds := range delta.DeliveryService {
+		states.DeliveryService[name] = ds
+	}
+	for _, name := range delta.RemovedDeliveryServices {
+		delete(states.DeliveryService, name)
+	}
+	return states
+}
+
+func crStatesDeliveryServiceEqual(a tc.CRStatesDeliveryService, b tc.CRStatesDeliveryService) bool {
+	if a.IsAvailable != b.IsAvailable || len(a.DisabledLocations) != len(b.DisabledLocations) {
+		return false
+	}
+	locations := make(map[tc.CacheGroupName]struct{}, len(a.DisabledLocations))
+	for _, cg := range a.DisabledLocations {
+		locations[cg] = struct{}{}
+	}
+	for _, cg := range b.DisabledLocations {
+		if _, ok := locations[cg]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// CRStatesBroadcaster sends the changes in a CRStates object to any number of
+// subscribers, as they happen. It is safe for multiple goroutines.
+type CRStatesBroadcaster struct {
+	last        *tc.CRStates
+	subscribers map[uint64]chan CRStatesDelta
+	nextID      *uint64
+	m           *sync.Mutex
+}
+
+// NewCRStatesBroadcaster creates a new CRStatesBroadcaster with no subscribers.
+func NewCRStatesBroadcaster() CRStatesBroadcaster {
+	crs := tc.NewCRStates()
+	nextID := uint64(0)
+	return CRStatesBroadcaster{
+		last:        &crs,
+		subscribers: map[uint64]chan CRStatesDelta{},
+		nextID:      &nextID,
+		m:           &sync.Mutex{},
+	}
+}
+
+// Publish sends the changes between the given CRStates and the previously
+// published CRStates to all subscribers. If nothing changed, nothing is sent.
+//
+// Publish never blocks on a subscriber. A subscriber whose buffer is full is
+// removed and its channel closed, because a subscriber which has missed a delta
+// no longer has an accurate view of the states.
+func (b CRStatesBroadcaster) Publish(states tc.CRStates) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	delta := NewCRStatesDelta(*b.last, states)
+	*b.last = states
+	if delta.Empty() {
+		return
+	}
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- delta:
+		default:
+			log.Warnf("CRStates subscriber %d fell behind by more than %d changes, disconnecting", id, CRStatesSubscriberBuffer)
+			delete(b.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a snapshot of the last published CRStates, a channel on
+// which every subsequent delta will be sent, and a func to unsubscribe. The
+// unsubscribe func must be called when the caller is done reading, and is safe
+// to call after the channel has been closed by the broadcaster.
+func (b CRStatesBroadcaster) Subscribe() (tc.CRStates, <-chan CRStatesDelta, func()) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	id := *b.nextID
+	*b.nextID++
+	ch := make(chan CRStatesDelta, CRStatesSubscriberBuffer)
+	b.subscribers[id] = ch
+	unsubscribe := func() {
+		b.m.Lock()
+		defer b.m.Unlock()
+		if _, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(ch)
+		}
+	}
+	return b.last.Copy(), ch, unsubscribe
+}
+
+// SubscriberCount returns the number of current subscribers.
+func (b CRStatesBroadcaster) SubscriberCount() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return len(b.subscribers)
+}
@@ -0,0 +1,131 @@
+package peer
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestCRStatesDelta(t *testing.T) {
+	old := tc.NewCRStates()
+	old.Caches["unchanged"] = tc.IsAvailable{IsAvailable: true, Ipv4Available: true}
+	old.Caches["changed"] = tc.IsAvailable{IsAvailable: true, Ipv4Available: true}
+	old.Caches["removed"] = tc.IsAvailable{}
+	old.DeliveryService["ds-unchanged"] = tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{"a", "b"}}
+	old.DeliveryService["ds-changed"] = tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{}}
+
+	new := tc.NewCRStates()
+	new.Caches["unchanged"] = tc.IsAvailable{IsAvailable: true, Ipv4Available: true}
+	new.Caches["changed"] = tc.IsAvailable{IsAvailable: true, Ipv6Available: true}
+	new.Caches["added"] = tc.IsAvailable{}
+	new.DeliveryService["ds-unchanged"] = tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{"b", "a"}}
+	new.DeliveryService["ds-changed"] = tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{"a"}}
+
+	delta := NewCRStatesDelta(old, new)
+
+	expectedCaches := map[tc.CacheName]tc.IsAvailable{
+		"changed": new.Caches["changed"],
+		"added":   new.Caches["added"],
+	}
+	if !reflect.DeepEqual(delta.Caches, expectedCaches) {
+		t.Errorf("expected delta caches %+v, actual %+v", expectedCaches, delta.Caches)
+	}
+	if !reflect.DeepEqual(delta.RemovedCaches, []tc.CacheName{"removed"}) {
+		t.Errorf("expected removed caches [removed], actual %+v", delta.RemovedCaches)
+	}
+	if _, ok := delta.DeliveryService["ds-unchanged"]; ok {
+		t.Errorf("expected reordered disabled locations not to be a change, actual %+v", delta.DeliveryService)
+	}
+	if _, ok := delta.DeliveryService["ds-changed"]; !ok {
+		t.Errorf("expected changed disabled locations to be a change, actual %+v", delta.DeliveryService)
+	}
+
+	applied := ApplyCRStatesDelta(old, delta)
+	if !reflect.DeepEqual(applied.Caches, new.Caches) {
+		t.Errorf("expected applied delta caches %+v, actual %+v", new.Caches, applied.Caches)
+	}
+	if len(old.Caches) != 3 {
+		t.Errorf("expected applying a delta not to modify the original, actual %+v", old.Caches)
+	}
+}
+
+func TestCRStatesBroadcaster(t *testing.T) {
+	b := NewCRStatesBroadcaster()
+
+	states := tc.NewCRStates()
+	states.Caches["cache0"] = tc.IsAvailable{IsAvailable: true}
+	b.Publish(states)
+
+	snapshot, deltas, unsubscribe := b.Subscribe()
+	if !reflect.DeepEqual(snapshot, states) {
+		t.Errorf("expected snapshot %+v, actual %+v", states, snapshot)
+	}
+
+	b.Publish(states)
+	select {
+	case delta := <-deltas:
+		t.Errorf("expected no delta for unchanged states, actual %+v", delta)
+	default:
+	}
+
+	changed := states.Copy()
+	changed.Caches["cache0"] = tc.IsAvailable{}
+	b.Publish(changed)
+	select {
+	case delta := <-deltas:
+		if len(delta.Caches) != 1 || delta.Caches["cache0"].IsAvailable {
+			t.Errorf("expected delta marking cache0 unavailable, actual %+v", delta)
+		}
+	default:
+		t.Error("expected delta for changed states, actual none")
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-deltas; ok {
+		t.Error("expected channel to be closed after unsubscribing")
+	}
+	if count := b.SubscriberCount(); count != 0 {
+		t.Errorf("expected 0 subscribers after unsubscribing, actual %d", count)
+	}
+}
+
+func TestCRStatesBroadcasterSlowSubscriber(t *testing.T) {
+	b := NewCRStatesBroadcaster()
+	_, deltas, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i <= CRStatesSubscriberBuffer; i++ {
+		states := tc.NewCRStates()
+		states.Caches["cache0"] = tc.IsAvailable{IsAvailable: i%2 == 0}
+		b.Publish(states)
+	}
+
+	received := 0
+	for range deltas {
+		received++
+	}
+	if received != CRStatesSubscriberBuffer {
+		t.Errorf("expected slow subscriber to receive %d deltas before being disconnected, actual %d", CRStatesSubscriberBuffer, received)
+	}
+}
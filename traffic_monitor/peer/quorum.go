@@ -0,0 +1,66 @@
+package peer
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// Quorum is the weighted vote of a Traffic Monitor's peers on whether it is
+// reachable, which is used to detect when the Traffic Monitor is on the
+// minority side of a network partition.
+type Quorum struct {
+	// SelfWeight is the weight of this Traffic Monitor's own vote, which is
+	// always counted as reachable.
+	SelfWeight float64
+	// ReachableWeight is the total weight of this Traffic Monitor and its
+	// ONLINE peers which are reachable.
+	ReachableWeight float64
+	// TotalWeight is the total weight of this Traffic Monitor and all of its
+	// ONLINE peers.
+	TotalWeight float64
+	// PeerCount is the number of ONLINE peers.
+	PeerCount int
+	// Holding is whether the combined states are being held because of a
+	// minority partition.
+	Holding bool
+	// Peers are the votes of each peer.
+	Peers map[tc.TrafficMonitorName]PeerVote
+}
+
+// PeerVote is a single peer's vote in the Quorum.
+type PeerVote struct {
+	Weight float64
+	// Online is whether the peer is ONLINE in Traffic Ops. Only ONLINE peers
+	// vote.
+	Online bool
+	// Available is whether the peer is reachable.
+	Available bool
+}
+
+// Minority returns whether this Traffic Monitor is on the minority side of a
+// partition, i.e. whether less than half the total weight is reachable.
+//
+// As with the optimistic quorum, at least two peers are required; with only a
+// single peer, neither Traffic Monitor could tell which of them was
+// unreachable.
+func (q Quorum) Minority() bool {
+	return q.PeerCount > 1 && q.ReachableWeight*2 < q.TotalWeight
+}
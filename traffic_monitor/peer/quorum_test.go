@@ -0,0 +1,60 @@
+package peer
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestQuorum(t *testing.T) {
+	peerStates := NewCRStatesPeersThreadsafe(0)
+	for _, name := range []tc.TrafficMonitorName{"tm-local-2", "tm-remote-1", "tm-remote-2"} {
+		peerStates.Set(Result{ID: name, Available: name == "tm-local-2", Time: time.Now()})
+	}
+	peerStates.SetPeers(map[tc.TrafficMonitorName]struct{}{"tm-local-2": {}, "tm-remote-1": {}, "tm-remote-2": {}})
+
+	quorum := peerStates.GetQuorum()
+	if quorum.PeerCount != 3 {
+		t.Errorf("expected 3 peers, got %d", quorum.PeerCount)
+	}
+	if quorum.ReachableWeight != 2 || quorum.TotalWeight != 4 {
+		t.Errorf("expected reachable weight 2 of 4, got %v of %v", quorum.ReachableWeight, quorum.TotalWeight)
+	}
+	if quorum.Minority() {
+		t.Error("expected half the weight reachable not to be a minority")
+	}
+
+	peerStates.SetWeights(1, map[tc.TrafficMonitorName]float64{"tm-remote-1": 2})
+	quorum = peerStates.GetQuorum()
+	if !quorum.Minority() {
+		t.Errorf("expected reachable weight %v of %v to be a minority", quorum.ReachableWeight, quorum.TotalWeight)
+	}
+	if vote := quorum.Peers["tm-remote-1"]; vote.Weight != 2 || !vote.Online || vote.Available {
+		t.Errorf("expected tm-remote-1 to be online and unreachable with weight 2, got %+v", vote)
+	}
+
+	peerStates.SetPeers(map[tc.TrafficMonitorName]struct{}{"tm-local-2": {}})
+	if peerStates.GetQuorum().Minority() {
+		t.Error("expected a single online peer never to be a minority")
+	}
+}
@@ -0,0 +1,418 @@
+// Package persist saves Traffic Monitor's stat history, health history, and
+// events to disk, so that they survive a restart.
+//
+// The history is written as a single snapshot file, which is replaced
+// atomically each time it's saved. The size of the snapshot is bounded by the
+// same limits as the in-memory history it's made from, i.e. the history count
+// of each cache server's Profile, and the max_events configuration.
+package persist
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// SnapshotVersion is the version of the snapshot file format. Snapshots with
+// a different version are not loaded.
+const SnapshotVersion = 1
+
+// Snapshot is the history of a Traffic Monitor, as persisted to disk.
+type Snapshot struct {
+	Version uint64
+	// Time is when the snapshot was taken.
+	Time time.Time
+	// StatHistory is the history of each cache server's stats, keyed by cache
+	// server name.
+	StatHistory map[string]CacheStatHistory
+	// StatInfo is the history of each cache server's stat poll results.
+	StatInfo map[tc.CacheName][]ResultInfo
+	// HealthHistory is the history of each cache server's health poll results.
+	HealthHistory map[tc.CacheName][]ResultInfo
+	// Events are the events, newest first.
+	Events []Event
+}
+
+// CacheStatHistory is the persisted form of a threadsafe.CacheStatHistory.
+type CacheStatHistory struct {
+	Stats      map[string][]tc.ResultStatVal
+	Interfaces map[string]map[string][]tc.ResultStatVal
+}
+
+// ResultInfo is the persisted form of a cache.ResultInfo. The error is stored
+// as its message, because errors themselves can't be encoded.
+type ResultInfo struct {
+	Available       bool
+	Error           string
+	ID              string
+	PollID          uint64
+	RequestTime     time.Duration
+	Statistics      cache.Statistics
+	Time            time.Time
+	UsingIPv4       bool
+	Vitals          cache.Vitals
+	InterfaceVitals map[string]cache.Vitals
+}
+
+// Event is the persisted form of a health.Event.
+type Event struct {
+	Time          time.Time
+	Index         uint64
+	Description   string
+	Name          string
+	Hostname      string
+	Type          string
+	Available     bool
+	IPv4Available bool
+	IPv6Available bool
+	Dampened      bool
+}
+
+// NewSnapshot creates a snapshot of the given history.
+func NewSnapshot(
+	statResultHistory threadsafe.ResultStatHistory,
+	statInfoHistory cache.ResultInfoHistory,
+	healthHistory cache.ResultHistory,
+	events []health.Event,
+) Snapshot {
+	s := Snapshot{
+		Version:       SnapshotVersion,
+		Time:          time.Now(),
+		StatHistory:   map[string]CacheStatHistory{},
+		StatInfo:      map[tc.CacheName][]ResultInfo{},
+		HealthHistory: map[tc.CacheName][]ResultInfo{},
+		Events:        make([]Event, 0, len(events)),
+	}
+
+	statResultHistory.Range(func(cacheName string, val threadsafe.CacheStatHistory) bool {
+		h := CacheStatHistory{
+			Stats:      copyStatValHistory(val.Stats),
+			Interfaces: make(map[string]map[string][]tc.ResultStatVal, len(val.Interfaces)),
+		}
+		for name, ifaceHistory := range val.Interfaces {
+			h.Interfaces[name] = copyStatValHistory(ifaceHistory)
+		}
+		s.StatHistory[cacheName] = h
+		return true
+	})
+
+	for cacheName, infos := range statInfoHistory {
+		s.StatInfo[cacheName] = newResultInfos(infos)
+	}
+
+	for cacheName, results := range healthHistory {
+		infos := make([]cache.ResultInfo, 0, len(results))
+		for _, result := range results {
+			infos = append(infos, cache.ToInfo(result))
+		}
+		s.HealthHistory[cacheName] = newResultInfos(infos)
+	}
+
+	for _, e := range events {
+		s.Events = append(s.Events, Event{
+			Time:          time.Time(e.Time),
+			Index:         e.Index,
+			Description:   e.Description,
+			Name:          e.Name,
+			Hostname:      e.Hostname,
+			Type:          e.Type,
+			Available:     e.Available,
+			IPv4Available: e.IPv4Available,
+			IPv6Available: e.IPv6Available,
+			Dampened:      e.Dampened,
+		})
+	}
+	return s
+}
+
+// copyStatValHistory copies the given history, omitting any values whose
+// types can't be persisted. In practice, the history only contains primitive
+// values, because newer values are compared to older ones.
+func copyStatValHistory(h threadsafe.ResultStatValHistory) map[string][]tc.ResultStatVal {
+	m := map[string][]tc.ResultStatVal{}
+	h.Range(func(stat string, vals []tc.ResultStatVal) bool {
+		copied := make([]tc.ResultStatVal, 0, len(vals))
+		for _, val := range vals {
+			switch val.Val.(type) {
+			case bool, float64, int64, string, uint64:
+				copied = append(copied, val)
+			}
+		}
+		m[stat] = copied
+		return true
+	})
+	return m
+}
+
+func newResultInfos(infos []cache.ResultInfo) []ResultInfo {
+	persisted := make([]ResultInfo, 0, len(infos))
+	for _, info := range infos {
+		errStr := ""
+		if info.Error != nil {
+			errStr = info.Error.Error()
+		}
+		persisted = append(persisted, ResultInfo{
+			Available:       info.Available,
+			Error:           errStr,
+			ID:              info.ID,
+			PollID:          info.PollID,
+			RequestTime:     info.RequestTime,
+			Statistics:      info.Statistics,
+			Time:            info.Time,
+			UsingIPv4:       info.UsingIPv4,
+			Vitals:          info.Vitals,
+			InterfaceVitals: info.InterfaceVitals,
+		})
+	}
+	return persisted
+}
+
+func (r ResultInfo) toInfo() cache.ResultInfo {
+	var err error
+	if r.Error != "" {
+		err = errors.New(r.Error)
+	}
+	return cache.ResultInfo{
+		Available:       r.Available,
+		Error:           err,
+		ID:              r.ID,
+		PollID:          r.PollID,
+		RequestTime:     r.RequestTime,
+		Statistics:      r.Statistics,
+		Time:            r.Time,
+		UsingIPv4:       r.UsingIPv4,
+		Vitals:          r.Vitals,
+		InterfaceVitals: r.InterfaceVitals,
+	}
+}
+
+func (r ResultInfo) toResult() cache.Result {
+	info := r.toInfo()
+	return cache.Result{
+		Available:       info.Available,
+		Error:           info.Error,
+		ID:              info.ID,
+		PollID:          info.PollID,
+		RequestTime:     info.RequestTime,
+		Statistics:      info.Statistics,
+		Time:            info.Time,
+		UsingIPv4:       info.UsingIPv4,
+		Vitals:          info.Vitals,
+		InterfaceVitals: info.InterfaceVitals,
+	}
+}
+
+// ResultStatHistory returns the snapshot's stat history.
+func (s Snapshot) ResultStatHistory() threadsafe.ResultStatHistory {
+	h := threadsafe.NewResultStatHistory()
+	for cacheName, persisted := range s.StatHistory {
+		cacheHistory := h.LoadOrStore(cacheName)
+		for stat, vals := range persisted.Stats {
+			cacheHistory.Stats.Store(stat, vals)
+		}
+		for name, ifaceHistory := range persisted.Interfaces {
+			valHistory := threadsafe.NewResultStatValHistory()
+			for stat, vals := range ifaceHistory {
+				valHistory.Store(stat, vals)
+			}
+			cacheHistory.Interfaces[name] = valHistory
+		}
+	}
+	return h
+}
+
+// ResultInfoHistory returns the snapshot's stat poll result history.
+func (s Snapshot) ResultInfoHistory() cache.ResultInfoHistory {
+	h := cache.ResultInfoHistory{}
+	for cacheName, persisted := range s.StatInfo {
+		infos := make([]cache.ResultInfo, 0, len(persisted))
+		for _, info := range persisted {
+			infos = append(infos, info.toInfo())
+		}
+		h[cacheName] = infos
+	}
+	return h
+}
+
+// LastStatResults returns the latest stat poll result of each cache server,
+// from which the rates of the next poll can be calculated.
+func (s Snapshot) LastStatResults() map[tc.CacheName]cache.Result {
+	results := map[tc.CacheName]cache.Result{}
+	for cacheName, persisted := range s.StatInfo {
+		if len(persisted) > 0 {
+			results[cacheName] = persisted[0].toResult()
+		}
+	}
+	return results
+}
+
+// ResultHistory returns the snapshot's health poll result history.
+func (s Snapshot) ResultHistory() cache.ResultHistory {
+	h := cache.ResultHistory{}
+	for cacheName, persisted := range s.HealthHistory {
+		results := make([]cache.Result, 0, len(persisted))
+		for _, info := range persisted {
+			results = append(results, info.toResult())
+		}
+		h[cacheName] = results
+	}
+	return h
+}
+
+// HealthEvents returns the snapshot's events, newest first.
+func (s Snapshot) HealthEvents() []health.Event {
+	events := make([]health.Event, 0, len(s.Events))
+	for _, e := range s.Events {
+		events = append(events, health.Event{
+			Time:          health.Time(e.Time),
+			Index:         e.Index,
+			Description:   e.Description,
+			Name:          e.Name,
+			Hostname:      e.Hostname,
+			Type:          e.Type,
+			Available:     e.Available,
+			IPv4Available: e.IPv4Available,
+			IPv6Available: e.IPv6Available,
+			Dampened:      e.Dampened,
+		})
+	}
+	return events
+}
+
+// prune removes all history older than the given time.
+func (s *Snapshot) prune(oldest time.Time) {
+	for cacheName, h := range s.StatHistory {
+		pruneStatVals(h.Stats, oldest)
+		for name, ifaceHistory := range h.Interfaces {
+			pruneStatVals(ifaceHistory, oldest)
+			if len(ifaceHistory) == 0 {
+				delete(h.Interfaces, name)
+			}
+		}
+		if len(h.Stats) == 0 && len(h.Interfaces) == 0 {
+			delete(s.StatHistory, cacheName)
+		}
+	}
+	pruneResultInfos(s.StatInfo, oldest)
+	pruneResultInfos(s.HealthHistory, oldest)
+
+	events := make([]Event, 0, len(s.Events))
+	for _, e := range s.Events {
+		if !e.Time.Before(oldest) {
+			events = append(events, e)
+		}
+	}
+	s.Events = events
+}
+
+func pruneStatVals(h map[string][]tc.ResultStatVal, oldest time.Time) {
+	for stat, vals := range h {
+		kept := make([]tc.ResultStatVal, 0, len(vals))
+		for _, val := range vals {
+			if !val.Time.Before(oldest) {
+				kept = append(kept, val)
+			}
+		}
+		if len(kept) == 0 {
+			delete(h, stat)
+		} else {
+			h[stat] = kept
+		}
+	}
+}
+
+func pruneResultInfos(h map[tc.CacheName][]ResultInfo, oldest time.Time) {
+	for cacheName, infos := range h {
+		kept := make([]ResultInfo, 0, len(infos))
+		for _, info := range infos {
+			if !info.Time.Before(oldest) {
+				kept = append(kept, info)
+			}
+		}
+		if len(kept) == 0 {
+			delete(h, cacheName)
+		} else {
+			h[cacheName] = kept
+		}
+	}
+}
+
+// Save writes the given snapshot to the given file. The file is replaced
+// atomically, so a crash while saving never leaves a partially written file.
+func Save(fileName string, s Snapshot) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return errors.New("creating temporary file: " + err.Error())
+	}
+	tmpName := tmpFile.Name()
+	if err := gob.NewEncoder(tmpFile).Encode(&s); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return errors.New("encoding snapshot: " + err.Error())
+	}
+	// sync before renaming, so a power loss never leaves the renamed file empty.
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return errors.New("syncing snapshot: " + err.Error())
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpName)
+		return errors.New("writing snapshot: " + err.Error())
+	}
+	if err := os.Rename(tmpName, fileName); err != nil {
+		os.Remove(tmpName)
+		return errors.New("replacing snapshot file: " + err.Error())
+	}
+	return nil
+}
+
+// Load reads the snapshot in the given file, discarding all history older than
+// the given retention. If the retention is 0, no history is discarded.
+func Load(fileName string, retention time.Duration) (Snapshot, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer f.Close()
+
+	s := Snapshot{}
+	if err := gob.NewDecoder(f).Decode(&s); err != nil {
+		return Snapshot{}, errors.New("decoding snapshot: " + err.Error())
+	}
+	if s.Version != SnapshotVersion {
+		return Snapshot{}, fmt.Errorf("snapshot version %d is not supported, expected %d", s.Version, SnapshotVersion)
+	}
+	if retention > 0 {
+		s.prune(time.Now().Add(-retention))
+	}
+	return s, nil
+}
@@ -0,0 +1,124 @@
+package persist
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tm-persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "history")
+
+	now := time.Now()
+	old := now.Add(-time.Hour)
+
+	statResultHistory := threadsafe.NewResultStatHistory()
+	result := cache.Result{
+		ID:         "cache0",
+		Time:       now,
+		Statistics: cache.Statistics{Interfaces: map[string]cache.Interface{"eth0": {Speed: 10000, BytesOut: 42}}},
+		Miscellaneous: map[string]interface{}{
+			"connections": float64(7),
+			"version":     "9.0.0",
+		},
+		Vitals: cache.Vitals{BytesOut: 42},
+	}
+	if err := statResultHistory.Add(result, 5); err != nil {
+		t.Fatal(err)
+	}
+	statResultHistory.LoadOrStore("cache0").Stats.Store("stale", []tc.ResultStatVal{{Val: uint64(1), Time: old, Span: 1}})
+
+	statInfoHistory := cache.ResultInfoHistory{}
+	statInfoHistory.Add(result, 5)
+
+	errResult := result
+	errResult.Error = errors.New("poll failed")
+	healthHistory := cache.ResultHistory{"cache0": {errResult}, "cache1": {{ID: "cache1", Time: old}}}
+
+	events := []health.Event{
+		{Time: health.Time(now), Index: 4, Hostname: "cache0", Description: "new"},
+		{Time: health.Time(old), Index: 3, Hostname: "cache1", Description: "old"},
+	}
+
+	if err := Save(fileName, NewSnapshot(statResultHistory, statInfoHistory, healthHistory, events)); err != nil {
+		t.Fatalf("expected no error saving snapshot, actual: %v", err)
+	}
+
+	s, err := Load(fileName, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("expected no error loading snapshot, actual: %v", err)
+	}
+
+	loadedStats := s.ResultStatHistory().LoadOrStore("cache0")
+	if vals := loadedStats.Stats.Load("connections"); len(vals) != 1 || vals[0].Val != float64(7) {
+		t.Errorf("expected connections stat 7, actual %+v", vals)
+	}
+	if vals := loadedStats.Stats.Load("stale"); vals != nil {
+		t.Errorf("expected stat older than retention to be discarded, actual %+v", vals)
+	}
+	if vals := loadedStats.Interfaces["eth0"].Load(threadsafe.InterfaceStatNameBytesOut); len(vals) != 1 || vals[0].Val != uint64(42) {
+		t.Errorf("expected eth0 outBytes uint64 42, actual %+v", vals)
+	}
+
+	if last, ok := s.LastStatResults()["cache0"]; !ok || last.Vitals.BytesOut != 42 || !last.Time.Equal(now) {
+		t.Errorf("expected last stat result for cache0 with 42 bytes out, actual %+v", last)
+	}
+
+	loadedHealth := s.ResultHistory()
+	if _, ok := loadedHealth["cache1"]; ok {
+		t.Errorf("expected health history older than retention to be discarded, actual %+v", loadedHealth["cache1"])
+	}
+	if h := loadedHealth["cache0"]; len(h) != 1 || h[0].Error == nil || h[0].Error.Error() != "poll failed" {
+		t.Errorf("expected cache0 health result with error 'poll failed', actual %+v", h)
+	}
+
+	loadedEvents := s.HealthEvents()
+	if len(loadedEvents) != 1 || loadedEvents[0].Index != 4 {
+		t.Errorf("expected only the newest event, actual %+v", loadedEvents)
+	}
+
+	threadsafeEvents := health.NewThreadsafeEvents(10)
+	threadsafeEvents.Restore(loadedEvents)
+	threadsafeEvents.Add(health.Event{Time: health.Time(time.Now())})
+	if got := threadsafeEvents.Get(); len(got) != 2 || got[0].Index != 5 {
+		t.Errorf("expected new event to be indexed after restored events, actual %+v", got)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	if _, err := Load(filepath.Join(os.TempDir(), "tm-persist-does-not-exist"), time.Minute); !os.IsNotExist(err) {
+		t.Errorf("expected not-exist error, actual: %v", err)
+	}
+}
@@ -24,10 +24,12 @@ import (
 	"io"
 	"math/rand"
 	"runtime"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/handler"
 )
@@ -47,6 +49,13 @@ type PollConfig struct {
 	Timeout  time.Duration
 	Format   string
 	PollType string
+	// Prometheus is the metric name mapping used to parse stats in the
+	// "prometheus" format.
+	Prometheus tc.TMPrometheusParameters
+	// MonitoredInterfaces is the comma-delimited names of the monitored
+	// network interfaces of the polled server. It's a string rather than a
+	// slice, so PollConfig is comparable.
+	MonitoredInterfaces string
 }
 
 type CachePollerConfig struct {
@@ -121,6 +130,10 @@ func (p CachePoller) Poll() {
 				Timeout:     info.Timeout,
 				NoKeepAlive: info.NoKeepAlive,
 				PollerID:    info.ID,
+				Prometheus:  info.Prometheus,
+			}
+			if info.MonitoredInterfaces != "" {
+				pollerCfg.Interfaces = strings.Split(info.MonitoredInterfaces, ",")
 			}
 			pollerCtx := interface{}(nil)
 			if pollerObj.Init != nil {
@@ -0,0 +1,311 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+
+	"golang.org/x/net/http2"
+)
+
+// PollerTypeGRPCHealth is the poller type which polls caches with the standard
+// gRPC Health Checking Protocol, grpc.health.v1.Health/Check.
+//
+// The health.polling.url is used for the scheme, host, and port of the gRPC
+// server; its path is ignored. The optional "service" query parameter sets the
+// name of the service to check; if it's absent, the health of the server as a
+// whole is checked. An "http" scheme uses HTTP/2 without TLS (h2c).
+//
+// A poll succeeds only if the server reports SERVING, in which case the body
+// returned is the status name, for parsing by the "grpc-health" stats format.
+const PollerTypeGRPCHealth = "grpc-health"
+
+// GRPCHealthCheckPath is the HTTP/2 path of the gRPC health check method.
+const GRPCHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// The grpc.health.v1.HealthCheckResponse.ServingStatus values.
+const (
+	GRPCHealthStatusUnknown        = 0
+	GRPCHealthStatusServing        = 1
+	GRPCHealthStatusNotServing     = 2
+	GRPCHealthStatusServiceUnknown = 3
+)
+
+// GRPCHealthStatusNames are the names of the grpc.health.v1.HealthCheckResponse.ServingStatus values.
+var GRPCHealthStatusNames = map[uint64]string{
+	GRPCHealthStatusUnknown:        "UNKNOWN",
+	GRPCHealthStatusServing:        "SERVING",
+	GRPCHealthStatusNotServing:     "NOT_SERVING",
+	GRPCHealthStatusServiceUnknown: "SERVICE_UNKNOWN",
+}
+
+func init() {
+	AddPollerType(PollerTypeGRPCHealth, grpcHealthGlobalInit, grpcHealthInit, grpcHealthPoll)
+}
+
+type GRPCHealthPollGlobalCtx struct {
+	UserAgent string
+	Timeout   time.Duration
+}
+
+type GRPCHealthPollCtx struct {
+	Client      *http.Client
+	UserAgent   string
+	NoKeepAlive bool
+	URL         string
+	URLv6       string
+	Host        string
+	PollerID    string
+	// Interfaces are the names of the server's monitored network interfaces.
+	// The health check doesn't report interface statistics, so these are
+	// reported as present, without traffic.
+	Interfaces []string
+}
+
+func grpcHealthGlobalInit(cfg config.Config, appData config.StaticAppData) interface{} {
+	return &GRPCHealthPollGlobalCtx{
+		UserAgent: appData.UserAgent,
+		Timeout:   cfg.HTTPTimeout,
+	}
+}
+
+func grpcHealthInit(cfg PollerConfig, globalCtxI interface{}) interface{} {
+	gctx := (globalCtxI).(*GRPCHealthPollGlobalCtx)
+
+	timeout := gctx.Timeout
+	if cfg.Timeout != 0 { // if the timeout isn't explicitly set, use the global value.
+		timeout = cfg.Timeout
+	}
+
+	// gRPC requires HTTP/2, and a client for plain-text HTTP/2 can't also speak
+	// TLS, so the appropriate transport is chosen per-request by scheme.
+	tlsTransport := &http2.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	h2cTransport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{Timeout: timeout}).Dial(network, addr)
+		},
+	}
+	transport := grpcHealthTransport{tls: tlsTransport, h2c: h2cTransport}
+
+	return &GRPCHealthPollCtx{
+		Client:      &http.Client{Transport: transport, Timeout: timeout},
+		UserAgent:   gctx.UserAgent,
+		NoKeepAlive: cfg.NoKeepAlive,
+		URL:         cfg.URL,
+		URLv6:       cfg.URLv6,
+		Host:        cfg.Host,
+		PollerID:    cfg.PollerID,
+		Interfaces:  cfg.Interfaces,
+	}
+}
+
+// grpcHealthTransport sends requests over HTTP/2, with TLS for "https" URLs and
+// without for "http" URLs.
+type grpcHealthTransport struct {
+	tls *http2.Transport
+	h2c *http2.Transport
+}
+
+func (t grpcHealthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.tls
+	if req.URL.Scheme == "http" {
+		transport = t.h2c
+	}
+	return transport.RoundTrip(req)
+}
+
+func grpcHealthPoll(ctxI interface{}, pollURL string, host string, pollID uint64) ([]byte, time.Time, time.Duration, error) {
+	ctx := (ctxI).(*GRPCHealthPollCtx)
+
+	reqURL, service, err := grpcHealthCheckURL(pollURL)
+	if err != nil {
+		return nil, time.Now(), 0, fmt.Errorf("id %v url %v: %v", ctx.PollerID, pollURL, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, reqURL, bytes.NewReader(grpcHealthCheckRequest(service)))
+	if err != nil {
+		return nil, time.Now(), 0, errors.New("creating gRPC health check request: " + err.Error())
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", ctx.UserAgent)
+	req.Host = host
+	req.Close = ctx.NoKeepAlive
+
+	startReq := time.Now()
+	status, err := grpcHealthDo(ctx.Client, req)
+	reqEnd := time.Now()
+	reqTime := reqEnd.Sub(startReq)
+	if err != nil {
+		return nil, reqEnd, reqTime, fmt.Errorf("id %v url %v fetch error: %v", ctx.PollerID, pollURL, err)
+	}
+	statusName, ok := GRPCHealthStatusNames[status]
+	if !ok {
+		statusName = strconv.FormatUint(status, 10)
+	}
+	if status != GRPCHealthStatusServing {
+		return nil, reqEnd, reqTime, fmt.Errorf("id %v url %v health check status: %v", ctx.PollerID, pollURL, statusName)
+	}
+	return []byte(statusName), reqEnd, reqTime, nil
+}
+
+// grpcHealthCheckURL returns the URL of the health check method for the given
+// polling URL, and the service to check.
+func grpcHealthCheckURL(pollURL string) (string, string, error) {
+	u, err := url.Parse(pollURL)
+	if err != nil {
+		return "", "", errors.New("parsing URL: " + err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", errors.New("unsupported scheme '" + u.Scheme + "', must be http or https")
+	}
+	service := u.Query().Get("service")
+	u.Path = GRPCHealthCheckPath
+	u.RawPath = ""
+	u.RawQuery = ""
+	return u.String(), service, nil
+}
+
+// grpcHealthCheckRequest returns the gRPC message frame containing a
+// grpc.health.v1.HealthCheckRequest for the given service.
+func grpcHealthCheckRequest(service string) []byte {
+	msg := []byte{}
+	if service != "" {
+		// field 1 (service), wire type 2 (length-delimited)
+		msg = append(msg, 0x0a)
+		msg = appendUvarint(msg, uint64(len(service)))
+		msg = append(msg, service...)
+	}
+	frame := make([]byte, 5, 5+len(msg))
+	frame[0] = 0 // not compressed
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, v)
+	return append(b, buf[:n]...)
+}
+
+// grpcHealthDo performs the given health check request, and returns the
+// serving status in the response.
+func grpcHealthDo(client *http.Client, req *http.Request) (uint64, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("bad HTTP status: %v", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, errors.New("reading body: " + err.Error())
+	}
+
+	// The gRPC status is in the trailers, or in the headers of a response with
+	// no body.
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	grpcMessage := resp.Trailer.Get("Grpc-Message")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+		grpcMessage = resp.Header.Get("Grpc-Message")
+	}
+	if grpcStatus == "" {
+		return 0, errors.New("response has no grpc-status")
+	}
+	if grpcStatus != "0" {
+		return 0, fmt.Errorf("gRPC status %v: %v", grpcStatus, grpcMessage)
+	}
+
+	return parseGRPCHealthCheckResponse(body)
+}
+
+// parseGRPCHealthCheckResponse parses the serving status from the gRPC message
+// frame containing a grpc.health.v1.HealthCheckResponse.
+func parseGRPCHealthCheckResponse(frame []byte) (uint64, error) {
+	if len(frame) < 5 {
+		return 0, errors.New("malformed gRPC message: too short")
+	}
+	if frame[0] != 0 {
+		return 0, errors.New("malformed gRPC message: compressed messages are not supported")
+	}
+	msgLen := binary.BigEndian.Uint32(frame[1:5])
+	if uint64(len(frame)-5) < uint64(msgLen) {
+		return 0, errors.New("malformed gRPC message: truncated")
+	}
+	msg := frame[5 : 5+msgLen]
+
+	status := uint64(GRPCHealthStatusUnknown)
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("malformed health check response: bad field key")
+		}
+		msg = msg[n:]
+		field, wireType := key>>3, key&0x7
+		switch wireType {
+		case 0: // varint
+			val, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("malformed health check response: bad varint")
+			}
+			msg = msg[n:]
+			if field == 1 {
+				status = val
+			}
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return 0, errors.New("malformed health check response: truncated field")
+			}
+			msg = msg[8:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return 0, errors.New("malformed health check response: truncated field")
+			}
+			msg = msg[uint64(n)+l:]
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return 0, errors.New("malformed health check response: truncated field")
+			}
+			msg = msg[4:]
+		default:
+			return 0, fmt.Errorf("malformed health check response: unsupported wire type %v", wireType)
+		}
+	}
+	return status, nil
+}
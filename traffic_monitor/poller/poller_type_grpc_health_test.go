@@ -0,0 +1,119 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+)
+
+// grpcHealthTestServer returns a TLS HTTP/2 server implementing the gRPC
+// health check, reporting the given status for every service except
+// "unknown", which fails with a gRPC NOT_FOUND error.
+func grpcHealthTestServer(t *testing.T, status uint64) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Method != http.MethodPost || r.URL.Path != GRPCHealthCheckPath || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("expected HTTP/2 gRPC POST to %s, actual %s %s %s %s", GRPCHealthCheckPath, r.Proto, r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if bytes.Equal(body, grpcHealthCheckRequest("unknown")) {
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "unknown service")
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte{0, 0, 0, 0, 2, 0x08, byte(status)})
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	return srv
+}
+
+func grpcHealthTestCtx() interface{} {
+	gctx := grpcHealthGlobalInit(config.Config{HTTPTimeout: time.Second}, config.StaticAppData{UserAgent: "test"})
+	return grpcHealthInit(PollerConfig{PollerID: "test", Timeout: 5 * time.Second}, gctx)
+}
+
+func TestGRPCHealthPoll(t *testing.T) {
+	srv := grpcHealthTestServer(t, GRPCHealthStatusServing)
+	defer srv.Close()
+	ctx := grpcHealthTestCtx()
+
+	bts, _, _, err := grpcHealthPoll(ctx, srv.URL+"/ignored/path", "example.net", 1)
+	if err != nil {
+		t.Fatalf("expected no error polling SERVING server, actual: %v", err)
+	}
+	if string(bts) != "SERVING" {
+		t.Errorf("expected body SERVING, actual %s", string(bts))
+	}
+
+	if _, _, _, err := grpcHealthPoll(ctx, srv.URL+"?service=unknown", "example.net", 2); err == nil || !strings.Contains(err.Error(), "unknown service") {
+		t.Errorf("expected unknown service error, actual: %v", err)
+	}
+}
+
+func TestGRPCHealthPollNotServing(t *testing.T) {
+	srv := grpcHealthTestServer(t, GRPCHealthStatusNotServing)
+	defer srv.Close()
+
+	_, _, _, err := grpcHealthPoll(grpcHealthTestCtx(), srv.URL, "example.net", 1)
+	if err == nil || !strings.Contains(err.Error(), "NOT_SERVING") {
+		t.Errorf("expected NOT_SERVING error, actual: %v", err)
+	}
+}
+
+func TestGRPCHealthCheckURL(t *testing.T) {
+	u, service, err := grpcHealthCheckURL("http://[2001:db8::1]:8081/path?service=grove")
+	if err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if expected := "http://[2001:db8::1]:8081" + GRPCHealthCheckPath; u != expected {
+		t.Errorf("expected URL %s, actual %s", expected, u)
+	}
+	if service != "grove" {
+		t.Errorf("expected service grove, actual %s", service)
+	}
+	if _, _, err := grpcHealthCheckURL("ftp://192.0.2.1/"); err == nil {
+		t.Error("expected error for unsupported scheme, actual nil")
+	}
+}
+
+func TestParseGRPCHealthCheckResponse(t *testing.T) {
+	// an unknown length-delimited field 2 followed by status NOT_SERVING
+	status, err := parseGRPCHealthCheckResponse([]byte{0, 0, 0, 0, 5, 0x12, 1, 'x', 0x08, 2})
+	if err != nil {
+		t.Fatalf("expected no error, actual: %v", err)
+	}
+	if status != GRPCHealthStatusNotServing {
+		t.Errorf("expected status %d, actual %d", GRPCHealthStatusNotServing, status)
+	}
+	if _, err := parseGRPCHealthCheckResponse([]byte{0, 0, 0, 0, 5, 0x08}); err == nil {
+		t.Error("expected error for truncated message, actual nil")
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 )
 
@@ -80,6 +81,7 @@ func httpInit(cfg PollerConfig, globalCtxI interface{}) interface{} {
 		Host:         cfg.Host,
 		PollerID:     cfg.PollerID,
 		FormatAccept: gctx.FormatAccept,
+		Prometheus:   cfg.Prometheus,
 	}
 }
 
@@ -99,6 +101,7 @@ type HTTPPollCtx struct {
 	PollerID     string
 	HTTPHeader   http.Header
 	FormatAccept string
+	Prometheus   tc.TMPrometheusParameters
 }
 
 func httpPoll(ctxI interface{}, url string, host string, pollID uint64) ([]byte, time.Time, time.Duration, error) {
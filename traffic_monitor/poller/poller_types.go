@@ -22,6 +22,7 @@ package poller
 import (
 	"time"
 
+	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 )
 
@@ -42,6 +43,9 @@ type PollerConfig struct {
 	Timeout     time.Duration
 	NoKeepAlive bool
 	PollerID    string
+	Prometheus  tc.TMPrometheusParameters
+	// Interfaces are the names of the monitored network interfaces of the polled server.
+	Interfaces []string
 }
 
 // PollerGlobalInit performs global initialization, and returns a global context object.
@@ -20,10 +20,12 @@ package tmclient
  */
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -34,6 +36,7 @@ import (
 	"github.com/apache/trafficcontrol/traffic_monitor/datareq"
 	"github.com/apache/trafficcontrol/traffic_monitor/dsdata"
 	"github.com/apache/trafficcontrol/traffic_monitor/handler"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
 	"github.com/apache/trafficcontrol/traffic_monitor/towrap"
 )
 
@@ -137,6 +140,71 @@ func (c *TMClient) CRStates(raw bool) (tc.CRStates, error) {
 	return obj, nil
 }
 
+// CRStatesStream subscribes to the Monitor's stream of combined CRStates
+// changes. The given func is called with the complete CRStates when the stream
+// starts, and again each time the Monitor reports a change.
+//
+// It returns when the stream ends, or when f returns false. Streams may be
+// ended by the Monitor at any time, notably if the client falls behind, so
+// callers wishing to stay subscribed should call CRStatesStream again.
+func (c *TMClient) CRStatesStream(f func(tc.CRStates) bool) error {
+	url := c.url + "/publish/CrStatesStream"
+	// The stream is long-lived, so only connecting and receiving headers are subject to the client timeout.
+	httpClient := http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: c.timeout}).DialContext,
+		TLSHandshakeTimeout:   c.timeout,
+		ResponseHeaderTimeout: c.timeout,
+	}}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return errors.New("getting from '" + url + "': " + err.Error())
+	}
+	defer log.Close(resp.Body, "Unable to close http client "+url)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Monitor '"+url+"' returned bad status %v", resp.StatusCode)
+	}
+
+	states := tc.NewCRStates()
+	event := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data := []byte(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			switch event {
+			case datareq.CRStatesStreamEventSnapshot:
+				states = tc.NewCRStates()
+				if err := json.Unmarshal(data, &states); err != nil {
+					return errors.New("unmarshalling snapshot from '" + url + "': " + err.Error())
+				}
+			case datareq.CRStatesStreamEventDelta:
+				delta := peer.CRStatesDelta{}
+				if err := json.Unmarshal(data, &delta); err != nil {
+					return errors.New("unmarshalling delta from '" + url + "': " + err.Error())
+				}
+				states = peer.ApplyCRStatesDelta(states, delta)
+			default:
+				continue
+			}
+			if !f(states) {
+				return nil
+			}
+		case line == "":
+			event = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.New("reading stream from '" + url + "': " + err.Error())
+	}
+	return nil
+}
+
 func (c *TMClient) CRConfig() (tc.CRConfig, error) {
 	path := "/publish/CrConfig"
 	obj := tc.CRConfig{}